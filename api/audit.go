@@ -0,0 +1,177 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Tecsisa/foulkon/database"
+	"github.com/satori/go.uuid"
+)
+
+// TYPE DEFINITIONS
+
+// AuditEvent records a change done by a user over a resource
+type AuditEvent struct {
+	ID        string    `json:"id"`
+	Actor     string    `json:"actor"`
+	RequestID string    `json:"requestId"`
+	Action    string    `json:"action"`
+	Urn       string    `json:"urn"`
+	CreateAt  time.Time `json:"createAt"`
+	// Resource state before and after the change, empty if resource didn't exist
+	Before *json.RawMessage `json:"before,omitempty"`
+	After  *json.RawMessage `json:"after,omitempty"`
+}
+
+// AuditFilter contains the optional parameters to retrieve audit events. Zero dates aren't used.
+type AuditFilter struct {
+	Actor  string
+	Urn    string
+	Action string
+	From   time.Time
+	To     time.Time
+	// Pagination
+	Offset int
+	Limit  int
+}
+
+// State of a relation between a group and a user or a policy
+type auditRelation struct {
+	Group  string `json:"group"`
+	User   string `json:"user,omitempty"`
+	Policy string `json:"policy,omitempty"`
+}
+
+// AUDIT API IMPLEMENTATION
+
+// ListAuditEvents returns the audit events filtered, most recent first. Only admin users are allowed to do it.
+func (api AuthAPI) ListAuditEvents(requestInfo RequestInfo, filter *AuditFilter) ([]AuditEvent, int, error) {
+	if !requestInfo.Admin {
+		return nil, 0, &Error{
+			Code:    UNAUTHORIZED_RESOURCES_ERROR,
+			Message: fmt.Sprintf("User with externalId %v is not allowed to access to audit events", requestInfo.Identifier),
+		}
+	}
+
+	// Validate fields
+	if len(filter.Action) > 0 {
+		if err := AreValidActions([]string{filter.Action}); err != nil {
+			return nil, 0, &Error{
+				Code:    INVALID_PARAMETER_ERROR,
+				Message: fmt.Sprintf("Invalid parameter: action %v", filter.Action),
+			}
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && filter.From.After(filter.To) {
+		return nil, 0, &Error{
+			Code:    INVALID_PARAMETER_ERROR,
+			Message: fmt.Sprintf("Invalid parameter: from %v is after to %v", filter.From.Format(time.RFC3339), filter.To.Format(time.RFC3339)),
+		}
+	}
+	if filter.Limit == 0 {
+		filter.Limit = DEFAULT_LIMIT_SIZE
+	} else if filter.Limit > MAX_LIMIT_SIZE {
+		return nil, 0, &Error{
+			Code:    INVALID_PARAMETER_ERROR,
+			Message: fmt.Sprintf("Invalid parameter: limit %v, max limit allowed: %v", filter.Limit, MAX_LIMIT_SIZE),
+		}
+	}
+
+	if api.AuditRepo == nil {
+		return []AuditEvent{}, 0, nil
+	}
+	events, total, err := api.AuditRepo.GetAuditEventsFiltered(filter)
+
+	// Error handling
+	if err != nil {
+		//Transform to DB error
+		dbError := err.(*database.Error)
+		return nil, 0, &Error{
+			Code:    UNKNOWN_API_ERROR,
+			Message: dbError.Message,
+		}
+	}
+
+	return events, total, nil
+}
+
+// PRIVATE HELPER METHODS
+
+// Make changes with an API whose repositories are in a transaction, so changes are stored together
+// with their audit events and their events. Database errors are transformed into API errors.
+func (api AuthAPI) transaction(change func(tx AuthAPI) error) error {
+	err := api.TxRepo.Transaction(func(repos Repos) error {
+		tx := api
+		tx.UserRepo = repos.UserRepo
+		tx.GroupRepo = repos.GroupRepo
+		tx.PolicyRepo = repos.PolicyRepo
+		tx.ServiceAccountRepo = repos.ServiceAccountRepo
+		// Audit and events are optional, so they are only used if they are enabled
+		if api.AuditRepo != nil {
+			tx.AuditRepo = repos.AuditRepo
+		}
+		if api.EventRepo != nil {
+			tx.EventRepo = repos.EventRepo
+		}
+		return change(tx)
+	})
+
+	// Error handling
+	if dbError, ok := err.(*database.Error); ok {
+		return &Error{
+			Code:    UNKNOWN_API_ERROR,
+			Message: dbError.Message,
+		}
+	}
+	return err
+}
+
+// Store an audit event for a change with the resource state before and after it. It must be called
+// in the transaction of the change, so the change isn't stored without its audit event.
+func (api AuthAPI) recordAuditEvent(requestInfo RequestInfo, action string, urn string, before interface{}, after interface{}) error {
+	if api.AuditRepo == nil {
+		return nil
+	}
+	event := AuditEvent{
+		ID:        uuid.NewV4().String(),
+		Actor:     requestInfo.Identifier,
+		RequestID: requestInfo.RequestID,
+		Action:    action,
+		Urn:       urn,
+		CreateAt:  time.Now().UTC(),
+	}
+	var err error
+	if event.Before, err = getAuditState(before); err == nil {
+		event.After, err = getAuditState(after)
+	}
+	if err != nil {
+		return &Error{
+			Code:    UNKNOWN_API_ERROR,
+			Message: fmt.Sprintf("Error storing audit event for action %v over resource %v: %v", action, urn, err),
+		}
+	}
+
+	if err := api.AuditRepo.AddAuditEvent(event); err != nil {
+		//Transform to DB error
+		dbError := err.(*database.Error)
+		return &Error{
+			Code:    UNKNOWN_API_ERROR,
+			Message: fmt.Sprintf("Error storing audit event for action %v over resource %v: %v", action, urn, dbError.Message),
+		}
+	}
+	return nil
+}
+
+// Transform a resource into its JSON state, nil if resource is nil
+func getAuditState(resource interface{}) (*json.RawMessage, error) {
+	if resource == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(resource)
+	if err != nil {
+		return nil, err
+	}
+	state := json.RawMessage(b)
+	return &state, nil
+}
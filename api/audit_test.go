@@ -0,0 +1,216 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Tecsisa/foulkon/database"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestAuthAPI_ListAuditEvents(t *testing.T) {
+	now := time.Date(2016, time.October, 1, 10, 0, 0, 0, time.UTC)
+	events := []AuditEvent{
+		{
+			ID:        "AuditEventID",
+			Actor:     "admin",
+			RequestID: "RequestID",
+			Action:    USER_ACTION_CREATE_USER,
+			Urn:       CreateUrn("", RESOURCE_USER, "/path/", "user1"),
+			CreateAt:  now,
+		},
+	}
+	testcases := map[string]struct {
+		// API method args
+		requestInfo RequestInfo
+		filter      *AuditFilter
+		// Expected result
+		expectedEvents []AuditEvent
+		expectedTotal  int
+		expectedFilter *AuditFilter
+		wantError      error
+		// Manager Results
+		getAuditEventsFilteredResult []AuditEvent
+		// API Errors
+		getAuditEventsFilteredErr error
+	}{
+		"OkCase": {
+			requestInfo: RequestInfo{
+				Identifier: "admin",
+				Admin:      true,
+			},
+			filter: &AuditFilter{
+				Actor:  "admin",
+				Action: USER_ACTION_CREATE_USER,
+				From:   now.Add(-time.Hour),
+				To:     now,
+			},
+			expectedEvents: events,
+			expectedTotal:  1,
+			expectedFilter: &AuditFilter{
+				Actor:  "admin",
+				Action: USER_ACTION_CREATE_USER,
+				From:   now.Add(-time.Hour),
+				To:     now,
+				Limit:  DEFAULT_LIMIT_SIZE,
+			},
+			getAuditEventsFilteredResult: events,
+		},
+		"ErrorCaseNotAdmin": {
+			requestInfo: RequestInfo{
+				Identifier: "user1",
+			},
+			filter: &AuditFilter{},
+			wantError: &Error{
+				Code:    UNAUTHORIZED_RESOURCES_ERROR,
+				Message: "User with externalId user1 is not allowed to access to audit events",
+			},
+		},
+		"ErrorCaseInvalidAction": {
+			requestInfo: RequestInfo{
+				Identifier: "admin",
+				Admin:      true,
+			},
+			filter: &AuditFilter{
+				Action: "iam:*%",
+			},
+			wantError: &Error{
+				Code:    INVALID_PARAMETER_ERROR,
+				Message: "Invalid parameter: action iam:*%",
+			},
+		},
+		"ErrorCaseInvalidDateRange": {
+			requestInfo: RequestInfo{
+				Identifier: "admin",
+				Admin:      true,
+			},
+			filter: &AuditFilter{
+				From: now,
+				To:   now.Add(-time.Hour),
+			},
+			wantError: &Error{
+				Code:    INVALID_PARAMETER_ERROR,
+				Message: "Invalid parameter: from 2016-10-01T10:00:00Z is after to 2016-10-01T09:00:00Z",
+			},
+		},
+		"ErrorCaseMaxLimitExceeded": {
+			requestInfo: RequestInfo{
+				Identifier: "admin",
+				Admin:      true,
+			},
+			filter: &AuditFilter{
+				Limit: 10000,
+			},
+			wantError: &Error{
+				Code:    INVALID_PARAMETER_ERROR,
+				Message: "Invalid parameter: limit 10000, max limit allowed: 1000",
+			},
+		},
+		"ErrorCaseInternalError": {
+			requestInfo: RequestInfo{
+				Identifier: "admin",
+				Admin:      true,
+			},
+			filter: &AuditFilter{},
+			wantError: &Error{
+				Code:    UNKNOWN_API_ERROR,
+				Message: "Error",
+			},
+			getAuditEventsFilteredErr: &database.Error{
+				Code:    database.INTERNAL_ERROR,
+				Message: "Error",
+			},
+		},
+	}
+
+	for n, test := range testcases {
+		testRepo := makeTestRepo()
+		testAPI := makeTestAPI(testRepo)
+		testRepo.ArgsOut[GetAuditEventsFilteredMethod][0] = test.getAuditEventsFilteredResult
+		testRepo.ArgsOut[GetAuditEventsFilteredMethod][1] = len(test.getAuditEventsFilteredResult)
+		testRepo.ArgsOut[GetAuditEventsFilteredMethod][2] = test.getAuditEventsFilteredErr
+
+		events, total, err := testAPI.ListAuditEvents(test.requestInfo, test.filter)
+		checkMethodResponse(t, n, test.wantError, err, test.expectedEvents, events)
+		if test.wantError != nil {
+			continue
+		}
+		if total != test.expectedTotal {
+			t.Errorf("Test %v failed. Received total %v, wanted %v", n, total, test.expectedTotal)
+		}
+		if diff := pretty.Compare(testRepo.ArgsIn[GetAuditEventsFilteredMethod][0], test.expectedFilter); diff != "" {
+			t.Errorf("Test %v failed. Received different filter (received/wanted) %v", n, diff)
+		}
+	}
+}
+
+func TestAuthAPI_ListAuditEventsWithoutRepo(t *testing.T) {
+	testAPI := makeTestAPI(makeTestRepo())
+	testAPI.AuditRepo = nil
+	events, total, err := testAPI.ListAuditEvents(RequestInfo{Identifier: "admin", Admin: true}, &AuditFilter{})
+	checkMethodResponse(t, "WithoutRepo", nil, err, []AuditEvent{}, events)
+	if total != 0 {
+		t.Errorf("Test failed. Received total %v, wanted 0", total)
+	}
+}
+
+func TestAuthAPI_recordAuditEvent(t *testing.T) {
+	testRepo := makeTestRepo()
+	testAPI := makeTestAPI(testRepo)
+	testRepo.ArgsOut[GetGroupByNameMethod][0] = &Group{
+		ID:   "GroupID",
+		Name: "group1",
+		Org:  "org1",
+		Urn:  CreateUrn("org1", RESOURCE_GROUP, "/", "group1"),
+	}
+	testRepo.ArgsOut[GetUserByExternalIDMethod][0] = &User{
+		ID:         "UserID",
+		ExternalID: "user1",
+		Urn:        CreateUrn("", RESOURCE_USER, "/", "user1"),
+	}
+	requestInfo := RequestInfo{
+		Identifier: "admin",
+		Admin:      true,
+		RequestID:  "RequestID",
+	}
+
+	if err := testAPI.AddMember(requestInfo, "user1", "group1", "org1"); err != nil {
+		t.Fatalf("Test failed. Unexpected error adding member: %v", err)
+	}
+	event := testRepo.ArgsIn[AddAuditEventMethod][0].(AuditEvent)
+	if event.ID == "" || event.CreateAt.IsZero() {
+		t.Errorf("Test failed. Expected id and creation date in event %+v", event)
+	}
+	after := json.RawMessage(`{"group":"urn:iws:iam:org1:group/group1","user":"urn:iws:iam::user/user1"}`)
+	expectedEvent := AuditEvent{
+		ID:        event.ID,
+		Actor:     "admin",
+		RequestID: "RequestID",
+		Action:    GROUP_ACTION_ADD_MEMBER,
+		Urn:       CreateUrn("org1", RESOURCE_GROUP, "/", "group1"),
+		CreateAt:  event.CreateAt,
+		After:     &after,
+	}
+	if diff := pretty.Compare(event, expectedEvent); diff != "" {
+		t.Errorf("Test failed. Received different event (received/wanted) %v", diff)
+	}
+
+	// Errors storing events are returned by the transaction of the change, so it is rolled back
+	testRepo.ArgsOut[AddAuditEventMethod][0] = &database.Error{
+		Code:    database.INTERNAL_ERROR,
+		Message: "Error",
+	}
+	testRepo.ArgsOut[IsMemberOfGroupMethod][0] = true
+	err := testAPI.RemoveMember(requestInfo, "user1", "group1", "org1")
+	expectedError := &Error{
+		Code:    UNKNOWN_API_ERROR,
+		Message: "Error storing audit event for action iam:RemoveMember over resource urn:iws:iam:org1:group/group1: Error",
+	}
+	if diff := pretty.Compare(err, expectedError); diff != "" {
+		t.Errorf("Test failed. Received different errors (received/wanted) %v", diff)
+	}
+	if testRepo.ArgsIn[RemoveMemberMethod][0] != "UserID" {
+		t.Errorf("Test failed. Member wasn't removed")
+	}
+}
@@ -14,6 +14,8 @@ type RequestInfo struct {
 	Identifier string
 	Admin      bool
 	RequestID  string
+	// Request attributes used to evaluate statement conditions
+	Context map[string]string
 }
 
 type EffectRestriction struct {
@@ -92,6 +94,35 @@ func (api AuthAPI) GetAuthorizedPolicies(requestInfo RequestInfo, resourceUrn st
 // GetAuthorizedExternalResources returns the resources where the specified user has the action granted
 func (api AuthAPI) GetAuthorizedExternalResources(requestInfo RequestInfo, action string, resources []string) ([]string, error) {
 	// Validate parameters
+	externalResources, err := validateExternalResources(action, resources)
+	if err != nil {
+		return nil, err
+	}
+
+	allowedUrns, err := api.getAuthorizedResources(requestInfo, "urn:*", action, externalResources)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(allowedUrns) < 1 {
+		return nil, &Error{
+			Code:    UNAUTHORIZED_RESOURCES_ERROR,
+			Message: fmt.Sprintf("User with externalId %v is not allowed to access to any resource", requestInfo.Identifier),
+		}
+	}
+
+	response := []string{}
+	for _, res := range allowedUrns {
+		response = append(response, res.GetUrn())
+	}
+
+	return response, nil
+}
+
+// PRIVATE HELPER METHODS
+
+// validateExternalResources checks the action and the full URNs requested, and transforms them into resources
+func validateExternalResources(action string, resources []string) ([]Resource, error) {
 	if err := AreValidActions([]string{action}); err != nil {
 		// Transform to API error
 		apiError := err.(*Error)
@@ -130,29 +161,9 @@ func (api AuthAPI) GetAuthorizedExternalResources(requestInfo RequestInfo, actio
 			Message: fmt.Sprintf("Invalid parameter action %v. Action parameter can't be a prefix", action),
 		}
 	}
-
-	allowedUrns, err := api.getAuthorizedResources(requestInfo, "urn:*", action, externalResources)
-	if err != nil {
-		return nil, err
-	}
-
-	if len(allowedUrns) < 1 {
-		return nil, &Error{
-			Code:    UNAUTHORIZED_RESOURCES_ERROR,
-			Message: fmt.Sprintf("User with externalId %v is not allowed to access to any resource", requestInfo.Identifier),
-		}
-	}
-
-	response := []string{}
-	for _, res := range allowedUrns {
-		response = append(response, res.GetUrn())
-	}
-
-	return response, nil
+	return externalResources, nil
 }
 
-// PRIVATE HELPER METHODS
-
 // getAuthorizedResources retrieves filtered resources where the authenticated user has permissions
 func (api AuthAPI) getAuthorizedResources(requestInfo RequestInfo, resourceUrn string, action string, resources []Resource) ([]Resource, error) {
 	// If user is an admin return all resources without restriction
@@ -161,7 +172,7 @@ func (api AuthAPI) getAuthorizedResources(requestInfo RequestInfo, resourceUrn s
 	}
 
 	// Check authorization for this user
-	restrictions, err := api.getRestrictions(requestInfo.Identifier, action, resourceUrn)
+	restrictions, err := api.getRestrictions(requestInfo.Identifier, action, resourceUrn, requestInfo.Context)
 	if err != nil {
 		return nil, err
 	}
@@ -183,7 +194,31 @@ func (api AuthAPI) getAuthorizedResources(requestInfo RequestInfo, resourceUrn s
 }
 
 // Get restrictions for this action and full resource or prefix resource, attached to this authenticated user
-func (api AuthAPI) getRestrictions(externalID string, action string, resource string) (*Restrictions, error) {
+func (api AuthAPI) getRestrictions(externalID string, action string, resource string, context map[string]string) (*Restrictions, error) {
+	// Retrieve valid statements
+	statements, err := api.getStatementsByUser(externalID, action)
+	if err != nil {
+		return nil, err
+	}
+
+	// Discard statements whose conditions don't match the request context
+	statements = filterStatementsByConditions(statements, context)
+
+	// Retrieve restrictions
+	var authResources *Restrictions
+	authResources = getRestrictions(statements, resource, isFullUrn(resource))
+
+	return authResources, nil
+}
+
+// Retrieve statements that apply to a user for an action. Cache stores all statements of the user
+// to be reused with any action, so they are filtered here. Otherwise database filters them.
+func (api AuthAPI) getStatementsByUser(externalID string, action string) ([]Statement, error) {
+	if statements, ok := api.Cache.Get(externalID); ok {
+		return getStatementsByAction(statements, action), nil
+	}
+	version := api.Cache.Version()
+
 	// Get user if exists
 	user, err := api.UserRepo.GetUserByExternalID(externalID)
 
@@ -205,24 +240,25 @@ func (api AuthAPI) getRestrictions(externalID string, action string, resource st
 		}
 	}
 
-	groups, err := api.getGroupsByUser(user.ID)
-	if err != nil {
-		return nil, err
+	repoAction := action
+	if api.Cache != nil {
+		repoAction = ""
 	}
-
-	policies, err := api.getPoliciesByGroups(groups)
+	statements, err := api.PolicyRepo.GetEffectiveStatementsByUser(user.ID, repoAction)
 	if err != nil {
-		return nil, err
+		//Transform to DB error
+		dbError := err.(*database.Error)
+		return nil, &Error{
+			Code:    UNKNOWN_API_ERROR,
+			Message: dbError.Message,
+		}
 	}
 
-	// Retrieve valid statements
-	statements := getStatementsByRequestedAction(policies, action)
-
-	// Retrieve restrictions
-	var authResources *Restrictions
-	authResources = getRestrictions(statements, resource, isFullUrn(resource))
-
-	return authResources, nil
+	if api.Cache == nil {
+		return statements, nil
+	}
+	api.Cache.Set(externalID, statements, version)
+	return getStatementsByAction(statements, action), nil
 }
 
 func (api AuthAPI) getGroupsByUser(userID string) ([]Group, error) {
@@ -285,7 +321,7 @@ func getStatementsByRequestedAction(policies []Policy, requestedAction string) [
 	statements := []Statement{}
 	for _, policy := range policies {
 		for _, statement := range *policy.Statements {
-			if isActionContained(requestedAction, statement.Actions) {
+			if IsActionContained(requestedAction, statement.Actions) {
 				statements = append(statements, statement)
 			}
 		}
@@ -294,8 +330,24 @@ func getStatementsByRequestedAction(policies []Policy, requestedAction string) [
 	return statements
 }
 
-// Returns true if an action is contained inside a slice of statements
-func isActionContained(actionRequested string, statementActions []string) bool {
+// Filter a slice of statements for a specified action, all of them are returned if action is empty
+func getStatementsByAction(statements []Statement, requestedAction string) []Statement {
+	if requestedAction == "" {
+		return statements
+	}
+	filtered := []Statement{}
+	for _, statement := range statements {
+		if IsActionContained(requestedAction, statement.Actions) {
+			filtered = append(filtered, statement)
+		}
+	}
+
+	return filtered
+}
+
+// IsActionContained returns true if the action requested is equal to one of the statement actions,
+// or starts with one of the prefixes ended with *
+func IsActionContained(actionRequested string, statementActions []string) bool {
 	match := false
 	for _, statementAction := range statementActions {
 		// Prefixes
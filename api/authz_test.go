@@ -877,6 +877,8 @@ func TestGetRestrictions(t *testing.T) {
 		resourceUrn string
 		// Action to do
 		action string
+		// Request context
+		context map[string]string
 		// Expected Restrictions
 		expectedRestrictions *Restrictions
 		// Error to compare when we expect an error
@@ -1095,6 +1097,103 @@ func TestGetRestrictions(t *testing.T) {
 					},
 				},
 			}},
+		"OktestCaseConditionsMatched": {
+			authUserID:  "AuthUserID",
+			resourceUrn: CreateUrn("example", RESOURCE_GROUP, "/path1/", "group"),
+			action:      GROUP_ACTION_GET_GROUP,
+			context: map[string]string{
+				CONTEXT_KEY_SOURCE_IP: "10.0.1.5",
+			},
+			expectedRestrictions: &Restrictions{
+				AllowedUrnPrefixes: []string{
+					GetUrnPrefix("example", RESOURCE_GROUP, "/path1/"),
+				},
+				DeniedFullUrns:    []string{},
+				DeniedUrnPrefixes: []string{},
+			},
+			getUserByExternalIDResult: &User{
+				ID: "AuthUserID",
+			},
+			getGroupsByUserIDResult: []TestUserGroupRelation{
+				{
+					Group: &Group{
+						ID: "GROUP-USER-ID",
+					},
+				},
+			},
+			getAttachedPoliciesResult: []TestPolicyGroupRelation{
+				{
+					Policy: &Policy{
+						ID:  "POLICY-USER-ID",
+						Urn: CreateUrn("example", RESOURCE_POLICY, "/path/", "policyUser"),
+						Statements: &[]Statement{
+							{
+								Effect: "allow",
+								Actions: []string{
+									GROUP_ACTION_GET_GROUP,
+								},
+								Resources: []string{
+									GetUrnPrefix("example", RESOURCE_GROUP, "/path1/"),
+								},
+								Conditions: Conditions{
+									CONDITION_IP_ADDRESS: {
+										CONTEXT_KEY_SOURCE_IP: []string{"10.0.0.0/16"},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		"OktestCaseConditionsNotMatched": {
+			authUserID:  "AuthUserID",
+			resourceUrn: CreateUrn("example", RESOURCE_GROUP, "/path1/", "group"),
+			action:      GROUP_ACTION_GET_GROUP,
+			context: map[string]string{
+				CONTEXT_KEY_SOURCE_IP: "192.168.1.5",
+			},
+			expectedRestrictions: &Restrictions{
+				AllowedUrnPrefixes: []string{},
+				AllowedFullUrns:    []string{},
+				DeniedFullUrns:     []string{},
+				DeniedUrnPrefixes:  []string{},
+			},
+			getUserByExternalIDResult: &User{
+				ID: "AuthUserID",
+			},
+			getGroupsByUserIDResult: []TestUserGroupRelation{
+				{
+					Group: &Group{
+						ID: "GROUP-USER-ID",
+					},
+				},
+			},
+			getAttachedPoliciesResult: []TestPolicyGroupRelation{
+				{
+					Policy: &Policy{
+						ID:  "POLICY-USER-ID",
+						Urn: CreateUrn("example", RESOURCE_POLICY, "/path/", "policyUser"),
+						Statements: &[]Statement{
+							{
+								Effect: "allow",
+								Actions: []string{
+									GROUP_ACTION_GET_GROUP,
+								},
+								Resources: []string{
+									GetUrnPrefix("example", RESOURCE_GROUP, "/path1/"),
+								},
+								Conditions: Conditions{
+									CONDITION_IP_ADDRESS: {
+										CONTEXT_KEY_SOURCE_IP: []string{"10.0.0.0/16"},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
 	}
 
 	for n, test := range testcases {
@@ -1111,7 +1210,7 @@ func TestGetRestrictions(t *testing.T) {
 		testRepo.ArgsOut[GetAttachedPoliciesMethod][0] = test.getAttachedPoliciesResult
 		testRepo.ArgsOut[GetAttachedPoliciesMethod][2] = test.getAttachedPoliciesError
 
-		restrictions, err := testAPI.getRestrictions(test.authUserID, test.action, test.resourceUrn)
+		restrictions, err := testAPI.getRestrictions(test.authUserID, test.action, test.resourceUrn, test.context)
 		checkMethodResponse(t, n, test.wantError, err, test.expectedRestrictions, restrictions)
 		if test.wantError == nil && testRepo.ArgsIn[GetUserByExternalIDMethod][0] != test.authUserID {
 			t.Errorf("Test %v failed. Received different user identifiers (wanted:%v / received:%v)",
@@ -1444,7 +1543,7 @@ func TestIsActionContained(t *testing.T) {
 	}
 
 	for n, test := range testcases {
-		isContained := isActionContained(test.actionRequested, test.statementActions)
+		isContained := IsActionContained(test.actionRequested, test.statementActions)
 		checkMethodResponse(t, n, nil, nil, test.expectedResponse, isContained)
 	}
 }
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"fmt"
+)
+
+// TYPE DEFINITIONS
+
+const (
+	// Constraints
+	MAX_AUTHORIZATION_CHECKS = 20
+)
+
+// Action to authorize over a list of resources
+type AuthorizationCheck struct {
+	Action    string   `json:"action"`
+	Resources []string `json:"resources"`
+}
+
+// Authorization for an action and resource pair
+type AuthorizationResult struct {
+	Action  string `json:"action"`
+	Urn     string `json:"urn"`
+	Allowed bool   `json:"allowed"`
+}
+
+// AUTHZ API IMPLEMENTATION
+
+// GetAuthorizedExternalResourcesBatch returns if the specified user has each action granted over its resources.
+// Policies of the user are retrieved once for all checks.
+func (api AuthAPI) GetAuthorizedExternalResourcesBatch(requestInfo RequestInfo, checks []AuthorizationCheck) ([]AuthorizationResult, error) {
+	// Validate parameters
+	if len(checks) < 1 || len(checks) > MAX_AUTHORIZATION_CHECKS {
+		return nil, &Error{
+			Code:    INVALID_PARAMETER_ERROR,
+			Message: fmt.Sprintf("Invalid parameter Checks. Checks can't be empty or bigger than %v elements", MAX_AUTHORIZATION_CHECKS),
+		}
+	}
+	for _, check := range checks {
+		if _, err := validateExternalResources(check.Action, check.Resources); err != nil {
+			return nil, err
+		}
+	}
+
+	// Admin users have all actions granted
+	var statements []Statement
+	if !requestInfo.Admin {
+		userStatements, err := api.getStatementsByUser(requestInfo.Identifier, "")
+		if err != nil {
+			return nil, err
+		}
+		statements = filterStatementsByConditions(userStatements, requestInfo.Context)
+	}
+
+	results := []AuthorizationResult{}
+	for _, check := range checks {
+		restrictions := getRestrictions(getStatementsByAction(statements, check.Action), "urn:*", false)
+		for _, urn := range check.Resources {
+			results = append(results, AuthorizationResult{
+				Action:  check.Action,
+				Urn:     urn,
+				Allowed: requestInfo.Admin || isAllowedResource(ExternalResource{Urn: urn}, *restrictions),
+			})
+		}
+	}
+
+	return results, nil
+}
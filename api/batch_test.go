@@ -0,0 +1,231 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/Tecsisa/foulkon/database"
+)
+
+func TestGetAuthorizedExternalResourcesBatch(t *testing.T) {
+	allowStatement := Statement{
+		Effect:    "allow",
+		Actions:   []string{"product:*"},
+		Resources: []string{"urn:ews:product:instance:resource/*"},
+	}
+	denyStatement := Statement{
+		Effect:    "deny",
+		Actions:   []string{"product:Write"},
+		Resources: []string{"urn:ews:product:instance:resource/secret/*"},
+	}
+	tenantStatement := Statement{
+		Effect:    "allow",
+		Actions:   []string{"product:Delete"},
+		Resources: []string{"urn:ews:product:instance:tenant/*"},
+		Conditions: Conditions{
+			CONDITION_STRING_EQUALS: {
+				"proxy:Tenant": []string{"tenant1"},
+			},
+		},
+	}
+	checks := []AuthorizationCheck{
+		{
+			Action: "product:Read",
+			Resources: []string{
+				"urn:ews:product:instance:resource/res1",
+				"urn:ews:product:instance:resource/secret/res2",
+			},
+		},
+		{
+			Action: "product:Write",
+			Resources: []string{
+				"urn:ews:product:instance:resource/res1",
+				"urn:ews:product:instance:resource/secret/res2",
+			},
+		},
+		{
+			Action:    "product:Delete",
+			Resources: []string{"urn:ews:product:instance:tenant/res3"},
+		},
+	}
+	tooManyChecks := []AuthorizationCheck{}
+	for i := 0; i <= MAX_AUTHORIZATION_CHECKS; i++ {
+		tooManyChecks = append(tooManyChecks, checks[0])
+	}
+	testcases := map[string]struct {
+		// API method args
+		requestInfo RequestInfo
+		checks      []AuthorizationCheck
+		// Expected result
+		expectedResponse []AuthorizationResult
+		wantError        error
+		// Manager Results
+		getUserByExternalIDResult          *User
+		getEffectiveStatementsByUserResult []Statement
+		// Manager Errors
+		getUserByExternalIDError          error
+		getEffectiveStatementsByUserError error
+	}{
+		"OkCase": {
+			requestInfo: RequestInfo{
+				Identifier: "user1",
+				Context: map[string]string{
+					"proxy:Tenant": "tenant1",
+				},
+			},
+			checks: checks,
+			expectedResponse: []AuthorizationResult{
+				{
+					Action:  "product:Read",
+					Urn:     "urn:ews:product:instance:resource/res1",
+					Allowed: true,
+				},
+				{
+					Action:  "product:Read",
+					Urn:     "urn:ews:product:instance:resource/secret/res2",
+					Allowed: true,
+				},
+				{
+					Action:  "product:Write",
+					Urn:     "urn:ews:product:instance:resource/res1",
+					Allowed: true,
+				},
+				{
+					Action: "product:Write",
+					Urn:    "urn:ews:product:instance:resource/secret/res2",
+				},
+				{
+					Action:  "product:Delete",
+					Urn:     "urn:ews:product:instance:tenant/res3",
+					Allowed: true,
+				},
+			},
+			getUserByExternalIDResult: &User{
+				ID:         "UserID",
+				ExternalID: "user1",
+			},
+			getEffectiveStatementsByUserResult: []Statement{allowStatement, denyStatement, tenantStatement},
+		},
+		"OkCaseConditionsNotMatched": {
+			requestInfo: RequestInfo{
+				Identifier: "user1",
+			},
+			checks: checks[2:],
+			expectedResponse: []AuthorizationResult{
+				{
+					Action: "product:Delete",
+					Urn:    "urn:ews:product:instance:tenant/res3",
+				},
+			},
+			getUserByExternalIDResult: &User{
+				ID:         "UserID",
+				ExternalID: "user1",
+			},
+			getEffectiveStatementsByUserResult: []Statement{allowStatement, denyStatement, tenantStatement},
+		},
+		"OkCaseAdmin": {
+			requestInfo: RequestInfo{
+				Identifier: "admin",
+				Admin:      true,
+			},
+			checks: checks[1:2],
+			expectedResponse: []AuthorizationResult{
+				{
+					Action:  "product:Write",
+					Urn:     "urn:ews:product:instance:resource/res1",
+					Allowed: true,
+				},
+				{
+					Action:  "product:Write",
+					Urn:     "urn:ews:product:instance:resource/secret/res2",
+					Allowed: true,
+				},
+			},
+			getUserByExternalIDError: &database.Error{
+				Code:    database.INTERNAL_ERROR,
+				Message: "Error",
+			},
+		},
+		"ErrorCaseEmptyChecks": {
+			requestInfo: RequestInfo{
+				Identifier: "user1",
+			},
+			wantError: &Error{
+				Code:    INVALID_PARAMETER_ERROR,
+				Message: "Invalid parameter Checks. Checks can't be empty or bigger than 20 elements",
+			},
+		},
+		"ErrorCaseTooManyChecks": {
+			requestInfo: RequestInfo{
+				Identifier: "user1",
+			},
+			checks: tooManyChecks,
+			wantError: &Error{
+				Code:    INVALID_PARAMETER_ERROR,
+				Message: "Invalid parameter Checks. Checks can't be empty or bigger than 20 elements",
+			},
+		},
+		"ErrorCaseEmptyResources": {
+			requestInfo: RequestInfo{
+				Identifier: "user1",
+			},
+			checks: []AuthorizationCheck{
+				{
+					Action: "product:Read",
+				},
+			},
+			wantError: &Error{
+				Code:    INVALID_PARAMETER_ERROR,
+				Message: "Invalid parameter Resources. Resources can't be empty or bigger than 50 elements",
+			},
+		},
+		"ErrorCaseUserNotFound": {
+			requestInfo: RequestInfo{
+				Identifier: "user1",
+			},
+			checks: checks,
+			wantError: &Error{
+				Code:    UNAUTHORIZED_RESOURCES_ERROR,
+				Message: "Authenticated user with externalId user1 not found. Unable to retrieve permissions.",
+			},
+			getUserByExternalIDError: &database.Error{
+				Code:    database.USER_NOT_FOUND,
+				Message: "User not found",
+			},
+		},
+		"ErrorCaseStatementsDBError": {
+			requestInfo: RequestInfo{
+				Identifier: "user1",
+			},
+			checks: checks,
+			wantError: &Error{
+				Code:    UNKNOWN_API_ERROR,
+				Message: "Error",
+			},
+			getUserByExternalIDResult: &User{
+				ID:         "UserID",
+				ExternalID: "user1",
+			},
+			getEffectiveStatementsByUserError: &database.Error{
+				Code:    database.INTERNAL_ERROR,
+				Message: "Error",
+			},
+		},
+	}
+
+	for n, test := range testcases {
+		testRepo := makeTestRepo()
+		testAPI := makeTestAPI(testRepo)
+
+		testRepo.ArgsOut[GetUserByExternalIDMethod][0] = test.getUserByExternalIDResult
+		testRepo.ArgsOut[GetUserByExternalIDMethod][1] = test.getUserByExternalIDError
+		testRepo.ArgsOut[GetEffectiveStatementsByUserMethod][0] = test.getEffectiveStatementsByUserResult
+		testRepo.ArgsOut[GetEffectiveStatementsByUserMethod][1] = test.getEffectiveStatementsByUserError
+
+		results, err := testAPI.GetAuthorizedExternalResourcesBatch(test.requestInfo, test.checks)
+		checkMethodResponse(t, n, test.wantError, err, test.expectedResponse, results)
+		// Statements are retrieved once for all actions
+		if action := testRepo.ArgsIn[GetEffectiveStatementsByUserMethod][1]; test.getEffectiveStatementsByUserResult != nil && action != "" {
+			t.Errorf("Test %v failed. Statements were retrieved for action %v", n, action)
+		}
+	}
+}
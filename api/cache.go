@@ -0,0 +1,208 @@
+package api
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// TYPE DEFINITIONS
+
+// PolicyCache stores the statements of the policies attached to each user through its groups, so
+// authorization requests don't need to retrieve them from database every time. Entries
+// expire after TTL and least recently used ones are evicted when cache is full. All methods can
+// be called on a nil cache, which never stores entries.
+type PolicyCache struct {
+	mutex sync.Mutex
+
+	size int
+	ttl  time.Duration
+
+	// Entries ordered by use, most recent first
+	entries map[string]*list.Element
+	lru     *list.List
+
+	hits          uint64
+	misses        uint64
+	evictions     uint64
+	invalidations uint64
+
+	// Incremented with every invalidation, to discard statements retrieved before it
+	version uint64
+
+	// Current time, replaced in tests
+	now func() time.Time
+}
+
+// Cache statistics
+type CacheStats struct {
+	Enabled       bool   `json:"enabled"`
+	Entries       int    `json:"entries"`
+	Size          int    `json:"size"`
+	TTL           string `json:"ttl"`
+	Hits          uint64 `json:"hits"`
+	Misses        uint64 `json:"misses"`
+	Evictions     uint64 `json:"evictions"`
+	Invalidations uint64 `json:"invalidations"`
+}
+
+type policyCacheEntry struct {
+	externalID string
+	statements []Statement
+	expireAt   time.Time
+}
+
+// NewPolicyCache returns a cache with the maximum number of users and time to live specified.
+// It returns nil, a disabled cache, if size or TTL aren't greater than 0.
+func NewPolicyCache(size int, ttl time.Duration) *PolicyCache {
+	if size < 1 || ttl <= 0 {
+		return nil
+	}
+	return &PolicyCache{
+		size:    size,
+		ttl:     ttl,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+		now:     time.Now,
+	}
+}
+
+// Get returns the statements of the user if they are cached and not expired
+func (c *PolicyCache) Get(externalID string) ([]Statement, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[externalID]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	entry := element.Value.(*policyCacheEntry)
+	if c.now().After(entry.expireAt) {
+		c.remove(element)
+		c.misses++
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	c.hits++
+	return entry.statements, true
+}
+
+// Version returns the current version of the cache. It must be retrieved before reading the statements
+// from database, and passed to Set.
+func (c *PolicyCache) Version() uint64 {
+	if c == nil {
+		return 0
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.version
+}
+
+// Set stores the statements of the user, evicting the least recently used user if cache is full. Statements
+// aren't stored if there were invalidations after the version was retrieved, because they could be outdated.
+func (c *PolicyCache) Set(externalID string, statements []Statement, version uint64) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if version != c.version {
+		return
+	}
+
+	expireAt := c.now().Add(c.ttl)
+	if element, ok := c.entries[externalID]; ok {
+		entry := element.Value.(*policyCacheEntry)
+		entry.statements = statements
+		entry.expireAt = expireAt
+		c.lru.MoveToFront(element)
+		return
+	}
+
+	if c.lru.Len() >= c.size {
+		c.remove(c.lru.Back())
+		c.evictions++
+	}
+	c.entries[externalID] = c.lru.PushFront(&policyCacheEntry{
+		externalID: externalID,
+		statements: statements,
+		expireAt:   expireAt,
+	})
+}
+
+// Invalidate removes the statements of the user
+func (c *PolicyCache) Invalidate(externalID string) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.version++
+	if element, ok := c.entries[externalID]; ok {
+		c.remove(element)
+		c.invalidations++
+	}
+}
+
+// Purge removes all users, used when a change can affect to several users
+func (c *PolicyCache) Purge() {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.version++
+	c.invalidations += uint64(c.lru.Len())
+	c.entries = map[string]*list.Element{}
+	c.lru.Init()
+}
+
+// Stats returns current statistics of the cache
+func (c *PolicyCache) Stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return CacheStats{
+		Enabled:       true,
+		Entries:       c.lru.Len(),
+		Size:          c.size,
+		TTL:           c.ttl.String(),
+		Hits:          c.hits,
+		Misses:        c.misses,
+		Evictions:     c.evictions,
+		Invalidations: c.invalidations,
+	}
+}
+
+// AUTHZ API IMPLEMENTATION
+
+// GetCacheStats returns the statistics of the policy cache. Only admin users are allowed to do it.
+func (api AuthAPI) GetCacheStats(requestInfo RequestInfo) (*CacheStats, error) {
+	if !requestInfo.Admin {
+		return nil, &Error{
+			Code:    UNAUTHORIZED_RESOURCES_ERROR,
+			Message: fmt.Sprintf("User with externalId %v is not allowed to access to cache statistics", requestInfo.Identifier),
+		}
+	}
+	stats := api.Cache.Stats()
+	return &stats, nil
+}
+
+// PRIVATE HELPER METHODS
+
+// Remove an entry, caller must hold the lock
+func (c *PolicyCache) remove(element *list.Element) {
+	entry := c.lru.Remove(element).(*policyCacheEntry)
+	delete(c.entries, entry.externalID)
+}
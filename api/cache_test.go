@@ -0,0 +1,267 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Tecsisa/foulkon/database"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestNewPolicyCache(t *testing.T) {
+	testcases := map[string]struct {
+		size            int
+		ttl             time.Duration
+		expectedEnabled bool
+	}{
+		"OkCase": {
+			size:            10,
+			ttl:             time.Minute,
+			expectedEnabled: true,
+		},
+		"OkCaseDisabledBySize": {
+			size: 0,
+			ttl:  time.Minute,
+		},
+		"OkCaseDisabledByTTL": {
+			size: 10,
+			ttl:  0,
+		},
+	}
+
+	for n, test := range testcases {
+		cache := NewPolicyCache(test.size, test.ttl)
+		if enabled := cache != nil; enabled != test.expectedEnabled {
+			t.Errorf("Test %v failed. Received enabled %v, wanted %v", n, enabled, test.expectedEnabled)
+		}
+	}
+}
+
+func TestPolicyCache(t *testing.T) {
+	now := time.Date(2016, time.October, 1, 10, 0, 0, 0, time.UTC)
+	cache := NewPolicyCache(2, time.Minute)
+	cache.now = func() time.Time { return now }
+	statements := []Statement{
+		{
+			Effect:    "allow",
+			Actions:   []string{"example:Read"},
+			Resources: []string{"urn:everything:*"},
+		},
+	}
+
+	// Miss
+	if _, ok := cache.Get("user1"); ok {
+		t.Errorf("Test failed. Unexpected statements for empty cache")
+	}
+
+	// Hit
+	cache.Set("user1", statements, cache.Version())
+	received, ok := cache.Get("user1")
+	if !ok {
+		t.Fatalf("Test failed. Expected cached statements")
+	}
+	if diff := pretty.Compare(received, statements); diff != "" {
+		t.Errorf("Test failed. Received different statements (received/wanted) %v", diff)
+	}
+
+	// Evict least recently used user
+	cache.Set("user2", statements, cache.Version())
+	cache.Get("user1")
+	cache.Set("user3", statements, cache.Version())
+	if _, ok := cache.Get("user2"); ok {
+		t.Errorf("Test failed. Least recently used user wasn't evicted")
+	}
+	if _, ok := cache.Get("user1"); !ok {
+		t.Errorf("Test failed. Recently used user was evicted")
+	}
+
+	// Invalidate user
+	cache.Invalidate("user1")
+	if _, ok := cache.Get("user1"); ok {
+		t.Errorf("Test failed. Invalidated user was returned")
+	}
+
+	// Statements retrieved before an invalidation aren't stored
+	version := cache.Version()
+	cache.Invalidate("other")
+	cache.Set("user1", statements, version)
+	if _, ok := cache.Get("user1"); ok {
+		t.Errorf("Test failed. Outdated statements were stored")
+	}
+
+	// Expiration
+	now = now.Add(2 * time.Minute)
+	if _, ok := cache.Get("user3"); ok {
+		t.Errorf("Test failed. Expired user was returned")
+	}
+
+	// Purge
+	cache.Set("user1", statements, cache.Version())
+	cache.Purge()
+	if _, ok := cache.Get("user1"); ok {
+		t.Errorf("Test failed. Purged user was returned")
+	}
+
+	expectedStats := CacheStats{
+		Enabled:       true,
+		Entries:       0,
+		Size:          2,
+		TTL:           "1m0s",
+		Hits:          3,
+		Misses:        6,
+		Evictions:     1,
+		Invalidations: 2,
+	}
+	if diff := pretty.Compare(cache.Stats(), expectedStats); diff != "" {
+		t.Errorf("Test failed. Received different stats (received/wanted) %v", diff)
+	}
+}
+
+func TestPolicyCache_Disabled(t *testing.T) {
+	var cache *PolicyCache
+	cache.Set("user1", []Statement{}, cache.Version())
+	if _, ok := cache.Get("user1"); ok {
+		t.Errorf("Test failed. Disabled cache returned statements")
+	}
+	cache.Invalidate("user1")
+	cache.Purge()
+	if diff := pretty.Compare(cache.Stats(), CacheStats{}); diff != "" {
+		t.Errorf("Test failed. Received different stats (received/wanted) %v", diff)
+	}
+}
+
+func TestAuthAPI_GetCacheStats(t *testing.T) {
+	testcases := map[string]struct {
+		requestInfo   RequestInfo
+		cache         *PolicyCache
+		expectedStats *CacheStats
+		expectedError error
+	}{
+		"OkCase": {
+			requestInfo: RequestInfo{
+				Identifier: "admin",
+				Admin:      true,
+			},
+			cache: NewPolicyCache(10, time.Minute),
+			expectedStats: &CacheStats{
+				Enabled: true,
+				Size:    10,
+				TTL:     "1m0s",
+			},
+		},
+		"OkCaseDisabled": {
+			requestInfo: RequestInfo{
+				Identifier: "admin",
+				Admin:      true,
+			},
+			expectedStats: &CacheStats{},
+		},
+		"ErrorCaseNotAdmin": {
+			requestInfo: RequestInfo{
+				Identifier: "user1",
+			},
+			cache: NewPolicyCache(10, time.Minute),
+			expectedError: &Error{
+				Code:    UNAUTHORIZED_RESOURCES_ERROR,
+				Message: "User with externalId user1 is not allowed to access to cache statistics",
+			},
+		},
+	}
+
+	for n, test := range testcases {
+		testAPI := makeTestAPI(makeTestRepo())
+		testAPI.Cache = test.cache
+		stats, err := testAPI.GetCacheStats(test.requestInfo)
+		checkMethodResponse(t, n, test.expectedError, err, test.expectedStats, stats)
+	}
+}
+
+func TestAuthAPI_getStatementsByUserCache(t *testing.T) {
+	testRepo := makeTestRepo()
+	testAPI := makeTestAPI(testRepo)
+	testAPI.Cache = NewPolicyCache(10, time.Minute)
+
+	user := &User{
+		ID:         "UserID",
+		ExternalID: "user1",
+	}
+	group := &Group{
+		ID:   "GroupID",
+		Name: "group1",
+		Org:  "org1",
+	}
+	readStatement := Statement{
+		Effect:    "allow",
+		Actions:   []string{"example:Read"},
+		Resources: []string{"urn:everything:*"},
+	}
+	writeStatement := Statement{
+		Effect:    "deny",
+		Actions:   []string{"example:Write"},
+		Resources: []string{"urn:everything:*"},
+	}
+	testRepo.ArgsOut[GetUserByExternalIDMethod][0] = user
+	testRepo.ArgsOut[GetEffectiveStatementsByUserMethod][0] = []Statement{readStatement, writeStatement}
+
+	statements, err := testAPI.getStatementsByUser(user.ExternalID, "example:Read")
+	checkMethodResponse(t, "Miss", nil, err, []Statement{readStatement}, statements)
+	// All statements are retrieved to be cached
+	if action := testRepo.ArgsIn[GetEffectiveStatementsByUserMethod][1]; action != "" {
+		t.Errorf("Test Miss failed. Statements were retrieved for action %v", action)
+	}
+
+	// Database isn't used if statements are cached
+	testRepo.ArgsOut[GetUserByExternalIDMethod][0] = nil
+	testRepo.ArgsOut[GetUserByExternalIDMethod][1] = &database.Error{
+		Code:    database.INTERNAL_ERROR,
+		Message: "Error",
+	}
+	statements, err = testAPI.getStatementsByUser(user.ExternalID, "example:Write")
+	checkMethodResponse(t, "Hit", nil, err, []Statement{writeStatement}, statements)
+
+	// Membership changes invalidate cached statements
+	testRepo.ArgsOut[GetUserByExternalIDMethod][0] = user
+	testRepo.ArgsOut[GetUserByExternalIDMethod][1] = nil
+	testRepo.ArgsOut[GetGroupByNameMethod][0] = group
+	testRepo.ArgsOut[IsMemberOfGroupMethod][0] = true
+	err = testAPI.RemoveMember(RequestInfo{Identifier: "admin", Admin: true}, user.ExternalID, group.Name, group.Org)
+	if err != nil {
+		t.Fatalf("Test failed. Unexpected error removing member: %v", err)
+	}
+	testRepo.ArgsOut[GetEffectiveStatementsByUserMethod][0] = []Statement{}
+	statements, err = testAPI.getStatementsByUser(user.ExternalID, "example:Read")
+	if err != nil || len(statements) != 0 {
+		t.Errorf("Test Invalidated failed. Received %v statements and error %v", len(statements), err)
+	}
+
+	expectedStats := CacheStats{
+		Enabled:       true,
+		Entries:       1,
+		Size:          10,
+		TTL:           "1m0s",
+		Hits:          1,
+		Misses:        2,
+		Invalidations: 1,
+	}
+	if diff := pretty.Compare(testAPI.Cache.Stats(), expectedStats); diff != "" {
+		t.Errorf("Test failed. Received different stats (received/wanted) %v", diff)
+	}
+}
+
+func TestAuthAPI_getStatementsByUserDisabledCache(t *testing.T) {
+	testRepo := makeTestRepo()
+	testAPI := makeTestAPI(testRepo)
+	testRepo.ArgsOut[GetUserByExternalIDMethod][0] = &User{
+		ID:         "UserID",
+		ExternalID: "user1",
+	}
+	testRepo.ArgsOut[GetEffectiveStatementsByUserMethod][0] = []Statement{}
+
+	// Database filters statements by action
+	if _, err := testAPI.getStatementsByUser("user1", "example:Read"); err != nil {
+		t.Fatalf("Test failed. Unexpected error: %v", err)
+	}
+	if action := testRepo.ArgsIn[GetEffectiveStatementsByUserMethod][1]; action != "example:Read" {
+		t.Errorf("Test failed. Statements were retrieved for action %v", action)
+	}
+}
@@ -0,0 +1,297 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Condition operators
+	CONDITION_STRING_EQUALS     = "StringEquals"
+	CONDITION_STRING_NOT_EQUALS = "StringNotEquals"
+	CONDITION_STRING_LIKE       = "StringLike"
+	CONDITION_IP_ADDRESS        = "IpAddress"
+	CONDITION_NOT_IP_ADDRESS    = "NotIpAddress"
+	CONDITION_DATE_LESS_THAN    = "DateLessThan"
+	CONDITION_DATE_GREATER_THAN = "DateGreaterThan"
+	CONDITION_BOOL              = "Bool"
+
+	// Context keys filled by the worker. Callers can't send keys with this prefix
+	CONTEXT_KEY_RESERVED_PREFIX = "foulkon:"
+	CONTEXT_KEY_CURRENT_TIME    = CONTEXT_KEY_RESERVED_PREFIX + "CurrentTime"
+	CONTEXT_KEY_SOURCE_IP       = CONTEXT_KEY_RESERVED_PREFIX + "SourceIp"
+	// Prefix of claims of the authenticated user, like "foulkon:Claim-groups"
+	CONTEXT_KEY_CLAIM_PREFIX = CONTEXT_KEY_RESERVED_PREFIX + "Claim-"
+
+	// Context keys filled by proxies. Only callers authenticated as proxies can send keys with this prefix
+	CONTEXT_KEY_PROXY_PREFIX = "proxy:"
+
+	// Constraints
+	MAX_CONDITION_KEY_LENGTH   = 128
+	MAX_CONDITION_VALUE_LENGTH = 256
+	MAX_CONDITION_VALUES       = 20
+	MAX_CONTEXT_KEYS           = 20
+)
+
+var rConditionKey, _ = regexp.Compile(`^[\w\-]+:[\w\-]+$`)
+
+// Conditions are stored as operator -> context key -> values. A statement with conditions
+// only applies when every operator is satisfied for every key, and a key is satisfied
+// when the value in the request context matches any of the condition values.
+type Conditions map[string]map[string][]string
+
+// IsValidContextKey validates the name of a condition or request context key
+func IsValidContextKey(key string) bool {
+	return rConditionKey.MatchString(key) && len(key) < MAX_CONDITION_KEY_LENGTH
+}
+
+func AreValidConditions(conditions Conditions) error {
+	for operator, keys := range conditions {
+		if len(keys) < 1 {
+			return &Error{
+				Code:    INVALID_PARAMETER_ERROR,
+				Message: fmt.Sprintf("Empty keys in condition operator %v", operator),
+			}
+		}
+		for key, values := range keys {
+			if !IsValidContextKey(key) {
+				return &Error{
+					Code:    REGEX_NO_MATCH,
+					Message: fmt.Sprintf("No regex match in condition key: %v", key),
+				}
+			}
+			if len(values) < 1 || len(values) > MAX_CONDITION_VALUES {
+				return &Error{
+					Code:    INVALID_PARAMETER_ERROR,
+					Message: fmt.Sprintf("Invalid condition values for key %v. Values can't be empty or bigger than %v elements", key, MAX_CONDITION_VALUES),
+				}
+			}
+			for _, value := range values {
+				if err := isValidConditionValue(operator, value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// AreValidRequestContext validates context keys received from a caller, that can send proxy keys if it is a proxy
+func AreValidRequestContext(context map[string]string, proxy bool) error {
+	if len(context) > MAX_CONTEXT_KEYS {
+		return &Error{
+			Code:    INVALID_PARAMETER_ERROR,
+			Message: fmt.Sprintf("Invalid parameter context. Context can't be bigger than %v elements", MAX_CONTEXT_KEYS),
+		}
+	}
+	for key, value := range context {
+		if !IsValidContextKey(key) {
+			return &Error{
+				Code:    REGEX_NO_MATCH,
+				Message: fmt.Sprintf("No regex match in context key: %v", key),
+			}
+		}
+		if strings.HasPrefix(key, CONTEXT_KEY_RESERVED_PREFIX) {
+			return &Error{
+				Code:    INVALID_PARAMETER_ERROR,
+				Message: fmt.Sprintf("Invalid parameter: context key %v uses reserved prefix %v", key, CONTEXT_KEY_RESERVED_PREFIX),
+			}
+		}
+		if !proxy && strings.HasPrefix(key, CONTEXT_KEY_PROXY_PREFIX) {
+			return &Error{
+				Code:    INVALID_PARAMETER_ERROR,
+				Message: fmt.Sprintf("Invalid parameter: context key %v uses prefix %v only allowed for proxies", key, CONTEXT_KEY_PROXY_PREFIX),
+			}
+		}
+		if len(value) > MAX_CONDITION_VALUE_LENGTH {
+			return &Error{
+				Code:    INVALID_PARAMETER_ERROR,
+				Message: fmt.Sprintf("Invalid parameter: context value for key %v is too long", key),
+			}
+		}
+	}
+	return nil
+}
+
+// Evaluate returns true if the request context satisfies all conditions
+func (c Conditions) Evaluate(context map[string]string) bool {
+	for operator, keys := range c {
+		for key, values := range keys {
+			contextValue, ok := context[key]
+			if !ok {
+				// Missing keys never satisfy a condition
+				return false
+			}
+			if !evaluateCondition(operator, contextValue, values) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// PRIVATE HELPER METHODS
+
+func isValidConditionValue(operator string, value string) error {
+	errFunc := func() error {
+		return &Error{
+			Code:    INVALID_PARAMETER_ERROR,
+			Message: fmt.Sprintf("Invalid value %v for condition operator %v", value, operator),
+		}
+	}
+
+	if len(value) < 1 || len(value) > MAX_CONDITION_VALUE_LENGTH {
+		return errFunc()
+	}
+
+	switch operator {
+	case CONDITION_STRING_EQUALS, CONDITION_STRING_NOT_EQUALS, CONDITION_STRING_LIKE:
+		return nil
+	case CONDITION_IP_ADDRESS, CONDITION_NOT_IP_ADDRESS:
+		if parseIPNet(value) == nil {
+			return errFunc()
+		}
+	case CONDITION_DATE_LESS_THAN, CONDITION_DATE_GREATER_THAN:
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			return errFunc()
+		}
+	case CONDITION_BOOL:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return errFunc()
+		}
+	default:
+		return &Error{
+			Code:    INVALID_PARAMETER_ERROR,
+			Message: fmt.Sprintf("Invalid condition operator: %v", operator),
+		}
+	}
+	return nil
+}
+
+// Evaluate an operator with the context value against the condition values
+func evaluateCondition(operator string, contextValue string, values []string) bool {
+	switch operator {
+	case CONDITION_STRING_EQUALS:
+		for _, v := range values {
+			if contextValue == v {
+				return true
+			}
+		}
+	case CONDITION_STRING_NOT_EQUALS:
+		for _, v := range values {
+			if contextValue == v {
+				return false
+			}
+		}
+		return true
+	case CONDITION_STRING_LIKE:
+		for _, v := range values {
+			if isLike(contextValue, v) {
+				return true
+			}
+		}
+	case CONDITION_IP_ADDRESS, CONDITION_NOT_IP_ADDRESS:
+		ip := net.ParseIP(contextValue)
+		if ip == nil {
+			return false
+		}
+		contained := false
+		for _, v := range values {
+			if ipNet := parseIPNet(v); ipNet != nil && ipNet.Contains(ip) {
+				contained = true
+				break
+			}
+		}
+		return contained == (operator == CONDITION_IP_ADDRESS)
+	case CONDITION_DATE_LESS_THAN, CONDITION_DATE_GREATER_THAN:
+		date, err := time.Parse(time.RFC3339, contextValue)
+		if err != nil {
+			return false
+		}
+		for _, v := range values {
+			limit, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				continue
+			}
+			if operator == CONDITION_DATE_LESS_THAN && date.Before(limit) {
+				return true
+			}
+			if operator == CONDITION_DATE_GREATER_THAN && date.After(limit) {
+				return true
+			}
+		}
+	case CONDITION_BOOL:
+		b, err := strconv.ParseBool(contextValue)
+		if err != nil {
+			return false
+		}
+		for _, v := range values {
+			if expected, err := strconv.ParseBool(v); err == nil && b == expected {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Parse an IP address or a CIDR block, single addresses are transformed into a one host network
+func parseIPNet(value string) *net.IPNet {
+	if _, ipNet, err := net.ParseCIDR(value); err == nil {
+		return ipNet
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+// Returns true if value matches the pattern, where '*' matches any sequence of characters
+// and '?' matches any single character. When a character doesn't match, it goes back to the
+// last '*' to make it match one more character, so it doesn't need to compile the pattern.
+func isLike(value string, pattern string) bool {
+	v, p := []rune(value), []rune(pattern)
+	i, j := 0, 0
+	// Positions after the last '*' found and of the value when it was found
+	star, mark := -1, 0
+	for i < len(v) {
+		switch {
+		case j < len(p) && (p[j] == '?' || p[j] == v[i]):
+			i++
+			j++
+		case j < len(p) && p[j] == '*':
+			star, mark = j+1, i
+			j++
+		case star >= 0:
+			mark++
+			i, j = mark, star
+		default:
+			return false
+		}
+	}
+	for j < len(p) && p[j] == '*' {
+		j++
+	}
+	return j == len(p)
+}
+
+// Filter a slice of statements, removing the ones whose conditions aren't satisfied by the context
+func filterStatementsByConditions(statements []Statement, context map[string]string) []Statement {
+	if statements == nil {
+		return nil
+	}
+	filtered := []Statement{}
+	for _, statement := range statements {
+		if statement.Conditions.Evaluate(context) {
+			filtered = append(filtered, statement)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,289 @@
+package api
+
+import (
+	"testing"
+)
+
+func TestAreValidConditions(t *testing.T) {
+	testcases := map[string]struct {
+		// Method args
+		conditions Conditions
+		// Expected results
+		wantError error
+	}{
+		"OKCaseEmpty": {},
+		"OKCaseAllOperators": {
+			conditions: Conditions{
+				CONDITION_STRING_EQUALS:     {"request:Tenant": []string{"tenant1", "tenant2"}},
+				CONDITION_STRING_NOT_EQUALS: {"request:Tenant": []string{"tenant3"}},
+				CONDITION_STRING_LIKE:       {"request:Path": []string{"/api/*"}},
+				CONDITION_IP_ADDRESS:        {CONTEXT_KEY_SOURCE_IP: []string{"10.0.0.0/8", "192.168.1.1"}},
+				CONDITION_NOT_IP_ADDRESS:    {CONTEXT_KEY_SOURCE_IP: []string{"10.0.0.1"}},
+				CONDITION_DATE_LESS_THAN:    {CONTEXT_KEY_CURRENT_TIME: []string{"2030-01-01T00:00:00Z"}},
+				CONDITION_DATE_GREATER_THAN: {CONTEXT_KEY_CURRENT_TIME: []string{"2016-01-01T00:00:00Z"}},
+				CONDITION_BOOL:              {"request:Mfa": []string{"true"}},
+			},
+		},
+		"ErrorCaseInvalidOperator": {
+			conditions: Conditions{
+				"NumericEquals": {"request:Count": []string{"1"}},
+			},
+			wantError: &Error{
+				Code:    INVALID_PARAMETER_ERROR,
+				Message: "Invalid condition operator: NumericEquals",
+			},
+		},
+		"ErrorCaseEmptyKeys": {
+			conditions: Conditions{
+				CONDITION_BOOL: {},
+			},
+			wantError: &Error{
+				Code:    INVALID_PARAMETER_ERROR,
+				Message: "Empty keys in condition operator Bool",
+			},
+		},
+		"ErrorCaseInvalidKey": {
+			conditions: Conditions{
+				CONDITION_STRING_EQUALS: {"tenant": []string{"tenant1"}},
+			},
+			wantError: &Error{
+				Code:    REGEX_NO_MATCH,
+				Message: "No regex match in condition key: tenant",
+			},
+		},
+		"ErrorCaseEmptyValues": {
+			conditions: Conditions{
+				CONDITION_STRING_EQUALS: {"request:Tenant": []string{}},
+			},
+			wantError: &Error{
+				Code:    INVALID_PARAMETER_ERROR,
+				Message: "Invalid condition values for key request:Tenant. Values can't be empty or bigger than 20 elements",
+			},
+		},
+		"ErrorCaseInvalidDate": {
+			conditions: Conditions{
+				CONDITION_DATE_LESS_THAN: {CONTEXT_KEY_CURRENT_TIME: []string{"2030-01-01"}},
+			},
+			wantError: &Error{
+				Code:    INVALID_PARAMETER_ERROR,
+				Message: "Invalid value 2030-01-01 for condition operator DateLessThan",
+			},
+		},
+		"ErrorCaseInvalidBool": {
+			conditions: Conditions{
+				CONDITION_BOOL: {"request:Mfa": []string{"yes"}},
+			},
+			wantError: &Error{
+				Code:    INVALID_PARAMETER_ERROR,
+				Message: "Invalid value yes for condition operator Bool",
+			},
+		},
+		"ErrorCaseInvalidIP": {
+			conditions: Conditions{
+				CONDITION_IP_ADDRESS: {CONTEXT_KEY_SOURCE_IP: []string{"10.0.0"}},
+			},
+			wantError: &Error{
+				Code:    INVALID_PARAMETER_ERROR,
+				Message: "Invalid value 10.0.0 for condition operator IpAddress",
+			},
+		},
+	}
+
+	for x, testcase := range testcases {
+		err := AreValidConditions(testcase.conditions)
+		checkMethodResponse(t, x, testcase.wantError, err, nil, nil)
+	}
+}
+
+func TestAreValidRequestContext(t *testing.T) {
+	testcases := map[string]struct {
+		// Method args
+		context map[string]string
+		proxy   bool
+		// Expected results
+		wantError error
+	}{
+		"OKCase": {
+			context: map[string]string{
+				"request:Tenant": "tenant1",
+			},
+		},
+		"OKCaseProxy": {
+			context: map[string]string{
+				"proxy:SourceIp": "10.0.0.1",
+			},
+			proxy: true,
+		},
+		"ErrorCaseProxyPrefix": {
+			context: map[string]string{
+				"proxy:SourceIp": "10.0.0.1",
+			},
+			wantError: &Error{
+				Code:    INVALID_PARAMETER_ERROR,
+				Message: "Invalid parameter: context key proxy:SourceIp uses prefix proxy: only allowed for proxies",
+			},
+		},
+		"ErrorCaseReservedPrefix": {
+			context: map[string]string{
+				CONTEXT_KEY_SOURCE_IP: "10.0.0.1",
+			},
+			wantError: &Error{
+				Code:    INVALID_PARAMETER_ERROR,
+				Message: "Invalid parameter: context key foulkon:SourceIp uses reserved prefix foulkon:",
+			},
+		},
+		"ErrorCaseInvalidKey": {
+			context: map[string]string{
+				"sourceIp": "10.0.0.1",
+			},
+			wantError: &Error{
+				Code:    REGEX_NO_MATCH,
+				Message: "No regex match in context key: sourceIp",
+			},
+		},
+	}
+
+	for x, testcase := range testcases {
+		err := AreValidRequestContext(testcase.context, testcase.proxy)
+		checkMethodResponse(t, x, testcase.wantError, err, nil, nil)
+	}
+}
+
+func TestConditionsEvaluate(t *testing.T) {
+	context := map[string]string{
+		CONTEXT_KEY_SOURCE_IP:    "10.0.1.5",
+		CONTEXT_KEY_CURRENT_TIME: "2020-06-01T10:00:00Z",
+		"request:Tenant":         "tenant1",
+		"request:Path":           "/api/v1/resource",
+		"request:Mfa":            "true",
+	}
+	testcases := map[string]struct {
+		conditions Conditions
+		expected   bool
+	}{
+		"OkCaseNoConditions": {
+			expected: true,
+		},
+		"OkCaseStringEquals": {
+			conditions: Conditions{CONDITION_STRING_EQUALS: {"request:Tenant": []string{"tenant2", "tenant1"}}},
+			expected:   true,
+		},
+		"OkCaseStringEqualsNoMatch": {
+			conditions: Conditions{CONDITION_STRING_EQUALS: {"request:Tenant": []string{"tenant2"}}},
+			expected:   false,
+		},
+		"OkCaseStringNotEquals": {
+			conditions: Conditions{CONDITION_STRING_NOT_EQUALS: {"request:Tenant": []string{"tenant2"}}},
+			expected:   true,
+		},
+		"OkCaseStringLike": {
+			conditions: Conditions{CONDITION_STRING_LIKE: {"request:Path": []string{"/api/v?/*"}}},
+			expected:   true,
+		},
+		"OkCaseIpAddress": {
+			conditions: Conditions{CONDITION_IP_ADDRESS: {CONTEXT_KEY_SOURCE_IP: []string{"10.0.0.0/16"}}},
+			expected:   true,
+		},
+		"OkCaseNotIpAddress": {
+			conditions: Conditions{CONDITION_NOT_IP_ADDRESS: {CONTEXT_KEY_SOURCE_IP: []string{"10.0.1.5"}}},
+			expected:   false,
+		},
+		"OkCaseDateLessThan": {
+			conditions: Conditions{CONDITION_DATE_LESS_THAN: {CONTEXT_KEY_CURRENT_TIME: []string{"2021-01-01T00:00:00Z"}}},
+			expected:   true,
+		},
+		"OkCaseDateGreaterThan": {
+			conditions: Conditions{CONDITION_DATE_GREATER_THAN: {CONTEXT_KEY_CURRENT_TIME: []string{"2021-01-01T00:00:00Z"}}},
+			expected:   false,
+		},
+		"OkCaseBool": {
+			conditions: Conditions{CONDITION_BOOL: {"request:Mfa": []string{"true"}}},
+			expected:   true,
+		},
+		"OkCaseMissingKey": {
+			conditions: Conditions{CONDITION_STRING_NOT_EQUALS: {"request:Unknown": []string{"value"}}},
+			expected:   false,
+		},
+		"OkCaseSeveralOperators": {
+			conditions: Conditions{
+				CONDITION_IP_ADDRESS: {CONTEXT_KEY_SOURCE_IP: []string{"10.0.0.0/8"}},
+				CONDITION_BOOL:       {"request:Mfa": []string{"false"}},
+			},
+			expected: false,
+		},
+	}
+
+	for x, testcase := range testcases {
+		received := testcase.conditions.Evaluate(context)
+		checkMethodResponse(t, x, nil, nil, testcase.expected, received)
+	}
+}
+
+func TestIsLike(t *testing.T) {
+	testcases := map[string]struct {
+		value    string
+		pattern  string
+		expected bool
+	}{
+		"OkCaseExact": {
+			value:    "/api/v1",
+			pattern:  "/api/v1",
+			expected: true,
+		},
+		"OkCaseAnySequence": {
+			value:    "/api/v1/resource",
+			pattern:  "/api/*",
+			expected: true,
+		},
+		"OkCaseEmptySequence": {
+			value:    "/api/",
+			pattern:  "/api/*",
+			expected: true,
+		},
+		"OkCaseSeveralSequences": {
+			value:    "/api/v1/users/user1/groups",
+			pattern:  "/api/*/users/*/groups",
+			expected: true,
+		},
+		"OkCaseBacktracking": {
+			value:    "aaab",
+			pattern:  "*a*ab",
+			expected: true,
+		},
+		"OkCaseSingleCharacter": {
+			value:    "/api/vñ",
+			pattern:  "/api/v?",
+			expected: true,
+		},
+		"OkCaseRegexCharacters": {
+			value:    "/api/v1.0",
+			pattern:  "/api/v1.0",
+			expected: true,
+		},
+		"OkCaseRegexCharactersNoMatch": {
+			value:    "/api/v1x0",
+			pattern:  "/api/v1.0",
+			expected: false,
+		},
+		"OkCaseNoMatch": {
+			value:    "/other/v1",
+			pattern:  "/api/*",
+			expected: false,
+		},
+		"OkCaseMissingCharacter": {
+			value:    "/api/v",
+			pattern:  "/api/v?",
+			expected: false,
+		},
+		"OkCaseTrailingCharacters": {
+			value:    "/api/v1/resource",
+			pattern:  "/api/*/users",
+			expected: false,
+		},
+	}
+
+	for x, testcase := range testcases {
+		received := isLike(testcase.value, testcase.pattern)
+		checkMethodResponse(t, x, nil, nil, testcase.expected, received)
+	}
+}
@@ -32,6 +32,11 @@ const (
 	POLICY_ALREADY_EXIST             = "PolicyAlreadyExist"
 	POLICY_BY_ORG_AND_NAME_NOT_FOUND = "PolicyWithOrgAndNameNotFound"
 
+	// Service account API error codes
+	SERVICE_ACCOUNT_ALREADY_EXIST     = "ServiceAccountAlreadyExist"
+	SERVICE_ACCOUNT_BY_NAME_NOT_FOUND = "ServiceAccountWithNameNotFound"
+	INVALID_API_KEY_ERROR             = "InvalidApiKeyError"
+
 	// Regex error
 	REGEX_NO_MATCH = "RegexNoMatch"
 )
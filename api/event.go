@@ -0,0 +1,161 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Tecsisa/foulkon/database"
+	"github.com/satori/go.uuid"
+)
+
+// Event types published after changes
+const (
+	USER_CREATED_EVENT    = "UserCreated"
+	USER_UPDATED_EVENT    = "UserUpdated"
+	USER_DELETED_EVENT    = "UserDeleted"
+	GROUP_CREATED_EVENT   = "GroupCreated"
+	GROUP_UPDATED_EVENT   = "GroupUpdated"
+	GROUP_DELETED_EVENT   = "GroupDeleted"
+	MEMBER_ADDED_EVENT    = "MemberAdded"
+	MEMBER_REMOVED_EVENT  = "MemberRemoved"
+	POLICY_CREATED_EVENT  = "PolicyCreated"
+	POLICY_UPDATED_EVENT  = "PolicyUpdated"
+	POLICY_DELETED_EVENT  = "PolicyDeleted"
+	POLICY_ATTACHED_EVENT = "PolicyAttached"
+	POLICY_DETACHED_EVENT = "PolicyDetached"
+)
+
+// Event type published for each action that changes a resource
+var eventTypes = map[string]string{
+	USER_ACTION_CREATE_USER:          USER_CREATED_EVENT,
+	USER_ACTION_UPDATE_USER:          USER_UPDATED_EVENT,
+	USER_ACTION_DELETE_USER:          USER_DELETED_EVENT,
+	GROUP_ACTION_CREATE_GROUP:        GROUP_CREATED_EVENT,
+	GROUP_ACTION_UPDATE_GROUP:        GROUP_UPDATED_EVENT,
+	GROUP_ACTION_DELETE_GROUP:        GROUP_DELETED_EVENT,
+	GROUP_ACTION_ADD_MEMBER:          MEMBER_ADDED_EVENT,
+	GROUP_ACTION_REMOVE_MEMBER:       MEMBER_REMOVED_EVENT,
+	GROUP_ACTION_ATTACH_GROUP_POLICY: POLICY_ATTACHED_EVENT,
+	GROUP_ACTION_DETACH_GROUP_POLICY: POLICY_DETACHED_EVENT,
+	POLICY_ACTION_CREATE_POLICY:      POLICY_CREATED_EVENT,
+	POLICY_ACTION_UPDATE_POLICY:      POLICY_UPDATED_EVENT,
+	POLICY_ACTION_DELETE_POLICY:      POLICY_DELETED_EVENT,
+}
+
+// TYPE DEFINITIONS
+
+// Event notifies a change done over a resource. Data contains the resource state after the change,
+// or before it if resource was deleted.
+type Event struct {
+	ID        string           `json:"id"`
+	Type      string           `json:"type"`
+	Urn       string           `json:"urn"`
+	Actor     string           `json:"actor"`
+	RequestID string           `json:"requestId"`
+	CreateAt  time.Time        `json:"createAt"`
+	Data      *json.RawMessage `json:"data,omitempty"`
+}
+
+// EventSink is a destination of events, like a webhook, that receives the event types
+// specified, or all of them if there aren't types.
+type EventSink struct {
+	Name   string
+	Events []string
+}
+
+// OutboxEntry is an event pending to be delivered to a sink. Entries are stored before they are
+// delivered, so events aren't lost if worker stops.
+type OutboxEntry struct {
+	Event         Event     `json:"event"`
+	Sink          string    `json:"sink"`
+	Attempts      int       `json:"attempts"`
+	NextAttemptAt time.Time `json:"nextAttemptAt"`
+	LastError     string    `json:"lastError,omitempty"`
+}
+
+// IsValidEventType checks if events of the type are published
+func IsValidEventType(eventType string) bool {
+	for _, t := range eventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// PRIVATE HELPER METHODS
+
+// Record a change in the audit log and publish its event. It must be called in the transaction of
+// the change, so the change isn't stored without its audit event and its event.
+func (api AuthAPI) recordChange(requestInfo RequestInfo, action string, urn string, before interface{}, after interface{}) error {
+	if err := api.recordAuditEvent(requestInfo, action, urn, before, after); err != nil {
+		return err
+	}
+	return api.publishEvent(requestInfo, action, urn, before, after)
+}
+
+// Store the event of a change in the outbox of every sink subscribed to its type
+func (api AuthAPI) publishEvent(requestInfo RequestInfo, action string, urn string, before interface{}, after interface{}) error {
+	eventType, ok := eventTypes[action]
+	if !ok || api.EventRepo == nil || len(api.EventSinks) == 0 {
+		return nil
+	}
+
+	data := after
+	if data == nil {
+		data = before
+	}
+	state, err := getAuditState(data)
+	if err != nil {
+		return &Error{
+			Code:    UNKNOWN_API_ERROR,
+			Message: fmt.Sprintf("Error publishing event for action %v over resource %v: %v", action, urn, err),
+		}
+	}
+	event := Event{
+		ID:        uuid.NewV4().String(),
+		Type:      eventType,
+		Urn:       urn,
+		Actor:     requestInfo.Identifier,
+		RequestID: requestInfo.RequestID,
+		CreateAt:  time.Now().UTC(),
+		Data:      state,
+	}
+	entries := []OutboxEntry{}
+	for _, sink := range api.EventSinks {
+		if sink.isSubscribed(eventType) {
+			entries = append(entries, OutboxEntry{
+				Event:         event,
+				Sink:          sink.Name,
+				NextAttemptAt: event.CreateAt,
+			})
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	if err := api.EventRepo.AddOutboxEntries(entries); err != nil {
+		//Transform to DB error
+		dbError := err.(*database.Error)
+		return &Error{
+			Code:    UNKNOWN_API_ERROR,
+			Message: fmt.Sprintf("Error publishing event for action %v over resource %v: %v", action, urn, dbError.Message),
+		}
+	}
+	return nil
+}
+
+// Check if sink receives the event type
+func (s EventSink) isSubscribed(eventType string) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, e := range s.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
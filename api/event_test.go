@@ -0,0 +1,154 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Tecsisa/foulkon/database"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestIsValidEventType(t *testing.T) {
+	testcases := map[string]struct {
+		eventType string
+		expected  bool
+	}{
+		"OkCase": {
+			eventType: MEMBER_ADDED_EVENT,
+			expected:  true,
+		},
+		"ErrorCaseUnknownType": {
+			eventType: "MemberUpdated",
+		},
+	}
+
+	for n, test := range testcases {
+		if valid := IsValidEventType(test.eventType); valid != test.expected {
+			t.Errorf("Test %v failed. Received %v, wanted %v", n, valid, test.expected)
+		}
+	}
+}
+
+func TestAuthAPI_publishEvent(t *testing.T) {
+	group := &Group{
+		ID:   "GroupID",
+		Name: "group1",
+		Org:  "org1",
+		Urn:  CreateUrn("org1", RESOURCE_GROUP, "/", "group1"),
+	}
+	user := &User{
+		ID:         "UserID",
+		ExternalID: "user1",
+		Urn:        CreateUrn("", RESOURCE_USER, "/", "user1"),
+	}
+	requestInfo := RequestInfo{
+		Identifier: "admin",
+		Admin:      true,
+		RequestID:  "RequestID",
+	}
+	data := json.RawMessage(`{"group":"urn:iws:iam:org1:group/group1","user":"urn:iws:iam::user/user1"}`)
+
+	testcases := map[string]struct {
+		sinks           []EventSink
+		expectedSinks   []string
+		expectedPublish bool
+	}{
+		"OkCase": {
+			sinks: []EventSink{
+				{Name: "all"},
+				{Name: "members", Events: []string{MEMBER_ADDED_EVENT, MEMBER_REMOVED_EVENT}},
+				{Name: "policies", Events: []string{POLICY_UPDATED_EVENT}},
+			},
+			expectedSinks:   []string{"all", "members"},
+			expectedPublish: true,
+		},
+		"OkCaseWithoutSubscribedSinks": {
+			sinks: []EventSink{
+				{Name: "policies", Events: []string{POLICY_UPDATED_EVENT}},
+			},
+		},
+		"OkCaseWithoutSinks": {},
+	}
+
+	for n, test := range testcases {
+		testRepo := makeTestRepo()
+		testAPI := makeTestAPI(testRepo)
+		testAPI.EventSinks = test.sinks
+		testRepo.ArgsOut[GetGroupByNameMethod][0] = group
+		testRepo.ArgsOut[GetUserByExternalIDMethod][0] = user
+
+		if err := testAPI.AddMember(requestInfo, "user1", "group1", "org1"); err != nil {
+			t.Errorf("Test %v failed. Unexpected error adding member: %v", n, err)
+			continue
+		}
+		if !test.expectedPublish {
+			if entries := testRepo.ArgsIn[AddOutboxEntriesMethod][0]; entries != nil {
+				t.Errorf("Test %v failed. Unexpected entries published: %v", n, entries)
+			}
+			continue
+		}
+
+		entries := testRepo.ArgsIn[AddOutboxEntriesMethod][0].([]OutboxEntry)
+		sinks := []string{}
+		for _, entry := range entries {
+			sinks = append(sinks, entry.Sink)
+		}
+		if diff := pretty.Compare(sinks, test.expectedSinks); diff != "" {
+			t.Errorf("Test %v failed. Received different sinks (received/wanted) %v", n, diff)
+			continue
+		}
+		event := entries[0].Event
+		expectedEvent := Event{
+			ID:        event.ID,
+			Type:      MEMBER_ADDED_EVENT,
+			Urn:       group.Urn,
+			Actor:     "admin",
+			RequestID: "RequestID",
+			CreateAt:  event.CreateAt,
+			Data:      &data,
+		}
+		if diff := pretty.Compare(event, expectedEvent); diff != "" {
+			t.Errorf("Test %v failed. Received different event (received/wanted) %v", n, diff)
+		}
+		if !entries[0].NextAttemptAt.Equal(event.CreateAt) {
+			t.Errorf("Test %v failed. Entry must be pending since event creation", n)
+		}
+	}
+
+	// Errors publishing events are returned by the transaction of the change, so it is rolled back
+	testRepo := makeTestRepo()
+	testAPI := makeTestAPI(testRepo)
+	testAPI.EventSinks = []EventSink{{Name: "all"}}
+	testRepo.ArgsOut[GetGroupByNameMethod][0] = group
+	testRepo.ArgsOut[GetUserByExternalIDMethod][0] = user
+	testRepo.ArgsOut[AddOutboxEntriesMethod][0] = &database.Error{
+		Code:    database.INTERNAL_ERROR,
+		Message: "Error",
+	}
+	err := testAPI.AddMember(requestInfo, "user1", "group1", "org1")
+	expectedError := &Error{
+		Code:    UNKNOWN_API_ERROR,
+		Message: "Error publishing event for action iam:AddMember over resource urn:iws:iam:org1:group/group1: Error",
+	}
+	if diff := pretty.Compare(err, expectedError); diff != "" {
+		t.Errorf("Test failed. Received different errors (received/wanted) %v", diff)
+	}
+
+	// Events aren't published if audit events can't be stored
+	testRepo.ArgsIn[AddOutboxEntriesMethod][0] = nil
+	testRepo.ArgsOut[AddAuditEventMethod][0] = &database.Error{
+		Code:    database.INTERNAL_ERROR,
+		Message: "Error",
+	}
+	err = testAPI.AddMember(requestInfo, "user1", "group1", "org1")
+	expectedError = &Error{
+		Code:    UNKNOWN_API_ERROR,
+		Message: "Error storing audit event for action iam:AddMember over resource urn:iws:iam:org1:group/group1: Error",
+	}
+	if diff := pretty.Compare(err, expectedError); diff != "" {
+		t.Errorf("Test failed. Received different errors (received/wanted) %v", diff)
+	}
+	if entries := testRepo.ArgsIn[AddOutboxEntriesMethod][0]; entries != nil {
+		t.Errorf("Test failed. Unexpected entries published: %v", entries)
+	}
+}
@@ -0,0 +1,240 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/Tecsisa/foulkon/database"
+)
+
+// TYPE DEFINITIONS
+
+const (
+	// Authorization decisions
+	DECISION_ALLOW         = "allow"
+	DECISION_EXPLICIT_DENY = "explicitDeny"
+	DECISION_IMPLICIT_DENY = "implicitDeny"
+)
+
+// Statement related to an authorization decision, with the group and policy where it comes from
+type MatchedStatement struct {
+	Group             string    `json:"group"`
+	Policy            string    `json:"policy"`
+	Statement         Statement `json:"statement"`
+	ConditionsMatched bool      `json:"conditionsMatched"`
+}
+
+// Decision taken for a requested resource
+type ResourceExplanation struct {
+	Urn      string `json:"urn"`
+	Decision string `json:"decision"`
+	// Statements with the requested action whose resources contain the urn
+	Statements []MatchedStatement `json:"statements"`
+	// Deny restriction that matched the urn and the statement that defines it
+	DeniedBy    string            `json:"deniedBy,omitempty"`
+	WinningDeny *MatchedStatement `json:"winningDeny,omitempty"`
+}
+
+type AuthorizationExplanation struct {
+	ExternalID   string                `json:"externalId"`
+	Action       string                `json:"action"`
+	Groups       []string              `json:"groups"`
+	Policies     []string              `json:"policies"`
+	Restrictions *Restrictions         `json:"restrictions"`
+	Resources    []ResourceExplanation `json:"resources"`
+}
+
+// AUTHZ API IMPLEMENTATION
+
+// ExplainAuthorizedExternalResources returns the trace of the decision taken for the user with the action
+// and resources specified. Only admin users are allowed to do it.
+func (api AuthAPI) ExplainAuthorizedExternalResources(requestInfo RequestInfo, externalID string, action string, resources []string,
+	context map[string]string) (*AuthorizationExplanation, error) {
+	if !requestInfo.Admin {
+		return nil, &Error{
+			Code:    UNAUTHORIZED_RESOURCES_ERROR,
+			Message: fmt.Sprintf("User with externalId %v is not allowed to explain authorization decisions", requestInfo.Identifier),
+		}
+	}
+
+	// Validate parameters
+	if !IsValidUserExternalID(externalID) {
+		return nil, &Error{
+			Code:    INVALID_PARAMETER_ERROR,
+			Message: fmt.Sprintf("Invalid parameter: externalId %v", externalID),
+		}
+	}
+	if _, err := validateExternalResources(action, resources); err != nil {
+		return nil, err
+	}
+	evalContext, err := getEvaluationContext(requestInfo, context)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get user if exists
+	user, err := api.UserRepo.GetUserByExternalID(externalID)
+	if err != nil {
+		//Transform to DB error
+		dbError := err.(*database.Error)
+		if dbError.Code == database.USER_NOT_FOUND {
+			return nil, &Error{
+				Code:    USER_BY_EXTERNAL_ID_NOT_FOUND,
+				Message: dbError.Message,
+			}
+		}
+		return nil, &Error{
+			Code:    UNKNOWN_API_ERROR,
+			Message: dbError.Message,
+		}
+	}
+
+	groups, err := api.getGroupsByUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	explanation := &AuthorizationExplanation{
+		ExternalID: externalID,
+		Action:     action,
+		Groups:     []string{},
+		Policies:   []string{},
+	}
+	statements := []MatchedStatement{}
+	policiesFound := map[string]bool{}
+	for _, group := range groups {
+		explanation.Groups = append(explanation.Groups, group.Urn)
+		policies, err := api.getPoliciesByGroups([]Group{group})
+		if err != nil {
+			return nil, err
+		}
+		for _, policy := range policies {
+			if !policiesFound[policy.Urn] {
+				policiesFound[policy.Urn] = true
+				explanation.Policies = append(explanation.Policies, policy.Urn)
+			}
+			statements = append(statements, getMatchedStatements(group.Urn, policy)...)
+		}
+	}
+
+	explanation.Restrictions, explanation.Resources = explainResources(action, resources, statements, evalContext)
+
+	LogOperation(api.Logger, requestInfo, fmt.Sprintf("Authorization explained for user %v, action %v and resources %v", externalID, action, resources))
+	return explanation, nil
+}
+
+// PRIVATE HELPER METHODS
+
+// Build the context to evaluate conditions for a request reproduced by an admin. Reserved keys are
+// allowed here, and the time of this request is used if the current time isn't specified.
+func getEvaluationContext(requestInfo RequestInfo, context map[string]string) (map[string]string, error) {
+	evalContext := map[string]string{}
+	if currentTime, ok := requestInfo.Context[CONTEXT_KEY_CURRENT_TIME]; ok {
+		evalContext[CONTEXT_KEY_CURRENT_TIME] = currentTime
+	}
+	for key, value := range context {
+		if !IsValidContextKey(key) {
+			return nil, &Error{
+				Code:    INVALID_PARAMETER_ERROR,
+				Message: fmt.Sprintf("Invalid parameter: context key %v", key),
+			}
+		}
+		evalContext[key] = value
+	}
+	return evalContext, nil
+}
+
+// Transform the statements of a policy attached to a group into matched statements
+func getMatchedStatements(group string, policy Policy) []MatchedStatement {
+	statements := []MatchedStatement{}
+	if policy.Statements == nil {
+		return statements
+	}
+	for _, statement := range *policy.Statements {
+		statements = append(statements, MatchedStatement{
+			Group:     group,
+			Policy:    policy.Urn,
+			Statement: statement,
+		})
+	}
+	return statements
+}
+
+// Evaluate the statements for each urn with the same pipeline that authorizes external resources,
+// keeping track of the statements that took part in the decision
+func explainResources(action string, urns []string, statements []MatchedStatement, context map[string]string) (*Restrictions, []ResourceExplanation) {
+	// Retrieve statements with the requested action, evaluating its conditions
+	actionStatements := []MatchedStatement{}
+	validStatements := []Statement{}
+	for _, ms := range statements {
+		if !IsActionContained(action, ms.Statement.Actions) {
+			continue
+		}
+		ms.ConditionsMatched = ms.Statement.Conditions.Evaluate(context)
+		if ms.ConditionsMatched {
+			validStatements = append(validStatements, ms.Statement)
+		}
+		actionStatements = append(actionStatements, ms)
+	}
+
+	restrictions := getRestrictions(validStatements, "urn:*", false)
+
+	explanations := []ResourceExplanation{}
+	for _, urn := range urns {
+		explanation := ResourceExplanation{
+			Urn:        urn,
+			Statements: []MatchedStatement{},
+		}
+		for _, ms := range actionStatements {
+			for _, res := range ms.Statement.Resources {
+				if isContainedOrEqual(urn, res) {
+					explanation.Statements = append(explanation.Statements, ms)
+					break
+				}
+			}
+		}
+
+		if isAllowedResource(ExternalResource{Urn: urn}, *restrictions) {
+			explanation.Decision = DECISION_ALLOW
+		} else if deniedBy := getDenyRestriction(urn, restrictions); deniedBy != "" {
+			explanation.Decision = DECISION_EXPLICIT_DENY
+			explanation.DeniedBy = deniedBy
+			explanation.WinningDeny = getWinningDeny(deniedBy, explanation.Statements)
+		} else {
+			explanation.Decision = DECISION_IMPLICIT_DENY
+		}
+		explanations = append(explanations, explanation)
+	}
+
+	return restrictions, explanations
+}
+
+// Return the deny restriction that matches the urn, in the same order that isAllowedResource checks them
+func getDenyRestriction(urn string, restrictions *Restrictions) string {
+	for _, restriction := range restrictions.DeniedUrnPrefixes {
+		if isContainedOrEqual(urn, restriction) {
+			return restriction
+		}
+	}
+	for _, restriction := range restrictions.DeniedFullUrns {
+		if urn == restriction {
+			return restriction
+		}
+	}
+	return ""
+}
+
+// Return the first deny statement with satisfied conditions that defines the restriction
+func getWinningDeny(restriction string, statements []MatchedStatement) *MatchedStatement {
+	for _, ms := range statements {
+		if ms.Statement.Effect != "deny" || !ms.ConditionsMatched {
+			continue
+		}
+		for _, res := range ms.Statement.Resources {
+			if res == restriction {
+				winner := ms
+				return &winner
+			}
+		}
+	}
+	return nil
+}
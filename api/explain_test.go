@@ -0,0 +1,239 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/Tecsisa/foulkon/database"
+)
+
+func TestExplainAuthorizedExternalResources(t *testing.T) {
+	groupUrn := CreateUrn("example", RESOURCE_GROUP, "/path/", "group1")
+	policyUrn := CreateUrn("example", RESOURCE_POLICY, "/path/", "policy1")
+	allowStatement := Statement{
+		Effect:    "allow",
+		Actions:   []string{"product:Read"},
+		Resources: []string{"urn:ews:product:instance:resource/*"},
+	}
+	denyStatement := Statement{
+		Effect:    "deny",
+		Actions:   []string{"product:*"},
+		Resources: []string{"urn:ews:product:instance:resource/secret/*"},
+	}
+	conditionalStatement := Statement{
+		Effect:    "allow",
+		Actions:   []string{"product:Read"},
+		Resources: []string{"urn:ews:product:instance:other/*"},
+		Conditions: Conditions{
+			CONDITION_IP_ADDRESS: {
+				CONTEXT_KEY_SOURCE_IP: []string{"10.0.0.0/8"},
+			},
+		},
+	}
+	testcases := map[string]struct {
+		// API method args
+		requestInfo RequestInfo
+		externalID  string
+		action      string
+		resources   []string
+		context     map[string]string
+		// Expected result
+		expectedResponse *AuthorizationExplanation
+		wantError        error
+		// Manager Results
+		getUserByExternalIDResult *User
+		getGroupsByUserIDResult   []TestUserGroupRelation
+		getAttachedPoliciesResult []TestPolicyGroupRelation
+		// Manager Errors
+		getUserByExternalIDError error
+	}{
+		"OkCase": {
+			requestInfo: RequestInfo{
+				Identifier: "admin",
+				Admin:      true,
+			},
+			externalID: "user1",
+			action:     "product:Read",
+			resources: []string{
+				"urn:ews:product:instance:resource/res1",
+				"urn:ews:product:instance:resource/secret/res2",
+				"urn:ews:product:instance:other/res3",
+			},
+			context: map[string]string{
+				CONTEXT_KEY_SOURCE_IP: "192.168.1.1",
+			},
+			expectedResponse: &AuthorizationExplanation{
+				ExternalID: "user1",
+				Action:     "product:Read",
+				Groups:     []string{groupUrn},
+				Policies:   []string{policyUrn},
+				Restrictions: &Restrictions{
+					AllowedUrnPrefixes: []string{"urn:ews:product:instance:resource/*"},
+					AllowedFullUrns:    []string{},
+					DeniedUrnPrefixes:  []string{"urn:ews:product:instance:resource/secret/*"},
+					DeniedFullUrns:     []string{},
+				},
+				Resources: []ResourceExplanation{
+					{
+						Urn:      "urn:ews:product:instance:resource/res1",
+						Decision: DECISION_ALLOW,
+						Statements: []MatchedStatement{
+							{
+								Group:             groupUrn,
+								Policy:            policyUrn,
+								Statement:         allowStatement,
+								ConditionsMatched: true,
+							},
+						},
+					},
+					{
+						Urn:      "urn:ews:product:instance:resource/secret/res2",
+						Decision: DECISION_EXPLICIT_DENY,
+						Statements: []MatchedStatement{
+							{
+								Group:             groupUrn,
+								Policy:            policyUrn,
+								Statement:         allowStatement,
+								ConditionsMatched: true,
+							},
+							{
+								Group:             groupUrn,
+								Policy:            policyUrn,
+								Statement:         denyStatement,
+								ConditionsMatched: true,
+							},
+						},
+						DeniedBy: "urn:ews:product:instance:resource/secret/*",
+						WinningDeny: &MatchedStatement{
+							Group:             groupUrn,
+							Policy:            policyUrn,
+							Statement:         denyStatement,
+							ConditionsMatched: true,
+						},
+					},
+					{
+						Urn:      "urn:ews:product:instance:other/res3",
+						Decision: DECISION_IMPLICIT_DENY,
+						Statements: []MatchedStatement{
+							{
+								Group:             groupUrn,
+								Policy:            policyUrn,
+								Statement:         conditionalStatement,
+								ConditionsMatched: false,
+							},
+						},
+					},
+				},
+			},
+			getUserByExternalIDResult: &User{
+				ID:         "UserID",
+				ExternalID: "user1",
+			},
+			getGroupsByUserIDResult: []TestUserGroupRelation{
+				{
+					Group: &Group{
+						ID:  "GroupID",
+						Urn: groupUrn,
+					},
+				},
+			},
+			getAttachedPoliciesResult: []TestPolicyGroupRelation{
+				{
+					Policy: &Policy{
+						ID:  "PolicyID",
+						Urn: policyUrn,
+						Statements: &[]Statement{
+							allowStatement,
+							denyStatement,
+							conditionalStatement,
+						},
+					},
+				},
+			},
+		},
+		"ErrorCaseNotAdmin": {
+			requestInfo: RequestInfo{
+				Identifier: "user2",
+			},
+			externalID: "user1",
+			action:     "product:Read",
+			resources:  []string{"urn:ews:product:instance:resource/res1"},
+			wantError: &Error{
+				Code:    UNAUTHORIZED_RESOURCES_ERROR,
+				Message: "User with externalId user2 is not allowed to explain authorization decisions",
+			},
+		},
+		"ErrorCaseInvalidExternalID": {
+			requestInfo: RequestInfo{
+				Identifier: "admin",
+				Admin:      true,
+			},
+			externalID: "user/1",
+			action:     "product:Read",
+			resources:  []string{"urn:ews:product:instance:resource/res1"},
+			wantError: &Error{
+				Code:    INVALID_PARAMETER_ERROR,
+				Message: "Invalid parameter: externalId user/1",
+			},
+		},
+		"ErrorCaseResourcePrefix": {
+			requestInfo: RequestInfo{
+				Identifier: "admin",
+				Admin:      true,
+			},
+			externalID: "user1",
+			action:     "product:Read",
+			resources:  []string{"urn:ews:product:instance:resource/*"},
+			wantError: &Error{
+				Code:    INVALID_PARAMETER_ERROR,
+				Message: "Invalid parameter resource urn:ews:product:instance:resource/*. Urn prefixes are not allowed here",
+			},
+		},
+		"ErrorCaseUserNotFound": {
+			requestInfo: RequestInfo{
+				Identifier: "admin",
+				Admin:      true,
+			},
+			externalID: "user1",
+			action:     "product:Read",
+			resources:  []string{"urn:ews:product:instance:resource/res1"},
+			wantError: &Error{
+				Code:    USER_BY_EXTERNAL_ID_NOT_FOUND,
+				Message: "User not found",
+			},
+			getUserByExternalIDError: &database.Error{
+				Code:    database.USER_NOT_FOUND,
+				Message: "User not found",
+			},
+		},
+		"ErrorCaseInternalError": {
+			requestInfo: RequestInfo{
+				Identifier: "admin",
+				Admin:      true,
+			},
+			externalID: "user1",
+			action:     "product:Read",
+			resources:  []string{"urn:ews:product:instance:resource/res1"},
+			wantError: &Error{
+				Code:    UNKNOWN_API_ERROR,
+				Message: "Error",
+			},
+			getUserByExternalIDError: &database.Error{
+				Code:    database.INTERNAL_ERROR,
+				Message: "Error",
+			},
+		},
+	}
+
+	for n, test := range testcases {
+		testRepo := makeTestRepo()
+		testAPI := makeTestAPI(testRepo)
+
+		testRepo.ArgsOut[GetUserByExternalIDMethod][0] = test.getUserByExternalIDResult
+		testRepo.ArgsOut[GetUserByExternalIDMethod][1] = test.getUserByExternalIDError
+		testRepo.ArgsOut[GetGroupsByUserIDMethod][0] = test.getGroupsByUserIDResult
+		testRepo.ArgsOut[GetAttachedPoliciesMethod][0] = test.getAttachedPoliciesResult
+
+		explanation, err := testAPI.ExplainAuthorizedExternalResources(test.requestInfo, test.externalID, test.action, test.resources, test.context)
+		checkMethodResponse(t, n, test.wantError, err, test.expectedResponse, explanation)
+	}
+}
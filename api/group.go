@@ -95,16 +95,18 @@ func (api AuthAPI) AddGroup(requestInfo RequestInfo, org string, name string, pa
 		// Group doesn't exist in DB, so we can create it
 		case database.GROUP_NOT_FOUND:
 			// Create group
-			createdGroup, err := api.GroupRepo.AddGroup(group)
+			var createdGroup *Group
+			err := api.transaction(func(tx AuthAPI) error {
+				var err error
+				if createdGroup, err = tx.GroupRepo.AddGroup(group); err != nil {
+					return err
+				}
+				return tx.recordChange(requestInfo, GROUP_ACTION_CREATE_GROUP, createdGroup.Urn, nil, createdGroup)
+			})
 
 			// Check if there is an unexpected error in DB
 			if err != nil {
-				//Transform to DB error
-				dbError := err.(*database.Error)
-				return nil, &Error{
-					Code:    UNKNOWN_API_ERROR,
-					Message: dbError.Message,
-				}
+				return nil, err
 			}
 			LogOperation(api.Logger, requestInfo, fmt.Sprintf("Group created %+v", createdGroup))
 			return createdGroup, nil
@@ -303,18 +305,19 @@ func (api AuthAPI) UpdateGroup(requestInfo RequestInfo, org string, name string,
 		UpdateAt: time.Now().UTC(),
 	}
 
-	updatedGroup, err := api.GroupRepo.UpdateGroup(group)
+	var updatedGroup *Group
+	err = api.transaction(func(tx AuthAPI) error {
+		var err error
+		if updatedGroup, err = tx.GroupRepo.UpdateGroup(group); err != nil {
+			return err
+		}
+		return tx.recordChange(requestInfo, GROUP_ACTION_UPDATE_GROUP, updatedGroup.Urn, oldGroup, updatedGroup)
+	})
 
 	// Check unexpected DB error
 	if err != nil {
-		//Transform to DB error
-		dbError := err.(*database.Error)
-		return nil, &Error{
-			Code:    UNKNOWN_API_ERROR,
-			Message: dbError.Message,
-		}
+		return nil, err
 	}
-
 	LogOperation(api.Logger, requestInfo, fmt.Sprintf("Group updated from %+v to %+v", oldGroup, updatedGroup))
 	return updatedGroup, nil
 
@@ -342,18 +345,19 @@ func (api AuthAPI) RemoveGroup(requestInfo RequestInfo, org string, name string)
 	}
 
 	// Remove group with given org and name
-	err = api.GroupRepo.RemoveGroup(group.ID)
+	err = api.transaction(func(tx AuthAPI) error {
+		if err := tx.GroupRepo.RemoveGroup(group.ID); err != nil {
+			return err
+		}
+		return tx.recordChange(requestInfo, GROUP_ACTION_DELETE_GROUP, group.Urn, group, nil)
+	})
 
 	// Error handling
 	if err != nil {
-		//Transform to DB error
-		dbError := err.(*database.Error)
-		return &Error{
-			Code:    UNKNOWN_API_ERROR,
-			Message: dbError.Message,
-		}
+		return err
 	}
 
+	api.Cache.Purge()
 	LogOperation(api.Logger, requestInfo, fmt.Sprintf("Group deleted %+v", group))
 	return nil
 }
@@ -405,17 +409,19 @@ func (api AuthAPI) AddMember(requestInfo RequestInfo, externalId string, name st
 	}
 
 	// Add Member
-	err = api.GroupRepo.AddMember(userDB.ID, groupDB.ID)
+	err = api.transaction(func(tx AuthAPI) error {
+		if err := tx.GroupRepo.AddMember(userDB.ID, groupDB.ID); err != nil {
+			return err
+		}
+		return tx.recordChange(requestInfo, GROUP_ACTION_ADD_MEMBER, groupDB.Urn, nil, auditRelation{Group: groupDB.Urn, User: userDB.Urn})
+	})
 
 	// Check if there is an unexpected error in DB
 	if err != nil {
-		//Transform to DB error
-		dbError := err.(*database.Error)
-		return &Error{
-			Code:    UNKNOWN_API_ERROR,
-			Message: dbError.Message,
-		}
+		return err
 	}
+	api.Cache.Invalidate(userDB.ExternalID)
+	api.Provisioning.forget(userDB.ExternalID)
 	LogOperation(api.Logger, requestInfo, fmt.Sprintf("Member %+v added to group %+v", userDB, groupDB))
 	return nil
 }
@@ -467,18 +473,20 @@ func (api AuthAPI) RemoveMember(requestInfo RequestInfo, externalId string, name
 	}
 
 	// Remove Member
-	err = api.GroupRepo.RemoveMember(userDB.ID, groupDB.ID)
+	err = api.transaction(func(tx AuthAPI) error {
+		if err := tx.GroupRepo.RemoveMember(userDB.ID, groupDB.ID); err != nil {
+			return err
+		}
+		return tx.recordChange(requestInfo, GROUP_ACTION_REMOVE_MEMBER, groupDB.Urn, auditRelation{Group: groupDB.Urn, User: userDB.Urn}, nil)
+	})
 
 	// Check if there is an unexpected error in DB
 	if err != nil {
-		//Transform to DB error
-		dbError := err.(*database.Error)
-		return &Error{
-			Code:    UNKNOWN_API_ERROR,
-			Message: dbError.Message,
-		}
+		return err
 	}
 
+	api.Cache.Invalidate(userDB.ExternalID)
+	api.Provisioning.forget(userDB.ExternalID)
 	LogOperation(api.Logger, requestInfo, fmt.Sprintf("Member %+v removed from group %+v", userDB, groupDB))
 	return nil
 }
@@ -584,16 +592,18 @@ func (api AuthAPI) AttachPolicyToGroup(requestInfo RequestInfo, org string, name
 	}
 
 	// Attach Policy to Group
-	err = api.GroupRepo.AttachPolicy(group.ID, policy.ID)
+	err = api.transaction(func(tx AuthAPI) error {
+		if err := tx.GroupRepo.AttachPolicy(group.ID, policy.ID); err != nil {
+			return err
+		}
+		return tx.recordChange(requestInfo, GROUP_ACTION_ATTACH_GROUP_POLICY, group.Urn, nil, auditRelation{Group: group.Urn, Policy: policy.Urn})
+	})
 
 	if err != nil {
-		dbError := err.(*database.Error)
-		return &Error{
-			Code:    UNKNOWN_API_ERROR,
-			Message: dbError.Message,
-		}
+		return err
 	}
 
+	api.Cache.Purge()
 	LogOperation(api.Logger, requestInfo, fmt.Sprintf("Policy %+v attached to group %+v", policy, group))
 	return nil
 }
@@ -645,16 +655,18 @@ func (api AuthAPI) DetachPolicyToGroup(requestInfo RequestInfo, org string, name
 	}
 
 	// Detach Policy to Group
-	err = api.GroupRepo.DetachPolicy(group.ID, policy.ID)
+	err = api.transaction(func(tx AuthAPI) error {
+		if err := tx.GroupRepo.DetachPolicy(group.ID, policy.ID); err != nil {
+			return err
+		}
+		return tx.recordChange(requestInfo, GROUP_ACTION_DETACH_GROUP_POLICY, group.Urn, auditRelation{Group: group.Urn, Policy: policy.Urn}, nil)
+	})
 
 	if err != nil {
-		dbError := err.(*database.Error)
-		return &Error{
-			Code:    UNKNOWN_API_ERROR,
-			Message: dbError.Message,
-		}
+		return err
 	}
 
+	api.Cache.Purge()
 	LogOperation(api.Logger, requestInfo, fmt.Sprintf("Policy %+v detached from group %+v", policy, group))
 	return nil
 }
@@ -33,7 +33,20 @@ type AuthAPI struct {
 	UserRepo   UserRepo
 	GroupRepo  GroupRepo
 	PolicyRepo PolicyRepo
-	Logger     *log.Logger
+	// Repository of service accounts that authenticate with API keys
+	ServiceAccountRepo ServiceAccountRepo
+	Logger             *log.Logger
+	// Optional cache of policies attached to users
+	Cache *PolicyCache
+	// Optional repository to record changes
+	AuditRepo AuditRepo
+	// Optional repository to store events until they are delivered to sinks
+	EventRepo  EventRepo
+	EventSinks []EventSink
+	// Optional just-in-time provisioning of authenticated users
+	Provisioning *Provisioning
+	// Repository to store changes with their audit events and events in transactions
+	TxRepo TxRepo
 }
 
 // Filter properties for database search
@@ -169,6 +182,59 @@ type AuthzAPI interface {
 	// Retrieve list of authorized external resources filtered according to the input parameters. Throw error
 	// if requestInfo doesn't exist, requestInfo doesn't have access to any resources or unexpected error happen.
 	GetAuthorizedExternalResources(requestInfo RequestInfo, action string, resources []string) ([]string, error)
+
+	// Retrieve for each action and resource pair of the checks if it's authorized, retrieving the policies of the
+	// user once. Throw error if requestInfo doesn't exist, input parameters are invalid or unexpected error happen.
+	GetAuthorizedExternalResourcesBatch(requestInfo RequestInfo, checks []AuthorizationCheck) ([]AuthorizationResult, error)
+
+	// Retrieve the groups, policies, statements and restrictions used to decide if the user with
+	// externalId has the action granted over the resources. Throw error if requestInfo isn't an admin,
+	// input parameters are invalid, user doesn't exist or unexpected error happen.
+	ExplainAuthorizedExternalResources(requestInfo RequestInfo, externalId string, action string, resources []string,
+		context map[string]string) (*AuthorizationExplanation, error)
+
+	// Retrieve the decision taken for each action and resource pair evaluating the draft statements together
+	// with the policies attached to the user and groups specified, without storing anything. Throw error if
+	// requestInfo isn't an admin, input parameters are invalid, user or groups don't exist or unexpected error happen.
+	SimulatePolicy(requestInfo RequestInfo, simulation PolicySimulation) ([]SimulationResult, error)
+
+	// Retrieve statistics of the cache used for authorization. Throw error if requester isn't an admin user.
+	GetCacheStats(requestInfo RequestInfo) (*CacheStats, error)
+}
+
+type AuditAPI interface {
+	// Retrieve audit events filtered by actor, resource urn, action and date range, most recent first.
+	// Throw error if requestInfo isn't an admin, filter is invalid or unexpected error happen.
+	ListAuditEvents(requestInfo RequestInfo, filter *AuditFilter) ([]AuditEvent, int, error)
+}
+
+type ServiceAccountAPI interface {
+	// Store service account for the user with externalId, returning it with its API key. Throw error if
+	// requestInfo isn't an admin, parameters are invalid, user doesn't exist, service account already
+	// exists or unexpected error happen.
+	AddServiceAccount(requestInfo RequestInfo, name string, externalId string) (*ServiceAccount, string, error)
+
+	// Retrieve service account from database. Throw error if requestInfo isn't an admin, name is invalid,
+	// service account doesn't exist or unexpected error happen.
+	GetServiceAccountByName(requestInfo RequestInfo, name string) (*ServiceAccount, error)
+
+	// Retrieve service account names filtered by externalId optional parameter. Throw error if requestInfo
+	// isn't an admin, filter is invalid or unexpected error happen.
+	ListServiceAccounts(requestInfo RequestInfo, filter *Filter) ([]string, int, error)
+
+	// Remove service account stored in database. Throw error if requestInfo isn't an admin, name is invalid,
+	// service account doesn't exist or unexpected error happen.
+	RemoveServiceAccount(requestInfo RequestInfo, name string) error
+
+	// Retrieve service account of the API key. Throw error if key isn't valid or unexpected error happen.
+	AuthenticateServiceAccount(key string) (*ServiceAccount, error)
+}
+
+type ProvisioningAPI interface {
+	// Create the authenticated user of requestInfo if it doesn't exist, and sync its members of mapped groups
+	// with the groups claim of request context. Nothing is done for admin users or without provisioning configured.
+	// Throw error if identifier is invalid or unexpected error happen.
+	ProvisionUser(requestInfo RequestInfo) error
 }
 
 // REPOSITORY INTERFACES
@@ -189,7 +255,7 @@ type UserRepo interface {
 	// are not satisfied or unexpected error happen.
 	UpdateUser(user User) (*User, error)
 
-	// Remove user stored in database with its group relationships.
+	// Remove user stored in database with its group relationships and service accounts.
 	// Throw error if there are problems during transactions.
 	RemoveUser(id string) error
 
@@ -278,6 +344,79 @@ type PolicyRepo interface {
 	// Retrieve groups that are attached to the policy. Throw error if there are problems with database.
 	GetAttachedGroups(policyID string, filter *Filter) ([]PolicyGroupRelation, int, error)
 
+	// Retrieve statements of the policies attached to the groups of the user, only the ones that contain
+	// the action if it isn't empty. Throw error if there are problems with database.
+	GetEffectiveStatementsByUser(userID string, action string) ([]Statement, error)
+
 	// OrderByValidColumns returns valid columns that you can use in OrderBy
 	OrderByValidColumns(action string) []string
 }
+
+// ServiceAccountRepo contains all database operations
+type ServiceAccountRepo interface {
+	// Store service account in database if there aren't errors.
+	AddServiceAccount(serviceAccount ServiceAccount) (*ServiceAccount, error)
+
+	// Retrieve service account from database if it exists. Otherwise it throws an error.
+	GetServiceAccountByName(name string) (*ServiceAccount, error)
+
+	// Retrieve service account with the API key hash if it exists. Otherwise it throws an error.
+	GetServiceAccountByKeyHash(keyHash string) (*ServiceAccount, error)
+
+	// Retrieve service accounts from database filtered by externalId optional parameter. Throw error
+	// if there are problems with database.
+	GetServiceAccountsFiltered(filter *Filter) ([]ServiceAccount, int, error)
+
+	// Remove service account stored in database. Service accounts of a user are removed with it too.
+	// Throw error if there are problems with database.
+	RemoveServiceAccount(id string) error
+
+	// OrderByValidColumns returns valid columns that you can use in OrderBy
+	OrderByValidColumns(action string) []string
+}
+
+// AuditRepo contains all database operations
+type AuditRepo interface {
+	// Store audit event in database. Throw error if there are problems with database.
+	AddAuditEvent(event AuditEvent) error
+
+	// Retrieve audit events from database filtered by actor, urn, action and date range optional
+	// parameters, most recent first. Throw error if there are problems with database.
+	GetAuditEventsFiltered(filter *AuditFilter) ([]AuditEvent, int, error)
+}
+
+// EventRepo contains all database operations
+type EventRepo interface {
+	// Store entries in outbox. Throw error if there are problems with database.
+	AddOutboxEntries(entries []OutboxEntry) error
+
+	// Retrieve entries with next attempt before or at the date specified, ordered by next attempt date,
+	// up to limit entries. Throw error if there are problems with database.
+	GetPendingOutboxEntries(until time.Time, limit int) ([]OutboxEntry, error)
+
+	// Update attempts, next attempt date and last error of an entry. Throw error if entry doesn't
+	// exist or there are problems with database.
+	UpdateOutboxEntry(entry OutboxEntry) error
+
+	// Remove an entry delivered or discarded. Throw error if entry doesn't exist or there are
+	// problems with database.
+	RemoveOutboxEntry(eventID string, sink string) error
+}
+
+// TxRepo contains the database operation to make changes in transactions
+type TxRepo interface {
+	// Call change with repositories that make changes in the same transaction. Transaction is committed
+	// if change doesn't return an error and rolled back otherwise. Throw the error returned by change
+	// or an error if there are problems with database.
+	Transaction(change func(repos Repos) error) error
+}
+
+// Repos contains the repositories of a transaction
+type Repos struct {
+	UserRepo           UserRepo
+	GroupRepo          GroupRepo
+	PolicyRepo         PolicyRepo
+	ServiceAccountRepo ServiceAccountRepo
+	AuditRepo          AuditRepo
+	EventRepo          EventRepo
+}
@@ -38,9 +38,10 @@ type PolicyIdentity struct {
 }
 
 type Statement struct {
-	Effect    string   `json:"effect, omitempty"`
-	Actions   []string `json:"actions, omitempty"`
-	Resources []string `json:"resources, omitempty"`
+	Effect     string     `json:"effect, omitempty"`
+	Actions    []string   `json:"actions, omitempty"`
+	Resources  []string   `json:"resources, omitempty"`
+	Conditions Conditions `json:"conditions,omitempty"`
 }
 
 type PolicyGroups struct {
@@ -49,6 +50,9 @@ type PolicyGroups struct {
 }
 
 func (s Statement) String() string {
+	if len(s.Conditions) > 0 {
+		return fmt.Sprintf("[effect: %v, actions: %v, resources: %v, conditions: %v]", s.Effect, s.Actions, s.Resources, s.Conditions)
+	}
 	return fmt.Sprintf("[effect: %v, actions: %v, resources: %v]", s.Effect, s.Actions, s.Resources)
 }
 
@@ -111,18 +115,19 @@ func (api AuthAPI) AddPolicy(requestInfo RequestInfo, name string, path string,
 		// Policy doesn't exist in DB
 		case database.POLICY_NOT_FOUND:
 			// Create policy
-			createdPolicy, err := api.PolicyRepo.AddPolicy(policy)
+			var createdPolicy *Policy
+			err := api.transaction(func(tx AuthAPI) error {
+				var err error
+				if createdPolicy, err = tx.PolicyRepo.AddPolicy(policy); err != nil {
+					return err
+				}
+				return tx.recordChange(requestInfo, POLICY_ACTION_CREATE_POLICY, createdPolicy.Urn, nil, createdPolicy)
+			})
 
 			// Check if there is an unexpected error in DB
 			if err != nil {
-				//Transform to DB error
-				dbError := err.(*database.Error)
-				return nil, &Error{
-					Code:    UNKNOWN_API_ERROR,
-					Message: dbError.Message,
-				}
+				return nil, err
 			}
-
 			LogOperation(api.Logger, requestInfo, fmt.Sprintf("Policy created %+v", createdPolicy))
 			return createdPolicy, nil
 		default: // Unexpected error
@@ -328,18 +333,21 @@ func (api AuthAPI) UpdatePolicy(requestInfo RequestInfo, org string, policyName
 	}
 
 	// Update policy
-	updatedPolicy, err := api.PolicyRepo.UpdatePolicy(policy)
+	var updatedPolicy *Policy
+	err = api.transaction(func(tx AuthAPI) error {
+		var err error
+		if updatedPolicy, err = tx.PolicyRepo.UpdatePolicy(policy); err != nil {
+			return err
+		}
+		return tx.recordChange(requestInfo, POLICY_ACTION_UPDATE_POLICY, updatedPolicy.Urn, oldPolicy, updatedPolicy)
+	})
 
 	// Check unexpected DB error
 	if err != nil {
-		//Transform to DB error
-		dbError := err.(*database.Error)
-		return nil, &Error{
-			Code:    UNKNOWN_API_ERROR,
-			Message: dbError.Message,
-		}
+		return nil, err
 	}
 
+	api.Cache.Purge()
 	LogOperation(api.Logger, requestInfo, fmt.Sprintf("Policy updated from %+v to %+v", oldPolicy, updatedPolicy))
 	return updatedPolicy, nil
 }
@@ -365,16 +373,17 @@ func (api AuthAPI) RemovePolicy(requestInfo RequestInfo, org string, name string
 		}
 	}
 
-	err = api.PolicyRepo.RemovePolicy(policy.ID)
-	if err != nil {
-		//Transform to DB error
-		dbError := err.(*database.Error)
-		return &Error{
-			Code:    UNKNOWN_API_ERROR,
-			Message: dbError.Message,
+	err = api.transaction(func(tx AuthAPI) error {
+		if err := tx.PolicyRepo.RemovePolicy(policy.ID); err != nil {
+			return err
 		}
+		return tx.recordChange(requestInfo, POLICY_ACTION_DELETE_POLICY, policy.Urn, policy, nil)
+	})
+	if err != nil {
+		return err
 	}
 
+	api.Cache.Purge()
 	LogOperation(api.Logger, requestInfo, fmt.Sprintf("Policy deleted %+v", policy))
 	return nil
 }
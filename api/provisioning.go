@@ -0,0 +1,256 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Tecsisa/foulkon/database"
+)
+
+// TYPE DEFINITIONS
+
+// Provisioning configures just-in-time creation of authenticated users that don't exist, and the sync
+// of their memberships with the groups claim. Only groups of the mapping are synced, so members added
+// to them with the API are removed if the claim doesn't have them, and other groups aren't changed.
+// Provisioned users are remembered with their groups claim, so they aren't retrieved from database
+// again until the claim changes or the time to live expires.
+type Provisioning struct {
+	// Path of created users
+	Path string
+	// Claim with the groups of the user, in request context. Groups aren't synced if empty
+	GroupsClaim string
+	// Groups by claim value
+	Groups map[string]GroupIdentity
+	// Maximum number of provisioned users remembered and time to live, users are checked in every
+	// request if any of them is 0
+	CacheSize int
+	CacheTTL  time.Duration
+
+	mutex       sync.Mutex
+	provisioned map[string]provisionedUser
+	// Current time, replaced in tests
+	now func() time.Time
+}
+
+// Groups claim of a provisioned user
+type provisionedUser struct {
+	claim    string
+	synced   bool
+	expireAt time.Time
+}
+
+// PROVISIONING API IMPLEMENTATION
+
+func (api AuthAPI) ProvisionUser(requestInfo RequestInfo) error {
+	if api.Provisioning == nil || requestInfo.Admin {
+		return nil
+	}
+	if !IsValidUserExternalID(requestInfo.Identifier) {
+		return &Error{
+			Code:    INVALID_PARAMETER_ERROR,
+			Message: fmt.Sprintf("Invalid parameter: externalId %v", requestInfo.Identifier),
+		}
+	}
+
+	claim, ok := requestInfo.Context[CONTEXT_KEY_CLAIM_PREFIX+api.Provisioning.GroupsClaim]
+	hasClaim := api.Provisioning.GroupsClaim != "" && ok
+	if api.Provisioning.isProvisioned(requestInfo.Identifier, claim, hasClaim) {
+		return nil
+	}
+
+	user, err := api.UserRepo.GetUserByExternalID(requestInfo.Identifier)
+	if err != nil {
+		//Transform to DB error
+		dbError := err.(*database.Error)
+		if dbError.Code != database.USER_NOT_FOUND {
+			return &Error{
+				Code:    UNKNOWN_API_ERROR,
+				Message: dbError.Message,
+			}
+		}
+		newUser := createUser(requestInfo.Identifier, api.Provisioning.Path)
+		err = api.transaction(func(tx AuthAPI) error {
+			var err error
+			if user, err = tx.UserRepo.AddUser(newUser); err != nil {
+				return err
+			}
+			return tx.recordChange(requestInfo, USER_ACTION_CREATE_USER, user.Urn, nil, user)
+		})
+		if err == nil {
+			LogOperation(api.Logger, requestInfo, fmt.Sprintf("User provisioned %+v", user))
+		} else if user, err = api.UserRepo.GetUserByExternalID(requestInfo.Identifier); err != nil {
+			// Only another request provisioning the same user can create it in the meantime
+			//Transform to DB error
+			dbError := err.(*database.Error)
+			return &Error{
+				Code:    UNKNOWN_API_ERROR,
+				Message: dbError.Message,
+			}
+		}
+	}
+
+	if hasClaim {
+		if err := api.syncGroups(requestInfo, user, claim); err != nil {
+			return err
+		}
+	}
+	api.Provisioning.setProvisioned(requestInfo.Identifier, claim, hasClaim)
+	return nil
+}
+
+// PRIVATE HELPER METHODS
+
+// Returns true if the user was provisioned with the same groups claim and it hasn't expired
+func (p *Provisioning) isProvisioned(externalID string, claim string, synced bool) bool {
+	if p.CacheSize < 1 || p.CacheTTL <= 0 {
+		return false
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	entry, ok := p.provisioned[externalID]
+	if !ok {
+		return false
+	}
+	if p.currentTime().After(entry.expireAt) {
+		delete(p.provisioned, externalID)
+		return false
+	}
+	return entry.claim == claim && entry.synced == synced
+}
+
+// Remember the groups claim of a provisioned user. Expired users are removed when it is full,
+// and the user isn't remembered if it is still full.
+func (p *Provisioning) setProvisioned(externalID string, claim string, synced bool) {
+	if p.CacheSize < 1 || p.CacheTTL <= 0 {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := p.currentTime()
+	if p.provisioned == nil {
+		p.provisioned = map[string]provisionedUser{}
+	}
+	if _, ok := p.provisioned[externalID]; !ok && len(p.provisioned) >= p.CacheSize {
+		for id, entry := range p.provisioned {
+			if now.After(entry.expireAt) {
+				delete(p.provisioned, id)
+			}
+		}
+		if len(p.provisioned) >= p.CacheSize {
+			return
+		}
+	}
+	p.provisioned[externalID] = provisionedUser{
+		claim:    claim,
+		synced:   synced,
+		expireAt: now.Add(p.CacheTTL),
+	}
+}
+
+// Forget a provisioned user, so it is checked again in its next request. Used when the user
+// or its memberships are changed with the API.
+func (p *Provisioning) forget(externalID string) {
+	if p == nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	delete(p.provisioned, externalID)
+}
+
+func (p *Provisioning) currentTime() time.Time {
+	if p.now == nil {
+		return time.Now()
+	}
+	return p.now()
+}
+
+// Add user to groups of the claim values and remove it from the other groups of the mapping
+func (api AuthAPI) syncGroups(requestInfo RequestInfo, user *User, claim string) error {
+	claimed := map[string]bool{}
+	for _, value := range strings.Split(claim, ",") {
+		claimed[value] = true
+	}
+	wanted := map[GroupIdentity]bool{}
+	for value, group := range api.Provisioning.Groups {
+		wanted[group] = wanted[group] || claimed[value]
+	}
+
+	userGroups, _, err := api.UserRepo.GetGroupsByUserID(user.ID, &Filter{})
+	if err != nil {
+		//Transform to DB error
+		dbError := err.(*database.Error)
+		return &Error{
+			Code:    UNKNOWN_API_ERROR,
+			Message: dbError.Message,
+		}
+	}
+	members := map[GroupIdentity]bool{}
+	for _, ug := range userGroups {
+		g := ug.GetGroup()
+		members[GroupIdentity{Org: g.Org, Name: g.Name}] = true
+	}
+
+	// Sorted to make changes in the same order
+	groups := []GroupIdentity{}
+	for group, want := range wanted {
+		if want != members[group] {
+			groups = append(groups, group)
+		}
+	}
+	sort.Sort(groupIdentities(groups))
+
+	for _, group := range groups {
+		groupDB, err := api.GroupRepo.GetGroupByName(group.Org, group.Name)
+		if err != nil {
+			//Transform to DB error
+			dbError := err.(*database.Error)
+			if dbError.Code == database.GROUP_NOT_FOUND {
+				api.Logger.Warnf("Group %v/%v of provisioning mapping not found", group.Org, group.Name)
+				continue
+			}
+			return &Error{
+				Code:    UNKNOWN_API_ERROR,
+				Message: dbError.Message,
+			}
+		}
+
+		relation := auditRelation{Group: groupDB.Urn, User: user.Urn}
+		err = api.transaction(func(tx AuthAPI) error {
+			if wanted[group] {
+				if err := tx.GroupRepo.AddMember(user.ID, groupDB.ID); err != nil {
+					return err
+				}
+				return tx.recordChange(requestInfo, GROUP_ACTION_ADD_MEMBER, groupDB.Urn, nil, relation)
+			}
+			if err := tx.GroupRepo.RemoveMember(user.ID, groupDB.ID); err != nil {
+				return err
+			}
+			return tx.recordChange(requestInfo, GROUP_ACTION_REMOVE_MEMBER, groupDB.Urn, relation, nil)
+		})
+		if err != nil {
+			return err
+		}
+		api.Cache.Invalidate(user.ExternalID)
+		if wanted[group] {
+			LogOperation(api.Logger, requestInfo, fmt.Sprintf("Provisioned member %+v added to group %+v", user, groupDB))
+		} else {
+			LogOperation(api.Logger, requestInfo, fmt.Sprintf("Provisioned member %+v removed from group %+v", user, groupDB))
+		}
+	}
+	return nil
+}
+
+type groupIdentities []GroupIdentity
+
+func (g groupIdentities) Len() int      { return len(g) }
+func (g groupIdentities) Swap(i, j int) { g[i], g[j] = g[j], g[i] }
+func (g groupIdentities) Less(i, j int) bool {
+	return g[i].Org < g[j].Org || (g[i].Org == g[j].Org && g[i].Name < g[j].Name)
+}
@@ -0,0 +1,337 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Tecsisa/foulkon/database"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestAuthAPI_ProvisionUser(t *testing.T) {
+	provisioning := &Provisioning{
+		Path:        "/sso/",
+		GroupsClaim: "groups",
+		Groups: map[string]GroupIdentity{
+			"admins":     {Org: "example", Name: "admins"},
+			"developers": {Org: "example", Name: "devs"},
+			"engineers":  {Org: "example", Name: "devs"},
+			"ops":        {Org: "example", Name: "ops"},
+		},
+	}
+	user := &User{
+		ID:         "UserID",
+		ExternalID: "user1",
+		Path:       "/sso/",
+		Urn:        CreateUrn("", RESOURCE_USER, "/sso/", "user1"),
+	}
+	userNotFoundErr := &database.Error{
+		Code:    database.USER_NOT_FOUND,
+		Message: "User not found",
+	}
+	testcases := map[string]struct {
+		// API method args
+		requestInfo  RequestInfo
+		provisioning *Provisioning
+		// Expected result
+		expectedUser   *User
+		expectedAdd    []interface{}
+		expectedRemove []interface{}
+		wantError      error
+		// Manager Results
+		getUserByExternalIDResult *User
+		getGroupsByUserIDResult   []TestUserGroupRelation
+		// Manager Errors
+		getUserByExternalIDErr      error
+		getUserByExternalIDRetryErr error
+		addUserErr                  error
+		getGroupsByUserIDErr        error
+		addMemberErr                error
+	}{
+		"OkCaseUserCreated": {
+			requestInfo: RequestInfo{
+				Identifier: "user1",
+			},
+			provisioning:           provisioning,
+			expectedUser:           user,
+			getUserByExternalIDErr: userNotFoundErr,
+		},
+		"OkCaseUserCreatedWithGroups": {
+			requestInfo: RequestInfo{
+				Identifier: "user1",
+				Context: map[string]string{
+					CONTEXT_KEY_CLAIM_PREFIX + "groups": ",admins,engineers,unmapped,",
+				},
+			},
+			provisioning:           provisioning,
+			expectedUser:           user,
+			expectedAdd:            []interface{}{"UserID", "example/devs"},
+			getUserByExternalIDErr: userNotFoundErr,
+		},
+		"OkCaseUserCreatedByAnotherRequest": {
+			requestInfo: RequestInfo{
+				Identifier: "user1",
+			},
+			provisioning:           provisioning,
+			expectedUser:           user,
+			getUserByExternalIDErr: userNotFoundErr,
+			addUserErr: &database.Error{
+				Code:    database.INTERNAL_ERROR,
+				Message: "Error",
+			},
+		},
+		"OkCaseGroupsSynced": {
+			requestInfo: RequestInfo{
+				Identifier: "user1",
+				Context: map[string]string{
+					CONTEXT_KEY_CLAIM_PREFIX + "groups": "admins",
+				},
+			},
+			provisioning:              provisioning,
+			expectedAdd:               []interface{}{"UserID", "example/admins"},
+			expectedRemove:            []interface{}{"UserID", "example/ops"},
+			getUserByExternalIDResult: user,
+			getGroupsByUserIDResult: []TestUserGroupRelation{
+				{Group: &Group{ID: "example/ops", Org: "example", Name: "ops"}},
+				{Group: &Group{ID: "example/other", Org: "example", Name: "other"}},
+			},
+		},
+		"OkCaseGroupsClaimNotFound": {
+			requestInfo: RequestInfo{
+				Identifier: "user1",
+			},
+			provisioning:              provisioning,
+			getUserByExternalIDResult: user,
+			getGroupsByUserIDResult: []TestUserGroupRelation{
+				{Group: &Group{ID: "example/ops", Org: "example", Name: "ops"}},
+			},
+		},
+		"OkCaseWithoutProvisioning": {
+			requestInfo: RequestInfo{
+				Identifier: "user1",
+			},
+			getUserByExternalIDErr: userNotFoundErr,
+		},
+		"OkCaseAdmin": {
+			requestInfo: RequestInfo{
+				Identifier: "admin",
+				Admin:      true,
+			},
+			provisioning:           provisioning,
+			getUserByExternalIDErr: userNotFoundErr,
+		},
+		"ErrorCaseInvalidExternalID": {
+			requestInfo: RequestInfo{
+				Identifier: "*%~#@|",
+			},
+			provisioning: provisioning,
+			wantError: &Error{
+				Code:    INVALID_PARAMETER_ERROR,
+				Message: "Invalid parameter: externalId *%~#@|",
+			},
+		},
+		"ErrorCaseGetUserDBErr": {
+			requestInfo: RequestInfo{
+				Identifier: "user1",
+			},
+			provisioning: provisioning,
+			wantError: &Error{
+				Code:    UNKNOWN_API_ERROR,
+				Message: "Error",
+			},
+			getUserByExternalIDErr: &database.Error{
+				Code:    database.INTERNAL_ERROR,
+				Message: "Error",
+			},
+		},
+		"ErrorCaseAddUserDBErr": {
+			requestInfo: RequestInfo{
+				Identifier: "user1",
+			},
+			provisioning: provisioning,
+			wantError: &Error{
+				Code:    UNKNOWN_API_ERROR,
+				Message: "User not found",
+			},
+			getUserByExternalIDErr:      userNotFoundErr,
+			getUserByExternalIDRetryErr: userNotFoundErr,
+			addUserErr: &database.Error{
+				Code:    database.INTERNAL_ERROR,
+				Message: "Error",
+			},
+		},
+		"ErrorCaseGetGroupsByUserDBErr": {
+			requestInfo: RequestInfo{
+				Identifier: "user1",
+				Context: map[string]string{
+					CONTEXT_KEY_CLAIM_PREFIX + "groups": "admins",
+				},
+			},
+			provisioning: provisioning,
+			wantError: &Error{
+				Code:    UNKNOWN_API_ERROR,
+				Message: "Error",
+			},
+			getUserByExternalIDResult: user,
+			getGroupsByUserIDErr: &database.Error{
+				Code:    database.INTERNAL_ERROR,
+				Message: "Error",
+			},
+		},
+		"ErrorCaseAddMemberDBErr": {
+			requestInfo: RequestInfo{
+				Identifier: "user1",
+				Context: map[string]string{
+					CONTEXT_KEY_CLAIM_PREFIX + "groups": "admins",
+				},
+			},
+			provisioning: provisioning,
+			expectedAdd:  []interface{}{"UserID", "example/admins"},
+			wantError: &Error{
+				Code:    UNKNOWN_API_ERROR,
+				Message: "Error",
+			},
+			getUserByExternalIDResult: user,
+			addMemberErr: &database.Error{
+				Code:    database.INTERNAL_ERROR,
+				Message: "Error",
+			},
+		},
+	}
+
+	for n, test := range testcases {
+		testRepo := makeTestRepo()
+		testAPI := makeTestAPI(testRepo)
+		testAPI.Provisioning = test.provisioning
+
+		calls := 0
+		testRepo.SpecialFuncs[GetUserByExternalIDMethod] = func(id string) (*User, error) {
+			calls++
+			if calls == 1 {
+				return test.getUserByExternalIDResult, test.getUserByExternalIDErr
+			}
+			if test.getUserByExternalIDRetryErr != nil {
+				return nil, test.getUserByExternalIDRetryErr
+			}
+			return user, nil
+		}
+		testRepo.SpecialFuncs[GetGroupByNameMethod] = func(org string, name string) (*Group, error) {
+			if name == "ops" || name == "admins" || name == "devs" {
+				return &Group{ID: org + "/" + name, Org: org, Name: name}, nil
+			}
+			return nil, &database.Error{Code: database.GROUP_NOT_FOUND}
+		}
+		testRepo.ArgsOut[AddUserMethod][0] = user
+		testRepo.ArgsOut[AddUserMethod][1] = test.addUserErr
+		testRepo.ArgsOut[GetGroupsByUserIDMethod][0] = test.getGroupsByUserIDResult
+		testRepo.ArgsOut[GetGroupsByUserIDMethod][2] = test.getGroupsByUserIDErr
+		testRepo.ArgsOut[AddMemberMethod][0] = test.addMemberErr
+
+		err := testAPI.ProvisionUser(test.requestInfo)
+		if test.wantError != nil {
+			if diff := pretty.Compare(err, test.wantError); diff != "" {
+				t.Errorf("Test %v failed. Received different errors (received/wanted) %v", n, diff)
+				continue
+			}
+		} else if err != nil {
+			t.Errorf("Test %v failed: %v", n, err)
+			continue
+		}
+
+		// Check user created
+		if test.expectedUser != nil && test.addUserErr == nil {
+			created, ok := testRepo.ArgsIn[AddUserMethod][0].(User)
+			if !ok || created.ExternalID != test.expectedUser.ExternalID || created.Path != test.expectedUser.Path ||
+				created.Urn != test.expectedUser.Urn {
+				t.Errorf("Test %v failed. Received different user created %v", n, testRepo.ArgsIn[AddUserMethod][0])
+				continue
+			}
+		} else if test.addUserErr == nil && testRepo.ArgsIn[AddUserMethod][0] != nil {
+			t.Errorf("Test %v failed. Unexpected user created %v", n, testRepo.ArgsIn[AddUserMethod][0])
+			continue
+		}
+
+		// Check memberships synced
+		expectedAdd := test.expectedAdd
+		if expectedAdd == nil {
+			expectedAdd = []interface{}{nil, nil}
+		}
+		if diff := pretty.Compare(testRepo.ArgsIn[AddMemberMethod], expectedAdd); diff != "" {
+			t.Errorf("Test %v failed. Received different members added (received/wanted) %v", n, diff)
+			continue
+		}
+		expectedRemove := test.expectedRemove
+		if expectedRemove == nil {
+			expectedRemove = []interface{}{nil, nil}
+		}
+		if diff := pretty.Compare(testRepo.ArgsIn[RemoveMemberMethod], expectedRemove); diff != "" {
+			t.Errorf("Test %v failed. Received different members removed (received/wanted) %v", n, diff)
+			continue
+		}
+	}
+}
+
+func TestAuthAPI_ProvisionUserCache(t *testing.T) {
+	now := time.Now()
+	provisioning := &Provisioning{
+		Path:        "/sso/",
+		GroupsClaim: "groups",
+		Groups: map[string]GroupIdentity{
+			"admins": {Org: "example", Name: "admins"},
+		},
+		CacheSize: 1,
+		CacheTTL:  time.Minute,
+		now: func() time.Time {
+			return now
+		},
+	}
+	testRepo := makeTestRepo()
+	testAPI := makeTestAPI(testRepo)
+	testAPI.Provisioning = provisioning
+
+	calls := 0
+	testRepo.SpecialFuncs[GetUserByExternalIDMethod] = func(id string) (*User, error) {
+		calls++
+		return &User{ID: id, ExternalID: id}, nil
+	}
+	testRepo.ArgsOut[GetGroupsByUserIDMethod][0] = []TestUserGroupRelation{}
+	testRepo.ArgsOut[GetGroupByNameMethod][0] = &Group{ID: "GroupID", Org: "example", Name: "admins"}
+
+	// Steps run in order over the same cache
+	steps := []struct {
+		name        string
+		externalID  string
+		claim       string
+		elapsed     time.Duration
+		forget      bool
+		wantChecked bool
+	}{
+		{name: "FirstRequest", externalID: "user1", claim: "admins", wantChecked: true},
+		{name: "SameClaim", externalID: "user1", claim: "admins"},
+		{name: "ClaimChanged", externalID: "user1", claim: "", wantChecked: true},
+		{name: "SameClaimChanged", externalID: "user1", claim: ""},
+		{name: "Expired", externalID: "user1", claim: "", elapsed: 2 * time.Minute, wantChecked: true},
+		{name: "Forgotten", externalID: "user1", claim: "", forget: true, wantChecked: true},
+		{name: "CacheFull", externalID: "user2", claim: "", wantChecked: true},
+		{name: "NotRememberedWithCacheFull", externalID: "user2", claim: "", wantChecked: true},
+		{name: "RememberedUser", externalID: "user1", claim: ""},
+	}
+	for _, step := range steps {
+		now = now.Add(step.elapsed)
+		if step.forget {
+			provisioning.forget(step.externalID)
+		}
+		requestInfo := RequestInfo{
+			Identifier: step.externalID,
+			Context:    map[string]string{CONTEXT_KEY_CLAIM_PREFIX + "groups": step.claim},
+		}
+		previousCalls := calls
+		if err := testAPI.ProvisionUser(requestInfo); err != nil {
+			t.Errorf("Test %v failed: %v", step.name, err)
+			continue
+		}
+		if checked := calls > previousCalls; checked != step.wantChecked {
+			t.Errorf("Test %v failed. Received user checked %v, wanted %v", step.name, checked, step.wantChecked)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Tecsisa/foulkon/database"
+	"github.com/satori/go.uuid"
+)
+
+const (
+	// Prefix of API keys, to recognize them in configuration files and logs
+	API_KEY_PREFIX = "fk_"
+	// Random bytes of API keys
+	API_KEY_SIZE = 32
+	// Characters of the key shown to identify it, prefix included
+	API_KEY_VISIBLE_LENGTH = 11
+)
+
+// TYPE DEFINITIONS
+
+// ServiceAccount is a machine identity that authenticates with an API key as a foulkon user,
+// so the policies of the groups of the user apply to it. Only the hash of the key is stored.
+type ServiceAccount struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	ExternalID string `json:"externalId"`
+	// First characters of the key, to identify it
+	KeyPrefix string    `json:"keyPrefix"`
+	KeyHash   string    `json:"-"`
+	Urn       string    `json:"urn"`
+	CreateAt  time.Time `json:"createAt"`
+}
+
+func (sa ServiceAccount) String() string {
+	return fmt.Sprintf("[id: %v, name: %v, externalId: %v, keyPrefix: %v, urn: %v, createAt: %v]",
+		sa.ID, sa.Name, sa.ExternalID, sa.KeyPrefix, sa.Urn, sa.CreateAt.Format("2006-01-02 15:04:05 MST"))
+}
+
+func (sa ServiceAccount) GetUrn() string {
+	return sa.Urn
+}
+
+// SERVICE ACCOUNT API IMPLEMENTATION
+
+// AddServiceAccount creates a service account for the user with externalId, and returns it with its
+// API key, which can't be retrieved again. Only admin users are allowed to do it.
+func (api AuthAPI) AddServiceAccount(requestInfo RequestInfo, name string, externalId string) (*ServiceAccount, string, error) {
+	if err := checkServiceAccountAdmin(requestInfo); err != nil {
+		return nil, "", err
+	}
+
+	// Validate fields
+	if !IsValidName(name) {
+		return nil, "", &Error{
+			Code:    INVALID_PARAMETER_ERROR,
+			Message: fmt.Sprintf("Invalid parameter: name %v", name),
+		}
+	}
+	if !IsValidUserExternalID(externalId) {
+		return nil, "", &Error{
+			Code:    INVALID_PARAMETER_ERROR,
+			Message: fmt.Sprintf("Invalid parameter: externalId %v", externalId),
+		}
+	}
+
+	// Check that user exists
+	if _, err := api.UserRepo.GetUserByExternalID(externalId); err != nil {
+		//Transform to DB error
+		dbError := err.(*database.Error)
+		if dbError.Code == database.USER_NOT_FOUND {
+			return nil, "", &Error{
+				Code:    USER_BY_EXTERNAL_ID_NOT_FOUND,
+				Message: dbError.Message,
+			}
+		}
+		return nil, "", &Error{
+			Code:    UNKNOWN_API_ERROR,
+			Message: dbError.Message,
+		}
+	}
+
+	// Check if service account already exists
+	_, err := api.ServiceAccountRepo.GetServiceAccountByName(name)
+	if err == nil {
+		return nil, "", &Error{
+			Code:    SERVICE_ACCOUNT_ALREADY_EXIST,
+			Message: fmt.Sprintf("Unable to create service account, service account with name %v already exist", name),
+		}
+	}
+	if dbError := err.(*database.Error); dbError.Code != database.SERVICE_ACCOUNT_NOT_FOUND {
+		return nil, "", &Error{
+			Code:    UNKNOWN_API_ERROR,
+			Message: dbError.Message,
+		}
+	}
+
+	key, err := generateAPIKey()
+	if err != nil {
+		return nil, "", &Error{
+			Code:    UNKNOWN_API_ERROR,
+			Message: fmt.Sprintf("Error generating API key: %v", err),
+		}
+	}
+	serviceAccount := ServiceAccount{
+		ID:         uuid.NewV4().String(),
+		Name:       name,
+		ExternalID: externalId,
+		KeyPrefix:  key[:API_KEY_VISIBLE_LENGTH],
+		KeyHash:    getAPIKeyHash(key),
+		Urn:        CreateUrn("", RESOURCE_SERVICE_ACCOUNT, "/", name),
+		CreateAt:   time.Now().UTC(),
+	}
+
+	// Create service account
+	var created *ServiceAccount
+	err = api.transaction(func(tx AuthAPI) error {
+		var err error
+		if created, err = tx.ServiceAccountRepo.AddServiceAccount(serviceAccount); err != nil {
+			return err
+		}
+		return tx.recordChange(requestInfo, SERVICE_ACCOUNT_ACTION_CREATE_SERVICE_ACCOUNT, created.Urn, nil, created)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	LogOperation(api.Logger, requestInfo, fmt.Sprintf("Service account created %+v", created))
+	return created, key, nil
+}
+
+// GetServiceAccountByName returns a service account without its key. Only admin users are allowed to do it.
+func (api AuthAPI) GetServiceAccountByName(requestInfo RequestInfo, name string) (*ServiceAccount, error) {
+	if err := checkServiceAccountAdmin(requestInfo); err != nil {
+		return nil, err
+	}
+	if !IsValidName(name) {
+		return nil, &Error{
+			Code:    INVALID_PARAMETER_ERROR,
+			Message: fmt.Sprintf("Invalid parameter: name %v", name),
+		}
+	}
+
+	serviceAccount, err := api.ServiceAccountRepo.GetServiceAccountByName(name)
+
+	// Error handling
+	if err != nil {
+		//Transform to DB error
+		dbError := err.(*database.Error)
+		if dbError.Code == database.SERVICE_ACCOUNT_NOT_FOUND {
+			return nil, &Error{
+				Code:    SERVICE_ACCOUNT_BY_NAME_NOT_FOUND,
+				Message: dbError.Message,
+			}
+		}
+		return nil, &Error{
+			Code:    UNKNOWN_API_ERROR,
+			Message: dbError.Message,
+		}
+	}
+
+	return serviceAccount, nil
+}
+
+// ListServiceAccounts returns the names of service accounts, only the ones of the user if filter has
+// an externalId. Only admin users are allowed to do it.
+func (api AuthAPI) ListServiceAccounts(requestInfo RequestInfo, filter *Filter) ([]string, int, error) {
+	if err := checkServiceAccountAdmin(requestInfo); err != nil {
+		return nil, 0, err
+	}
+
+	// Check parameters
+	var total int
+	orderByValidColumns := api.ServiceAccountRepo.OrderByValidColumns(SERVICE_ACCOUNT_ACTION_LIST_SERVICE_ACCOUNTS)
+	err := validateFilter(filter, orderByValidColumns)
+	if err != nil {
+		return nil, total, err
+	}
+
+	serviceAccounts, total, err := api.ServiceAccountRepo.GetServiceAccountsFiltered(filter)
+
+	// Error handling
+	if err != nil {
+		//Transform to DB error
+		dbError := err.(*database.Error)
+		return nil, total, &Error{
+			Code:    UNKNOWN_API_ERROR,
+			Message: dbError.Message,
+		}
+	}
+
+	names := []string{}
+	for _, sa := range serviceAccounts {
+		names = append(names, sa.Name)
+	}
+
+	return names, total, nil
+}
+
+// RemoveServiceAccount removes a service account, so its key isn't valid anymore. Only admin users
+// are allowed to do it.
+func (api AuthAPI) RemoveServiceAccount(requestInfo RequestInfo, name string) error {
+	serviceAccount, err := api.GetServiceAccountByName(requestInfo, name)
+	if err != nil {
+		return err
+	}
+
+	err = api.transaction(func(tx AuthAPI) error {
+		if err := tx.ServiceAccountRepo.RemoveServiceAccount(serviceAccount.ID); err != nil {
+			return err
+		}
+		return tx.recordChange(requestInfo, SERVICE_ACCOUNT_ACTION_DELETE_SERVICE_ACCOUNT, serviceAccount.Urn, serviceAccount, nil)
+	})
+	if err != nil {
+		return err
+	}
+	LogOperation(api.Logger, requestInfo, fmt.Sprintf("Service account deleted %+v", serviceAccount))
+	return nil
+}
+
+// AuthenticateServiceAccount returns the service account of an API key. It is used by auth connectors
+// before the request is authenticated, so it doesn't need request info. Throw error if key isn't valid.
+func (api AuthAPI) AuthenticateServiceAccount(key string) (*ServiceAccount, error) {
+	if !strings.HasPrefix(key, API_KEY_PREFIX) {
+		return nil, &Error{
+			Code:    INVALID_API_KEY_ERROR,
+			Message: "Invalid API key",
+		}
+	}
+
+	serviceAccount, err := api.ServiceAccountRepo.GetServiceAccountByKeyHash(getAPIKeyHash(key))
+
+	// Error handling
+	if err != nil {
+		//Transform to DB error
+		dbError := err.(*database.Error)
+		if dbError.Code == database.SERVICE_ACCOUNT_NOT_FOUND {
+			return nil, &Error{
+				Code:    INVALID_API_KEY_ERROR,
+				Message: "Invalid API key",
+			}
+		}
+		return nil, &Error{
+			Code:    UNKNOWN_API_ERROR,
+			Message: dbError.Message,
+		}
+	}
+
+	return serviceAccount, nil
+}
+
+// PRIVATE HELPER METHODS
+
+func checkServiceAccountAdmin(requestInfo RequestInfo) error {
+	if !requestInfo.Admin {
+		return &Error{
+			Code:    UNAUTHORIZED_RESOURCES_ERROR,
+			Message: fmt.Sprintf("User with externalId %v is not allowed to access to service accounts", requestInfo.Identifier),
+		}
+	}
+	return nil
+}
+
+// Returns a random API key with the API key prefix
+func generateAPIKey() (string, error) {
+	b := make([]byte, API_KEY_SIZE)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return API_KEY_PREFIX + hex.EncodeToString(b), nil
+}
+
+// Returns the hex encoded SHA-256 of an API key. Keys are random, so they don't need a salted hash.
+func getAPIKeyHash(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,506 @@
+package api
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Tecsisa/foulkon/database"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestAuthAPI_AddServiceAccount(t *testing.T) {
+	adminRequestInfo := RequestInfo{
+		Identifier: "admin",
+		Admin:      true,
+	}
+	testcases := map[string]struct {
+		// API method args
+		requestInfo RequestInfo
+		name        string
+		externalID  string
+		// Expected result
+		expectedServiceAccount *ServiceAccount
+		wantError              error
+		// Manager Results
+		getUserByExternalIDResult     *User
+		getServiceAccountByNameResult *ServiceAccount
+		// Manager Errors
+		getUserByExternalIDErr     error
+		getServiceAccountByNameErr error
+		addServiceAccountErr       error
+	}{
+		"OkCase": {
+			requestInfo: adminRequestInfo,
+			name:        "serviceaccount1",
+			externalID:  "user1",
+			expectedServiceAccount: &ServiceAccount{
+				Name:       "serviceaccount1",
+				ExternalID: "user1",
+				Urn:        CreateUrn("", RESOURCE_SERVICE_ACCOUNT, "/", "serviceaccount1"),
+			},
+			getUserByExternalIDResult: &User{
+				ID:         "UserID",
+				ExternalID: "user1",
+			},
+			getServiceAccountByNameErr: &database.Error{
+				Code: database.SERVICE_ACCOUNT_NOT_FOUND,
+			},
+		},
+		"ErrorCaseNotAdmin": {
+			requestInfo: RequestInfo{
+				Identifier: "user1",
+			},
+			name:       "serviceaccount1",
+			externalID: "user1",
+			wantError: &Error{
+				Code:    UNAUTHORIZED_RESOURCES_ERROR,
+				Message: "User with externalId user1 is not allowed to access to service accounts",
+			},
+		},
+		"ErrorCaseInvalidName": {
+			requestInfo: adminRequestInfo,
+			name:        "*%~#@|",
+			externalID:  "user1",
+			wantError: &Error{
+				Code:    INVALID_PARAMETER_ERROR,
+				Message: "Invalid parameter: name *%~#@|",
+			},
+		},
+		"ErrorCaseInvalidExternalID": {
+			requestInfo: adminRequestInfo,
+			name:        "serviceaccount1",
+			externalID:  "*%~#@|",
+			wantError: &Error{
+				Code:    INVALID_PARAMETER_ERROR,
+				Message: "Invalid parameter: externalId *%~#@|",
+			},
+		},
+		"ErrorCaseUserNotFound": {
+			requestInfo: adminRequestInfo,
+			name:        "serviceaccount1",
+			externalID:  "user1",
+			wantError: &Error{
+				Code:    USER_BY_EXTERNAL_ID_NOT_FOUND,
+				Message: "User not found",
+			},
+			getUserByExternalIDErr: &database.Error{
+				Code:    database.USER_NOT_FOUND,
+				Message: "User not found",
+			},
+		},
+		"ErrorCaseServiceAccountAlreadyExist": {
+			requestInfo: adminRequestInfo,
+			name:        "serviceaccount1",
+			externalID:  "user1",
+			wantError: &Error{
+				Code:    SERVICE_ACCOUNT_ALREADY_EXIST,
+				Message: "Unable to create service account, service account with name serviceaccount1 already exist",
+			},
+			getUserByExternalIDResult: &User{
+				ID:         "UserID",
+				ExternalID: "user1",
+			},
+			getServiceAccountByNameResult: &ServiceAccount{
+				Name: "serviceaccount1",
+			},
+		},
+		"ErrorCaseAddServiceAccountDBErr": {
+			requestInfo: adminRequestInfo,
+			name:        "serviceaccount1",
+			externalID:  "user1",
+			wantError: &Error{
+				Code:    UNKNOWN_API_ERROR,
+				Message: "Error",
+			},
+			getUserByExternalIDResult: &User{
+				ID:         "UserID",
+				ExternalID: "user1",
+			},
+			getServiceAccountByNameErr: &database.Error{
+				Code: database.SERVICE_ACCOUNT_NOT_FOUND,
+			},
+			addServiceAccountErr: &database.Error{
+				Code:    database.INTERNAL_ERROR,
+				Message: "Error",
+			},
+		},
+	}
+
+	for n, test := range testcases {
+		testRepo := makeTestRepo()
+		testAPI := makeTestAPI(testRepo)
+		testRepo.ArgsOut[GetUserByExternalIDMethod][0] = test.getUserByExternalIDResult
+		testRepo.ArgsOut[GetUserByExternalIDMethod][1] = test.getUserByExternalIDErr
+		testRepo.ArgsOut[GetServiceAccountByNameMethod][0] = test.getServiceAccountByNameResult
+		testRepo.ArgsOut[GetServiceAccountByNameMethod][1] = test.getServiceAccountByNameErr
+		testRepo.ArgsOut[AddServiceAccountMethod][0] = test.expectedServiceAccount
+		testRepo.ArgsOut[AddServiceAccountMethod][1] = test.addServiceAccountErr
+
+		serviceAccount, key, err := testAPI.AddServiceAccount(test.requestInfo, test.name, test.externalID)
+		if test.wantError != nil {
+			checkMethodResponse(t, n, test.wantError, err, nil, nil)
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %v failed. Unexpected error: %v", n, err)
+			continue
+		}
+
+		// Check stored service account
+		stored := testRepo.ArgsIn[AddServiceAccountMethod][0].(ServiceAccount)
+		if stored.ID == "" || stored.CreateAt.IsZero() {
+			t.Errorf("Test %v failed. Expected id and creation date in service account %v", n, stored)
+		}
+		if !strings.HasPrefix(key, API_KEY_PREFIX) || len(key) != len(API_KEY_PREFIX)+2*API_KEY_SIZE {
+			t.Errorf("Test %v failed. Invalid API key %v", n, key)
+		}
+		if stored.KeyPrefix != key[:API_KEY_VISIBLE_LENGTH] || stored.KeyHash != getAPIKeyHash(key) {
+			t.Errorf("Test %v failed. Key prefix or hash doesn't match API key %v: %v", n, key, stored)
+		}
+		expected := *test.expectedServiceAccount
+		expected.ID = stored.ID
+		expected.KeyPrefix = stored.KeyPrefix
+		expected.KeyHash = stored.KeyHash
+		expected.CreateAt = stored.CreateAt
+		if diff := pretty.Compare(stored, expected); diff != "" {
+			t.Errorf("Test %v failed. Received different service accounts (received/wanted) %v", n, diff)
+		}
+		checkMethodResponse(t, n, nil, nil, test.expectedServiceAccount, serviceAccount)
+	}
+}
+
+func TestAuthAPI_GetServiceAccountByName(t *testing.T) {
+	now := time.Date(2016, time.October, 1, 10, 0, 0, 0, time.UTC)
+	serviceAccount := &ServiceAccount{
+		ID:         "ServiceAccountID",
+		Name:       "serviceaccount1",
+		ExternalID: "user1",
+		KeyPrefix:  "fk_01234567",
+		KeyHash:    "hash",
+		Urn:        CreateUrn("", RESOURCE_SERVICE_ACCOUNT, "/", "serviceaccount1"),
+		CreateAt:   now,
+	}
+	testcases := map[string]struct {
+		// API method args
+		requestInfo RequestInfo
+		name        string
+		// Expected result
+		expectedServiceAccount *ServiceAccount
+		wantError              error
+		// Manager Results
+		getServiceAccountByNameResult *ServiceAccount
+		// Manager Errors
+		getServiceAccountByNameErr error
+	}{
+		"OkCase": {
+			requestInfo: RequestInfo{
+				Identifier: "admin",
+				Admin:      true,
+			},
+			name:                          "serviceaccount1",
+			expectedServiceAccount:        serviceAccount,
+			getServiceAccountByNameResult: serviceAccount,
+		},
+		"ErrorCaseNotAdmin": {
+			requestInfo: RequestInfo{
+				Identifier: "user1",
+			},
+			name: "serviceaccount1",
+			wantError: &Error{
+				Code:    UNAUTHORIZED_RESOURCES_ERROR,
+				Message: "User with externalId user1 is not allowed to access to service accounts",
+			},
+		},
+		"ErrorCaseInvalidName": {
+			requestInfo: RequestInfo{
+				Identifier: "admin",
+				Admin:      true,
+			},
+			name: "*%~#@|",
+			wantError: &Error{
+				Code:    INVALID_PARAMETER_ERROR,
+				Message: "Invalid parameter: name *%~#@|",
+			},
+		},
+		"ErrorCaseServiceAccountNotFound": {
+			requestInfo: RequestInfo{
+				Identifier: "admin",
+				Admin:      true,
+			},
+			name: "serviceaccount1",
+			wantError: &Error{
+				Code:    SERVICE_ACCOUNT_BY_NAME_NOT_FOUND,
+				Message: "Service account not found",
+			},
+			getServiceAccountByNameErr: &database.Error{
+				Code:    database.SERVICE_ACCOUNT_NOT_FOUND,
+				Message: "Service account not found",
+			},
+		},
+		"ErrorCaseInternalError": {
+			requestInfo: RequestInfo{
+				Identifier: "admin",
+				Admin:      true,
+			},
+			name: "serviceaccount1",
+			wantError: &Error{
+				Code:    UNKNOWN_API_ERROR,
+				Message: "Error",
+			},
+			getServiceAccountByNameErr: &database.Error{
+				Code:    database.INTERNAL_ERROR,
+				Message: "Error",
+			},
+		},
+	}
+
+	for n, test := range testcases {
+		testRepo := makeTestRepo()
+		testAPI := makeTestAPI(testRepo)
+		testRepo.ArgsOut[GetServiceAccountByNameMethod][0] = test.getServiceAccountByNameResult
+		testRepo.ArgsOut[GetServiceAccountByNameMethod][1] = test.getServiceAccountByNameErr
+
+		serviceAccount, err := testAPI.GetServiceAccountByName(test.requestInfo, test.name)
+		checkMethodResponse(t, n, test.wantError, err, test.expectedServiceAccount, serviceAccount)
+	}
+}
+
+func TestAuthAPI_ListServiceAccounts(t *testing.T) {
+	testcases := map[string]struct {
+		// API method args
+		requestInfo RequestInfo
+		filter      *Filter
+		// Expected result
+		expectedServiceAccounts []string
+		expectedTotal           int
+		wantError               error
+		// Manager Results
+		getServiceAccountsFilteredResult []ServiceAccount
+		// Manager Errors
+		getServiceAccountsFilteredErr error
+	}{
+		"OkCase": {
+			requestInfo: RequestInfo{
+				Identifier: "admin",
+				Admin:      true,
+			},
+			filter: &Filter{
+				ExternalID: "user1",
+			},
+			expectedServiceAccounts: []string{"serviceaccount1", "serviceaccount2"},
+			expectedTotal:           2,
+			getServiceAccountsFilteredResult: []ServiceAccount{
+				{Name: "serviceaccount1", ExternalID: "user1"},
+				{Name: "serviceaccount2", ExternalID: "user1"},
+			},
+		},
+		"ErrorCaseNotAdmin": {
+			requestInfo: RequestInfo{
+				Identifier: "user1",
+			},
+			filter: &Filter{},
+			wantError: &Error{
+				Code:    UNAUTHORIZED_RESOURCES_ERROR,
+				Message: "User with externalId user1 is not allowed to access to service accounts",
+			},
+		},
+		"ErrorCaseInvalidOrderBy": {
+			requestInfo: RequestInfo{
+				Identifier: "admin",
+				Admin:      true,
+			},
+			filter: &Filter{
+				OrderBy: "invalid",
+			},
+			wantError: &Error{
+				Code:    INVALID_PARAMETER_ERROR,
+				Message: "Invalid parameter: OrderBy invalid",
+			},
+		},
+		"ErrorCaseInternalError": {
+			requestInfo: RequestInfo{
+				Identifier: "admin",
+				Admin:      true,
+			},
+			filter: &Filter{},
+			wantError: &Error{
+				Code:    UNKNOWN_API_ERROR,
+				Message: "Error",
+			},
+			getServiceAccountsFilteredErr: &database.Error{
+				Code:    database.INTERNAL_ERROR,
+				Message: "Error",
+			},
+		},
+	}
+
+	for n, test := range testcases {
+		testRepo := makeTestRepo()
+		testAPI := makeTestAPI(testRepo)
+		testRepo.ArgsOut[OrderByValidColumnsMethod][0] = []string{"name"}
+		testRepo.ArgsOut[GetServiceAccountsFilteredMethod][0] = test.getServiceAccountsFilteredResult
+		testRepo.ArgsOut[GetServiceAccountsFilteredMethod][1] = len(test.getServiceAccountsFilteredResult)
+		testRepo.ArgsOut[GetServiceAccountsFilteredMethod][2] = test.getServiceAccountsFilteredErr
+
+		serviceAccounts, total, err := testAPI.ListServiceAccounts(test.requestInfo, test.filter)
+		checkMethodResponse(t, n, test.wantError, err, test.expectedServiceAccounts, serviceAccounts)
+		if test.wantError == nil && total != test.expectedTotal {
+			t.Errorf("Test %v failed. Received total %v, wanted %v", n, total, test.expectedTotal)
+		}
+	}
+}
+
+func TestAuthAPI_RemoveServiceAccount(t *testing.T) {
+	testcases := map[string]struct {
+		// API method args
+		requestInfo RequestInfo
+		name        string
+		// Expected result
+		wantError error
+		// Manager Results
+		getServiceAccountByNameResult *ServiceAccount
+		// Manager Errors
+		getServiceAccountByNameErr error
+		removeServiceAccountErr    error
+	}{
+		"OkCase": {
+			requestInfo: RequestInfo{
+				Identifier: "admin",
+				Admin:      true,
+			},
+			name: "serviceaccount1",
+			getServiceAccountByNameResult: &ServiceAccount{
+				ID:   "ServiceAccountID",
+				Name: "serviceaccount1",
+			},
+		},
+		"ErrorCaseNotAdmin": {
+			requestInfo: RequestInfo{
+				Identifier: "user1",
+			},
+			name: "serviceaccount1",
+			wantError: &Error{
+				Code:    UNAUTHORIZED_RESOURCES_ERROR,
+				Message: "User with externalId user1 is not allowed to access to service accounts",
+			},
+		},
+		"ErrorCaseServiceAccountNotFound": {
+			requestInfo: RequestInfo{
+				Identifier: "admin",
+				Admin:      true,
+			},
+			name: "serviceaccount1",
+			wantError: &Error{
+				Code:    SERVICE_ACCOUNT_BY_NAME_NOT_FOUND,
+				Message: "Service account not found",
+			},
+			getServiceAccountByNameErr: &database.Error{
+				Code:    database.SERVICE_ACCOUNT_NOT_FOUND,
+				Message: "Service account not found",
+			},
+		},
+		"ErrorCaseRemoveServiceAccountDBErr": {
+			requestInfo: RequestInfo{
+				Identifier: "admin",
+				Admin:      true,
+			},
+			name: "serviceaccount1",
+			wantError: &Error{
+				Code:    UNKNOWN_API_ERROR,
+				Message: "Error",
+			},
+			getServiceAccountByNameResult: &ServiceAccount{
+				ID:   "ServiceAccountID",
+				Name: "serviceaccount1",
+			},
+			removeServiceAccountErr: &database.Error{
+				Code:    database.INTERNAL_ERROR,
+				Message: "Error",
+			},
+		},
+	}
+
+	for n, test := range testcases {
+		testRepo := makeTestRepo()
+		testAPI := makeTestAPI(testRepo)
+		testRepo.ArgsOut[GetServiceAccountByNameMethod][0] = test.getServiceAccountByNameResult
+		testRepo.ArgsOut[GetServiceAccountByNameMethod][1] = test.getServiceAccountByNameErr
+		testRepo.ArgsOut[RemoveServiceAccountMethod][0] = test.removeServiceAccountErr
+
+		err := testAPI.RemoveServiceAccount(test.requestInfo, test.name)
+		checkMethodResponse(t, n, test.wantError, err, nil, nil)
+		if test.wantError == nil && testRepo.ArgsIn[RemoveServiceAccountMethod][0] != "ServiceAccountID" {
+			t.Errorf("Test %v failed. Received different id to remove %v", n, testRepo.ArgsIn[RemoveServiceAccountMethod][0])
+		}
+	}
+}
+
+func TestAuthAPI_AuthenticateServiceAccount(t *testing.T) {
+	serviceAccount := &ServiceAccount{
+		ID:         "ServiceAccountID",
+		Name:       "serviceaccount1",
+		ExternalID: "user1",
+	}
+	testcases := map[string]struct {
+		// API method args
+		key string
+		// Expected result
+		expectedServiceAccount *ServiceAccount
+		expectedKeyHash        string
+		wantError              error
+		// Manager Results
+		getServiceAccountByKeyHashResult *ServiceAccount
+		// Manager Errors
+		getServiceAccountByKeyHashErr error
+	}{
+		"OkCase": {
+			key:                              "fk_0123456789",
+			expectedServiceAccount:           serviceAccount,
+			expectedKeyHash:                  getAPIKeyHash("fk_0123456789"),
+			getServiceAccountByKeyHashResult: serviceAccount,
+		},
+		"ErrorCaseInvalidPrefix": {
+			key: "0123456789",
+			wantError: &Error{
+				Code:    INVALID_API_KEY_ERROR,
+				Message: "Invalid API key",
+			},
+		},
+		"ErrorCaseKeyNotFound": {
+			key: "fk_0123456789",
+			wantError: &Error{
+				Code:    INVALID_API_KEY_ERROR,
+				Message: "Invalid API key",
+			},
+			getServiceAccountByKeyHashErr: &database.Error{
+				Code:    database.SERVICE_ACCOUNT_NOT_FOUND,
+				Message: "Service account not found",
+			},
+		},
+		"ErrorCaseInternalError": {
+			key: "fk_0123456789",
+			wantError: &Error{
+				Code:    UNKNOWN_API_ERROR,
+				Message: "Error",
+			},
+			getServiceAccountByKeyHashErr: &database.Error{
+				Code:    database.INTERNAL_ERROR,
+				Message: "Error",
+			},
+		},
+	}
+
+	for n, test := range testcases {
+		testRepo := makeTestRepo()
+		testAPI := makeTestAPI(testRepo)
+		testRepo.ArgsOut[GetServiceAccountByKeyHashMethod][0] = test.getServiceAccountByKeyHashResult
+		testRepo.ArgsOut[GetServiceAccountByKeyHashMethod][1] = test.getServiceAccountByKeyHashErr
+
+		serviceAccount, err := testAPI.AuthenticateServiceAccount(test.key)
+		checkMethodResponse(t, n, test.wantError, err, test.expectedServiceAccount, serviceAccount)
+		if test.wantError == nil && testRepo.ArgsIn[GetServiceAccountByKeyHashMethod][0] != test.expectedKeyHash {
+			t.Errorf("Test %v failed. Received different key hash %v", n, testRepo.ArgsIn[GetServiceAccountByKeyHashMethod][0])
+		}
+	}
+}
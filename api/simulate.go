@@ -0,0 +1,146 @@
+package api
+
+import (
+	"fmt"
+)
+
+// TYPE DEFINITIONS
+
+const (
+	// Constraints
+	MAX_SIMULATION_ACTIONS = 20
+	MAX_SIMULATION_GROUPS  = 50
+)
+
+// Draft statements to evaluate together with the policies attached to a user or a set of groups
+type PolicySimulation struct {
+	ExternalID string            `json:"externalId,omitempty"`
+	Groups     []GroupIdentity   `json:"groups,omitempty"`
+	Statements []Statement       `json:"statements,omitempty"`
+	Actions    []string          `json:"actions"`
+	Resources  []string          `json:"resources"`
+	Context    map[string]string `json:"context,omitempty"`
+}
+
+// Decision taken for an action and resource pair
+type SimulationResult struct {
+	Action   string `json:"action"`
+	Urn      string `json:"urn"`
+	Decision string `json:"decision"`
+}
+
+// AUTHZ API IMPLEMENTATION
+
+// SimulatePolicy evaluates the draft statements together with the policies attached to the user and groups
+// specified, and returns the decision for each action and resource pair. Nothing is stored in database.
+// Only admin users are allowed to do it.
+func (api AuthAPI) SimulatePolicy(requestInfo RequestInfo, simulation PolicySimulation) ([]SimulationResult, error) {
+	if !requestInfo.Admin {
+		return nil, &Error{
+			Code:    UNAUTHORIZED_RESOURCES_ERROR,
+			Message: fmt.Sprintf("User with externalId %v is not allowed to simulate policies", requestInfo.Identifier),
+		}
+	}
+
+	// Validate parameters
+	if len(simulation.Actions) < 1 || len(simulation.Actions) > MAX_SIMULATION_ACTIONS {
+		return nil, &Error{
+			Code:    INVALID_PARAMETER_ERROR,
+			Message: fmt.Sprintf("Invalid parameter Actions. Actions can't be empty or bigger than %v elements", MAX_SIMULATION_ACTIONS),
+		}
+	}
+	for _, action := range simulation.Actions {
+		if _, err := validateExternalResources(action, simulation.Resources); err != nil {
+			return nil, err
+		}
+	}
+	if len(simulation.Groups) > MAX_SIMULATION_GROUPS {
+		return nil, &Error{
+			Code:    INVALID_PARAMETER_ERROR,
+			Message: fmt.Sprintf("Invalid parameter Groups. Groups can't be bigger than %v elements", MAX_SIMULATION_GROUPS),
+		}
+	}
+	if err := AreValidStatements(&simulation.Statements); err != nil {
+		// Transform to API error
+		apiError := err.(*Error)
+		return nil, &Error{
+			Code:    INVALID_PARAMETER_ERROR,
+			Message: apiError.Message,
+		}
+	}
+	evalContext, err := getEvaluationContext(requestInfo, simulation.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	// Retrieve groups of the user and the hypothetical group attachments
+	groups := []Group{}
+	if simulation.ExternalID != "" {
+		user, err := api.GetUserByExternalID(requestInfo, simulation.ExternalID)
+		if err != nil {
+			return nil, err
+		}
+		userGroups, err := api.getGroupsByUser(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, userGroups...)
+	}
+	for _, groupIdentity := range simulation.Groups {
+		group, err := api.GetGroupByName(requestInfo, groupIdentity.Org, groupIdentity.Name)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, *group)
+	}
+
+	// Avoid evaluating twice the policies of a group attached to the user and specified in request
+	uniqueGroups := []Group{}
+	groupsFound := map[string]bool{}
+	for _, group := range groups {
+		if !groupsFound[group.ID] {
+			groupsFound[group.ID] = true
+			uniqueGroups = append(uniqueGroups, group)
+		}
+	}
+
+	policies, err := api.getPoliciesByGroups(uniqueGroups)
+	if err != nil {
+		return nil, err
+	}
+	// Draft policy isn't stored, it only lives during this simulation
+	policies = append(policies, Policy{
+		Name:       "simulation",
+		Statements: &simulation.Statements,
+	})
+
+	results := []SimulationResult{}
+	for _, action := range simulation.Actions {
+		statements := filterStatementsByConditions(getStatementsByRequestedAction(policies, action), evalContext)
+		restrictions := getRestrictions(statements, "urn:*", false)
+		for _, urn := range simulation.Resources {
+			results = append(results, SimulationResult{
+				Action:   action,
+				Urn:      urn,
+				Decision: getDecision(urn, restrictions),
+			})
+		}
+	}
+
+	LogOperation(api.Logger, requestInfo, fmt.Sprintf("Policy simulated for user %v, groups %v, actions %v and resources %v",
+		simulation.ExternalID, simulation.Groups, simulation.Actions, simulation.Resources))
+	return results, nil
+}
+
+// PRIVATE HELPER METHODS
+
+// Return the decision taken for the urn with the restrictions specified
+func getDecision(urn string, restrictions *Restrictions) string {
+	if isAllowedResource(ExternalResource{Urn: urn}, *restrictions) {
+		return DECISION_ALLOW
+	}
+	if getDenyRestriction(urn, restrictions) != "" {
+		return DECISION_EXPLICIT_DENY
+	}
+	return DECISION_IMPLICIT_DENY
+}
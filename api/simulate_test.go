@@ -0,0 +1,268 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/Tecsisa/foulkon/database"
+)
+
+func TestSimulatePolicy(t *testing.T) {
+	allowStatement := Statement{
+		Effect:    "allow",
+		Actions:   []string{"product:Read"},
+		Resources: []string{"urn:ews:product:instance:resource/*"},
+	}
+	denyStatement := Statement{
+		Effect:    "deny",
+		Actions:   []string{"product:*"},
+		Resources: []string{"urn:ews:product:instance:resource/secret/*"},
+	}
+	testcases := map[string]struct {
+		// API method args
+		requestInfo RequestInfo
+		simulation  PolicySimulation
+		// Expected result
+		expectedResponse []SimulationResult
+		wantError        error
+		// Manager Results
+		getUserByExternalIDResult *User
+		getGroupsByUserIDResult   []TestUserGroupRelation
+		getGroupByNameResult      *Group
+		getAttachedPoliciesResult []TestPolicyGroupRelation
+		// Manager Errors
+		getUserByExternalIDError error
+		getGroupByNameError      error
+	}{
+		"OkCaseUser": {
+			requestInfo: RequestInfo{
+				Identifier: "admin",
+				Admin:      true,
+			},
+			simulation: PolicySimulation{
+				ExternalID: "user1",
+				Statements: []Statement{denyStatement},
+				Actions:    []string{"product:Read", "product:Write"},
+				Resources: []string{
+					"urn:ews:product:instance:resource/res1",
+					"urn:ews:product:instance:resource/secret/res2",
+				},
+			},
+			expectedResponse: []SimulationResult{
+				{
+					Action:   "product:Read",
+					Urn:      "urn:ews:product:instance:resource/res1",
+					Decision: DECISION_ALLOW,
+				},
+				{
+					Action:   "product:Read",
+					Urn:      "urn:ews:product:instance:resource/secret/res2",
+					Decision: DECISION_EXPLICIT_DENY,
+				},
+				{
+					Action:   "product:Write",
+					Urn:      "urn:ews:product:instance:resource/res1",
+					Decision: DECISION_IMPLICIT_DENY,
+				},
+				{
+					Action:   "product:Write",
+					Urn:      "urn:ews:product:instance:resource/secret/res2",
+					Decision: DECISION_EXPLICIT_DENY,
+				},
+			},
+			getUserByExternalIDResult: &User{
+				ID:         "UserID",
+				ExternalID: "user1",
+			},
+			getGroupsByUserIDResult: []TestUserGroupRelation{
+				{
+					Group: &Group{
+						ID: "GroupID",
+					},
+				},
+			},
+			getAttachedPoliciesResult: []TestPolicyGroupRelation{
+				{
+					Policy: &Policy{
+						ID:         "PolicyID",
+						Statements: &[]Statement{allowStatement},
+					},
+				},
+			},
+		},
+		"OkCaseGroupsAndConditions": {
+			requestInfo: RequestInfo{
+				Identifier: "admin",
+				Admin:      true,
+			},
+			simulation: PolicySimulation{
+				Groups: []GroupIdentity{
+					{
+						Org:  "example",
+						Name: "group1",
+					},
+				},
+				Statements: []Statement{
+					{
+						Effect:    "allow",
+						Actions:   []string{"product:Write"},
+						Resources: []string{"urn:ews:product:instance:resource/*"},
+						Conditions: Conditions{
+							CONDITION_STRING_EQUALS: {
+								"product:Env": []string{"dev"},
+							},
+						},
+					},
+				},
+				Actions:   []string{"product:Read", "product:Write"},
+				Resources: []string{"urn:ews:product:instance:resource/res1"},
+				Context: map[string]string{
+					"product:Env": "pro",
+				},
+			},
+			expectedResponse: []SimulationResult{
+				{
+					Action:   "product:Read",
+					Urn:      "urn:ews:product:instance:resource/res1",
+					Decision: DECISION_ALLOW,
+				},
+				{
+					Action:   "product:Write",
+					Urn:      "urn:ews:product:instance:resource/res1",
+					Decision: DECISION_IMPLICIT_DENY,
+				},
+			},
+			getGroupByNameResult: &Group{
+				ID:   "GroupID",
+				Org:  "example",
+				Name: "group1",
+			},
+			getAttachedPoliciesResult: []TestPolicyGroupRelation{
+				{
+					Policy: &Policy{
+						ID:         "PolicyID",
+						Statements: &[]Statement{allowStatement},
+					},
+				},
+			},
+		},
+		"ErrorCaseNotAdmin": {
+			requestInfo: RequestInfo{
+				Identifier: "user2",
+			},
+			simulation: PolicySimulation{
+				Actions:   []string{"product:Read"},
+				Resources: []string{"urn:ews:product:instance:resource/res1"},
+			},
+			wantError: &Error{
+				Code:    UNAUTHORIZED_RESOURCES_ERROR,
+				Message: "User with externalId user2 is not allowed to simulate policies",
+			},
+		},
+		"ErrorCaseEmptyActions": {
+			requestInfo: RequestInfo{
+				Identifier: "admin",
+				Admin:      true,
+			},
+			simulation: PolicySimulation{
+				Resources: []string{"urn:ews:product:instance:resource/res1"},
+			},
+			wantError: &Error{
+				Code:    INVALID_PARAMETER_ERROR,
+				Message: "Invalid parameter Actions. Actions can't be empty or bigger than 20 elements",
+			},
+		},
+		"ErrorCaseResourcePrefix": {
+			requestInfo: RequestInfo{
+				Identifier: "admin",
+				Admin:      true,
+			},
+			simulation: PolicySimulation{
+				Actions:   []string{"product:Read"},
+				Resources: []string{"urn:ews:product:instance:resource/*"},
+			},
+			wantError: &Error{
+				Code:    INVALID_PARAMETER_ERROR,
+				Message: "Invalid parameter resource urn:ews:product:instance:resource/*. Urn prefixes are not allowed here",
+			},
+		},
+		"ErrorCaseInvalidStatement": {
+			requestInfo: RequestInfo{
+				Identifier: "admin",
+				Admin:      true,
+			},
+			simulation: PolicySimulation{
+				Statements: []Statement{
+					{
+						Effect:    "other",
+						Actions:   []string{"product:Read"},
+						Resources: []string{"urn:ews:product:instance:resource/*"},
+					},
+				},
+				Actions:   []string{"product:Read"},
+				Resources: []string{"urn:ews:product:instance:resource/res1"},
+			},
+			wantError: &Error{
+				Code:    INVALID_PARAMETER_ERROR,
+				Message: "Invalid effect: other - Only 'allow' and 'deny' accepted",
+			},
+		},
+		"ErrorCaseUserNotFound": {
+			requestInfo: RequestInfo{
+				Identifier: "admin",
+				Admin:      true,
+			},
+			simulation: PolicySimulation{
+				ExternalID: "user1",
+				Actions:    []string{"product:Read"},
+				Resources:  []string{"urn:ews:product:instance:resource/res1"},
+			},
+			wantError: &Error{
+				Code:    USER_BY_EXTERNAL_ID_NOT_FOUND,
+				Message: "User not found",
+			},
+			getUserByExternalIDError: &database.Error{
+				Code:    database.USER_NOT_FOUND,
+				Message: "User not found",
+			},
+		},
+		"ErrorCaseGroupNotFound": {
+			requestInfo: RequestInfo{
+				Identifier: "admin",
+				Admin:      true,
+			},
+			simulation: PolicySimulation{
+				Groups: []GroupIdentity{
+					{
+						Org:  "example",
+						Name: "group1",
+					},
+				},
+				Actions:   []string{"product:Read"},
+				Resources: []string{"urn:ews:product:instance:resource/res1"},
+			},
+			wantError: &Error{
+				Code:    GROUP_BY_ORG_AND_NAME_NOT_FOUND,
+				Message: "Group not found",
+			},
+			getGroupByNameError: &database.Error{
+				Code:    database.GROUP_NOT_FOUND,
+				Message: "Group not found",
+			},
+		},
+	}
+
+	for n, test := range testcases {
+		testRepo := makeTestRepo()
+		testAPI := makeTestAPI(testRepo)
+
+		testRepo.ArgsOut[GetUserByExternalIDMethod][0] = test.getUserByExternalIDResult
+		testRepo.ArgsOut[GetUserByExternalIDMethod][1] = test.getUserByExternalIDError
+		testRepo.ArgsOut[GetGroupsByUserIDMethod][0] = test.getGroupsByUserIDResult
+		testRepo.ArgsOut[GetGroupByNameMethod][0] = test.getGroupByNameResult
+		testRepo.ArgsOut[GetGroupByNameMethod][1] = test.getGroupByNameError
+		testRepo.ArgsOut[GetAttachedPoliciesMethod][0] = test.getAttachedPoliciesResult
+
+		results, err := testAPI.SimulatePolicy(test.requestInfo, test.simulation)
+		checkMethodResponse(t, n, test.wantError, err, test.expectedResponse, results)
+	}
+}
@@ -38,6 +38,22 @@ const (
 	GetPoliciesFilteredMethod = "GetPoliciesFiltered"
 	GetAttachedGroupsMethod   = "GetAttachedGroups"
 	OrderByValidColumnsMethod = "OrderByValidColumns"
+
+	GetEffectiveStatementsByUserMethod = "GetEffectiveStatementsByUser"
+
+	AddAuditEventMethod          = "AddAuditEvent"
+	GetAuditEventsFilteredMethod = "GetAuditEventsFiltered"
+
+	AddOutboxEntriesMethod        = "AddOutboxEntries"
+	GetPendingOutboxEntriesMethod = "GetPendingOutboxEntries"
+	UpdateOutboxEntryMethod       = "UpdateOutboxEntry"
+	RemoveOutboxEntryMethod       = "RemoveOutboxEntry"
+
+	AddServiceAccountMethod          = "AddServiceAccount"
+	GetServiceAccountByNameMethod    = "GetServiceAccountByName"
+	GetServiceAccountByKeyHashMethod = "GetServiceAccountByKeyHash"
+	GetServiceAccountsFilteredMethod = "GetServiceAccountsFiltered"
+	RemoveServiceAccountMethod       = "RemoveServiceAccount"
 )
 
 // TestRepo that implements all repo manager interfaces
@@ -102,6 +118,18 @@ func makeTestRepo() *TestRepo {
 	testRepo.ArgsIn[GetPoliciesFilteredMethod] = make([]interface{}, 1)
 	testRepo.ArgsIn[GetAttachedGroupsMethod] = make([]interface{}, 2)
 	testRepo.ArgsIn[OrderByValidColumnsMethod] = make([]interface{}, 1)
+	testRepo.ArgsIn[GetEffectiveStatementsByUserMethod] = make([]interface{}, 2)
+	testRepo.ArgsIn[AddAuditEventMethod] = make([]interface{}, 1)
+	testRepo.ArgsIn[GetAuditEventsFilteredMethod] = make([]interface{}, 1)
+	testRepo.ArgsIn[AddOutboxEntriesMethod] = make([]interface{}, 1)
+	testRepo.ArgsIn[GetPendingOutboxEntriesMethod] = make([]interface{}, 2)
+	testRepo.ArgsIn[UpdateOutboxEntryMethod] = make([]interface{}, 1)
+	testRepo.ArgsIn[RemoveOutboxEntryMethod] = make([]interface{}, 2)
+	testRepo.ArgsIn[AddServiceAccountMethod] = make([]interface{}, 1)
+	testRepo.ArgsIn[GetServiceAccountByNameMethod] = make([]interface{}, 1)
+	testRepo.ArgsIn[GetServiceAccountByKeyHashMethod] = make([]interface{}, 1)
+	testRepo.ArgsIn[GetServiceAccountsFilteredMethod] = make([]interface{}, 1)
+	testRepo.ArgsIn[RemoveServiceAccountMethod] = make([]interface{}, 1)
 
 	testRepo.ArgsOut[GetUserByExternalIDMethod] = make([]interface{}, 2)
 	testRepo.ArgsOut[AddUserMethod] = make([]interface{}, 2)
@@ -129,15 +157,31 @@ func makeTestRepo() *TestRepo {
 	testRepo.ArgsOut[GetPoliciesFilteredMethod] = make([]interface{}, 3)
 	testRepo.ArgsOut[GetAttachedGroupsMethod] = make([]interface{}, 3)
 	testRepo.ArgsOut[OrderByValidColumnsMethod] = make([]interface{}, 1)
+	testRepo.ArgsOut[GetEffectiveStatementsByUserMethod] = make([]interface{}, 2)
+	testRepo.ArgsOut[AddAuditEventMethod] = make([]interface{}, 1)
+	testRepo.ArgsOut[GetAuditEventsFilteredMethod] = make([]interface{}, 3)
+	testRepo.ArgsOut[AddOutboxEntriesMethod] = make([]interface{}, 1)
+	testRepo.ArgsOut[GetPendingOutboxEntriesMethod] = make([]interface{}, 2)
+	testRepo.ArgsOut[UpdateOutboxEntryMethod] = make([]interface{}, 1)
+	testRepo.ArgsOut[RemoveOutboxEntryMethod] = make([]interface{}, 1)
+	testRepo.ArgsOut[AddServiceAccountMethod] = make([]interface{}, 2)
+	testRepo.ArgsOut[GetServiceAccountByNameMethod] = make([]interface{}, 2)
+	testRepo.ArgsOut[GetServiceAccountByKeyHashMethod] = make([]interface{}, 2)
+	testRepo.ArgsOut[GetServiceAccountsFilteredMethod] = make([]interface{}, 3)
+	testRepo.ArgsOut[RemoveServiceAccountMethod] = make([]interface{}, 1)
 
 	return testRepo
 }
 
 func makeTestAPI(testRepo *TestRepo) *AuthAPI {
 	api := &AuthAPI{
-		UserRepo:   testRepo,
-		GroupRepo:  testRepo,
-		PolicyRepo: testRepo,
+		UserRepo:           testRepo,
+		GroupRepo:          testRepo,
+		PolicyRepo:         testRepo,
+		AuditRepo:          testRepo,
+		EventRepo:          testRepo,
+		ServiceAccountRepo: testRepo,
+		TxRepo:             testRepo,
 		Logger: &log.Logger{
 			Out:       bytes.NewBuffer([]byte{}),
 			Formatter: &log.TextFormatter{},
@@ -553,6 +597,192 @@ func (t TestRepo) GetAttachedGroups(policyID string, filter *Filter) ([]PolicyGr
 	return groups, total, err
 }
 
+// GetEffectiveStatementsByUser returns the statements configured in ArgsOut. If there aren't, it joins the
+// groups and policies returned by GetGroupsByUserID and GetAttachedPolicies like databases do.
+func (t TestRepo) GetEffectiveStatementsByUser(userID string, action string) ([]Statement, error) {
+	t.ArgsIn[GetEffectiveStatementsByUserMethod][0] = userID
+	t.ArgsIn[GetEffectiveStatementsByUserMethod][1] = action
+
+	if t.ArgsOut[GetEffectiveStatementsByUserMethod][0] != nil || t.ArgsOut[GetEffectiveStatementsByUserMethod][1] != nil {
+		var statements []Statement
+		if t.ArgsOut[GetEffectiveStatementsByUserMethod][0] != nil {
+			statements = t.ArgsOut[GetEffectiveStatementsByUserMethod][0].([]Statement)
+		}
+		var err error
+		if t.ArgsOut[GetEffectiveStatementsByUserMethod][1] != nil {
+			err = t.ArgsOut[GetEffectiveStatementsByUserMethod][1].(error)
+		}
+		return statements, err
+	}
+
+	groups, _, err := t.GetGroupsByUserID(userID, &Filter{})
+	if err != nil {
+		return nil, err
+	}
+	statements := []Statement{}
+	for _, g := range groups {
+		policies, _, err := t.GetAttachedPolicies(g.GetGroup().ID, &Filter{})
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range policies {
+			for _, statement := range *p.GetPolicy().Statements {
+				if action == "" || IsActionContained(action, statement.Actions) {
+					statements = append(statements, statement)
+				}
+			}
+		}
+	}
+	return statements, nil
+}
+
+//////////////////
+// Audit repo
+//////////////////
+
+func (t TestRepo) AddAuditEvent(event AuditEvent) error {
+	t.ArgsIn[AddAuditEventMethod][0] = event
+	var err error
+	if t.ArgsOut[AddAuditEventMethod][0] != nil {
+		err = t.ArgsOut[AddAuditEventMethod][0].(error)
+	}
+	return err
+}
+
+func (t TestRepo) GetAuditEventsFiltered(filter *AuditFilter) ([]AuditEvent, int, error) {
+	t.ArgsIn[GetAuditEventsFilteredMethod][0] = filter
+
+	var events []AuditEvent
+	if t.ArgsOut[GetAuditEventsFilteredMethod][0] != nil {
+		events = t.ArgsOut[GetAuditEventsFilteredMethod][0].([]AuditEvent)
+	}
+	var total int
+	if t.ArgsOut[GetAuditEventsFilteredMethod][1] != nil {
+		total = t.ArgsOut[GetAuditEventsFilteredMethod][1].(int)
+	}
+	var err error
+	if t.ArgsOut[GetAuditEventsFilteredMethod][2] != nil {
+		err = t.ArgsOut[GetAuditEventsFilteredMethod][2].(error)
+	}
+	return events, total, err
+}
+
+//////////////////
+// Event repo
+//////////////////
+
+func (t TestRepo) AddOutboxEntries(entries []OutboxEntry) error {
+	t.ArgsIn[AddOutboxEntriesMethod][0] = entries
+	var err error
+	if t.ArgsOut[AddOutboxEntriesMethod][0] != nil {
+		err = t.ArgsOut[AddOutboxEntriesMethod][0].(error)
+	}
+	return err
+}
+
+func (t TestRepo) GetPendingOutboxEntries(until time.Time, limit int) ([]OutboxEntry, error) {
+	t.ArgsIn[GetPendingOutboxEntriesMethod][0] = until
+	t.ArgsIn[GetPendingOutboxEntriesMethod][1] = limit
+
+	var entries []OutboxEntry
+	if t.ArgsOut[GetPendingOutboxEntriesMethod][0] != nil {
+		entries = t.ArgsOut[GetPendingOutboxEntriesMethod][0].([]OutboxEntry)
+	}
+	var err error
+	if t.ArgsOut[GetPendingOutboxEntriesMethod][1] != nil {
+		err = t.ArgsOut[GetPendingOutboxEntriesMethod][1].(error)
+	}
+	return entries, err
+}
+
+func (t TestRepo) UpdateOutboxEntry(entry OutboxEntry) error {
+	t.ArgsIn[UpdateOutboxEntryMethod][0] = entry
+	var err error
+	if t.ArgsOut[UpdateOutboxEntryMethod][0] != nil {
+		err = t.ArgsOut[UpdateOutboxEntryMethod][0].(error)
+	}
+	return err
+}
+
+func (t TestRepo) RemoveOutboxEntry(eventID string, sink string) error {
+	t.ArgsIn[RemoveOutboxEntryMethod][0] = eventID
+	t.ArgsIn[RemoveOutboxEntryMethod][1] = sink
+	var err error
+	if t.ArgsOut[RemoveOutboxEntryMethod][0] != nil {
+		err = t.ArgsOut[RemoveOutboxEntryMethod][0].(error)
+	}
+	return err
+}
+
+//////////////////////////
+// Service account repo
+//////////////////////////
+
+func (t TestRepo) AddServiceAccount(serviceAccount ServiceAccount) (*ServiceAccount, error) {
+	t.ArgsIn[AddServiceAccountMethod][0] = serviceAccount
+	var created *ServiceAccount
+	if t.ArgsOut[AddServiceAccountMethod][0] != nil {
+		created = t.ArgsOut[AddServiceAccountMethod][0].(*ServiceAccount)
+	}
+	var err error
+	if t.ArgsOut[AddServiceAccountMethod][1] != nil {
+		err = t.ArgsOut[AddServiceAccountMethod][1].(error)
+	}
+	return created, err
+}
+
+func (t TestRepo) GetServiceAccountByName(name string) (*ServiceAccount, error) {
+	t.ArgsIn[GetServiceAccountByNameMethod][0] = name
+	var serviceAccount *ServiceAccount
+	if t.ArgsOut[GetServiceAccountByNameMethod][0] != nil {
+		serviceAccount = t.ArgsOut[GetServiceAccountByNameMethod][0].(*ServiceAccount)
+	}
+	var err error
+	if t.ArgsOut[GetServiceAccountByNameMethod][1] != nil {
+		err = t.ArgsOut[GetServiceAccountByNameMethod][1].(error)
+	}
+	return serviceAccount, err
+}
+
+func (t TestRepo) GetServiceAccountByKeyHash(keyHash string) (*ServiceAccount, error) {
+	t.ArgsIn[GetServiceAccountByKeyHashMethod][0] = keyHash
+	var serviceAccount *ServiceAccount
+	if t.ArgsOut[GetServiceAccountByKeyHashMethod][0] != nil {
+		serviceAccount = t.ArgsOut[GetServiceAccountByKeyHashMethod][0].(*ServiceAccount)
+	}
+	var err error
+	if t.ArgsOut[GetServiceAccountByKeyHashMethod][1] != nil {
+		err = t.ArgsOut[GetServiceAccountByKeyHashMethod][1].(error)
+	}
+	return serviceAccount, err
+}
+
+func (t TestRepo) GetServiceAccountsFiltered(filter *Filter) ([]ServiceAccount, int, error) {
+	t.ArgsIn[GetServiceAccountsFilteredMethod][0] = filter
+	var serviceAccounts []ServiceAccount
+	if t.ArgsOut[GetServiceAccountsFilteredMethod][0] != nil {
+		serviceAccounts = t.ArgsOut[GetServiceAccountsFilteredMethod][0].([]ServiceAccount)
+	}
+	var total int
+	if t.ArgsOut[GetServiceAccountsFilteredMethod][1] != nil {
+		total = t.ArgsOut[GetServiceAccountsFilteredMethod][1].(int)
+	}
+	var err error
+	if t.ArgsOut[GetServiceAccountsFilteredMethod][2] != nil {
+		err = t.ArgsOut[GetServiceAccountsFilteredMethod][2].(error)
+	}
+	return serviceAccounts, total, err
+}
+
+func (t TestRepo) RemoveServiceAccount(id string) error {
+	t.ArgsIn[RemoveServiceAccountMethod][0] = id
+	var err error
+	if t.ArgsOut[RemoveServiceAccountMethod][0] != nil {
+		err = t.ArgsOut[RemoveServiceAccountMethod][0].(error)
+	}
+	return err
+}
+
 func (t TestRepo) OrderByValidColumns(action string) []string {
 	t.ArgsIn[OrderByValidColumnsMethod][0] = action
 	var validColumns []string
@@ -562,6 +792,22 @@ func (t TestRepo) OrderByValidColumns(action string) []string {
 	return validColumns
 }
 
+//////////////////
+// Tx repo
+//////////////////
+
+// Transaction makes changes with the same repository, so there isn't a rollback
+func (t TestRepo) Transaction(change func(repos Repos) error) error {
+	return change(Repos{
+		UserRepo:           t,
+		GroupRepo:          t,
+		PolicyRepo:         t,
+		ServiceAccountRepo: t,
+		AuditRepo:          t,
+		EventRepo:          t,
+	})
+}
+
 // Private helper methods
 
 func getRandomString(runeValue []rune, n int) string {
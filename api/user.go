@@ -77,16 +77,18 @@ func (api AuthAPI) AddUser(requestInfo RequestInfo, externalId string, path stri
 		switch dbError.Code {
 		case database.USER_NOT_FOUND:
 			// Create user
-			createdUser, err := api.UserRepo.AddUser(user)
+			var createdUser *User
+			err := api.transaction(func(tx AuthAPI) error {
+				var err error
+				if createdUser, err = tx.UserRepo.AddUser(user); err != nil {
+					return err
+				}
+				return tx.recordChange(requestInfo, USER_ACTION_CREATE_USER, createdUser.Urn, nil, createdUser)
+			})
 
 			// Check unexpected DB error
 			if err != nil {
-				//Transform to DB error
-				dbError := err.(*database.Error)
-				return nil, &Error{
-					Code:    UNKNOWN_API_ERROR,
-					Message: dbError.Message,
-				}
+				return nil, err
 			}
 			LogOperation(api.Logger, requestInfo, fmt.Sprintf("User created %+v", createdUser))
 			return createdUser, nil
@@ -239,16 +241,18 @@ func (api AuthAPI) UpdateUser(requestInfo RequestInfo, externalId string, newPat
 		Urn:        auxUser.Urn,
 	}
 
-	updatedUser, err := api.UserRepo.UpdateUser(user)
+	var updatedUser *User
+	err = api.transaction(func(tx AuthAPI) error {
+		var err error
+		if updatedUser, err = tx.UserRepo.UpdateUser(user); err != nil {
+			return err
+		}
+		return tx.recordChange(requestInfo, USER_ACTION_UPDATE_USER, updatedUser.Urn, oldUser, updatedUser)
+	})
 
 	// Check unexpected DB error
 	if err != nil {
-		//Transform to DB error
-		dbError := err.(*database.Error)
-		return nil, &Error{
-			Code:    UNKNOWN_API_ERROR,
-			Message: dbError.Message,
-		}
+		return nil, err
 	}
 
 	LogOperation(api.Logger, requestInfo, fmt.Sprintf("User updated from %+v to %+v", oldUser, updatedUser))
@@ -276,17 +280,19 @@ func (api AuthAPI) RemoveUser(requestInfo RequestInfo, externalId string) error
 		}
 	}
 
-	err = api.UserRepo.RemoveUser(user.ID)
+	err = api.transaction(func(tx AuthAPI) error {
+		if err := tx.UserRepo.RemoveUser(user.ID); err != nil {
+			return err
+		}
+		return tx.recordChange(requestInfo, USER_ACTION_DELETE_USER, user.Urn, user, nil)
+	})
 
 	// Error handling
 	if err != nil {
-		//Transform to DB error
-		dbError := err.(*database.Error)
-		return &Error{
-			Code:    UNKNOWN_API_ERROR,
-			Message: dbError.Message,
-		}
+		return err
 	}
+	api.Cache.Invalidate(user.ExternalID)
+	api.Provisioning.forget(user.ExternalID)
 	LogOperation(api.Logger, requestInfo, fmt.Sprintf("User deleted %+v", user))
 	return nil
 }
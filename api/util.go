@@ -14,6 +14,8 @@ const (
 	RESOURCE_USER   = "user"
 	RESOURCE_POLICY = "policy"
 
+	RESOURCE_SERVICE_ACCOUNT = "serviceaccount"
+
 	// Constraints
 	MAX_EXTERNAL_ID_LENGTH = 128
 	MAX_NAME_LENGTH        = 128
@@ -53,6 +55,11 @@ const (
 	POLICY_ACTION_GET_POLICY           = "iam:GetPolicy"
 	POLICY_ACTION_LIST_ATTACHED_GROUPS = "iam:ListAttachedGroups"
 	POLICY_ACTION_LIST_POLICIES        = "iam:ListPolicies"
+
+	// Service account actions
+	SERVICE_ACCOUNT_ACTION_CREATE_SERVICE_ACCOUNT = "iam:CreateServiceAccount"
+	SERVICE_ACCOUNT_ACTION_DELETE_SERVICE_ACCOUNT = "iam:DeleteServiceAccount"
+	SERVICE_ACCOUNT_ACTION_LIST_SERVICE_ACCOUNTS  = "iam:ListServiceAccounts"
 )
 
 var (
@@ -110,6 +117,12 @@ func IsValidPath(path string) bool {
 	return rPath.MatchString(path) && !rPathExclude.MatchString(path) && len(path) < MAX_PATH_LENGTH
 }
 
+// IsValidUrnValue validates a value that is part of a resource name in an URN, so it can't
+// contain separators or wildcards
+func IsValidUrnValue(value string) bool {
+	return rWordResource.MatchString(value) && len(value) < MAX_NAME_LENGTH
+}
+
 func IsValidEffect(effect string) error {
 	if effect != "allow" && effect != "deny" {
 		return &Error{
@@ -232,6 +245,12 @@ func AreValidStatements(statements *[]Statement) error {
 		if err != nil {
 			return err
 		}
+
+		// check conditions
+		err = AreValidConditions(statement.Conditions)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -273,6 +273,43 @@ func TestIsValidPath(t *testing.T) {
 	}
 }
 
+func TestIsValidUrnValue(t *testing.T) {
+	testcases := map[string]struct {
+		value string
+		valid bool
+	}{
+		"OkCaseEmpty": {
+			value: "",
+			valid: false,
+		},
+		"OkCaseInvalidColon": {
+			value: "org:user",
+			valid: false,
+		},
+		"OkCaseInvalidSlash": {
+			value: "path/user",
+			valid: false,
+		},
+		"OkCaseInvalidWildcard": {
+			value: "user*",
+			valid: false,
+		},
+		"OkCaseMaxLimitExceed": {
+			value: getRandomString([]rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"), MAX_NAME_LENGTH+1),
+			valid: false,
+		},
+		"OkCase": {
+			value: "user-1.name@example+test",
+			valid: true,
+		},
+	}
+
+	for x, testcase := range testcases {
+		valid := IsValidUrnValue(testcase.value)
+		checkMethodResponse(t, x, nil, nil, testcase.valid, valid)
+	}
+}
+
 func TestIsValidEffect(t *testing.T) {
 	testcases := map[string]struct {
 		// Method args
@@ -439,6 +476,28 @@ func TestAreValidStatements(t *testing.T) {
 				Message: "No regex match in resource: urn:iws:iam::user/path/****",
 			},
 		},
+		"ErrorCaseInvalidCondition": {
+			Statements: &[]Statement{
+				{
+					Effect: "allow",
+					Actions: []string{
+						USER_ACTION_GET_USER,
+					},
+					Resources: []string{
+						GetUrnPrefix("", RESOURCE_USER, "/path/"),
+					},
+					Conditions: Conditions{
+						CONDITION_IP_ADDRESS: {
+							CONTEXT_KEY_SOURCE_IP: []string{"10.0.0.0/99"},
+						},
+					},
+				},
+			},
+			wantError: &Error{
+				Code:    INVALID_PARAMETER_ERROR,
+				Message: "Invalid value 10.0.0.0/99 for condition operator IpAddress",
+			},
+		},
 	}
 
 	for x, testcase := range testcases {
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/Tecsisa/foulkon/api"
+)
+
+// Validator of API keys, implemented by service account API
+type APIKeyValidator interface {
+	AuthenticateServiceAccount(key string) (*api.ServiceAccount, error)
+}
+
+// APIKeyAuthConnector represents a connector for service accounts that implements interface of auth connector.
+// Requests must have an "Authorization: Bearer <key>" header, and they are authenticated as the user of
+// the service account.
+type APIKeyAuthConnector struct {
+	logger    *log.Logger
+	validator APIKeyValidator
+}
+
+func InitAPIKeyConnector(logger *log.Logger, validator APIKeyValidator) AuthConnector {
+	return &APIKeyAuthConnector{
+		logger:    logger,
+		validator: validator,
+	}
+}
+
+// This method retrieves API key from request and checks that it belongs to a service account
+func (c APIKeyAuthConnector) Authenticate(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("Request-ID")
+		// Header can't be sent by clients
+		r.Header.Del(USER_ID_HEADER)
+
+		key := getBearerToken(r)
+		if key == "" {
+			c.logger.WithFields(log.Fields{
+				"requestID": requestID,
+			}).Error("Authorization header with bearer API key not found")
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Error Authorization header with bearer API key not found", http.StatusUnauthorized)
+			return
+		}
+
+		serviceAccount, err := c.validator.AuthenticateServiceAccount(key)
+		if err != nil {
+			if apiError, ok := err.(*api.Error); ok && apiError.Code == api.INVALID_API_KEY_ERROR {
+				c.logger.WithFields(log.Fields{
+					"requestID": requestID,
+				}).Error(apiError.Message)
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, fmt.Sprintf("Error %v", apiError.Message), http.StatusUnauthorized)
+			} else {
+				c.logger.WithFields(log.Fields{
+					"requestID": requestID,
+				}).Error("Internal server error")
+				http.Error(w, "Unexpected error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		r.Header.Set(USER_ID_HEADER, serviceAccount.ExternalID)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Retrieve user of service account
+func (c APIKeyAuthConnector) RetrieveUserID(r http.Request) string {
+	return r.Header.Get(USER_ID_HEADER)
+}
+
+// Returns the token of a bearer authorization header, or empty string if there isn't one
+func getBearerToken(r *http.Request) string {
+	parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(parts[1])
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/Tecsisa/foulkon/api"
+)
+
+type testValidator struct {
+	serviceAccount *api.ServiceAccount
+	err            error
+}
+
+func (v testValidator) AuthenticateServiceAccount(key string) (*api.ServiceAccount, error) {
+	return v.serviceAccount, v.err
+}
+
+func TestAPIKeyAuthConnector_Authenticate(t *testing.T) {
+	testcases := map[string]struct {
+		authorization string
+		validator     testValidator
+		// Expected result
+		expectedStatusCode int
+		expectedUserID     string
+	}{
+		"OkCase": {
+			authorization: "Bearer fk_0123456789",
+			validator: testValidator{
+				serviceAccount: &api.ServiceAccount{Name: "serviceaccount1", ExternalID: "user1"},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedUserID:     "user1",
+		},
+		"ErrorCaseNoAuthorizationHeader": {
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+		"ErrorCaseBasicAuthorization": {
+			authorization:      "Basic YWRtaW46YWRtaW4=",
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+		"ErrorCaseInvalidKey": {
+			authorization: "Bearer fk_0123456789",
+			validator: testValidator{
+				err: &api.Error{Code: api.INVALID_API_KEY_ERROR, Message: "Invalid API key"},
+			},
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+		"ErrorCaseUnknownError": {
+			authorization: "Bearer fk_0123456789",
+			validator: testValidator{
+				err: &api.Error{Code: api.UNKNOWN_API_ERROR, Message: "Error"},
+			},
+			expectedStatusCode: http.StatusInternalServerError,
+		},
+	}
+
+	logger := &log.Logger{
+		Out:       bytes.NewBuffer([]byte{}),
+		Formatter: &log.TextFormatter{},
+		Hooks:     make(log.LevelHooks),
+		Level:     log.DebugLevel,
+	}
+
+	for n, test := range testcases {
+		connector := InitAPIKeyConnector(logger, test.validator)
+		var userID string
+		handler := connector.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID = connector.RetrieveUserID(*r)
+		}))
+
+		r, _ := http.NewRequest(http.MethodGet, "/", nil)
+		// Header sent by client must be ignored
+		r.Header.Set(USER_ID_HEADER, "admin")
+		if test.authorization != "" {
+			r.Header.Set("Authorization", test.authorization)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("Test %v failed. Received different http status code (wanted:%v / received:%v)", n, test.expectedStatusCode, w.Code)
+			continue
+		}
+		if userID != test.expectedUserID {
+			t.Errorf("Test %v failed. Received different user (wanted:%v / received:%v)", n, test.expectedUserID, userID)
+		}
+		if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("Test %v failed. Expected WWW-Authenticate header in response", n)
+		}
+	}
+}
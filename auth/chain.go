@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	// Separator between the namespace of a connector and the user ID it authenticated
+	NAMESPACE_SEPARATOR = "."
+)
+
+var rConnectorName = regexp.MustCompile(`^[\w\-]+$`)
+
+// ChainedConnector is a connector of a chain, with the namespace added to the users it authenticates.
+// Users aren't namespaced if namespace is empty, for example with service accounts of foulkon users.
+type ChainedConnector struct {
+	Name      string
+	Namespace string
+	Connector AuthConnector
+}
+
+// ChainAuthConnector represents a connector that implements interface of auth connector trying several
+// connectors in order, so users of different identity providers can be authenticated. The first connector
+// that authenticates the request is used, and if all of them fail, the response of the last one is returned.
+type ChainAuthConnector struct {
+	logger     *log.Logger
+	connectors []ChainedConnector
+}
+
+func InitChainConnector(logger *log.Logger, connectors []ChainedConnector) (AuthConnector, error) {
+	if len(connectors) == 0 {
+		return nil, fmt.Errorf("Connector chain without connectors")
+	}
+	names := map[string]bool{}
+	for _, c := range connectors {
+		if !rConnectorName.MatchString(c.Name) || names[c.Name] {
+			return nil, fmt.Errorf("Invalid or duplicated connector name in chain: %v", c.Name)
+		}
+		if c.Namespace != "" && !rConnectorName.MatchString(c.Namespace) {
+			return nil, fmt.Errorf("Invalid namespace of connector %v in chain: %v", c.Name, c.Namespace)
+		}
+		names[c.Name] = true
+	}
+	return &ChainAuthConnector{
+		logger:     logger,
+		connectors: connectors,
+	}, nil
+}
+
+// This method tries every connector until one of them authenticates the request
+func (c ChainAuthConnector) Authenticate(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("Request-ID")
+		var failure *responseRecorder
+		for _, chained := range c.connectors {
+			// Headers can't be sent by clients or kept from connectors that failed
+			r.Header.Del(USER_ID_HEADER)
+			r.Header.Del(CLAIMS_HEADER)
+
+			var authenticated *http.Request
+			recorder := newResponseRecorder()
+			chained.Connector.Authenticate(http.HandlerFunc(func(_ http.ResponseWriter, ar *http.Request) {
+				authenticated = ar
+			})).ServeHTTP(recorder, r)
+
+			if authenticated == nil {
+				c.logger.WithFields(log.Fields{
+					"requestID": requestID,
+					"connector": chained.Name,
+				}).Debugf("Request not authenticated by connector, status %v", recorder.code)
+				failure = recorder
+				continue
+			}
+
+			userID := chained.Connector.RetrieveUserID(*authenticated)
+			if chained.Namespace != "" {
+				userID = chained.Namespace + NAMESPACE_SEPARATOR + userID
+			}
+			authenticated.Header.Set(USER_ID_HEADER, userID)
+			h.ServeHTTP(w, authenticated)
+			return
+		}
+
+		failure.writeTo(w)
+	})
+}
+
+// Retrieve namespaced user of the connector that authenticated the request
+func (c ChainAuthConnector) RetrieveUserID(r http.Request) string {
+	return r.Header.Get(USER_ID_HEADER)
+}
+
+// PRIVATE HELPER METHODS
+
+// Response of a connector that isn't sent until the chain knows if the request is authenticated
+type responseRecorder struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{
+		header: http.Header{},
+		code:   http.StatusOK,
+	}
+}
+
+func (rr *responseRecorder) Header() http.Header {
+	return rr.header
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	return rr.body.Write(b)
+}
+
+func (rr *responseRecorder) WriteHeader(code int) {
+	rr.code = code
+}
+
+func (rr *responseRecorder) writeTo(w http.ResponseWriter) {
+	for key, values := range rr.header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(rr.code)
+	w.Write(rr.body.Bytes())
+}
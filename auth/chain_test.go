@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Connector that authenticates requests with a header value
+type testHeaderConnector struct {
+	header string
+	status int
+}
+
+func (c testHeaderConnector) Authenticate(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Header.Get(c.header)
+		if userID == "" {
+			w.Header().Set("WWW-Authenticate", c.header)
+			http.Error(w, "Error "+c.header, c.status)
+			return
+		}
+		r.Header.Set(USER_ID_HEADER, userID)
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (c testHeaderConnector) RetrieveUserID(r http.Request) string {
+	return r.Header.Get(USER_ID_HEADER)
+}
+
+func TestChainAuthConnector_Authenticate(t *testing.T) {
+	connectors := []ChainedConnector{
+		{Name: "employees", Namespace: "employees", Connector: testHeaderConnector{header: "Employee", status: http.StatusUnauthorized}},
+		{Name: "partners", Namespace: "partners", Connector: testHeaderConnector{header: "Partner", status: http.StatusUnauthorized}},
+		{Name: "machines", Connector: testHeaderConnector{header: "Machine", status: http.StatusForbidden}},
+	}
+	testcases := map[string]struct {
+		headers map[string]string
+		// Expected result
+		expectedStatusCode int
+		expectedUserID     string
+		expectedBody       string
+	}{
+		"OkCaseFirstConnector": {
+			headers: map[string]string{
+				"Employee": "user1",
+				"Partner":  "user2",
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedUserID:     "employees.user1",
+		},
+		"OkCaseSecondConnector": {
+			headers: map[string]string{
+				"Partner": "user1",
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedUserID:     "partners.user1",
+		},
+		"OkCaseConnectorWithoutNamespace": {
+			headers: map[string]string{
+				"Machine": "user1",
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedUserID:     "user1",
+		},
+		"OkCaseUserIDHeaderIgnored": {
+			headers: map[string]string{
+				USER_ID_HEADER: "admin",
+				"Partner":      "user1",
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedUserID:     "partners.user1",
+		},
+		"ErrorCaseNotAuthenticated": {
+			headers: map[string]string{
+				USER_ID_HEADER: "admin",
+			},
+			expectedStatusCode: http.StatusForbidden,
+			expectedBody:       "Error Machine\n",
+		},
+	}
+
+	logger := &log.Logger{
+		Out:       bytes.NewBuffer([]byte{}),
+		Formatter: &log.TextFormatter{},
+		Hooks:     make(log.LevelHooks),
+		Level:     log.DebugLevel,
+	}
+	connector, err := InitChainConnector(logger, connectors)
+	if err != nil {
+		t.Fatalf("Unexpected error creating chain connector: %v", err)
+	}
+
+	for n, test := range testcases {
+		var userID string
+		handler := connector.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID = connector.RetrieveUserID(*r)
+		}))
+
+		r, _ := http.NewRequest(http.MethodGet, "/", nil)
+		for key, value := range test.headers {
+			r.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("Test %v failed. Received different http status code (wanted:%v / received:%v)", n, test.expectedStatusCode, w.Code)
+			continue
+		}
+		if userID != test.expectedUserID {
+			t.Errorf("Test %v failed. Received different user (wanted:%v / received:%v)", n, test.expectedUserID, userID)
+		}
+		if test.expectedBody != "" && (w.Body.String() != test.expectedBody || w.Header().Get("WWW-Authenticate") != "Machine") {
+			t.Errorf("Test %v failed. Expected response of last connector, received %v", n, w.Body.String())
+		}
+	}
+}
+
+func TestInitChainConnector(t *testing.T) {
+	connector := testHeaderConnector{header: "Employee", status: http.StatusUnauthorized}
+	testcases := map[string]struct {
+		connectors []ChainedConnector
+		wantError  bool
+	}{
+		"OkCase": {
+			connectors: []ChainedConnector{
+				{Name: "employees", Namespace: "employees", Connector: connector},
+				{Name: "machines", Connector: connector},
+			},
+		},
+		"ErrorCaseWithoutConnectors": {
+			wantError: true,
+		},
+		"ErrorCaseDuplicatedName": {
+			connectors: []ChainedConnector{
+				{Name: "employees", Connector: connector},
+				{Name: "employees", Connector: connector},
+			},
+			wantError: true,
+		},
+		"ErrorCaseInvalidNamespace": {
+			connectors: []ChainedConnector{
+				{Name: "employees", Namespace: "employees.corp", Connector: connector},
+			},
+			wantError: true,
+		},
+	}
+
+	for n, test := range testcases {
+		_, err := InitChainConnector(log.New(), test.connectors)
+		if (err != nil) != test.wantError {
+			t.Errorf("Test %v failed. Received error %v, wanted error: %v", n, err, test.wantError)
+		}
+	}
+}
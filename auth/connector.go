@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"encoding/json"
 	"net/http"
 )
 
@@ -28,6 +29,9 @@ type AuthConnector interface {
 
 func (a *Authenticator) Authenticate(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Claims are only set by connectors
+		r.Header.Del(CLAIMS_HEADER)
+
 		var handler http.Handler
 		if isAdmin(r, a.adminUser, a.adminPassword) {
 			// Admin check
@@ -50,6 +54,22 @@ func (a *Authenticator) GetAuthenticatedUser(r *http.Request) (string, bool) {
 	return a.Connector.RetrieveUserID(*r), false
 }
 
+// GetAuthenticatedClaims retrieves claims that connector added to request, nil for admin or without claims
+func (a *Authenticator) GetAuthenticatedClaims(r *http.Request) map[string]string {
+	if isAdmin(r, a.adminUser, a.adminPassword) {
+		return nil
+	}
+	encoded := r.Header.Get(CLAIMS_HEADER)
+	if encoded == "" {
+		return nil
+	}
+	claims := map[string]string{}
+	if err := json.Unmarshal([]byte(encoded), &claims); err != nil {
+		return nil
+	}
+	return claims
+}
+
 func isAdmin(r *http.Request, adminUser string, adminPassword string) bool {
 	username, password, ok := r.BasicAuth()
 	// Password is never stored in DB
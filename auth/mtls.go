@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/Tecsisa/foulkon/api"
+)
+
+const (
+	// Certificate fields that can be mapped to users
+	MTLS_FIELD_CN    = "cn"
+	MTLS_FIELD_URI   = "uri"
+	MTLS_FIELD_EMAIL = "email"
+)
+
+var oidSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+
+// MTLSAuthConnector represents a connector for client certificates that implements interface of auth connector.
+// Certificates are verified with the CA bundle, and a field of the certificate is mapped to the user ID with
+// a template, where "{value}" is replaced by the field value. With "uri" field "{host}" and "{path}" are
+// replaced by the host and the path without leading "/", and with "email" field "{user}" and "{domain}" are
+// replaced by the parts of the address.
+type MTLSAuthConnector struct {
+	logger   *log.Logger
+	roots    *x509.CertPool
+	field    string
+	template string
+}
+
+func InitMTLSConnector(logger *log.Logger, caFile string, field string, template string) (AuthConnector, error) {
+	switch field {
+	case MTLS_FIELD_CN, MTLS_FIELD_URI, MTLS_FIELD_EMAIL:
+	default:
+		return nil, fmt.Errorf("Invalid certificate field for mTLS connector: %v", field)
+	}
+	if !strings.Contains(template, "{") {
+		return nil, fmt.Errorf("Invalid user template for mTLS connector without fields: %v", template)
+	}
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read CA file %v: %v", caFile, err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("CA file %v without valid PEM certificates", caFile)
+	}
+	return &MTLSAuthConnector{
+		logger:   logger,
+		roots:    roots,
+		field:    field,
+		template: template,
+	}, nil
+}
+
+// This method verifies client certificate of TLS connection and maps it to a user
+func (c MTLSAuthConnector) Authenticate(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("Request-ID")
+		// Header can't be sent by clients
+		r.Header.Del(USER_ID_HEADER)
+
+		userID, err := c.getUserID(r)
+		if err != nil {
+			c.logger.WithFields(log.Fields{
+				"requestID": requestID,
+			}).Error(err.Error())
+			http.Error(w, fmt.Sprintf("Error %v", err.Error()), http.StatusUnauthorized)
+			return
+		}
+
+		r.Header.Set(USER_ID_HEADER, userID)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Retrieve user of client certificate
+func (c MTLSAuthConnector) RetrieveUserID(r http.Request) string {
+	return r.Header.Get(USER_ID_HEADER)
+}
+
+// RequiresClientCertificates returns true if connector, or any connector of a chain, authenticates client
+// certificates, so servers have to request them in TLS handshakes.
+func RequiresClientCertificates(connector AuthConnector) bool {
+	switch c := connector.(type) {
+	case *MTLSAuthConnector:
+		return true
+	case *ChainAuthConnector:
+		for _, chained := range c.connectors {
+			if RequiresClientCertificates(chained.Connector) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PRIVATE HELPER METHODS
+
+// Verify client certificate and return the user ID of the configured field
+func (c MTLSAuthConnector) getUserID(r *http.Request) (string, error) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return "", errors.New("Client certificate not found")
+	}
+	cert := r.TLS.PeerCertificates[0]
+	intermediates := x509.NewCertPool()
+	for _, ic := range r.TLS.PeerCertificates[1:] {
+		intermediates.AddCert(ic)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:         c.roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		return "", fmt.Errorf("Invalid client certificate: %v", err)
+	}
+
+	var replacements []string
+	switch c.field {
+	case MTLS_FIELD_CN:
+		if cert.Subject.CommonName != "" {
+			replacements = []string{"{value}", cert.Subject.CommonName}
+		}
+	case MTLS_FIELD_URI:
+		if uris := getURIs(cert); len(uris) > 0 {
+			uri := uris[0]
+			replacements = []string{"{value}", uri.String(), "{host}", uri.Host, "{path}", strings.TrimPrefix(uri.Path, "/")}
+		}
+	case MTLS_FIELD_EMAIL:
+		if len(cert.EmailAddresses) > 0 {
+			email := cert.EmailAddresses[0]
+			parts := strings.SplitN(email, "@", 2)
+			replacements = []string{"{value}", email, "{user}", parts[0], "{domain}", parts[len(parts)-1]}
+		}
+	}
+	if replacements == nil {
+		return "", fmt.Errorf("Client certificate without %v field", c.field)
+	}
+
+	userID := strings.NewReplacer(replacements...).Replace(c.template)
+	if !api.IsValidUserExternalID(userID) {
+		return "", fmt.Errorf("Invalid user %v for client certificate %v field", userID, c.field)
+	}
+	return userID, nil
+}
+
+// Return URIs of subject alternative names extension, ignoring invalid ones
+func getURIs(cert *x509.Certificate) []*url.URL {
+	uris := []*url.URL{}
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidSubjectAltName) {
+			continue
+		}
+		var names asn1.RawValue
+		if _, err := asn1.Unmarshal(ext.Value, &names); err != nil || !names.IsCompound {
+			continue
+		}
+		rest := names.Bytes
+		for len(rest) > 0 {
+			var name asn1.RawValue
+			var err error
+			if rest, err = asn1.Unmarshal(rest, &name); err != nil {
+				break
+			}
+			// uniformResourceIdentifier [6] IA5String
+			if name.Class == asn1.ClassContextSpecific && name.Tag == 6 {
+				if uri, err := url.Parse(string(name.Bytes)); err == nil {
+					uris = append(uris, uri)
+				}
+			}
+		}
+	}
+	return uris
+}
@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+func TestMTLSAuthConnector_Authenticate(t *testing.T) {
+	ca, caKey := createTestCertificate(t, "ca", nil, nil, nil)
+	otherCA, otherCAKey := createTestCertificate(t, "other", nil, nil, nil)
+	caFile := writeTestCAFile(t, ca)
+	defer os.Remove(caFile)
+
+	sans := []asn1.RawValue{
+		{Class: asn1.ClassContextSpecific, Tag: 1, Bytes: []byte("billing@example.com")},
+		{Class: asn1.ClassContextSpecific, Tag: 6, Bytes: []byte("spiffe://example.com/billing")},
+	}
+	cert, _ := createTestCertificate(t, "billing", sans, ca, caKey)
+	nestedURICert, _ := createTestCertificate(t, "billing", []asn1.RawValue{
+		{Class: asn1.ClassContextSpecific, Tag: 6, Bytes: []byte("spiffe://example.com/ns/billing")},
+	}, ca, caKey)
+	untrustedCert, _ := createTestCertificate(t, "billing", sans, otherCA, otherCAKey)
+
+	testcases := map[string]struct {
+		field    string
+		template string
+		certs    []*x509.Certificate
+		// Expected result
+		expectedStatusCode int
+		expectedUserID     string
+	}{
+		"OkCaseCN": {
+			field:              MTLS_FIELD_CN,
+			template:           "svc-{value}",
+			certs:              []*x509.Certificate{cert},
+			expectedStatusCode: http.StatusOK,
+			expectedUserID:     "svc-billing",
+		},
+		"OkCaseURI": {
+			field:              MTLS_FIELD_URI,
+			template:           "{host}.{path}",
+			certs:              []*x509.Certificate{cert},
+			expectedStatusCode: http.StatusOK,
+			expectedUserID:     "example.com.billing",
+		},
+		"OkCaseEmail": {
+			field:              MTLS_FIELD_EMAIL,
+			template:           "{value}",
+			certs:              []*x509.Certificate{cert},
+			expectedStatusCode: http.StatusOK,
+			expectedUserID:     "billing@example.com",
+		},
+		"ErrorCaseWithoutCertificate": {
+			field:              MTLS_FIELD_CN,
+			template:           "{value}",
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+		"ErrorCaseUntrustedCertificate": {
+			field:              MTLS_FIELD_CN,
+			template:           "{value}",
+			certs:              []*x509.Certificate{untrustedCert},
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+		"ErrorCaseCertificateWithoutField": {
+			field:              MTLS_FIELD_EMAIL,
+			template:           "{value}",
+			certs:              []*x509.Certificate{nestedURICert},
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+		"ErrorCaseInvalidUser": {
+			field:              MTLS_FIELD_URI,
+			template:           "{path}",
+			certs:              []*x509.Certificate{nestedURICert},
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	logger := &log.Logger{
+		Out:       bytes.NewBuffer([]byte{}),
+		Formatter: &log.TextFormatter{},
+		Hooks:     make(log.LevelHooks),
+		Level:     log.DebugLevel,
+	}
+
+	for n, test := range testcases {
+		connector, err := InitMTLSConnector(logger, caFile, test.field, test.template)
+		if err != nil {
+			t.Errorf("Test %v failed. Unexpected error creating connector: %v", n, err)
+			continue
+		}
+		var userID string
+		handler := connector.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID = connector.RetrieveUserID(*r)
+		}))
+
+		r, _ := http.NewRequest(http.MethodGet, "/", nil)
+		// Header sent by client must be ignored
+		r.Header.Set(USER_ID_HEADER, "admin")
+		if test.certs != nil {
+			r.TLS = &tls.ConnectionState{PeerCertificates: test.certs}
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("Test %v failed. Received different http status code (wanted:%v / received:%v)", n, test.expectedStatusCode, w.Code)
+			continue
+		}
+		if userID != test.expectedUserID {
+			t.Errorf("Test %v failed. Received different user (wanted:%v / received:%v)", n, test.expectedUserID, userID)
+		}
+	}
+}
+
+func TestInitMTLSConnector(t *testing.T) {
+	ca, _ := createTestCertificate(t, "ca", nil, nil, nil)
+	caFile := writeTestCAFile(t, ca)
+	defer os.Remove(caFile)
+
+	testcases := map[string]struct {
+		caFile    string
+		field     string
+		template  string
+		wantError bool
+	}{
+		"OkCase": {
+			caFile:   caFile,
+			field:    MTLS_FIELD_URI,
+			template: "{host}.{path}",
+		},
+		"ErrorCaseInvalidField": {
+			caFile:    caFile,
+			field:     "dns",
+			template:  "{value}",
+			wantError: true,
+		},
+		"ErrorCaseTemplateWithoutFields": {
+			caFile:    caFile,
+			field:     MTLS_FIELD_CN,
+			template:  "user1",
+			wantError: true,
+		},
+		"ErrorCaseCAFileNotFound": {
+			caFile:    caFile + ".notfound",
+			field:     MTLS_FIELD_CN,
+			template:  "{value}",
+			wantError: true,
+		},
+	}
+
+	for n, test := range testcases {
+		connector, err := InitMTLSConnector(log.New(), test.caFile, test.field, test.template)
+		if (err != nil) != test.wantError {
+			t.Errorf("Test %v failed. Received error %v, wanted error: %v", n, err, test.wantError)
+			continue
+		}
+		if err == nil && !RequiresClientCertificates(connector) {
+			t.Errorf("Test %v failed. Connector doesn't require client certificates", n)
+		}
+	}
+}
+
+// Private helper methods
+
+// Create a CA certificate if parent is nil, or a client certificate signed by parent with subject alternative names
+func createTestCertificate(t *testing.T, cn string, sans []asn1.RawValue, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected error generating key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	} else {
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+	if len(sans) > 0 {
+		value, err := asn1.Marshal(sans)
+		if err != nil {
+			t.Fatalf("Unexpected error marshalling subject alternative names: %v", err)
+		}
+		template.ExtraExtensions = []pkix.Extension{{Id: oidSubjectAltName, Value: value}}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("Unexpected error creating certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing certificate: %v", err)
+	}
+	return cert, key
+}
+
+func writeTestCAFile(t *testing.T, ca *x509.Certificate) string {
+	f, err := ioutil.TempFile("", "foulkon-ca")
+	if err != nil {
+		t.Fatalf("Unexpected error creating CA file: %v", err)
+	}
+	defer f.Close()
+	if err := pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}); err != nil {
+		t.Fatalf("Unexpected error writing CA file: %v", err)
+	}
+	return f.Name()
+}
@@ -1,24 +1,69 @@
 package auth
 
 import (
+	"encoding/json"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"fmt"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/Tecsisa/foulkon/api"
 	"github.com/emanoelxavier/openid2go/openid"
 )
 
 const (
 	USER_ID_HEADER = "X-FOULKON-USER-ID"
+	// Header with the claims of the authenticated user, encoded as a JSON object
+	CLAIMS_HEADER = "X-FOULKON-CLAIMS"
+
+	// Transforms of the user claim
+	OIDC_TRANSFORM_LOWERCASE = "lowercase"
+	OIDC_TRANSFORM_UPPERCASE = "uppercase"
+	OIDC_TRANSFORM_LOCALPART = "localpart"
+
+	OIDC_DEFAULT_USER_CLAIM = "sub"
 )
 
+var rClaimName = regexp.MustCompile(`^[\w\-]+$`)
+
+// OIDCClaimMapping configures how claims of ID tokens are mapped to users. UserClaim is the claim used as
+// user ID, changed by UserTransforms in order, and Claims are carried into the request for authorization.
+type OIDCClaimMapping struct {
+	UserClaim      string
+	UserTransforms []string
+	Claims         []string
+}
+
 // OIDCAuthConnector represents an OIDC connector that implements interface of auth connector
 type OIDCAuthConnector struct {
+	logger        *log.Logger
 	configuration openid.Configuration
+	mapping       OIDCClaimMapping
 }
 
-func InitOIDCConnector(logger *log.Logger, provider string, clientids []string) (AuthConnector, error) {
+func InitOIDCConnector(logger *log.Logger, provider string, clientids []string, mapping OIDCClaimMapping) (AuthConnector, error) {
+	if mapping.UserClaim == "" {
+		mapping.UserClaim = OIDC_DEFAULT_USER_CLAIM
+	}
+	if !rClaimName.MatchString(mapping.UserClaim) {
+		return nil, fmt.Errorf("Invalid user claim for OIDC connector: %v", mapping.UserClaim)
+	}
+	for _, transform := range mapping.UserTransforms {
+		switch transform {
+		case OIDC_TRANSFORM_LOWERCASE, OIDC_TRANSFORM_UPPERCASE, OIDC_TRANSFORM_LOCALPART:
+		default:
+			return nil, fmt.Errorf("Invalid user transform for OIDC connector: %v", transform)
+		}
+	}
+	for _, claim := range mapping.Claims {
+		if !rClaimName.MatchString(claim) {
+			return nil, fmt.Errorf("Invalid claim for OIDC connector: %v", claim)
+		}
+	}
+
 	getProviders := func() ([]openid.Provider, error) {
 		provider, err := openid.NewProvider(provider, clientids)
 
@@ -46,7 +91,9 @@ func InitOIDCConnector(logger *log.Logger, provider string, clientids []string)
 	}
 	configuration, _ := openid.NewConfiguration(openid.ProvidersGetter(getProviders), openid.ErrorHandler(errorHandler))
 	return &OIDCAuthConnector{
+		logger:        logger,
 		configuration: *configuration,
+		mapping:       mapping,
 	}, nil
 
 }
@@ -54,8 +101,7 @@ func InitOIDCConnector(logger *log.Logger, provider string, clientids []string)
 // This method retrieves data from request an checks if user is correctly authenticated
 func (c OIDCAuthConnector) Authenticate(h http.Handler) http.Handler {
 	userHandler := func(u *openid.User, w http.ResponseWriter, r *http.Request) {
-		r.Header.Add(USER_ID_HEADER, u.ID)
-		h.ServeHTTP(w, r)
+		c.authenticateUser(u, h).ServeHTTP(w, r)
 	}
 	return openid.AuthenticateUser(&c.configuration, openid.UserHandlerFunc(userHandler))
 }
@@ -65,3 +111,99 @@ func (c OIDCAuthConnector) RetrieveUserID(r http.Request) string {
 	userID := r.Header.Get(USER_ID_HEADER)
 	return userID
 }
+
+// PRIVATE HELPER METHODS
+
+// Map claims of a validated token to the user and claims headers before calling the handler
+func (c OIDCAuthConnector) authenticateUser(u *openid.User, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Headers can't be sent by clients
+		r.Header.Del(USER_ID_HEADER)
+		r.Header.Del(CLAIMS_HEADER)
+
+		userID, claims, err := c.mapping.getUser(u)
+		if err != nil {
+			c.logger.WithFields(log.Fields{
+				"requestID": r.Header.Get("Request-ID"),
+			}).Error(err.Error())
+			http.Error(w, fmt.Sprintf("Error %v", err.Error()), http.StatusUnauthorized)
+			return
+		}
+
+		r.Header.Set(USER_ID_HEADER, userID)
+		if len(claims) > 0 {
+			encoded, err := json.Marshal(claims)
+			if err != nil {
+				http.Error(w, "Unexpected error", http.StatusInternalServerError)
+				return
+			}
+			r.Header.Set(CLAIMS_HEADER, string(encoded))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Return the user ID and configured claims of an OIDC user. Claims not found in the token are ignored
+func (m OIDCClaimMapping) getUser(u *openid.User) (string, map[string]string, error) {
+	var userID string
+	if m.UserClaim == OIDC_DEFAULT_USER_CLAIM || m.UserClaim == "" {
+		userID = u.ID
+	} else {
+		value, ok := getClaimValue(u.Claims, m.UserClaim)
+		if !ok || strings.HasPrefix(value, ",") {
+			return "", nil, fmt.Errorf("Token without valid %v claim for user", m.UserClaim)
+		}
+		userID = value
+	}
+	for _, transform := range m.UserTransforms {
+		switch transform {
+		case OIDC_TRANSFORM_LOWERCASE:
+			userID = strings.ToLower(userID)
+		case OIDC_TRANSFORM_UPPERCASE:
+			userID = strings.ToUpper(userID)
+		case OIDC_TRANSFORM_LOCALPART:
+			if i := strings.LastIndex(userID, "@"); i >= 0 {
+				userID = userID[:i]
+			}
+		}
+	}
+	if !api.IsValidUserExternalID(userID) {
+		return "", nil, fmt.Errorf("Invalid user %v for %v claim", userID, m.UserClaim)
+	}
+
+	claims := map[string]string{}
+	for _, claim := range m.Claims {
+		if value, ok := getClaimValue(u.Claims, claim); ok {
+			claims[claim] = value
+		}
+	}
+	return userID, claims, nil
+}
+
+// Return a claim as string. Lists are joined with commas, also at the beginning and the end, so
+// conditions can match an element with patterns like "*,admins,*"
+func getClaimValue(claims map[string]interface{}, name string) (string, bool) {
+	switch v := claims[name].(type) {
+	case string:
+		return v, v != ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case []interface{}:
+		values := []string{}
+		for _, e := range v {
+			if _, nested := e.([]interface{}); nested {
+				continue
+			}
+			if value, ok := getClaimValue(map[string]interface{}{name: e}, name); ok {
+				values = append(values, value)
+			}
+		}
+		if len(values) == 0 {
+			return "", false
+		}
+		return "," + strings.Join(values, ",") + ",", true
+	}
+	return "", false
+}
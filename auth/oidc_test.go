@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/emanoelxavier/openid2go/openid"
+)
+
+func TestOIDCAuthConnector_authenticateUser(t *testing.T) {
+	user := &openid.User{
+		Issuer: "https://accounts.example.com",
+		ID:     "1234567890",
+		Claims: map[string]interface{}{
+			"sub":                "1234567890",
+			"email":              "John.Doe@Example.com",
+			"preferred_username": "jdoe",
+			"name":               "John Doe",
+			"email_verified":     true,
+			"level":              float64(3),
+			"groups":             []interface{}{"admins", "devs", []interface{}{"nested"}},
+			"tenant":             "tenant1",
+			"empty":              []interface{}{},
+		},
+	}
+	testcases := map[string]struct {
+		mapping OIDCClaimMapping
+		// Expected result
+		expectedStatusCode int
+		expectedUserID     string
+		expectedClaims     string
+	}{
+		"OkCaseDefaultSubject": {
+			expectedStatusCode: http.StatusOK,
+			expectedUserID:     "1234567890",
+		},
+		"OkCaseClaimWithTransforms": {
+			mapping: OIDCClaimMapping{
+				UserClaim:      "email",
+				UserTransforms: []string{OIDC_TRANSFORM_LOCALPART, OIDC_TRANSFORM_LOWERCASE},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedUserID:     "john.doe",
+		},
+		"OkCaseUppercase": {
+			mapping: OIDCClaimMapping{
+				UserClaim:      "preferred_username",
+				UserTransforms: []string{OIDC_TRANSFORM_UPPERCASE},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedUserID:     "JDOE",
+		},
+		"OkCaseClaims": {
+			mapping: OIDCClaimMapping{
+				UserClaim: "preferred_username",
+				Claims:    []string{"groups", "tenant", "email_verified", "level", "empty", "notfound"},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedUserID:     "jdoe",
+			expectedClaims:     `{"email_verified":"true","groups":",admins,devs,","level":"3","tenant":"tenant1"}`,
+		},
+		"ErrorCaseClaimNotFound": {
+			mapping: OIDCClaimMapping{
+				UserClaim: "upn",
+			},
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+		"ErrorCaseListClaim": {
+			mapping: OIDCClaimMapping{
+				UserClaim: "groups",
+			},
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+		"ErrorCaseInvalidUser": {
+			mapping: OIDCClaimMapping{
+				UserClaim:      "name",
+				UserTransforms: []string{OIDC_TRANSFORM_LOWERCASE},
+			},
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	logger := &log.Logger{
+		Out:       bytes.NewBuffer([]byte{}),
+		Formatter: &log.TextFormatter{},
+		Hooks:     make(log.LevelHooks),
+		Level:     log.DebugLevel,
+	}
+
+	for n, test := range testcases {
+		connector := OIDCAuthConnector{
+			logger:  logger,
+			mapping: test.mapping,
+		}
+		var userID, claims string
+		handler := connector.authenticateUser(user, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID = connector.RetrieveUserID(*r)
+			claims = r.Header.Get(CLAIMS_HEADER)
+		}))
+
+		r, _ := http.NewRequest(http.MethodGet, "/", nil)
+		// Headers sent by client must be ignored
+		r.Header.Set(USER_ID_HEADER, "admin")
+		r.Header.Set(CLAIMS_HEADER, `{"groups":",admins,"}`)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("Test %v failed. Received different http status code (wanted:%v / received:%v)", n, test.expectedStatusCode, w.Code)
+			continue
+		}
+		if userID != test.expectedUserID {
+			t.Errorf("Test %v failed. Received different user (wanted:%v / received:%v)", n, test.expectedUserID, userID)
+		}
+		if claims != test.expectedClaims {
+			t.Errorf("Test %v failed. Received different claims (wanted:%v / received:%v)", n, test.expectedClaims, claims)
+		}
+	}
+}
+
+func TestInitOIDCConnector(t *testing.T) {
+	testcases := map[string]struct {
+		mapping   OIDCClaimMapping
+		wantError bool
+	}{
+		"OkCase": {
+			mapping: OIDCClaimMapping{
+				UserClaim:      "email",
+				UserTransforms: []string{OIDC_TRANSFORM_LOCALPART, OIDC_TRANSFORM_LOWERCASE},
+				Claims:         []string{"groups", "tenant"},
+			},
+		},
+		"OkCaseDefaultMapping": {},
+		"ErrorCaseInvalidUserClaim": {
+			mapping: OIDCClaimMapping{
+				UserClaim: "email address",
+			},
+			wantError: true,
+		},
+		"ErrorCaseInvalidTransform": {
+			mapping: OIDCClaimMapping{
+				UserTransforms: []string{"trim"},
+			},
+			wantError: true,
+		},
+		"ErrorCaseInvalidClaim": {
+			mapping: OIDCClaimMapping{
+				Claims: []string{"groups", "foulkon:tenant"},
+			},
+			wantError: true,
+		},
+	}
+
+	for n, test := range testcases {
+		_, err := InitOIDCConnector(log.New(), "https://accounts.example.com", []string{"client1"}, test.mapping)
+		if (err != nil) != test.wantError {
+			t.Errorf("Test %v failed. Received error %v, wanted error: %v", n, err, test.wantError)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/Tecsisa/foulkon/foulkon"
 	internalhttp "github.com/Tecsisa/foulkon/http"
@@ -37,6 +38,13 @@ func main() {
 		os.Exit(1)
 	}
 
+	router, err := internalhttp.ProxyHandlerRouter(proxy)
+	if err != nil {
+		proxy.Logger.Error(err)
+		foulkon.CloseProxy()
+		os.Exit(1)
+	}
+
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig,
 		syscall.SIGHUP,
@@ -48,7 +56,10 @@ func main() {
 		for {
 			sigrecv := <-sig
 			switch sigrecv {
-			case syscall.SIGINT, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGQUIT:
+			case syscall.SIGHUP:
+				proxy.Logger.Infof("Signal '%v' received, reloading resources...", sigrecv.String())
+				reloadResources(proxy, router, *configFile)
+			case syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT:
 				proxy.Logger.Infof("Signal '%v' received, closing proxy...", sigrecv.String())
 				os.Exit(foulkon.CloseProxy())
 			default:
@@ -57,13 +68,53 @@ func main() {
 		}
 	}()
 
+	// Reload resources when config file changes
+	if proxy.WatchInterval > 0 {
+		go watchConfigFile(proxy, router, *configFile)
+	}
+
 	proxy.Logger.Infof("Server running in %v:%v", proxy.Host, proxy.Port)
 	if proxy.CertFile != "" && proxy.KeyFile != "" {
-		proxy.Logger.Error(http.ListenAndServeTLS(proxy.Host+":"+proxy.Port, proxy.CertFile, proxy.KeyFile, internalhttp.ProxyHandlerRouter(proxy)).Error())
+		proxy.Logger.Error(http.ListenAndServeTLS(proxy.Host+":"+proxy.Port, proxy.CertFile, proxy.KeyFile, router).Error())
 	} else {
-		proxy.Logger.Error(http.ListenAndServe(proxy.Host+":"+proxy.Port, internalhttp.ProxyHandlerRouter(proxy)).Error())
+		proxy.Logger.Error(http.ListenAndServe(proxy.Host+":"+proxy.Port, router).Error())
 	}
 
 	os.Exit(foulkon.CloseProxy())
 
 }
+
+// Read resources from config file and replace the current ones, keeping them if there is any error
+func reloadResources(proxy *foulkon.Proxy, router *internalhttp.ProxyRouter, configFile string) {
+	config, err := toml.LoadFile(configFile)
+	if err == nil {
+		var resources []foulkon.APIResource
+		if resources, err = foulkon.ReadProxyResources(config); err == nil {
+			err = router.Reload(resources)
+		}
+	}
+	if err != nil {
+		proxy.Logger.Errorf("Error reloading resources from %v, keeping current ones: %v", configFile, err)
+	}
+}
+
+// Check periodically the modification time of config file, reloading resources when it changes
+func watchConfigFile(proxy *foulkon.Proxy, router *internalhttp.ProxyRouter, configFile string) {
+	var modTime time.Time
+	if info, err := os.Stat(configFile); err == nil {
+		modTime = info.ModTime()
+	}
+	for range time.Tick(proxy.WatchInterval) {
+		info, err := os.Stat(configFile)
+		if err != nil {
+			proxy.Logger.Errorf("Error checking config file %v: %v", configFile, err)
+			continue
+		}
+		if info.ModTime().Equal(modTime) {
+			continue
+		}
+		modTime = info.ModTime()
+		proxy.Logger.Infof("Config file %v changed, reloading resources...", configFile)
+		reloadResources(proxy, router, configFile)
+	}
+}
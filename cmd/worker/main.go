@@ -16,11 +16,23 @@ import (
 )
 
 func main() {
+	// Migrate subcommand: worker migrate up|down|status -config-file=...
+	args := os.Args[1:]
+	migrateCommand := ""
+	if len(args) > 0 && args[0] == "migrate" {
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "Usage: worker migrate up|down|status -config-file=<file>")
+			os.Exit(1)
+		}
+		migrateCommand = args[1]
+		args = args[2:]
+	}
+
 	// Retrieve config file
 	fs := flag.NewFlagSet("foulkon", flag.ExitOnError)
 	configFile := fs.String("config-file", "", "Config file for worker")
 
-	if err := fs.Parse(os.Args[1:]); err != nil {
+	if err := fs.Parse(args); err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	}
@@ -32,6 +44,14 @@ func main() {
 		os.Exit(1)
 	}
 
+	if migrateCommand != "" {
+		if err := foulkon.Migrate(config, migrateCommand, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	// Create Worker
 	core, err := foulkon.NewWorker(config)
 	if err != nil {
@@ -61,7 +81,12 @@ func main() {
 
 	core.Logger.Infof("Server running in %v:%v", core.Host, core.Port)
 	if core.CertFile != "" && core.KeyFile != "" {
-		core.Logger.Error(http.ListenAndServeTLS(core.Host+":"+core.Port, core.CertFile, core.KeyFile, internalhttp.WorkerHandlerRouter(core)).Error())
+		server := &http.Server{
+			Addr:      core.Host + ":" + core.Port,
+			Handler:   internalhttp.WorkerHandlerRouter(core),
+			TLSConfig: core.TLSConfig,
+		}
+		core.Logger.Error(server.ListenAndServeTLS(core.CertFile, core.KeyFile).Error())
 	} else {
 		core.Logger.Error(http.ListenAndServe(core.Host+":"+core.Port, internalhttp.WorkerHandlerRouter(core)).Error())
 	}
@@ -0,0 +1,1044 @@
+// Package conformance contains tests shared by all repository implementations, so every
+// database type behaves like the postgresql one.
+package conformance
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Tecsisa/foulkon/api"
+	"github.com/Tecsisa/foulkon/database"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+// Repos contains the repositories to test. They must be empty when they are returned.
+type Repos struct {
+	UserRepo           api.UserRepo
+	GroupRepo          api.GroupRepo
+	PolicyRepo         api.PolicyRepo
+	ServiceAccountRepo api.ServiceAccountRepo
+	AuditRepo          api.AuditRepo
+	EventRepo          api.EventRepo
+	TxRepo             api.TxRepo
+}
+
+var now = time.Date(2016, time.October, 1, 10, 0, 0, 0, time.UTC)
+
+// RunRepoTests runs the conformance tests, calling newRepos to get empty repositories for each test.
+func RunRepoTests(t *testing.T, newRepos func(t *testing.T) Repos) {
+	tests := map[string]func(t *testing.T, repos Repos){
+		"Users":           testUsers,
+		"UsersFilter":     testUsersFiltered,
+		"Groups":          testGroups,
+		"GroupsFilter":    testGroupsFiltered,
+		"Members":         testMembers,
+		"Policies":        testPolicies,
+		"PoliciesFilter":  testPoliciesFiltered,
+		"Attachments":     testAttachments,
+		"Statements":      testEffectiveStatements,
+		"ServiceAccounts": testServiceAccounts,
+		"AuditEvents":     testAuditEvents,
+		"Outbox":          testOutbox,
+		"Transactions":    testTransactions,
+	}
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			test(t, newRepos(t))
+		})
+	}
+}
+
+// USER
+
+func testUsers(t *testing.T, repos Repos) {
+	user := makeUser("1", "/path/", 0)
+	created, err := repos.UserRepo.AddUser(user)
+	if err != nil {
+		t.Fatalf("Unexpected error adding user: %v", err)
+	}
+	checkResponse(t, "AddUser", created, &user)
+
+	// Duplicated user
+	_, err = repos.UserRepo.AddUser(user)
+	checkErrorCode(t, "AddUserDuplicated", err, database.INTERNAL_ERROR)
+
+	stored, err := repos.UserRepo.GetUserByExternalID(user.ExternalID)
+	if err != nil {
+		t.Fatalf("Unexpected error getting user: %v", err)
+	}
+	checkResponse(t, "GetUserByExternalID", stored, &user)
+
+	_, err = repos.UserRepo.GetUserByExternalID("unknown")
+	checkError(t, "GetUserByExternalIDNotFound", err, &database.Error{
+		Code:    database.USER_NOT_FOUND,
+		Message: "User with externalId unknown not found",
+	})
+
+	user.Path = "/newpath/"
+	user.Urn = api.CreateUrn("", api.RESOURCE_USER, user.Path, user.ExternalID)
+	user.UpdateAt = now.Add(time.Hour)
+	updated, err := repos.UserRepo.UpdateUser(user)
+	if err != nil {
+		t.Fatalf("Unexpected error updating user: %v", err)
+	}
+	checkResponse(t, "UpdateUser", updated, &user)
+	stored, err = repos.UserRepo.GetUserByExternalID(user.ExternalID)
+	if err != nil {
+		t.Fatalf("Unexpected error getting updated user: %v", err)
+	}
+	checkResponse(t, "GetUpdatedUser", stored, &user)
+
+	if err := repos.UserRepo.RemoveUser(user.ID); err != nil {
+		t.Fatalf("Unexpected error removing user: %v", err)
+	}
+	_, err = repos.UserRepo.GetUserByExternalID(user.ExternalID)
+	checkErrorCode(t, "GetRemovedUser", err, database.USER_NOT_FOUND)
+}
+
+func testUsersFiltered(t *testing.T, repos Repos) {
+	users := []api.User{
+		makeUser("1", "/path/", 0),
+		makeUser("2", "/path/sub/", 1),
+		makeUser("3", "/other/", 2),
+	}
+	for _, user := range users {
+		if _, err := repos.UserRepo.AddUser(user); err != nil {
+			t.Fatalf("Unexpected error adding user: %v", err)
+		}
+	}
+
+	testcases := map[string]struct {
+		filter        *api.Filter
+		expectedUsers []api.User
+		expectedTotal int
+	}{
+		"All": {
+			filter: &api.Filter{
+				OrderBy: "create_at asc",
+			},
+			expectedUsers: users,
+			expectedTotal: 3,
+		},
+		"PathPrefix": {
+			filter: &api.Filter{
+				PathPrefix: "/path/",
+				OrderBy:    "create_at asc",
+			},
+			expectedUsers: users[:2],
+			expectedTotal: 2,
+		},
+		"OrderBy": {
+			filter: &api.Filter{
+				OrderBy: "create_at desc",
+			},
+			expectedUsers: []api.User{users[2], users[1], users[0]},
+			expectedTotal: 3,
+		},
+		"Pagination": {
+			filter: &api.Filter{
+				Offset:  1,
+				Limit:   1,
+				OrderBy: "create_at asc",
+			},
+			expectedUsers: users[1:2],
+			expectedTotal: 3,
+		},
+	}
+	for n, test := range testcases {
+		received, total, err := repos.UserRepo.GetUsersFiltered(test.filter)
+		if err != nil {
+			t.Errorf("Test %v failed. Unexpected error: %v", n, err)
+			continue
+		}
+		checkResponse(t, n, received, test.expectedUsers)
+		checkResponse(t, n+"Total", total, test.expectedTotal)
+	}
+
+	received, total, err := repos.UserRepo.GetUsersFiltered(&api.Filter{PathPrefix: "/unknown/"})
+	if err != nil || len(received) != 0 || total != 0 {
+		t.Errorf("Test NoUsers failed. Received %v users, total %v and error %v", len(received), total, err)
+	}
+}
+
+// GROUP
+
+func testGroups(t *testing.T, repos Repos) {
+	group := makeGroup("1", "org1", "/path/", 0)
+	created, err := repos.GroupRepo.AddGroup(group)
+	if err != nil {
+		t.Fatalf("Unexpected error adding group: %v", err)
+	}
+	checkResponse(t, "AddGroup", created, &group)
+
+	_, err = repos.GroupRepo.AddGroup(group)
+	checkErrorCode(t, "AddGroupDuplicated", err, database.INTERNAL_ERROR)
+
+	stored, err := repos.GroupRepo.GetGroupByName(group.Org, group.Name)
+	if err != nil {
+		t.Fatalf("Unexpected error getting group: %v", err)
+	}
+	checkResponse(t, "GetGroupByName", stored, &group)
+
+	_, err = repos.GroupRepo.GetGroupByName("org1", "unknown")
+	checkError(t, "GetGroupByNameNotFound", err, &database.Error{
+		Code:    database.GROUP_NOT_FOUND,
+		Message: "Group with organization org1 and name unknown not found",
+	})
+
+	group.Name = "newname"
+	group.Path = "/newpath/"
+	group.Urn = api.CreateUrn(group.Org, api.RESOURCE_GROUP, group.Path, group.Name)
+	group.UpdateAt = now.Add(time.Hour)
+	updated, err := repos.GroupRepo.UpdateGroup(group)
+	if err != nil {
+		t.Fatalf("Unexpected error updating group: %v", err)
+	}
+	checkResponse(t, "UpdateGroup", updated, &group)
+	stored, err = repos.GroupRepo.GetGroupByName(group.Org, group.Name)
+	if err != nil {
+		t.Fatalf("Unexpected error getting updated group: %v", err)
+	}
+	checkResponse(t, "GetUpdatedGroup", stored, &group)
+
+	if err := repos.GroupRepo.RemoveGroup(group.ID); err != nil {
+		t.Fatalf("Unexpected error removing group: %v", err)
+	}
+	_, err = repos.GroupRepo.GetGroupByName(group.Org, group.Name)
+	checkErrorCode(t, "GetRemovedGroup", err, database.GROUP_NOT_FOUND)
+}
+
+func testGroupsFiltered(t *testing.T, repos Repos) {
+	groups := []api.Group{
+		makeGroup("1", "org1", "/path/", 0),
+		makeGroup("2", "org1", "/other/", 1),
+		makeGroup("3", "org2", "/path/", 2),
+	}
+	for _, group := range groups {
+		if _, err := repos.GroupRepo.AddGroup(group); err != nil {
+			t.Fatalf("Unexpected error adding group: %v", err)
+		}
+	}
+
+	testcases := map[string]struct {
+		filter         *api.Filter
+		expectedGroups []api.Group
+		expectedTotal  int
+	}{
+		"All": {
+			filter: &api.Filter{
+				OrderBy: "create_at asc",
+			},
+			expectedGroups: groups,
+			expectedTotal:  3,
+		},
+		"Org": {
+			filter: &api.Filter{
+				Org:     "org1",
+				OrderBy: "create_at asc",
+			},
+			expectedGroups: groups[:2],
+			expectedTotal:  2,
+		},
+		"PathPrefix": {
+			filter: &api.Filter{
+				PathPrefix: "/path/",
+				OrderBy:    "create_at asc",
+			},
+			expectedGroups: []api.Group{groups[0], groups[2]},
+			expectedTotal:  2,
+		},
+		"OrderBy": {
+			filter: &api.Filter{
+				OrderBy: "name desc",
+			},
+			expectedGroups: []api.Group{groups[2], groups[1], groups[0]},
+			expectedTotal:  3,
+		},
+		"Pagination": {
+			filter: &api.Filter{
+				Offset:  2,
+				Limit:   5,
+				OrderBy: "create_at asc",
+			},
+			expectedGroups: groups[2:],
+			expectedTotal:  3,
+		},
+	}
+	for n, test := range testcases {
+		received, total, err := repos.GroupRepo.GetGroupsFiltered(test.filter)
+		if err != nil {
+			t.Errorf("Test %v failed. Unexpected error: %v", n, err)
+			continue
+		}
+		checkResponse(t, n, received, test.expectedGroups)
+		checkResponse(t, n+"Total", total, test.expectedTotal)
+	}
+}
+
+func testMembers(t *testing.T, repos Repos) {
+	user1 := makeUser("1", "/path/", 0)
+	user2 := makeUser("2", "/path/", 1)
+	group := makeGroup("1", "org1", "/path/", 0)
+	for _, user := range []api.User{user1, user2} {
+		if _, err := repos.UserRepo.AddUser(user); err != nil {
+			t.Fatalf("Unexpected error adding user: %v", err)
+		}
+	}
+	if _, err := repos.GroupRepo.AddGroup(group); err != nil {
+		t.Fatalf("Unexpected error adding group: %v", err)
+	}
+
+	for _, user := range []api.User{user1, user2} {
+		if err := repos.GroupRepo.AddMember(user.ID, group.ID); err != nil {
+			t.Fatalf("Unexpected error adding member: %v", err)
+		}
+	}
+	err := repos.GroupRepo.AddMember(user1.ID, group.ID)
+	checkErrorCode(t, "AddMemberDuplicated", err, database.INTERNAL_ERROR)
+
+	isMember, err := repos.GroupRepo.IsMemberOfGroup(user1.ID, group.ID)
+	if err != nil || !isMember {
+		t.Errorf("Test IsMemberOfGroup failed. Received %v and error %v", isMember, err)
+	}
+
+	members, total, err := repos.GroupRepo.GetGroupMembers(group.ID, &api.Filter{})
+	if err != nil {
+		t.Fatalf("Unexpected error getting members: %v", err)
+	}
+	checkResponse(t, "GetGroupMembersTotal", total, 2)
+	memberIDs := []string{}
+	for _, member := range members {
+		memberIDs = append(memberIDs, member.GetUser().ID)
+	}
+	// Relations are created at the same time, so their order isn't checked
+	sort.Strings(memberIDs)
+	checkResponse(t, "GetGroupMembers", memberIDs, []string{user1.ID, user2.ID})
+
+	members, total, err = repos.GroupRepo.GetGroupMembers(group.ID, &api.Filter{Offset: 1, Limit: 1})
+	if err != nil || len(members) != 1 || total != 2 {
+		t.Errorf("Test GetGroupMembersPagination failed. Received %v members, total %v and error %v", len(members), total, err)
+	}
+
+	groups, total, err := repos.UserRepo.GetGroupsByUserID(user1.ID, &api.Filter{})
+	if err != nil || len(groups) != 1 || total != 1 {
+		t.Fatalf("Test GetGroupsByUserID failed. Received %v groups, total %v and error %v", len(groups), total, err)
+	}
+	checkResponse(t, "GetGroupsByUserID", groups[0].GetGroup(), &group)
+
+	if err := repos.GroupRepo.RemoveMember(user1.ID, group.ID); err != nil {
+		t.Fatalf("Unexpected error removing member: %v", err)
+	}
+	isMember, err = repos.GroupRepo.IsMemberOfGroup(user1.ID, group.ID)
+	if err != nil || isMember {
+		t.Errorf("Test IsMemberOfGroupRemoved failed. Received %v and error %v", isMember, err)
+	}
+
+	// Removing a user removes its relations
+	if err := repos.UserRepo.RemoveUser(user2.ID); err != nil {
+		t.Fatalf("Unexpected error removing user: %v", err)
+	}
+	members, total, err = repos.GroupRepo.GetGroupMembers(group.ID, &api.Filter{})
+	if err != nil || len(members) != 0 || total != 0 {
+		t.Errorf("Test GetGroupMembersRemovedUser failed. Received %v members, total %v and error %v", len(members), total, err)
+	}
+}
+
+// POLICY
+
+func testPolicies(t *testing.T, repos Repos) {
+	policy := makePolicy("1", "org1", "/path/", 0)
+	created, err := repos.PolicyRepo.AddPolicy(policy)
+	if err != nil {
+		t.Fatalf("Unexpected error adding policy: %v", err)
+	}
+	checkResponse(t, "AddPolicy", created, &policy)
+
+	_, err = repos.PolicyRepo.AddPolicy(policy)
+	checkErrorCode(t, "AddPolicyDuplicated", err, database.INTERNAL_ERROR)
+
+	stored, err := repos.PolicyRepo.GetPolicyByName(policy.Org, policy.Name)
+	if err != nil {
+		t.Fatalf("Unexpected error getting policy: %v", err)
+	}
+	checkResponse(t, "GetPolicyByName", stored, &policy)
+
+	_, err = repos.PolicyRepo.GetPolicyByName("org1", "unknown")
+	checkError(t, "GetPolicyByNameNotFound", err, &database.Error{
+		Code:    database.POLICY_NOT_FOUND,
+		Message: "Policy with organization org1 and name unknown not found",
+	})
+
+	policy.Name = "newname"
+	policy.Path = "/newpath/"
+	policy.Urn = api.CreateUrn(policy.Org, api.RESOURCE_POLICY, policy.Path, policy.Name)
+	policy.UpdateAt = now.Add(time.Hour)
+	policy.Statements = &[]api.Statement{
+		{
+			Effect:    "deny",
+			Actions:   []string{"iam:*"},
+			Resources: []string{"urn:everything:*"},
+		},
+	}
+	updated, err := repos.PolicyRepo.UpdatePolicy(policy)
+	if err != nil {
+		t.Fatalf("Unexpected error updating policy: %v", err)
+	}
+	checkResponse(t, "UpdatePolicy", updated, &policy)
+	stored, err = repos.PolicyRepo.GetPolicyByName(policy.Org, policy.Name)
+	if err != nil {
+		t.Fatalf("Unexpected error getting updated policy: %v", err)
+	}
+	checkResponse(t, "GetUpdatedPolicy", stored, &policy)
+
+	if err := repos.PolicyRepo.RemovePolicy(policy.ID); err != nil {
+		t.Fatalf("Unexpected error removing policy: %v", err)
+	}
+	_, err = repos.PolicyRepo.GetPolicyByName(policy.Org, policy.Name)
+	checkErrorCode(t, "GetRemovedPolicy", err, database.POLICY_NOT_FOUND)
+}
+
+func testPoliciesFiltered(t *testing.T, repos Repos) {
+	policies := []api.Policy{
+		makePolicy("1", "org1", "/path/", 0),
+		makePolicy("2", "org2", "/path/", 1),
+		makePolicy("3", "org1", "/other/", 2),
+	}
+	for _, policy := range policies {
+		if _, err := repos.PolicyRepo.AddPolicy(policy); err != nil {
+			t.Fatalf("Unexpected error adding policy: %v", err)
+		}
+	}
+
+	testcases := map[string]struct {
+		filter           *api.Filter
+		expectedPolicies []api.Policy
+		expectedTotal    int
+	}{
+		"All": {
+			filter: &api.Filter{
+				OrderBy: "create_at asc",
+			},
+			expectedPolicies: policies,
+			expectedTotal:    3,
+		},
+		"OrgAndPathPrefix": {
+			filter: &api.Filter{
+				Org:        "org1",
+				PathPrefix: "/path/",
+			},
+			expectedPolicies: policies[:1],
+			expectedTotal:    1,
+		},
+		"OrderByPagination": {
+			filter: &api.Filter{
+				OrderBy: "path asc",
+				Limit:   1,
+			},
+			expectedPolicies: policies[2:],
+			expectedTotal:    3,
+		},
+	}
+	for n, test := range testcases {
+		received, total, err := repos.PolicyRepo.GetPoliciesFiltered(test.filter)
+		if err != nil {
+			t.Errorf("Test %v failed. Unexpected error: %v", n, err)
+			continue
+		}
+		checkResponse(t, n, received, test.expectedPolicies)
+		checkResponse(t, n+"Total", total, test.expectedTotal)
+	}
+}
+
+func testAttachments(t *testing.T, repos Repos) {
+	group := makeGroup("1", "org1", "/path/", 0)
+	policy1 := makePolicy("1", "org1", "/path/", 0)
+	policy2 := makePolicy("2", "org1", "/path/", 1)
+	if _, err := repos.GroupRepo.AddGroup(group); err != nil {
+		t.Fatalf("Unexpected error adding group: %v", err)
+	}
+	for _, policy := range []api.Policy{policy1, policy2} {
+		if _, err := repos.PolicyRepo.AddPolicy(policy); err != nil {
+			t.Fatalf("Unexpected error adding policy: %v", err)
+		}
+		if err := repos.GroupRepo.AttachPolicy(group.ID, policy.ID); err != nil {
+			t.Fatalf("Unexpected error attaching policy: %v", err)
+		}
+	}
+	err := repos.GroupRepo.AttachPolicy(group.ID, policy1.ID)
+	checkErrorCode(t, "AttachPolicyDuplicated", err, database.INTERNAL_ERROR)
+
+	isAttached, err := repos.GroupRepo.IsAttachedToGroup(group.ID, policy1.ID)
+	if err != nil || !isAttached {
+		t.Errorf("Test IsAttachedToGroup failed. Received %v and error %v", isAttached, err)
+	}
+
+	attached, total, err := repos.GroupRepo.GetAttachedPolicies(group.ID, &api.Filter{})
+	if err != nil {
+		t.Fatalf("Unexpected error getting attached policies: %v", err)
+	}
+	checkResponse(t, "GetAttachedPoliciesTotal", total, 2)
+	policyIDs := []string{}
+	for _, rel := range attached {
+		policyIDs = append(policyIDs, rel.GetPolicy().ID)
+	}
+	sort.Strings(policyIDs)
+	checkResponse(t, "GetAttachedPolicies", policyIDs, []string{policy1.ID, policy2.ID})
+	for _, rel := range attached {
+		if rel.GetPolicy().ID == policy1.ID {
+			checkResponse(t, "GetAttachedPoliciesStatements", rel.GetPolicy(), &policy1)
+		}
+	}
+
+	groups, total, err := repos.PolicyRepo.GetAttachedGroups(policy1.ID, &api.Filter{})
+	if err != nil || len(groups) != 1 || total != 1 {
+		t.Fatalf("Test GetAttachedGroups failed. Received %v groups, total %v and error %v", len(groups), total, err)
+	}
+	checkResponse(t, "GetAttachedGroups", groups[0].GetGroup(), &group)
+
+	if err := repos.GroupRepo.DetachPolicy(group.ID, policy1.ID); err != nil {
+		t.Fatalf("Unexpected error detaching policy: %v", err)
+	}
+	isAttached, err = repos.GroupRepo.IsAttachedToGroup(group.ID, policy1.ID)
+	if err != nil || isAttached {
+		t.Errorf("Test IsAttachedToGroupDetached failed. Received %v and error %v", isAttached, err)
+	}
+
+	// Removing a group removes its relations
+	if err := repos.GroupRepo.RemoveGroup(group.ID); err != nil {
+		t.Fatalf("Unexpected error removing group: %v", err)
+	}
+	groups, total, err = repos.PolicyRepo.GetAttachedGroups(policy2.ID, &api.Filter{})
+	if err != nil || len(groups) != 0 || total != 0 {
+		t.Errorf("Test GetAttachedGroupsRemovedGroup failed. Received %v groups, total %v and error %v", len(groups), total, err)
+	}
+}
+
+func testEffectiveStatements(t *testing.T, repos Repos) {
+	user := makeUser("1", "/path/", 0)
+	group1 := makeGroup("1", "org1", "/path/", 0)
+	group2 := makeGroup("2", "org1", "/path/", 1)
+	group3 := makeGroup("3", "org1", "/path/", 2)
+	policy1 := makePolicy("1", "org1", "/path/", 0)
+	policy2 := makePolicy("2", "org1", "/path/", 1)
+	policy2.Statements = &[]api.Statement{
+		{
+			Effect:    "deny",
+			Actions:   []string{"example:*"},
+			Resources: []string{"urn:example:*"},
+		},
+		{
+			Effect:    "allow",
+			Actions:   []string{"example:Read"},
+			Resources: []string{"urn:example:resource"},
+		},
+	}
+	policy3 := makePolicy("3", "org1", "/path/", 2)
+	if _, err := repos.UserRepo.AddUser(user); err != nil {
+		t.Fatalf("Unexpected error adding user: %v", err)
+	}
+	for _, group := range []api.Group{group1, group2, group3} {
+		if _, err := repos.GroupRepo.AddGroup(group); err != nil {
+			t.Fatalf("Unexpected error adding group: %v", err)
+		}
+	}
+	for _, policy := range []api.Policy{policy1, policy2, policy3} {
+		if _, err := repos.PolicyRepo.AddPolicy(policy); err != nil {
+			t.Fatalf("Unexpected error adding policy: %v", err)
+		}
+	}
+	// Policy 1 is attached to both groups of the user, after policy 2, and policy 3 to a group without the user
+	for _, groupID := range []string{group1.ID, group2.ID} {
+		if err := repos.GroupRepo.AddMember(user.ID, groupID); err != nil {
+			t.Fatalf("Unexpected error adding member: %v", err)
+		}
+	}
+	attachments := [][]string{{group2.ID, policy2.ID}, {group1.ID, policy1.ID}, {group2.ID, policy1.ID}, {group3.ID, policy3.ID}}
+	for _, a := range attachments {
+		if err := repos.GroupRepo.AttachPolicy(a[0], a[1]); err != nil {
+			t.Fatalf("Unexpected error attaching policy: %v", err)
+		}
+	}
+
+	// Statements are ordered by policy organization and name, and by their position in the policy
+	testcases := map[string]struct {
+		userID   string
+		action   string
+		expected []api.Statement
+	}{
+		"AllActions": {
+			userID:   user.ID,
+			expected: []api.Statement{(*policy1.Statements)[0], (*policy2.Statements)[0], (*policy2.Statements)[1]},
+		},
+		"Action": {
+			userID:   user.ID,
+			action:   "iam:GetUser",
+			expected: []api.Statement{(*policy1.Statements)[0]},
+		},
+		"ActionPrefix": {
+			userID:   user.ID,
+			action:   "example:Read",
+			expected: []api.Statement{(*policy2.Statements)[0], (*policy2.Statements)[1]},
+		},
+		"NoMatches": {
+			userID:   user.ID,
+			action:   "iam:ListUsers",
+			expected: []api.Statement{},
+		},
+		"UserWithoutGroups": {
+			userID:   "UnknownUserID",
+			expected: []api.Statement{},
+		},
+	}
+	for n, test := range testcases {
+		statements, err := repos.PolicyRepo.GetEffectiveStatementsByUser(test.userID, test.action)
+		if err != nil {
+			t.Errorf("Test %v failed. Unexpected error: %v", n, err)
+			continue
+		}
+		checkResponse(t, n, statements, test.expected)
+	}
+}
+
+// SERVICE ACCOUNT
+
+func testServiceAccounts(t *testing.T, repos Repos) {
+	user1 := makeUser("1", "/path/", 0)
+	user2 := makeUser("2", "/path/", 1)
+	for _, user := range []api.User{user1, user2} {
+		if _, err := repos.UserRepo.AddUser(user); err != nil {
+			t.Fatalf("Unexpected error adding user: %v", err)
+		}
+	}
+	sa1 := makeServiceAccount("1", user1.ExternalID, 0)
+	sa2 := makeServiceAccount("2", user2.ExternalID, 1)
+	sa3 := makeServiceAccount("3", user1.ExternalID, 2)
+	for _, sa := range []api.ServiceAccount{sa1, sa2, sa3} {
+		created, err := repos.ServiceAccountRepo.AddServiceAccount(sa)
+		if err != nil {
+			t.Fatalf("Unexpected error adding service account: %v", err)
+		}
+		checkResponse(t, "AddServiceAccount"+sa.Name, created, &sa)
+	}
+
+	// Duplicated service account
+	_, err := repos.ServiceAccountRepo.AddServiceAccount(sa1)
+	checkErrorCode(t, "AddServiceAccountDuplicated", err, database.INTERNAL_ERROR)
+
+	stored, err := repos.ServiceAccountRepo.GetServiceAccountByName(sa1.Name)
+	if err != nil {
+		t.Fatalf("Unexpected error getting service account: %v", err)
+	}
+	checkResponse(t, "GetServiceAccountByName", stored, &sa1)
+	_, err = repos.ServiceAccountRepo.GetServiceAccountByName("unknown")
+	checkError(t, "GetServiceAccountByNameNotFound", err, &database.Error{
+		Code:    database.SERVICE_ACCOUNT_NOT_FOUND,
+		Message: "Service account with name unknown not found",
+	})
+
+	stored, err = repos.ServiceAccountRepo.GetServiceAccountByKeyHash(sa2.KeyHash)
+	if err != nil {
+		t.Fatalf("Unexpected error getting service account by key: %v", err)
+	}
+	checkResponse(t, "GetServiceAccountByKeyHash", stored, &sa2)
+	_, err = repos.ServiceAccountRepo.GetServiceAccountByKeyHash("unknown")
+	checkErrorCode(t, "GetServiceAccountByKeyHashNotFound", err, database.SERVICE_ACCOUNT_NOT_FOUND)
+
+	testcases := map[string]struct {
+		filter        *api.Filter
+		expected      []api.ServiceAccount
+		expectedTotal int
+	}{
+		"All": {
+			filter:        &api.Filter{},
+			expected:      []api.ServiceAccount{sa1, sa2, sa3},
+			expectedTotal: 3,
+		},
+		"ExternalID": {
+			filter:        &api.Filter{ExternalID: user1.ExternalID},
+			expected:      []api.ServiceAccount{sa1, sa3},
+			expectedTotal: 2,
+		},
+		"OrderBy": {
+			filter:        &api.Filter{OrderBy: "name desc"},
+			expected:      []api.ServiceAccount{sa3, sa2, sa1},
+			expectedTotal: 3,
+		},
+		"Pagination": {
+			filter:        &api.Filter{Offset: 1, Limit: 1},
+			expected:      []api.ServiceAccount{sa2},
+			expectedTotal: 3,
+		},
+	}
+	for n, test := range testcases {
+		serviceAccounts, total, err := repos.ServiceAccountRepo.GetServiceAccountsFiltered(test.filter)
+		if err != nil {
+			t.Errorf("Test %v failed. Unexpected error: %v", n, err)
+			continue
+		}
+		checkResponse(t, n, serviceAccounts, test.expected)
+		checkResponse(t, n+"Total", total, test.expectedTotal)
+	}
+
+	if err := repos.ServiceAccountRepo.RemoveServiceAccount(sa2.ID); err != nil {
+		t.Fatalf("Unexpected error removing service account: %v", err)
+	}
+	_, err = repos.ServiceAccountRepo.GetServiceAccountByKeyHash(sa2.KeyHash)
+	checkErrorCode(t, "GetRemovedServiceAccount", err, database.SERVICE_ACCOUNT_NOT_FOUND)
+
+	// Service accounts are removed with their user
+	if err := repos.UserRepo.RemoveUser(user1.ID); err != nil {
+		t.Fatalf("Unexpected error removing user: %v", err)
+	}
+	serviceAccounts, total, err := repos.ServiceAccountRepo.GetServiceAccountsFiltered(&api.Filter{})
+	if err != nil {
+		t.Fatalf("Unexpected error getting service accounts: %v", err)
+	}
+	checkResponse(t, "RemoveUser", serviceAccounts, []api.ServiceAccount{})
+	checkResponse(t, "RemoveUserTotal", total, 0)
+}
+
+// Aux methods
+
+// AUDIT
+
+func testAuditEvents(t *testing.T, repos Repos) {
+	state := json.RawMessage(`{"externalId":"user1"}`)
+	created := makeAuditEvent("1", "admin", api.USER_ACTION_CREATE_USER, "urn:iws:iam::user/user1", 0)
+	created.After = &state
+	updated := makeAuditEvent("2", "admin", api.USER_ACTION_UPDATE_USER, "urn:iws:iam::user/user1", 1)
+	updated.Before = &state
+	updated.After = &state
+	deleted := makeAuditEvent("3", "other", api.USER_ACTION_DELETE_USER, "urn:iws:iam::user/user1", 2)
+	deleted.Before = &state
+	group := makeAuditEvent("4", "admin", api.GROUP_ACTION_CREATE_GROUP, "urn:iws:iam:org1:group/group1", 3)
+	for _, event := range []api.AuditEvent{created, updated, deleted, group} {
+		if err := repos.AuditRepo.AddAuditEvent(event); err != nil {
+			t.Fatalf("Unexpected error adding audit event: %v", err)
+		}
+	}
+
+	// Duplicated event
+	err := repos.AuditRepo.AddAuditEvent(created)
+	checkErrorCode(t, "AddAuditEventDuplicated", err, database.INTERNAL_ERROR)
+
+	testcases := map[string]struct {
+		filter        *api.AuditFilter
+		expected      []api.AuditEvent
+		expectedTotal int
+	}{
+		"All": {
+			filter:        &api.AuditFilter{},
+			expected:      []api.AuditEvent{group, deleted, updated, created},
+			expectedTotal: 4,
+		},
+		"Actor": {
+			filter:        &api.AuditFilter{Actor: "other"},
+			expected:      []api.AuditEvent{deleted},
+			expectedTotal: 1,
+		},
+		"Urn": {
+			filter:        &api.AuditFilter{Urn: "urn:iws:iam::user/user1"},
+			expected:      []api.AuditEvent{deleted, updated, created},
+			expectedTotal: 3,
+		},
+		"Action": {
+			filter:        &api.AuditFilter{Action: api.USER_ACTION_UPDATE_USER},
+			expected:      []api.AuditEvent{updated},
+			expectedTotal: 1,
+		},
+		"DateRange": {
+			filter: &api.AuditFilter{
+				From: now.Add(time.Minute),
+				To:   now.Add(2 * time.Minute),
+			},
+			expected:      []api.AuditEvent{deleted, updated},
+			expectedTotal: 2,
+		},
+		"Pagination": {
+			filter:        &api.AuditFilter{Offset: 1, Limit: 2},
+			expected:      []api.AuditEvent{deleted, updated},
+			expectedTotal: 4,
+		},
+		"NoMatches": {
+			filter:        &api.AuditFilter{Actor: "unknown"},
+			expected:      []api.AuditEvent{},
+			expectedTotal: 0,
+		},
+	}
+	for n, test := range testcases {
+		events, total, err := repos.AuditRepo.GetAuditEventsFiltered(test.filter)
+		if err != nil {
+			t.Errorf("Test %v failed. Unexpected error: %v", n, err)
+			continue
+		}
+		checkResponse(t, n, events, test.expected)
+		checkResponse(t, n+"Total", total, test.expectedTotal)
+	}
+}
+
+// EVENT
+
+func testOutbox(t *testing.T, repos Repos) {
+	data := json.RawMessage(`{"externalId":"user1"}`)
+	event1 := api.Event{
+		ID:        "EventID1",
+		Type:      api.USER_CREATED_EVENT,
+		Urn:       "urn:iws:iam::user/user1",
+		Actor:     "admin",
+		RequestID: "RequestID1",
+		CreateAt:  now,
+		Data:      &data,
+	}
+	event2 := api.Event{
+		ID:        "EventID2",
+		Type:      api.MEMBER_ADDED_EVENT,
+		Urn:       "urn:iws:iam:org1:group/group1",
+		Actor:     "admin",
+		RequestID: "RequestID2",
+		CreateAt:  now.Add(time.Minute),
+	}
+	entry1 := api.OutboxEntry{Event: event1, Sink: "sink1", NextAttemptAt: event1.CreateAt}
+	entry2 := api.OutboxEntry{Event: event1, Sink: "sink2", NextAttemptAt: event1.CreateAt}
+	entry3 := api.OutboxEntry{Event: event2, Sink: "sink1", NextAttemptAt: event2.CreateAt}
+	if err := repos.EventRepo.AddOutboxEntries([]api.OutboxEntry{entry1, entry2, entry3}); err != nil {
+		t.Fatalf("Unexpected error adding outbox entries: %v", err)
+	}
+
+	// Duplicated entries aren't stored
+	err := repos.EventRepo.AddOutboxEntries([]api.OutboxEntry{
+		{Event: event2, Sink: "sink2", NextAttemptAt: event2.CreateAt},
+		entry1,
+	})
+	checkErrorCode(t, "AddOutboxEntriesDuplicated", err, database.INTERNAL_ERROR)
+
+	pending, err := repos.EventRepo.GetPendingOutboxEntries(now.Add(time.Hour), 0)
+	if err != nil {
+		t.Fatalf("Unexpected error getting pending entries: %v", err)
+	}
+	checkResponse(t, "GetPendingOutboxEntries", pending, []api.OutboxEntry{entry1, entry2, entry3})
+
+	pending, err = repos.EventRepo.GetPendingOutboxEntries(now, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error getting pending entries: %v", err)
+	}
+	checkResponse(t, "GetPendingOutboxEntriesLimit", pending, []api.OutboxEntry{entry1})
+
+	// Failed attempt delays entry
+	entry1.Attempts = 1
+	entry1.NextAttemptAt = now.Add(2 * time.Minute)
+	entry1.LastError = "Unexpected status code 500"
+	if err := repos.EventRepo.UpdateOutboxEntry(entry1); err != nil {
+		t.Fatalf("Unexpected error updating entry: %v", err)
+	}
+	pending, err = repos.EventRepo.GetPendingOutboxEntries(now.Add(time.Hour), 0)
+	if err != nil {
+		t.Fatalf("Unexpected error getting pending entries: %v", err)
+	}
+	checkResponse(t, "UpdateOutboxEntry", pending, []api.OutboxEntry{entry2, entry3, entry1})
+
+	err = repos.EventRepo.UpdateOutboxEntry(api.OutboxEntry{Event: api.Event{ID: "unknown"}, Sink: "sink1"})
+	checkError(t, "UpdateOutboxEntryNotFound", err, &database.Error{
+		Code:    database.OUTBOX_ENTRY_NOT_FOUND,
+		Message: "Outbox entry with event id unknown and sink sink1 not found",
+	})
+
+	// Delivered entry
+	if err := repos.EventRepo.RemoveOutboxEntry(entry2.Event.ID, entry2.Sink); err != nil {
+		t.Fatalf("Unexpected error removing entry: %v", err)
+	}
+	pending, err = repos.EventRepo.GetPendingOutboxEntries(now.Add(time.Hour), 0)
+	if err != nil {
+		t.Fatalf("Unexpected error getting pending entries: %v", err)
+	}
+	checkResponse(t, "RemoveOutboxEntry", pending, []api.OutboxEntry{entry3, entry1})
+
+	err = repos.EventRepo.RemoveOutboxEntry(entry2.Event.ID, entry2.Sink)
+	checkError(t, "RemoveOutboxEntryNotFound", err, &database.Error{
+		Code:    database.OUTBOX_ENTRY_NOT_FOUND,
+		Message: "Outbox entry with event id EventID1 and sink sink2 not found",
+	})
+}
+
+// TRANSACTION
+
+func testTransactions(t *testing.T, repos Repos) {
+	user := makeUser("1", "/path/", 0)
+	policy := makePolicy("1", "org1", "/path/", 0)
+	created := makeAuditEvent("1", "admin", api.USER_ACTION_CREATE_USER, user.Urn, 0)
+	err := repos.TxRepo.Transaction(func(tx api.Repos) error {
+		if _, err := tx.UserRepo.AddUser(user); err != nil {
+			return err
+		}
+		// Method that uses its own transaction when it isn't in one
+		if _, err := tx.PolicyRepo.AddPolicy(policy); err != nil {
+			return err
+		}
+		return tx.AuditRepo.AddAuditEvent(created)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error in transaction: %v", err)
+	}
+	stored, err := repos.UserRepo.GetUserByExternalID(user.ExternalID)
+	if err != nil {
+		t.Fatalf("Unexpected error getting user: %v", err)
+	}
+	checkResponse(t, "TransactionCommitUser", stored, &user)
+	storedPolicy, err := repos.PolicyRepo.GetPolicyByName(policy.Org, policy.Name)
+	if err != nil {
+		t.Fatalf("Unexpected error getting policy: %v", err)
+	}
+	checkResponse(t, "TransactionCommitPolicy", storedPolicy, &policy)
+
+	// Changes are rolled back if an audit event can't be stored
+	deleted := makeAuditEvent("2", "admin", api.USER_ACTION_DELETE_USER, user.Urn, 1)
+	entry := api.OutboxEntry{
+		Event: api.Event{
+			ID:       "EventID",
+			Type:     api.USER_DELETED_EVENT,
+			Urn:      user.Urn,
+			CreateAt: now,
+		},
+		Sink:          "sink",
+		NextAttemptAt: now,
+	}
+	err = repos.TxRepo.Transaction(func(tx api.Repos) error {
+		if err := tx.UserRepo.RemoveUser(user.ID); err != nil {
+			return err
+		}
+		if err := tx.PolicyRepo.RemovePolicy(policy.ID); err != nil {
+			return err
+		}
+		if err := tx.EventRepo.AddOutboxEntries([]api.OutboxEntry{entry}); err != nil {
+			return err
+		}
+		if err := tx.AuditRepo.AddAuditEvent(deleted); err != nil {
+			return err
+		}
+		return tx.AuditRepo.AddAuditEvent(created)
+	})
+	checkErrorCode(t, "TransactionRollback", err, database.INTERNAL_ERROR)
+	stored, err = repos.UserRepo.GetUserByExternalID(user.ExternalID)
+	if err != nil {
+		t.Fatalf("Unexpected error getting user: %v", err)
+	}
+	checkResponse(t, "TransactionRollbackUser", stored, &user)
+	storedPolicy, err = repos.PolicyRepo.GetPolicyByName(policy.Org, policy.Name)
+	if err != nil {
+		t.Fatalf("Unexpected error getting policy: %v", err)
+	}
+	checkResponse(t, "TransactionRollbackPolicy", storedPolicy, &policy)
+	events, total, err := repos.AuditRepo.GetAuditEventsFiltered(&api.AuditFilter{})
+	if err != nil {
+		t.Fatalf("Unexpected error getting audit events: %v", err)
+	}
+	checkResponse(t, "TransactionRollbackAuditEvents", events, []api.AuditEvent{created})
+	checkResponse(t, "TransactionRollbackAuditEventsTotal", total, 1)
+	pending, err := repos.EventRepo.GetPendingOutboxEntries(now.Add(time.Hour), 0)
+	if err != nil {
+		t.Fatalf("Unexpected error getting pending entries: %v", err)
+	}
+	checkResponse(t, "TransactionRollbackOutboxEntries", pending, []api.OutboxEntry{})
+}
+
+func makeUser(id string, path string, offset int) api.User {
+	date := now.Add(time.Duration(offset) * time.Minute)
+	return api.User{
+		ID:         "UserID" + id,
+		ExternalID: "user" + id,
+		Path:       path,
+		Urn:        api.CreateUrn("", api.RESOURCE_USER, path, "user"+id),
+		CreateAt:   date,
+		UpdateAt:   date,
+	}
+}
+
+func makeGroup(id string, org string, path string, offset int) api.Group {
+	date := now.Add(time.Duration(offset) * time.Minute)
+	return api.Group{
+		ID:       "GroupID" + id,
+		Name:     "group" + id,
+		Org:      org,
+		Path:     path,
+		Urn:      api.CreateUrn(org, api.RESOURCE_GROUP, path, "group"+id),
+		CreateAt: date,
+		UpdateAt: date,
+	}
+}
+
+func makePolicy(id string, org string, path string, offset int) api.Policy {
+	date := now.Add(time.Duration(offset) * time.Minute)
+	return api.Policy{
+		ID:       "PolicyID" + id,
+		Name:     "policy" + id,
+		Org:      org,
+		Path:     path,
+		Urn:      api.CreateUrn(org, api.RESOURCE_POLICY, path, "policy"+id),
+		CreateAt: date,
+		UpdateAt: date,
+		Statements: &[]api.Statement{
+			{
+				Effect:    "allow",
+				Actions:   []string{"iam:GetUser"},
+				Resources: []string{"urn:everything:*"},
+				Conditions: api.Conditions{
+					"StringEquals": {
+						"aws:SourceIp": []string{"10.0.0.1"},
+					},
+				},
+			},
+		},
+	}
+}
+
+func makeServiceAccount(id string, externalID string, offset int) api.ServiceAccount {
+	return api.ServiceAccount{
+		ID:         "ServiceAccountID" + id,
+		Name:       "serviceaccount" + id,
+		ExternalID: externalID,
+		KeyPrefix:  "fk_prefix" + id,
+		KeyHash:    "hash" + id,
+		Urn:        api.CreateUrn("", api.RESOURCE_SERVICE_ACCOUNT, "/", "serviceaccount"+id),
+		CreateAt:   now.Add(time.Duration(offset) * time.Minute),
+	}
+}
+
+func makeAuditEvent(id string, actor string, action string, urn string, offset int) api.AuditEvent {
+	return api.AuditEvent{
+		ID:        "AuditEventID" + id,
+		Actor:     actor,
+		RequestID: "RequestID" + id,
+		Action:    action,
+		Urn:       urn,
+		CreateAt:  now.Add(time.Duration(offset) * time.Minute),
+	}
+}
+
+func checkResponse(t *testing.T, name string, received interface{}, expected interface{}) {
+	if diff := pretty.Compare(received, expected); diff != "" {
+		t.Errorf("Test %v failed. Received different responses (received/wanted) %v", name, diff)
+	}
+}
+
+func checkError(t *testing.T, name string, err error, expected *database.Error) {
+	dbError, ok := err.(*database.Error)
+	if !ok || dbError == nil {
+		t.Errorf("Test %v failed. Unexpected data retrieved from error: %v", name, err)
+		return
+	}
+	checkResponse(t, name, dbError, expected)
+}
+
+// Messages of internal errors depend on the database, so only the code is checked
+func checkErrorCode(t *testing.T, name string, err error, code string) {
+	dbError, ok := err.(*database.Error)
+	if !ok || dbError == nil {
+		t.Errorf("Test %v failed. Unexpected data retrieved from error: %v", name, err)
+		return
+	}
+	if dbError.Code != code {
+		t.Errorf("Test %v failed. Received error code %v, wanted %v", name, dbError.Code, code)
+	}
+}
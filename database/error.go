@@ -20,6 +20,12 @@ const (
 
 	// Policy Codes
 	POLICY_NOT_FOUND = "PolicyNotFound"
+
+	// Service Account Codes
+	SERVICE_ACCOUNT_NOT_FOUND = "ServiceAccountNotFound"
+
+	// Outbox Codes
+	OUTBOX_ENTRY_NOT_FOUND = "OutboxEntryNotFound"
 )
 
 type Error struct {
@@ -0,0 +1,16 @@
+package filedb
+
+import (
+	"github.com/Tecsisa/foulkon/api"
+)
+
+// AUDIT REPOSITORY IMPLEMENTATION
+
+func (f *FileRepo) AddAuditEvent(event api.AuditEvent) error {
+	_, err := f.update(change{Method: "AddAuditEvent", AuditEvent: &event})
+	return err
+}
+
+func (f *FileRepo) GetAuditEventsFiltered(filter *api.AuditFilter) ([]api.AuditEvent, int, error) {
+	return f.repo.GetAuditEventsFiltered(filter)
+}
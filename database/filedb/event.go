@@ -0,0 +1,28 @@
+package filedb
+
+import (
+	"time"
+
+	"github.com/Tecsisa/foulkon/api"
+)
+
+// EVENT REPOSITORY IMPLEMENTATION
+
+func (f *FileRepo) AddOutboxEntries(entries []api.OutboxEntry) error {
+	_, err := f.update(change{Method: "AddOutboxEntries", OutboxEntries: entries})
+	return err
+}
+
+func (f *FileRepo) GetPendingOutboxEntries(until time.Time, limit int) ([]api.OutboxEntry, error) {
+	return f.repo.GetPendingOutboxEntries(until, limit)
+}
+
+func (f *FileRepo) UpdateOutboxEntry(entry api.OutboxEntry) error {
+	_, err := f.update(change{Method: "UpdateOutboxEntry", OutboxEntry: &entry})
+	return err
+}
+
+func (f *FileRepo) RemoveOutboxEntry(eventID string, sink string) error {
+	_, err := f.update(change{Method: "RemoveOutboxEntry", EventID: eventID, Sink: sink})
+	return err
+}
@@ -0,0 +1,378 @@
+package filedb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Tecsisa/foulkon/api"
+	"github.com/Tecsisa/foulkon/database"
+	"github.com/Tecsisa/foulkon/database/memory"
+)
+
+const (
+	// Suffix of the file, next to the database file, where changes are appended
+	LOG_FILE_SUFFIX = ".log"
+
+	// Number of changes appended to the log before writing all data into the database file
+	COMPACT_CHANGES = 1000
+)
+
+// FileRepo implements user, group, policy, service account, audit and event repositories keeping
+// all data in memory and persisting it in JSON files. Every change is appended to a log file, one per
+// line, so changes don't rewrite all data. After a number of changes, all data is written into the
+// database file and the log is emptied, so the log doesn't grow forever and it is fast to open.
+type FileRepo struct {
+	path string
+
+	// Serializes changes so they are appended in the same order they are applied
+	mutex sync.Mutex
+	repo  *memory.MemoryRepo
+
+	// Sequence number of the last change stored, and number of changes in log
+	seq       int64
+	logged    int
+	compactAt int
+
+	// Changes done by a transaction, in the repository received by the transaction
+	inTransaction bool
+	changes       []change
+}
+
+// Content of the database file, with the sequence number of the last change written in it
+type fileSnapshot struct {
+	Seq int64 `json:"seq,omitempty"`
+	memory.Snapshot
+}
+
+// Line of the log with the changes done by a transaction
+type record struct {
+	Seq     int64     `json:"seq"`
+	Time    time.Time `json:"time"`
+	Changes []change  `json:"changes"`
+}
+
+// Change done in the repository, stored with the name and arguments of the method that does it
+type change struct {
+	Method string `json:"method"`
+
+	User           *api.User              `json:"user,omitempty"`
+	Group          *api.Group             `json:"group,omitempty"`
+	Policy         *api.Policy            `json:"policy,omitempty"`
+	ServiceAccount *memory.ServiceAccount `json:"serviceAccount,omitempty"`
+	AuditEvent     *api.AuditEvent        `json:"auditEvent,omitempty"`
+	OutboxEntries  []api.OutboxEntry      `json:"outboxEntries,omitempty"`
+	OutboxEntry    *api.OutboxEntry       `json:"outboxEntry,omitempty"`
+
+	ID       string `json:"id,omitempty"`
+	UserID   string `json:"userId,omitempty"`
+	GroupID  string `json:"groupId,omitempty"`
+	PolicyID string `json:"policyId,omitempty"`
+	EventID  string `json:"eventId,omitempty"`
+	Sink     string `json:"sink,omitempty"`
+}
+
+// Open returns a repository with the content of the files. Files are created if they don't exist.
+func Open(path string) (*FileRepo, error) {
+	f := &FileRepo{
+		path:      path,
+		repo:      memory.NewMemoryRepo(),
+		compactAt: COMPACT_CHANGES,
+	}
+
+	data, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		// Check that the file can be written before accepting changes
+		if err := persist(path, fileSnapshot{Snapshot: *f.repo.Snapshot()}); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	default:
+		snapshot := &fileSnapshot{}
+		if err := json.Unmarshal(data, snapshot); err != nil {
+			return nil, fmt.Errorf("Invalid database file %v: %v", path, err)
+		}
+		f.repo.Restore(&snapshot.Snapshot)
+		f.seq = snapshot.Seq
+	}
+
+	if err := f.loadLog(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Transaction makes changes with the repositories of a transaction, whose changes are appended
+// to log together
+func (f *FileRepo) Transaction(change func(repos api.Repos) error) error {
+	return f.transaction(func(tx *FileRepo) error {
+		return change(api.Repos{
+			UserRepo:           tx,
+			GroupRepo:          tx,
+			PolicyRepo:         tx,
+			ServiceAccountRepo: tx,
+			AuditRepo:          tx,
+			EventRepo:          tx,
+		})
+	})
+}
+
+func (f *FileRepo) OrderByValidColumns(action string) []string {
+	return f.repo.OrderByValidColumns(action)
+}
+
+// PRIVATE HELPER METHODS
+
+// Make a change in the transaction of the repository, or in a new transaction if it hasn't got one.
+// It returns the result of the method that does the change.
+func (f *FileRepo) update(c change) (interface{}, error) {
+	if f.inTransaction {
+		result, err := apply(f.repo, c)
+		if err != nil {
+			return nil, err
+		}
+		f.changes = append(f.changes, c)
+		return result, nil
+	}
+
+	var result interface{}
+	err := f.transaction(func(tx *FileRepo) error {
+		var err error
+		result, err = tx.update(c)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Make changes with the repository received, in a transaction. Changes are only visible when they
+// have been appended to log, so a failed write doesn't modify the repository.
+func (f *FileRepo) transaction(changes func(tx *FileRepo) error) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	now := time.Now().UTC()
+	err := f.repo.Update(now, func(repo *memory.MemoryRepo) error {
+		tx := &FileRepo{
+			path:          f.path,
+			repo:          repo,
+			inTransaction: true,
+		}
+		if err := changes(tx); err != nil {
+			return err
+		}
+		if len(tx.changes) == 0 {
+			return nil
+		}
+
+		data, err := json.Marshal(record{Seq: f.seq + 1, Time: now, Changes: tx.changes})
+		if err == nil {
+			err = appendLine(f.path+LOG_FILE_SUFFIX, data)
+		}
+		if err != nil {
+			return &database.Error{
+				Code:    database.INTERNAL_ERROR,
+				Message: err.Error(),
+			}
+		}
+		f.seq++
+		f.logged++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Changes are already stored, so if data can't be written it is tried again with next change
+	if f.logged >= f.compactAt {
+		f.compact()
+	}
+
+	return nil
+}
+
+// Write all data into the database file and empty the log, whose changes are already in the file
+func (f *FileRepo) compact() error {
+	if err := persist(f.path, fileSnapshot{Seq: f.seq, Snapshot: *f.repo.Snapshot()}); err != nil {
+		return err
+	}
+	if err := os.Truncate(f.path+LOG_FILE_SUFFIX, 0); err != nil {
+		return err
+	}
+	f.logged = 0
+
+	return nil
+}
+
+// Read the log and apply the changes that aren't in the database file yet. A last line without end
+// is a write interrupted by a crash, so it is discarded.
+func (f *FileRepo) loadLog() error {
+	path := f.path + LOG_FILE_SUFFIX
+	data, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		// Check that the file can be written before accepting changes
+		return appendLine(path, nil)
+	case err != nil:
+		return err
+	}
+
+	end := bytes.LastIndexByte(data, '\n') + 1
+	if end < len(data) {
+		if err := os.Truncate(path, int64(end)); err != nil {
+			return err
+		}
+	}
+
+	for i, line := range bytes.Split(data[:end], []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		rec := record{}
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return fmt.Errorf("Invalid log file %v in line %v: %v", path, i+1, err)
+		}
+		// Changes written into database file by a compaction that didn't empty the log
+		if rec.Seq <= f.seq {
+			continue
+		}
+		if rec.Seq != f.seq+1 {
+			return fmt.Errorf("Invalid log file %v in line %v: expected change %v but found %v", path, i+1, f.seq+1, rec.Seq)
+		}
+		err := f.repo.Update(rec.Time, func(repo *memory.MemoryRepo) error {
+			for _, c := range rec.Changes {
+				if _, err := apply(repo, c); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("Invalid change in log file %v in line %v: %v", path, i+1, err)
+		}
+		f.seq = rec.Seq
+		f.logged++
+	}
+
+	return nil
+}
+
+// Apply a change to a repository with its method, returning the result of the method
+func apply(repo *memory.MemoryRepo, c change) (interface{}, error) {
+	switch c.Method {
+	case "AddUser":
+		return repo.AddUser(*c.User)
+	case "UpdateUser":
+		return repo.UpdateUser(*c.User)
+	case "RemoveUser":
+		return nil, repo.RemoveUser(c.ID)
+	case "AddGroup":
+		return repo.AddGroup(*c.Group)
+	case "UpdateGroup":
+		return repo.UpdateGroup(*c.Group)
+	case "RemoveGroup":
+		return nil, repo.RemoveGroup(c.ID)
+	case "AddMember":
+		return nil, repo.AddMember(c.UserID, c.GroupID)
+	case "RemoveMember":
+		return nil, repo.RemoveMember(c.UserID, c.GroupID)
+	case "AttachPolicy":
+		return nil, repo.AttachPolicy(c.GroupID, c.PolicyID)
+	case "DetachPolicy":
+		return nil, repo.DetachPolicy(c.GroupID, c.PolicyID)
+	case "AddPolicy":
+		return repo.AddPolicy(*c.Policy)
+	case "UpdatePolicy":
+		return repo.UpdatePolicy(*c.Policy)
+	case "RemovePolicy":
+		return nil, repo.RemovePolicy(c.ID)
+	case "AddServiceAccount":
+		serviceAccount := c.ServiceAccount.ServiceAccount
+		serviceAccount.KeyHash = c.ServiceAccount.KeyHash
+		return repo.AddServiceAccount(serviceAccount)
+	case "RemoveServiceAccount":
+		return nil, repo.RemoveServiceAccount(c.ID)
+	case "AddAuditEvent":
+		return nil, repo.AddAuditEvent(*c.AuditEvent)
+	case "AddOutboxEntries":
+		return nil, repo.AddOutboxEntries(c.OutboxEntries)
+	case "UpdateOutboxEntry":
+		return nil, repo.UpdateOutboxEntry(*c.OutboxEntry)
+	case "RemoveOutboxEntry":
+		return nil, repo.RemoveOutboxEntry(c.EventID, c.Sink)
+	}
+	return nil, &database.Error{
+		Code:    database.INTERNAL_ERROR,
+		Message: fmt.Sprintf("Unknown change %v", c.Method),
+	}
+}
+
+// Write the content into a temporary file and rename it, so the file always has a complete content
+func persist(path string, content interface{}) error {
+	data, err := json.Marshal(content)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return nil
+}
+
+// Append a line to a file, creating it if it doesn't exist. Nothing is appended if data is empty.
+// A failed write is truncated, so next lines aren't appended to a partial line.
+func appendLine(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return err
+		}
+		if _, err := file.Write(append(data, '\n')); err != nil {
+			file.Truncate(info.Size())
+			file.Close()
+			return err
+		}
+		if err := file.Sync(); err != nil {
+			file.Truncate(info.Size())
+			file.Close()
+			return err
+		}
+	}
+	return file.Close()
+}
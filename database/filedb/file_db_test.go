@@ -0,0 +1,376 @@
+package filedb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Tecsisa/foulkon/api"
+	"github.com/Tecsisa/foulkon/database"
+	"github.com/Tecsisa/foulkon/database/conformance"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+var now = time.Date(2016, time.October, 1, 10, 0, 0, 0, time.UTC)
+
+func TestFileRepo_Conformance(t *testing.T) {
+	conformance.RunRepoTests(t, func(t *testing.T) conformance.Repos {
+		repo, err := Open(tempFile(t))
+		if err != nil {
+			t.Fatalf("Unexpected error opening file: %v", err)
+		}
+		return conformance.Repos{
+			UserRepo:           repo,
+			GroupRepo:          repo,
+			PolicyRepo:         repo,
+			ServiceAccountRepo: repo,
+			AuditRepo:          repo,
+			EventRepo:          repo,
+			TxRepo:             repo,
+		}
+	})
+}
+
+func TestOpen(t *testing.T) {
+	path := tempFile(t)
+	repo, err := Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected error opening file: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("File wasn't created: %v", err)
+	}
+
+	// Store data
+	user := api.User{
+		ID:         "UserID",
+		ExternalID: "user",
+		Path:       "/path/",
+		Urn:        api.CreateUrn("", api.RESOURCE_USER, "/path/", "user"),
+		CreateAt:   now,
+		UpdateAt:   now,
+	}
+	group := api.Group{
+		ID:       "GroupID",
+		Name:     "group",
+		Org:      "org",
+		Path:     "/path/",
+		Urn:      api.CreateUrn("org", api.RESOURCE_GROUP, "/path/", "group"),
+		CreateAt: now,
+		UpdateAt: now,
+	}
+	policy := api.Policy{
+		ID:       "PolicyID",
+		Name:     "policy",
+		Org:      "org",
+		Path:     "/path/",
+		Urn:      api.CreateUrn("org", api.RESOURCE_POLICY, "/path/", "policy"),
+		CreateAt: now,
+		UpdateAt: now,
+		Statements: &[]api.Statement{
+			{
+				Effect:    "allow",
+				Actions:   []string{"iam:*"},
+				Resources: []string{"urn:everything:*"},
+			},
+		},
+	}
+	if _, err := repo.AddUser(user); err != nil {
+		t.Fatalf("Unexpected error adding user: %v", err)
+	}
+	if _, err := repo.AddGroup(group); err != nil {
+		t.Fatalf("Unexpected error adding group: %v", err)
+	}
+	if _, err := repo.AddPolicy(policy); err != nil {
+		t.Fatalf("Unexpected error adding policy: %v", err)
+	}
+	if err := repo.AddMember(user.ID, group.ID); err != nil {
+		t.Fatalf("Unexpected error adding member: %v", err)
+	}
+	if err := repo.AttachPolicy(group.ID, policy.ID); err != nil {
+		t.Fatalf("Unexpected error attaching policy: %v", err)
+	}
+	event := api.AuditEvent{
+		ID:       "EventID",
+		Actor:    "admin",
+		Action:   api.USER_ACTION_CREATE_USER,
+		Urn:      user.Urn,
+		CreateAt: now,
+	}
+	if err := repo.AddAuditEvent(event); err != nil {
+		t.Fatalf("Unexpected error adding audit event: %v", err)
+	}
+	entry := api.OutboxEntry{
+		Event: api.Event{
+			ID:       "EventID",
+			Type:     api.USER_CREATED_EVENT,
+			Urn:      user.Urn,
+			CreateAt: now,
+		},
+		Sink:          "sink",
+		NextAttemptAt: now,
+	}
+	if err := repo.AddOutboxEntries([]api.OutboxEntry{entry}); err != nil {
+		t.Fatalf("Unexpected error adding outbox entry: %v", err)
+	}
+
+	// Changes are appended to log without writing database file
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error reading file: %v", err)
+	}
+	if strings.Contains(string(data), user.ID) {
+		t.Errorf("Test failed. Database file was written before compaction: %v", string(data))
+	}
+
+	// Open file again and check data
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected error reopening file: %v", err)
+	}
+	storedUser, err := reopened.GetUserByExternalID(user.ExternalID)
+	if err != nil {
+		t.Fatalf("Unexpected error getting user: %v", err)
+	}
+	if diff := pretty.Compare(storedUser, &user); diff != "" {
+		t.Errorf("Test failed. Received different users (received/wanted) %v", diff)
+	}
+	storedPolicy, err := reopened.GetPolicyByName(policy.Org, policy.Name)
+	if err != nil {
+		t.Fatalf("Unexpected error getting policy: %v", err)
+	}
+	if diff := pretty.Compare(storedPolicy, &policy); diff != "" {
+		t.Errorf("Test failed. Received different policies (received/wanted) %v", diff)
+	}
+	if ok, err := reopened.IsMemberOfGroup(user.ID, group.ID); !ok || err != nil {
+		t.Errorf("Test failed. Member wasn't stored: %v", err)
+	}
+	if ok, err := reopened.IsAttachedToGroup(group.ID, policy.ID); !ok || err != nil {
+		t.Errorf("Test failed. Attachment wasn't stored: %v", err)
+	}
+	events, _, err := reopened.GetAuditEventsFiltered(&api.AuditFilter{})
+	if err != nil {
+		t.Fatalf("Unexpected error getting audit events: %v", err)
+	}
+	if diff := pretty.Compare(events, []api.AuditEvent{event}); diff != "" {
+		t.Errorf("Test failed. Received different audit events (received/wanted) %v", diff)
+	}
+	entries, err := reopened.GetPendingOutboxEntries(now, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error getting outbox entries: %v", err)
+	}
+	if diff := pretty.Compare(entries, []api.OutboxEntry{entry}); diff != "" {
+		t.Errorf("Test failed. Received different outbox entries (received/wanted) %v", diff)
+	}
+}
+
+func TestOpen_InterruptedChange(t *testing.T) {
+	path := tempFile(t)
+	repo, err := Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected error opening file: %v", err)
+	}
+	event := api.AuditEvent{
+		ID:       "EventID",
+		Actor:    "admin",
+		Action:   api.USER_ACTION_CREATE_USER,
+		Urn:      "urn:iws:iam::user/path/user",
+		CreateAt: now,
+	}
+	if err := repo.AddAuditEvent(event); err != nil {
+		t.Fatalf("Unexpected error adding audit event: %v", err)
+	}
+
+	// Last line is written partially
+	file, err := os.OpenFile(path+LOG_FILE_SUFFIX, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte(`{"seq":2,"changes":[{"method":"AddAuditEvent"`))
+	file.Close()
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected error reopening file: %v", err)
+	}
+	other := event
+	other.ID = "OtherEventID"
+	if err := reopened.AddAuditEvent(other); err != nil {
+		t.Fatalf("Unexpected error adding audit event: %v", err)
+	}
+
+	// Partial line is discarded
+	reopened, err = Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected error reopening file: %v", err)
+	}
+	events, total, err := reopened.GetAuditEventsFiltered(&api.AuditFilter{})
+	if err != nil || total != 2 {
+		t.Fatalf("Test failed. Received %v audit events with error %v", total, err)
+	}
+	for _, e := range events {
+		if e.ID != event.ID && e.ID != other.ID {
+			t.Errorf("Test failed. Received unexpected audit event %v", e.ID)
+		}
+	}
+}
+
+func TestFileRepo_Compact(t *testing.T) {
+	path := tempFile(t)
+	repo, err := Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected error opening file: %v", err)
+	}
+	repo.compactAt = 2
+
+	addUser := func(repo *FileRepo, externalID string) {
+		_, err := repo.AddUser(api.User{
+			ID:         externalID,
+			ExternalID: externalID,
+			Path:       "/path/",
+			Urn:        api.CreateUrn("", api.RESOURCE_USER, "/path/", externalID),
+			CreateAt:   now,
+			UpdateAt:   now,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error adding user %v: %v", externalID, err)
+		}
+	}
+	addUser(repo, "user1")
+	log, err := ioutil.ReadFile(path + LOG_FILE_SUFFIX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addUser(repo, "user2")
+	addUser(repo, "user3")
+
+	// Two first changes are written into database file, and only the last one is in log
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "user2") || strings.Contains(string(data), "user3") {
+		t.Errorf("Test failed. Database file has unexpected content: %v", string(data))
+	}
+	compacted, err := ioutil.ReadFile(path + LOG_FILE_SUFFIX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(compacted), "\n") != 1 || !strings.Contains(string(compacted), "user3") {
+		t.Errorf("Test failed. Log has unexpected content: %v", string(compacted))
+	}
+
+	// Changes already written into database file are skipped, like if a compaction didn't empty the log
+	if err := ioutil.WriteFile(path+LOG_FILE_SUFFIX, append(log, compacted...), 0600); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected error reopening file: %v", err)
+	}
+	users, total, err := reopened.GetUsersFiltered(&api.Filter{})
+	if err != nil || total != 3 {
+		t.Fatalf("Test failed. Received %v users with error %v", total, err)
+	}
+	for i, user := range users {
+		if user.ExternalID != fmt.Sprintf("user%v", i+1) {
+			t.Errorf("Test failed. Received unexpected user %v", user.ExternalID)
+		}
+	}
+}
+
+func TestOpen_Errors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filedb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	invalidFile := filepath.Join(dir, "invalid.json")
+	if err := ioutil.WriteFile(invalidFile, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	invalidLog := filepath.Join(dir, "invalidlog.json")
+	if err := ioutil.WriteFile(invalidLog+LOG_FILE_SUFFIX, []byte("{\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	missingChange := filepath.Join(dir, "missingchange.json")
+	if err := ioutil.WriteFile(missingChange+LOG_FILE_SUFFIX, []byte(`{"seq":2,"changes":[]}`+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	unknownChange := filepath.Join(dir, "unknownchange.json")
+	if err := ioutil.WriteFile(unknownChange+LOG_FILE_SUFFIX, []byte(`{"seq":1,"changes":[{"method":"Unknown"}]}`+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := map[string]struct {
+		path string
+	}{
+		"ErrorCaseInvalidFile": {
+			path: invalidFile,
+		},
+		"ErrorCaseInvalidLog": {
+			path: invalidLog,
+		},
+		"ErrorCaseMissingChange": {
+			path: missingChange,
+		},
+		"ErrorCaseUnknownChange": {
+			path: unknownChange,
+		},
+		"ErrorCaseUnknownDirectory": {
+			path: filepath.Join(dir, "unknown", "db.json"),
+		},
+	}
+
+	for n, test := range testcases {
+		if _, err := Open(test.path); err == nil {
+			t.Errorf("Test %v failed. Expected error opening file", n)
+		}
+	}
+}
+
+func TestFileRepo_PersistError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filedb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := Open(filepath.Join(dir, "db.json"))
+	if err != nil {
+		t.Fatalf("Unexpected error opening file: %v", err)
+	}
+
+	// File can't be written without directory
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.AddUser(api.User{
+		ID:         "UserID",
+		ExternalID: "user",
+		Path:       "/path/",
+		CreateAt:   now,
+		UpdateAt:   now,
+	})
+	dbError, ok := err.(*database.Error)
+	if !ok || dbError == nil || dbError.Code != database.INTERNAL_ERROR {
+		t.Fatalf("Test failed. Unexpected error: %v", err)
+	}
+
+	// Change must not be applied
+	if _, err := repo.GetUserByExternalID("user"); err == nil {
+		t.Errorf("Test failed. User was stored although file wasn't written")
+	}
+}
+
+// Aux methods
+
+func tempFile(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "filedb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "db.json")
+}
@@ -0,0 +1,76 @@
+package filedb
+
+import (
+	"github.com/Tecsisa/foulkon/api"
+)
+
+// GROUP REPOSITORY IMPLEMENTATION
+
+func (f *FileRepo) AddGroup(group api.Group) (*api.Group, error) {
+	created, err := f.update(change{Method: "AddGroup", Group: &group})
+	if err != nil {
+		return nil, err
+	}
+	return created.(*api.Group), nil
+}
+
+func (f *FileRepo) GetGroupByName(org string, name string) (*api.Group, error) {
+	return f.repo.GetGroupByName(org, name)
+}
+
+func (f *FileRepo) GetGroupById(id string) (*api.Group, error) {
+	return f.repo.GetGroupById(id)
+}
+
+func (f *FileRepo) GetGroupsFiltered(filter *api.Filter) ([]api.Group, int, error) {
+	return f.repo.GetGroupsFiltered(filter)
+}
+
+func (f *FileRepo) UpdateGroup(group api.Group) (*api.Group, error) {
+	updated, err := f.update(change{Method: "UpdateGroup", Group: &group})
+	if err != nil {
+		return nil, err
+	}
+	return updated.(*api.Group), nil
+}
+
+func (f *FileRepo) RemoveGroup(id string) error {
+	_, err := f.update(change{Method: "RemoveGroup", ID: id})
+	return err
+}
+
+func (f *FileRepo) AddMember(userID string, groupID string) error {
+	_, err := f.update(change{Method: "AddMember", UserID: userID, GroupID: groupID})
+	return err
+}
+
+func (f *FileRepo) RemoveMember(userID string, groupID string) error {
+	_, err := f.update(change{Method: "RemoveMember", UserID: userID, GroupID: groupID})
+	return err
+}
+
+func (f *FileRepo) IsMemberOfGroup(userID string, groupID string) (bool, error) {
+	return f.repo.IsMemberOfGroup(userID, groupID)
+}
+
+func (f *FileRepo) GetGroupMembers(groupID string, filter *api.Filter) ([]api.UserGroupRelation, int, error) {
+	return f.repo.GetGroupMembers(groupID, filter)
+}
+
+func (f *FileRepo) AttachPolicy(groupID string, policyID string) error {
+	_, err := f.update(change{Method: "AttachPolicy", GroupID: groupID, PolicyID: policyID})
+	return err
+}
+
+func (f *FileRepo) DetachPolicy(groupID string, policyID string) error {
+	_, err := f.update(change{Method: "DetachPolicy", GroupID: groupID, PolicyID: policyID})
+	return err
+}
+
+func (f *FileRepo) IsAttachedToGroup(groupID string, policyID string) (bool, error) {
+	return f.repo.IsAttachedToGroup(groupID, policyID)
+}
+
+func (f *FileRepo) GetAttachedPolicies(groupID string, filter *api.Filter) ([]api.PolicyGroupRelation, int, error) {
+	return f.repo.GetAttachedPolicies(groupID, filter)
+}
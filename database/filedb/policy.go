@@ -0,0 +1,48 @@
+package filedb
+
+import (
+	"github.com/Tecsisa/foulkon/api"
+)
+
+// POLICY REPOSITORY IMPLEMENTATION
+
+func (f *FileRepo) AddPolicy(policy api.Policy) (*api.Policy, error) {
+	created, err := f.update(change{Method: "AddPolicy", Policy: &policy})
+	if err != nil {
+		return nil, err
+	}
+	return created.(*api.Policy), nil
+}
+
+func (f *FileRepo) GetPolicyByName(org string, name string) (*api.Policy, error) {
+	return f.repo.GetPolicyByName(org, name)
+}
+
+func (f *FileRepo) GetPolicyById(id string) (*api.Policy, error) {
+	return f.repo.GetPolicyById(id)
+}
+
+func (f *FileRepo) GetPoliciesFiltered(filter *api.Filter) ([]api.Policy, int, error) {
+	return f.repo.GetPoliciesFiltered(filter)
+}
+
+func (f *FileRepo) UpdatePolicy(policy api.Policy) (*api.Policy, error) {
+	updated, err := f.update(change{Method: "UpdatePolicy", Policy: &policy})
+	if err != nil {
+		return nil, err
+	}
+	return updated.(*api.Policy), nil
+}
+
+func (f *FileRepo) RemovePolicy(id string) error {
+	_, err := f.update(change{Method: "RemovePolicy", ID: id})
+	return err
+}
+
+func (f *FileRepo) GetAttachedGroups(policyID string, filter *api.Filter) ([]api.PolicyGroupRelation, int, error) {
+	return f.repo.GetAttachedGroups(policyID, filter)
+}
+
+func (f *FileRepo) GetEffectiveStatementsByUser(userID string, action string) ([]api.Statement, error) {
+	return f.repo.GetEffectiveStatementsByUser(userID, action)
+}
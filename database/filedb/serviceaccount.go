@@ -0,0 +1,37 @@
+package filedb
+
+import (
+	"github.com/Tecsisa/foulkon/api"
+	"github.com/Tecsisa/foulkon/database/memory"
+)
+
+// SERVICE ACCOUNT REPOSITORY IMPLEMENTATION
+
+func (f *FileRepo) AddServiceAccount(serviceAccount api.ServiceAccount) (*api.ServiceAccount, error) {
+	// Key hash isn't marshalled with the service account
+	created, err := f.update(change{
+		Method:         "AddServiceAccount",
+		ServiceAccount: &memory.ServiceAccount{ServiceAccount: serviceAccount, KeyHash: serviceAccount.KeyHash},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created.(*api.ServiceAccount), nil
+}
+
+func (f *FileRepo) GetServiceAccountByName(name string) (*api.ServiceAccount, error) {
+	return f.repo.GetServiceAccountByName(name)
+}
+
+func (f *FileRepo) GetServiceAccountByKeyHash(keyHash string) (*api.ServiceAccount, error) {
+	return f.repo.GetServiceAccountByKeyHash(keyHash)
+}
+
+func (f *FileRepo) GetServiceAccountsFiltered(filter *api.Filter) ([]api.ServiceAccount, int, error) {
+	return f.repo.GetServiceAccountsFiltered(filter)
+}
+
+func (f *FileRepo) RemoveServiceAccount(id string) error {
+	_, err := f.update(change{Method: "RemoveServiceAccount", ID: id})
+	return err
+}
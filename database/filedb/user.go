@@ -0,0 +1,44 @@
+package filedb
+
+import (
+	"github.com/Tecsisa/foulkon/api"
+)
+
+// USER REPOSITORY IMPLEMENTATION
+
+func (f *FileRepo) AddUser(user api.User) (*api.User, error) {
+	created, err := f.update(change{Method: "AddUser", User: &user})
+	if err != nil {
+		return nil, err
+	}
+	return created.(*api.User), nil
+}
+
+func (f *FileRepo) GetUserByExternalID(id string) (*api.User, error) {
+	return f.repo.GetUserByExternalID(id)
+}
+
+func (f *FileRepo) GetUserByID(id string) (*api.User, error) {
+	return f.repo.GetUserByID(id)
+}
+
+func (f *FileRepo) GetUsersFiltered(filter *api.Filter) ([]api.User, int, error) {
+	return f.repo.GetUsersFiltered(filter)
+}
+
+func (f *FileRepo) UpdateUser(user api.User) (*api.User, error) {
+	updated, err := f.update(change{Method: "UpdateUser", User: &user})
+	if err != nil {
+		return nil, err
+	}
+	return updated.(*api.User), nil
+}
+
+func (f *FileRepo) RemoveUser(id string) error {
+	_, err := f.update(change{Method: "RemoveUser", ID: id})
+	return err
+}
+
+func (f *FileRepo) GetGroupsByUserID(id string, filter *api.Filter) ([]api.UserGroupRelation, int, error) {
+	return f.repo.GetGroupsByUserID(id, filter)
+}
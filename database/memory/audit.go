@@ -0,0 +1,83 @@
+package memory
+
+import (
+	"encoding/json"
+
+	"github.com/Tecsisa/foulkon/api"
+)
+
+// AUDIT REPOSITORY IMPLEMENTATION
+
+func (r *MemoryRepo) AddAuditEvent(event api.AuditEvent) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, e := range r.auditEvents {
+		if e.ID == event.ID {
+			return internalError("Audit event with id %v already exists", event.ID)
+		}
+	}
+
+	// Store audit event
+	r.auditEvents = append(r.auditEvents, memAuditEvent(event))
+
+	return nil
+}
+
+func (r *MemoryRepo) GetAuditEventsFiltered(filter *api.AuditFilter) ([]api.AuditEvent, int, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	events := []api.AuditEvent{}
+	for _, e := range r.auditEvents {
+		if len(filter.Actor) > 0 && e.Actor != filter.Actor {
+			continue
+		}
+		if len(filter.Urn) > 0 && e.Urn != filter.Urn {
+			continue
+		}
+		if len(filter.Action) > 0 && e.Action != filter.Action {
+			continue
+		}
+		if !filter.From.IsZero() && e.CreateAt.Before(filter.From) {
+			continue
+		}
+		if !filter.To.IsZero() && e.CreateAt.After(filter.To) {
+			continue
+		}
+		events = append(events, memAuditEvent(e))
+	}
+
+	// Most recent events first
+	sortByColumn("create_at desc", len(events), func(i int, column string) string {
+		if column == "id" {
+			return events[i].ID
+		}
+		return timeColumn(events[i].CreateAt)
+	}, func(i, j int) {
+		events[i], events[j] = events[j], events[i]
+	})
+
+	total := len(events)
+	start, end := paginate(&api.Filter{Offset: filter.Offset, Limit: filter.Limit}, total)
+
+	return events[start:end], total, nil
+}
+
+// PRIVATE HELPER METHODS
+
+// Copy an audit event with its dates normalized, so stored states can't be modified from outside
+func memAuditEvent(event api.AuditEvent) api.AuditEvent {
+	event.CreateAt = normalizeTime(event.CreateAt)
+	event.Before = copyAuditState(event.Before)
+	event.After = copyAuditState(event.After)
+	return event
+}
+
+func copyAuditState(state *json.RawMessage) *json.RawMessage {
+	if state == nil {
+		return nil
+	}
+	copied := append(json.RawMessage{}, *state...)
+	return &copied
+}
@@ -0,0 +1,68 @@
+package memory
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Tecsisa/foulkon/api"
+	"github.com/Tecsisa/foulkon/database"
+)
+
+func TestMemoryRepo_AddAuditEvent(t *testing.T) {
+	state := json.RawMessage(`{"externalId":"user1"}`)
+	event := api.AuditEvent{
+		ID:        "AuditEventID",
+		Actor:     "admin",
+		RequestID: "RequestID",
+		Action:    api.USER_ACTION_CREATE_USER,
+		Urn:       api.CreateUrn("", api.RESOURCE_USER, "/path/", "user1"),
+		CreateAt:  now,
+		After:     &state,
+	}
+	testcases := map[string]struct {
+		// Previous data
+		previousEvent *api.AuditEvent
+		// Expected result
+		expectedResponse []api.AuditEvent
+		expectedError    *database.Error
+	}{
+		"OkCase": {
+			expectedResponse: []api.AuditEvent{event},
+		},
+		"ErrorCaseAuditEventAlreadyExist": {
+			previousEvent: &event,
+			expectedError: &database.Error{
+				Code:    database.INTERNAL_ERROR,
+				Message: "Audit event with id AuditEventID already exists",
+			},
+		},
+	}
+
+	for n, test := range testcases {
+		repo := NewMemoryRepo()
+		if test.previousEvent != nil {
+			if err := repo.AddAuditEvent(*test.previousEvent); err != nil {
+				t.Errorf("Test %v failed. Unexpected error inserting previous event: %v", n, err)
+				continue
+			}
+		}
+		err := repo.AddAuditEvent(event)
+		var events []api.AuditEvent
+		if err == nil {
+			events, _, _ = repo.GetAuditEventsFiltered(&api.AuditFilter{})
+		}
+		checkRepoResponse(t, n, test.expectedError, err, test.expectedResponse, events)
+	}
+
+	// Stored states can't be modified from outside
+	repo := NewMemoryRepo()
+	if err := repo.AddAuditEvent(event); err != nil {
+		t.Fatalf("Test failed. Unexpected error: %v", err)
+	}
+	events, _, _ := repo.GetAuditEventsFiltered(&api.AuditFilter{})
+	(*events[0].After)[0] = '['
+	events, _, _ = repo.GetAuditEventsFiltered(&api.AuditFilter{})
+	if string(*events[0].After) != string(state) {
+		t.Errorf("Test failed. Stored state modified: %v", string(*events[0].After))
+	}
+}
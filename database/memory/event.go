@@ -0,0 +1,116 @@
+package memory
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Tecsisa/foulkon/api"
+	"github.com/Tecsisa/foulkon/database"
+)
+
+// EVENT REPOSITORY IMPLEMENTATION
+
+func (r *MemoryRepo) AddOutboxEntries(entries []api.OutboxEntry) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// Check unique fields before storing any entry
+	for i, entry := range entries {
+		if r.getOutboxEntryIndex(entry.Event.ID, entry.Sink) >= 0 {
+			return internalError("Outbox entry with event id %v and sink %v already exists", entry.Event.ID, entry.Sink)
+		}
+		for _, e := range entries[:i] {
+			if e.Event.ID == entry.Event.ID && e.Sink == entry.Sink {
+				return internalError("Outbox entry with event id %v and sink %v already exists", entry.Event.ID, entry.Sink)
+			}
+		}
+	}
+
+	// Store entries
+	for _, entry := range entries {
+		r.outbox = append(r.outbox, memOutboxEntry(entry))
+	}
+
+	return nil
+}
+
+func (r *MemoryRepo) GetPendingOutboxEntries(until time.Time, limit int) ([]api.OutboxEntry, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	entries := []api.OutboxEntry{}
+	for _, entry := range r.outbox {
+		if !entry.NextAttemptAt.After(until) {
+			entries = append(entries, memOutboxEntry(entry))
+		}
+	}
+
+	// Oldest attempts first
+	sortByColumn("", len(entries), func(i int, column string) string {
+		if column == "id" {
+			return entries[i].Event.ID + " " + entries[i].Sink
+		}
+		return timeColumn(entries[i].NextAttemptAt)
+	}, func(i, j int) {
+		entries[i], entries[j] = entries[j], entries[i]
+	})
+
+	start, end := paginate(&api.Filter{Limit: limit}, len(entries))
+
+	return entries[start:end], nil
+}
+
+func (r *MemoryRepo) UpdateOutboxEntry(entry api.OutboxEntry) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	i := r.getOutboxEntryIndex(entry.Event.ID, entry.Sink)
+	if i < 0 {
+		return outboxEntryNotFound(entry.Event.ID, entry.Sink)
+	}
+	r.outbox[i].Attempts = entry.Attempts
+	r.outbox[i].NextAttemptAt = normalizeTime(entry.NextAttemptAt)
+	r.outbox[i].LastError = entry.LastError
+
+	return nil
+}
+
+func (r *MemoryRepo) RemoveOutboxEntry(eventID string, sink string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	i := r.getOutboxEntryIndex(eventID, sink)
+	if i < 0 {
+		return outboxEntryNotFound(eventID, sink)
+	}
+	r.outbox = append(r.outbox[:i], r.outbox[i+1:]...)
+
+	return nil
+}
+
+// PRIVATE HELPER METHODS
+
+// Return the position of an entry in outbox, -1 if it doesn't exist. Caller must hold the lock
+func (r *MemoryRepo) getOutboxEntryIndex(eventID string, sink string) int {
+	for i, entry := range r.outbox {
+		if entry.Event.ID == eventID && entry.Sink == sink {
+			return i
+		}
+	}
+	return -1
+}
+
+// Copy an outbox entry with its dates normalized, so stored data can't be modified from outside
+func memOutboxEntry(entry api.OutboxEntry) api.OutboxEntry {
+	entry.Event.CreateAt = normalizeTime(entry.Event.CreateAt)
+	entry.Event.Data = copyAuditState(entry.Event.Data)
+	entry.NextAttemptAt = normalizeTime(entry.NextAttemptAt)
+	return entry
+}
+
+func outboxEntryNotFound(eventID string, sink string) error {
+	return &database.Error{
+		Code:    database.OUTBOX_ENTRY_NOT_FOUND,
+		Message: fmt.Sprintf("Outbox entry with event id %v and sink %v not found", eventID, sink),
+	}
+}
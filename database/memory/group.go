@@ -0,0 +1,356 @@
+package memory
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Tecsisa/foulkon/api"
+	"github.com/Tecsisa/foulkon/database"
+)
+
+// GROUP REPOSITORY IMPLEMENTATION
+
+func (r *MemoryRepo) AddGroup(group api.Group) (*api.Group, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// Check unique fields
+	if _, ok := r.groups[group.ID]; ok {
+		return nil, internalError("Group with id %v already exists", group.ID)
+	}
+	for _, g := range r.groups {
+		if g.Urn == group.Urn {
+			return nil, internalError("Group with urn %v already exists", group.Urn)
+		}
+	}
+
+	// Store group
+	groupDB := memGroup(group)
+	r.groups[group.ID] = groupDB
+
+	return &groupDB, nil
+}
+
+func (r *MemoryRepo) GetGroupByName(org string, name string) (*api.Group, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.getGroupByName(org, name)
+}
+
+func (r *MemoryRepo) GetGroupById(id string) (*api.Group, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.getGroupByID(id)
+}
+
+func (r *MemoryRepo) GetGroupsFiltered(filter *api.Filter) ([]api.Group, int, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	groups := []api.Group{}
+	for _, group := range r.groups {
+		if len(filter.Org) > 0 && group.Org != filter.Org {
+			continue
+		}
+		if strings.HasPrefix(group.Path, filter.PathPrefix) {
+			groups = append(groups, group)
+		}
+	}
+
+	sortByColumn(filter.OrderBy, len(groups), func(i int, column string) string {
+		return groupColumn(groups[i], column)
+	}, func(i, j int) {
+		groups[i], groups[j] = groups[j], groups[i]
+	})
+
+	total := len(groups)
+	start, end := paginate(filter, total)
+
+	return groups[start:end], total, nil
+}
+
+func (r *MemoryRepo) UpdateGroup(group api.Group) (*api.Group, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.groups[group.ID]; !ok {
+		return nil, &database.Error{
+			Code:    database.GROUP_NOT_FOUND,
+			Message: fmt.Sprintf("Group with name %v not found", group.Name),
+		}
+	}
+	for _, g := range r.groups {
+		if g.ID != group.ID && g.Urn == group.Urn {
+			return nil, internalError("Group with urn %v already exists", group.Urn)
+		}
+	}
+
+	// Update group
+	r.groups[group.ID] = memGroup(group)
+
+	return &group, nil
+}
+
+func (r *MemoryRepo) RemoveGroup(id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// Delete group
+	delete(r.groups, id)
+
+	// Delete all group relations
+	members := []groupUserRelation{}
+	for _, rel := range r.groupUserRelations {
+		if rel.GroupID != id {
+			members = append(members, rel)
+		}
+	}
+	r.groupUserRelations = members
+
+	// Delete all policy relations
+	policies := []groupPolicyRelation{}
+	for _, rel := range r.groupPolicyRelations {
+		if rel.GroupID != id {
+			policies = append(policies, rel)
+		}
+	}
+	r.groupPolicyRelations = policies
+
+	return nil
+}
+
+func (r *MemoryRepo) AddMember(userID string, groupID string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, rel := range r.groupUserRelations {
+		if rel.UserID == userID && rel.GroupID == groupID {
+			return internalError("User with id %v is already a member of group with id %v", userID, groupID)
+		}
+	}
+
+	// Store relation
+	r.groupUserRelations = append(r.groupUserRelations, groupUserRelation{
+		UserID:   userID,
+		GroupID:  groupID,
+		CreateAt: normalizeTime(r.now()),
+	})
+
+	return nil
+}
+
+func (r *MemoryRepo) RemoveMember(userID string, groupID string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	relations := []groupUserRelation{}
+	for _, rel := range r.groupUserRelations {
+		if rel.UserID != userID || rel.GroupID != groupID {
+			relations = append(relations, rel)
+		}
+	}
+	r.groupUserRelations = relations
+
+	return nil
+}
+
+func (r *MemoryRepo) IsMemberOfGroup(userID string, groupID string) (bool, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, rel := range r.groupUserRelations {
+		if rel.UserID == userID && rel.GroupID == groupID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (r *MemoryRepo) GetGroupMembers(groupID string, filter *api.Filter) ([]api.UserGroupRelation, int, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	relations := []groupUserRelation{}
+	for _, rel := range r.groupUserRelations {
+		if rel.GroupID == groupID {
+			relations = append(relations, rel)
+		}
+	}
+
+	sortByColumn(filter.OrderBy, len(relations), func(i int, column string) string {
+		if column == "create_at" {
+			return timeColumn(relations[i].CreateAt)
+		}
+		return relations[i].UserID
+	}, func(i, j int) {
+		relations[i], relations[j] = relations[j], relations[i]
+	})
+
+	total := len(relations)
+	start, end := paginate(filter, total)
+
+	// Transform relations to API domain
+	members := []api.UserGroupRelation{}
+	for _, rel := range relations[start:end] {
+		user, err := r.getUserByID(rel.UserID)
+		if err != nil {
+			return nil, total, internalError("%v", err.Error())
+		}
+		members = append(members, GroupUser{
+			User:     user,
+			CreateAt: rel.CreateAt,
+		})
+	}
+
+	return members, total, nil
+}
+
+func (r *MemoryRepo) AttachPolicy(groupID string, policyID string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, rel := range r.groupPolicyRelations {
+		if rel.GroupID == groupID && rel.PolicyID == policyID {
+			return internalError("Policy with id %v is already attached to group with id %v", policyID, groupID)
+		}
+	}
+
+	// Store relation
+	r.groupPolicyRelations = append(r.groupPolicyRelations, groupPolicyRelation{
+		GroupID:  groupID,
+		PolicyID: policyID,
+		CreateAt: normalizeTime(r.now()),
+	})
+
+	return nil
+}
+
+func (r *MemoryRepo) DetachPolicy(groupID string, policyID string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	relations := []groupPolicyRelation{}
+	for _, rel := range r.groupPolicyRelations {
+		if rel.GroupID != groupID || rel.PolicyID != policyID {
+			relations = append(relations, rel)
+		}
+	}
+	r.groupPolicyRelations = relations
+
+	return nil
+}
+
+func (r *MemoryRepo) IsAttachedToGroup(groupID string, policyID string) (bool, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, rel := range r.groupPolicyRelations {
+		if rel.GroupID == groupID && rel.PolicyID == policyID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (r *MemoryRepo) GetAttachedPolicies(groupID string, filter *api.Filter) ([]api.PolicyGroupRelation, int, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	relations := []groupPolicyRelation{}
+	for _, rel := range r.groupPolicyRelations {
+		if rel.GroupID == groupID {
+			relations = append(relations, rel)
+		}
+	}
+
+	sortByColumn(filter.OrderBy, len(relations), func(i int, column string) string {
+		if column == "create_at" {
+			return timeColumn(relations[i].CreateAt)
+		}
+		return relations[i].PolicyID
+	}, func(i, j int) {
+		relations[i], relations[j] = relations[j], relations[i]
+	})
+
+	total := len(relations)
+	start, end := paginate(filter, total)
+
+	// Transform relations to API domain
+	policies := []api.PolicyGroupRelation{}
+	for _, rel := range relations[start:end] {
+		policy, err := r.getPolicyByID(rel.PolicyID)
+		if err != nil {
+			return nil, total, internalError("%v", err.Error())
+		}
+		policies = append(policies, PolicyGroup{
+			Policy:   policy,
+			CreateAt: rel.CreateAt,
+		})
+	}
+
+	return policies, total, nil
+}
+
+// PRIVATE HELPER METHODS
+
+// Retrieve group by id. Caller must hold the lock
+func (r *MemoryRepo) getGroupByID(id string) (*api.Group, error) {
+	group, ok := r.groups[id]
+	if !ok {
+		return nil, &database.Error{
+			Code:    database.GROUP_NOT_FOUND,
+			Message: fmt.Sprintf("Group with id %v not found", id),
+		}
+	}
+	return &group, nil
+}
+
+// Retrieve group by organization and name. Caller must hold the lock
+func (r *MemoryRepo) getGroupByName(org string, name string) (*api.Group, error) {
+	for _, group := range r.groups {
+		if group.Org == org && group.Name == name {
+			return &group, nil
+		}
+	}
+	return nil, &database.Error{
+		Code:    database.GROUP_NOT_FOUND,
+		Message: fmt.Sprintf("Group with organization %v and name %v not found", org, name),
+	}
+}
+
+// Transform a group received into the stored one
+func memGroup(group api.Group) api.Group {
+	return api.Group{
+		ID:       group.ID,
+		Name:     group.Name,
+		Path:     group.Path,
+		CreateAt: normalizeTime(group.CreateAt),
+		UpdateAt: normalizeTime(group.UpdateAt),
+		Urn:      group.Urn,
+		Org:      group.Org,
+	}
+}
+
+// Return the value of a group column to sort groups
+func groupColumn(group api.Group, column string) string {
+	switch column {
+	case "name":
+		return group.Name
+	case "path":
+		return group.Path
+	case "org":
+		return group.Org
+	case "create_at":
+		return timeColumn(group.CreateAt)
+	case "update_at":
+		return timeColumn(group.UpdateAt)
+	case "urn":
+		return group.Urn
+	default:
+		return group.ID
+	}
+}
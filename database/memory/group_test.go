@@ -0,0 +1,245 @@
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Tecsisa/foulkon/api"
+	"github.com/Tecsisa/foulkon/database"
+)
+
+func TestMemoryRepo_AddGroup(t *testing.T) {
+	group := makeGroup("GroupID", "org1", "group1", "/path/", now)
+	testcases := map[string]struct {
+		// Previous data
+		previousGroup *api.Group
+		// Memory Repo Args
+		groupToCreate api.Group
+		// Expected result
+		expectedResponse *api.Group
+		expectedError    *database.Error
+	}{
+		"OkCase": {
+			groupToCreate:    group,
+			expectedResponse: &group,
+		},
+		"ErrorCaseGroupAlreadyExist": {
+			previousGroup: &group,
+			groupToCreate: group,
+			expectedError: &database.Error{
+				Code:    database.INTERNAL_ERROR,
+				Message: "Group with id GroupID already exists",
+			},
+		},
+	}
+
+	for n, test := range testcases {
+		repo := NewMemoryRepo()
+		if test.previousGroup != nil {
+			repo.AddGroup(*test.previousGroup)
+		}
+		storedGroup, err := repo.AddGroup(test.groupToCreate)
+		checkRepoResponse(t, n, test.expectedError, err, test.expectedResponse, storedGroup)
+	}
+}
+
+func TestMemoryRepo_GetGroupByName(t *testing.T) {
+	group := makeGroup("GroupID", "org1", "group1", "/path/", now)
+	testcases := map[string]struct {
+		org  string
+		name string
+		// Expected result
+		expectedResponse *api.Group
+		expectedError    *database.Error
+	}{
+		"OkCase": {
+			org:              "org1",
+			name:             "group1",
+			expectedResponse: &group,
+		},
+		"ErrorCaseGroupNotExist": {
+			org:  "org2",
+			name: "group1",
+			expectedError: &database.Error{
+				Code:    database.GROUP_NOT_FOUND,
+				Message: "Group with organization org2 and name group1 not found",
+			},
+		},
+	}
+
+	repo := NewMemoryRepo()
+	repo.AddGroup(group)
+	for n, test := range testcases {
+		receivedGroup, err := repo.GetGroupByName(test.org, test.name)
+		checkRepoResponse(t, n, test.expectedError, err, test.expectedResponse, receivedGroup)
+	}
+}
+
+func TestMemoryRepo_GetGroupsFiltered(t *testing.T) {
+	group1 := makeGroup("GroupID1", "org1", "group1", "/path/", now)
+	group2 := makeGroup("GroupID2", "org1", "group2", "/path/sub/", now.Add(time.Second))
+	group3 := makeGroup("GroupID3", "org2", "group3", "/path/", now.Add(2*time.Second))
+	testcases := map[string]struct {
+		filter *api.Filter
+		// Expected result
+		expectedResponse []api.Group
+		expectedTotal    int
+	}{
+		"OkCaseWithoutFilter": {
+			filter:           &api.Filter{},
+			expectedResponse: []api.Group{group1, group2, group3},
+			expectedTotal:    3,
+		},
+		"OkCaseOrgAndPathPrefix": {
+			filter: &api.Filter{
+				Org:        "org1",
+				PathPrefix: "/path/sub/",
+			},
+			expectedResponse: []api.Group{group2},
+			expectedTotal:    1,
+		},
+		"OkCaseOrderByAndPagination": {
+			filter: &api.Filter{
+				Limit:   2,
+				OrderBy: "name desc",
+			},
+			expectedResponse: []api.Group{group3, group2},
+			expectedTotal:    3,
+		},
+	}
+
+	repo := NewMemoryRepo()
+	for _, group := range []api.Group{group2, group3, group1} {
+		repo.AddGroup(group)
+	}
+	for n, test := range testcases {
+		groups, total, err := repo.GetGroupsFiltered(test.filter)
+		checkRepoResponse(t, n, nil, err, test.expectedResponse, groups)
+		if total != test.expectedTotal {
+			t.Errorf("Test %v failed. Received different total (wanted:%v / received:%v)", n, test.expectedTotal, total)
+		}
+	}
+}
+
+func TestMemoryRepo_UpdateGroup(t *testing.T) {
+	updatedGroup := makeGroup("GroupID", "org1", "newName", "/newpath/", now)
+	testcases := map[string]struct {
+		groupToUpdate api.Group
+		// Expected result
+		expectedResponse *api.Group
+		expectedError    *database.Error
+	}{
+		"OkCase": {
+			groupToUpdate:    updatedGroup,
+			expectedResponse: &updatedGroup,
+		},
+		"ErrorCaseGroupNotExist": {
+			groupToUpdate: makeGroup("GroupID2", "org1", "group2", "/path/", now),
+			expectedError: &database.Error{
+				Code:    database.GROUP_NOT_FOUND,
+				Message: "Group with name group2 not found",
+			},
+		},
+	}
+
+	for n, test := range testcases {
+		repo := NewMemoryRepo()
+		repo.AddGroup(makeGroup("GroupID", "org1", "group1", "/path/", now))
+		receivedGroup, err := repo.UpdateGroup(test.groupToUpdate)
+		checkRepoResponse(t, n, test.expectedError, err, test.expectedResponse, receivedGroup)
+		if test.expectedError == nil {
+			storedGroup, _ := repo.GetGroupByName(test.groupToUpdate.Org, test.groupToUpdate.Name)
+			checkRepoResponse(t, n, nil, nil, test.expectedResponse, storedGroup)
+		}
+	}
+}
+
+func TestMemoryRepo_RemoveGroup(t *testing.T) {
+	repo := NewMemoryRepo()
+	repo.AddUser(makeUser("UserID", "user1", "/path/", now))
+	repo.AddGroup(makeGroup("GroupID", "org1", "group1", "/path/", now))
+	repo.AddPolicy(makePolicy("PolicyID", "org1", "policy1", "/path/", now))
+	repo.AddMember("UserID", "GroupID")
+	repo.AttachPolicy("GroupID", "PolicyID")
+
+	if err := repo.RemoveGroup("GroupID"); err != nil {
+		t.Fatalf("Test failed. Unexpected error: %v", err)
+	}
+	if _, err := repo.GetGroupById("GroupID"); err == nil {
+		t.Errorf("Test failed. Group wasn't removed")
+	}
+	if isMember, _ := repo.IsMemberOfGroup("UserID", "GroupID"); isMember {
+		t.Errorf("Test failed. Member relations weren't removed")
+	}
+	if isAttached, _ := repo.IsAttachedToGroup("GroupID", "PolicyID"); isAttached {
+		t.Errorf("Test failed. Policy relations weren't removed")
+	}
+}
+
+func TestMemoryRepo_Members(t *testing.T) {
+	repo := NewMemoryRepo()
+	user := makeUser("UserID", "user1", "/path/", now)
+	repo.AddUser(user)
+	repo.AddGroup(makeGroup("GroupID", "org1", "group1", "/path/", now))
+
+	// Add member
+	if err := repo.AddMember("UserID", "GroupID"); err != nil {
+		t.Fatalf("Test failed. Unexpected error adding member: %v", err)
+	}
+	checkRepoResponse(t, "AddMemberDuplicated", &database.Error{
+		Code:    database.INTERNAL_ERROR,
+		Message: "User with id UserID is already a member of group with id GroupID",
+	}, repo.AddMember("UserID", "GroupID"), nil, nil)
+
+	// Check member
+	if isMember, err := repo.IsMemberOfGroup("UserID", "GroupID"); !isMember || err != nil {
+		t.Errorf("Test failed. User isn't member of group, error: %v", err)
+	}
+	members, total, err := repo.GetGroupMembers("GroupID", &api.Filter{})
+	if err != nil || total != 1 || len(members) != 1 {
+		t.Fatalf("Test failed. Received different members (wanted:1 / received:%v), error: %v", total, err)
+	}
+	checkRepoResponse(t, "GetGroupMembers", nil, nil, &user, members[0].GetUser())
+
+	// Remove member
+	if err := repo.RemoveMember("UserID", "GroupID"); err != nil {
+		t.Fatalf("Test failed. Unexpected error removing member: %v", err)
+	}
+	if isMember, _ := repo.IsMemberOfGroup("UserID", "GroupID"); isMember {
+		t.Errorf("Test failed. User is still member of group")
+	}
+}
+
+func TestMemoryRepo_AttachedPolicies(t *testing.T) {
+	repo := NewMemoryRepo()
+	policy := makePolicy("PolicyID", "org1", "policy1", "/path/", now)
+	repo.AddGroup(makeGroup("GroupID", "org1", "group1", "/path/", now))
+	repo.AddPolicy(policy)
+
+	// Attach policy
+	if err := repo.AttachPolicy("GroupID", "PolicyID"); err != nil {
+		t.Fatalf("Test failed. Unexpected error attaching policy: %v", err)
+	}
+	checkRepoResponse(t, "AttachPolicyDuplicated", &database.Error{
+		Code:    database.INTERNAL_ERROR,
+		Message: "Policy with id PolicyID is already attached to group with id GroupID",
+	}, repo.AttachPolicy("GroupID", "PolicyID"), nil, nil)
+
+	// Check attachment
+	if isAttached, err := repo.IsAttachedToGroup("GroupID", "PolicyID"); !isAttached || err != nil {
+		t.Errorf("Test failed. Policy isn't attached to group, error: %v", err)
+	}
+	policies, total, err := repo.GetAttachedPolicies("GroupID", &api.Filter{})
+	if err != nil || total != 1 || len(policies) != 1 {
+		t.Fatalf("Test failed. Received different policies (wanted:1 / received:%v), error: %v", total, err)
+	}
+	checkRepoResponse(t, "GetAttachedPolicies", nil, nil, &policy, policies[0].GetPolicy())
+
+	// Detach policy
+	if err := repo.DetachPolicy("GroupID", "PolicyID"); err != nil {
+		t.Fatalf("Test failed. Unexpected error detaching policy: %v", err)
+	}
+	if isAttached, _ := repo.IsAttachedToGroup("GroupID", "PolicyID"); isAttached {
+		t.Errorf("Test failed. Policy is still attached to group")
+	}
+}
@@ -0,0 +1,252 @@
+package memory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Tecsisa/foulkon/api"
+	"github.com/Tecsisa/foulkon/database"
+)
+
+// MemoryRepo implements user, group, policy, service account, audit and event repositories keeping all data in memory.
+// It is safe for concurrent use and its content is lost when the process finishes.
+type MemoryRepo struct {
+	mutex sync.RWMutex
+	memoryData
+
+	// Current time, fixed by transactions
+	now func() time.Time
+}
+
+// Data stored in a repository
+type memoryData struct {
+	users    map[string]api.User
+	groups   map[string]api.Group
+	policies map[string]api.Policy
+
+	serviceAccounts map[string]api.ServiceAccount
+
+	groupUserRelations   []groupUserRelation
+	groupPolicyRelations []groupPolicyRelation
+
+	auditEvents []api.AuditEvent
+	outbox      []api.OutboxEntry
+}
+
+// Group-Users Relationship
+type groupUserRelation struct {
+	UserID   string
+	GroupID  string
+	CreateAt time.Time
+}
+
+// Group-Policies Relationship
+type groupPolicyRelation struct {
+	GroupID  string
+	PolicyID string
+	CreateAt time.Time
+}
+
+// NewMemoryRepo returns an empty repository
+func NewMemoryRepo() *MemoryRepo {
+	return &MemoryRepo{
+		memoryData: memoryData{
+			users:                map[string]api.User{},
+			groups:               map[string]api.Group{},
+			policies:             map[string]api.Policy{},
+			serviceAccounts:      map[string]api.ServiceAccount{},
+			groupUserRelations:   []groupUserRelation{},
+			groupPolicyRelations: []groupPolicyRelation{},
+			auditEvents:          []api.AuditEvent{},
+			outbox:               []api.OutboxEntry{},
+		},
+		now: time.Now,
+	}
+}
+
+// Update makes a change in a transaction, with the date specified as the date of the relations it creates.
+// Change is done with the repository received, while this one is locked, and it is rolled back if change
+// returns an error. Data is copied to roll it back, except audit events that are only appended.
+func (r *MemoryRepo) Update(now time.Time, change func(tx *MemoryRepo) error) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	backup := r.memoryData.copy()
+	tx := &MemoryRepo{
+		memoryData: r.memoryData,
+		now: func() time.Time {
+			return now
+		},
+	}
+	if err := change(tx); err != nil {
+		r.memoryData = backup
+		return err
+	}
+	r.memoryData = tx.memoryData
+	return nil
+}
+
+// Transaction makes changes with the repositories of a transaction, like Update method
+func (r *MemoryRepo) Transaction(change func(repos api.Repos) error) error {
+	return r.Update(time.Now(), func(tx *MemoryRepo) error {
+		return change(api.Repos{
+			UserRepo:           tx,
+			GroupRepo:          tx,
+			PolicyRepo:         tx,
+			ServiceAccountRepo: tx,
+			AuditRepo:          tx,
+			EventRepo:          tx,
+		})
+	})
+}
+
+func (r *MemoryRepo) OrderByValidColumns(action string) []string {
+	switch action {
+	case api.USER_ACTION_LIST_USERS:
+		return []string{"path", "external_id", "create_at", "update_at", "urn"}
+	case api.USER_ACTION_LIST_GROUPS_FOR_USER:
+		return []string{"create_at"}
+	case api.GROUP_ACTION_LIST_GROUPS:
+		return []string{"name", "path", "org", "create_at", "update_at", "urn"}
+	case api.GROUP_ACTION_LIST_MEMBERS:
+		return []string{"create_at"}
+	case api.GROUP_ACTION_LIST_ATTACHED_GROUP_POLICIES:
+		return []string{"create_at"}
+	case api.POLICY_ACTION_LIST_POLICIES:
+		return []string{"name", "path", "org", "create_at", "update_at", "urn"}
+	case api.POLICY_ACTION_LIST_ATTACHED_GROUPS:
+		return []string{"create_at"}
+	case api.SERVICE_ACCOUNT_ACTION_LIST_SERVICE_ACCOUNTS:
+		return []string{"name", "external_id", "create_at"}
+	default:
+		return nil
+	}
+}
+
+// PRIVATE HELPER METHODS
+
+// Copy the collections, so changes done in the data don't modify the copy. Stored values are
+// replaced instead of modified, so they aren't copied.
+func (d memoryData) copy() memoryData {
+	c := memoryData{
+		users:                map[string]api.User{},
+		groups:               map[string]api.Group{},
+		policies:             map[string]api.Policy{},
+		serviceAccounts:      map[string]api.ServiceAccount{},
+		groupUserRelations:   append([]groupUserRelation{}, d.groupUserRelations...),
+		groupPolicyRelations: append([]groupPolicyRelation{}, d.groupPolicyRelations...),
+		// Appended events are beyond the length of the copy
+		auditEvents: d.auditEvents,
+		outbox:      append([]api.OutboxEntry{}, d.outbox...),
+	}
+	for id, user := range d.users {
+		c.users[id] = user
+	}
+	for id, group := range d.groups {
+		c.groups[id] = group
+	}
+	for id, policy := range d.policies {
+		c.policies[id] = policy
+	}
+	for id, sa := range d.serviceAccounts {
+		c.serviceAccounts[id] = sa
+	}
+	return c
+}
+
+// Sorter used to order entities with the column values returned by a function
+type sorter struct {
+	length int
+	less   func(i, j int) bool
+	swap   func(i, j int)
+}
+
+func (s sorter) Len() int           { return s.length }
+func (s sorter) Less(i, j int) bool { return s.less(i, j) }
+func (s sorter) Swap(i, j int)      { s.swap(i, j) }
+
+// Sort entities with the OrderBy filter value ("column asc" or "column desc"). Entities are sorted by
+// creation date if there isn't order, and ties are broken by id to return always the same order.
+func sortByColumn(orderBy string, length int, value func(i int, column string) string, swap func(i, j int)) {
+	column := "create_at"
+	desc := false
+	if len(orderBy) > 0 {
+		fields := strings.Fields(orderBy)
+		column = fields[0]
+		desc = len(fields) > 1 && strings.ToLower(fields[1]) == "desc"
+	}
+	sort.Sort(sorter{
+		length: length,
+		less: func(i, j int) bool {
+			vi, vj := value(i, column), value(j, column)
+			if vi == vj {
+				return value(i, "id") < value(j, "id")
+			}
+			if desc {
+				return vi > vj
+			}
+			return vi < vj
+		},
+		swap: swap,
+	})
+}
+
+// Transform a date into a column value that keeps the order when it is compared as string
+func timeColumn(t time.Time) string {
+	return fmt.Sprintf("%020d", t.UnixNano())
+}
+
+// Return the bounds of the page requested. A limit less than 1 returns all elements from offset
+func paginate(filter *api.Filter, total int) (int, int) {
+	start := filter.Offset
+	if start > total || start < 0 {
+		start = total
+	}
+	end := total
+	if filter.Limit > 0 && start+filter.Limit < total {
+		end = start + filter.Limit
+	}
+	return start, end
+}
+
+// Remove monotonic clock and location from dates so they are returned like they are stored
+func normalizeTime(t time.Time) time.Time {
+	return time.Unix(0, t.UnixNano()).UTC()
+}
+
+// Copy statements so stored policies can't be modified from outside
+func copyStatements(statements *[]api.Statement) *[]api.Statement {
+	if statements == nil {
+		return nil
+	}
+	copied := make([]api.Statement, len(*statements))
+	for i, s := range *statements {
+		var conditions api.Conditions
+		if s.Conditions != nil {
+			conditions = api.Conditions{}
+			for operator, keys := range s.Conditions {
+				conditions[operator] = map[string][]string{}
+				for key, values := range keys {
+					conditions[operator][key] = append([]string{}, values...)
+				}
+			}
+		}
+		copied[i] = api.Statement{
+			Effect:     s.Effect,
+			Actions:    append([]string{}, s.Actions...),
+			Resources:  append([]string{}, s.Resources...),
+			Conditions: conditions,
+		}
+	}
+	return &copied
+}
+
+func internalError(format string, args ...interface{}) error {
+	return &database.Error{
+		Code:    database.INTERNAL_ERROR,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
@@ -0,0 +1,269 @@
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Tecsisa/foulkon/api"
+	"github.com/Tecsisa/foulkon/database"
+	"github.com/Tecsisa/foulkon/database/conformance"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+var now = time.Date(2016, time.October, 1, 10, 0, 0, 0, time.UTC)
+
+func TestMemoryRepo_OrderByValidColumns(t *testing.T) {
+	testcases := map[string]struct {
+		action          string
+		expectedColumns []string
+	}{
+		"OkCaseAction-" + api.USER_ACTION_LIST_USERS: {
+			action:          api.USER_ACTION_LIST_USERS,
+			expectedColumns: []string{"path", "external_id", "create_at", "update_at", "urn"},
+		},
+		"OkCaseAction-" + api.USER_ACTION_LIST_GROUPS_FOR_USER: {
+			action:          api.USER_ACTION_LIST_GROUPS_FOR_USER,
+			expectedColumns: []string{"create_at"},
+		},
+		"OkCaseAction-" + api.GROUP_ACTION_LIST_GROUPS: {
+			action:          api.GROUP_ACTION_LIST_GROUPS,
+			expectedColumns: []string{"name", "path", "org", "create_at", "update_at", "urn"},
+		},
+		"OkCaseAction-" + api.GROUP_ACTION_LIST_MEMBERS: {
+			action:          api.GROUP_ACTION_LIST_MEMBERS,
+			expectedColumns: []string{"create_at"},
+		},
+		"OkCaseAction-" + api.GROUP_ACTION_LIST_ATTACHED_GROUP_POLICIES: {
+			action:          api.GROUP_ACTION_LIST_ATTACHED_GROUP_POLICIES,
+			expectedColumns: []string{"create_at"},
+		},
+		"OkCaseAction-" + api.POLICY_ACTION_LIST_POLICIES: {
+			action:          api.POLICY_ACTION_LIST_POLICIES,
+			expectedColumns: []string{"name", "path", "org", "create_at", "update_at", "urn"},
+		},
+		"OkCaseAction-" + api.POLICY_ACTION_LIST_ATTACHED_GROUPS: {
+			action:          api.POLICY_ACTION_LIST_ATTACHED_GROUPS,
+			expectedColumns: []string{"create_at"},
+		},
+		"OkCaseOtherActions": {
+			action:          "other",
+			expectedColumns: []string{},
+		},
+	}
+
+	for n, test := range testcases {
+		validColumns := NewMemoryRepo().OrderByValidColumns(test.action)
+		if diff := pretty.Compare(validColumns, test.expectedColumns); diff != "" {
+			t.Errorf("Test %v failed. Received different error response (received/wanted) %v", n, diff)
+		}
+	}
+}
+
+func Test_paginate(t *testing.T) {
+	testcases := map[string]struct {
+		filter        *api.Filter
+		total         int
+		expectedStart int
+		expectedEnd   int
+	}{
+		"OkCaseNoLimit": {
+			filter:        &api.Filter{},
+			total:         5,
+			expectedStart: 0,
+			expectedEnd:   5,
+		},
+		"OkCaseLimit": {
+			filter: &api.Filter{
+				Offset: 1,
+				Limit:  2,
+			},
+			total:         5,
+			expectedStart: 1,
+			expectedEnd:   3,
+		},
+		"OkCaseLimitBiggerThanTotal": {
+			filter: &api.Filter{
+				Offset: 3,
+				Limit:  20,
+			},
+			total:         5,
+			expectedStart: 3,
+			expectedEnd:   5,
+		},
+		"OkCaseOffsetBiggerThanTotal": {
+			filter: &api.Filter{
+				Offset: 10,
+				Limit:  20,
+			},
+			total:         5,
+			expectedStart: 5,
+			expectedEnd:   5,
+		},
+	}
+
+	for n, test := range testcases {
+		start, end := paginate(test.filter, test.total)
+		if start != test.expectedStart || end != test.expectedEnd {
+			t.Errorf("Test %v failed. Received different bounds (wanted:%v-%v / received:%v-%v)",
+				n, test.expectedStart, test.expectedEnd, start, end)
+		}
+	}
+}
+
+func Test_copyStatements(t *testing.T) {
+	statements := &[]api.Statement{
+		{
+			Effect:    "allow",
+			Actions:   []string{"iam:*"},
+			Resources: []string{"urn:everything:*"},
+			Conditions: api.Conditions{
+				api.CONDITION_STRING_EQUALS: {
+					"example:Key": []string{"value"},
+				},
+			},
+		},
+	}
+	copied := copyStatements(statements)
+	if diff := pretty.Compare(copied, statements); diff != "" {
+		t.Errorf("Test failed. Received different statements (received/wanted) %v", diff)
+	}
+
+	// Modify copy
+	(*copied)[0].Actions[0] = "other:*"
+	(*copied)[0].Conditions[api.CONDITION_STRING_EQUALS]["example:Key"][0] = "other"
+	if (*statements)[0].Actions[0] != "iam:*" || (*statements)[0].Conditions[api.CONDITION_STRING_EQUALS]["example:Key"][0] != "value" {
+		t.Errorf("Test failed. Original statements modified: %v", *statements)
+	}
+	if copyStatements(nil) != nil {
+		t.Errorf("Test failed. Expected nil statements")
+	}
+}
+
+func TestMemoryRepo_Conformance(t *testing.T) {
+	conformance.RunRepoTests(t, func(t *testing.T) conformance.Repos {
+		repo := NewMemoryRepo()
+		return conformance.Repos{
+			UserRepo:           repo,
+			GroupRepo:          repo,
+			PolicyRepo:         repo,
+			ServiceAccountRepo: repo,
+			AuditRepo:          repo,
+			EventRepo:          repo,
+			TxRepo:             repo,
+		}
+	})
+}
+
+func TestMemoryRepo_Update(t *testing.T) {
+	repo := NewMemoryRepo()
+	user := makeUser("UserID", "user1", "/path/", now)
+	group := makeGroup("GroupID", "org1", "group1", "/path/", now)
+
+	// Relations are created with the date of the transaction
+	err := repo.Update(now, func(tx *MemoryRepo) error {
+		if _, err := tx.AddUser(user); err != nil {
+			return err
+		}
+		if _, err := tx.AddGroup(group); err != nil {
+			return err
+		}
+		return tx.AddMember(user.ID, group.ID)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error updating repository: %v", err)
+	}
+	members := repo.Snapshot().Members
+	if len(members) != 1 || !members[0].CreateAt.Equal(now) {
+		t.Errorf("Test failed. Received unexpected members %v", members)
+	}
+
+	// Changes are rolled back when transaction fails
+	other := makeUser("OtherUserID", "user2", "/path/", now)
+	err = repo.Update(now, func(tx *MemoryRepo) error {
+		if _, err := tx.AddUser(other); err != nil {
+			return err
+		}
+		if err := tx.RemoveMember(user.ID, group.ID); err != nil {
+			return err
+		}
+		// User already exists
+		_, err := tx.AddUser(user)
+		return err
+	})
+	if err == nil {
+		t.Fatalf("Test failed. Expected error updating repository")
+	}
+	if _, err := repo.GetUserByExternalID(other.ExternalID); err == nil {
+		t.Errorf("Test failed. User was stored although transaction failed")
+	}
+	if ok, _ := repo.IsMemberOfGroup(user.ID, group.ID); !ok {
+		t.Errorf("Test failed. Member was removed although transaction failed")
+	}
+}
+
+// Aux methods
+
+func checkRepoResponse(t *testing.T, testcase string, expectedError *database.Error, receivedError error, expectedResponse interface{}, receivedResponse interface{}) {
+	if expectedError != nil {
+		dbError, ok := receivedError.(*database.Error)
+		if !ok || dbError == nil {
+			t.Errorf("Test %v failed. Unexpected data retrieved from error: %v", testcase, receivedError)
+			return
+		}
+		if diff := pretty.Compare(dbError, expectedError); diff != "" {
+			t.Errorf("Test %v failed. Received different error response (received/wanted) %v", testcase, diff)
+			return
+		}
+	} else {
+		if receivedError != nil {
+			t.Errorf("Test %v failed. Unexpected error: %v", testcase, receivedError)
+			return
+		}
+		if diff := pretty.Compare(receivedResponse, expectedResponse); diff != "" {
+			t.Errorf("Test %v failed. Received different responses (received/wanted) %v", testcase, diff)
+			return
+		}
+	}
+}
+
+func makeUser(id string, externalID string, path string, createAt time.Time) api.User {
+	return api.User{
+		ID:         id,
+		ExternalID: externalID,
+		Path:       path,
+		Urn:        api.CreateUrn("", api.RESOURCE_USER, path, externalID),
+		CreateAt:   createAt,
+		UpdateAt:   createAt,
+	}
+}
+
+func makeGroup(id string, org string, name string, path string, createAt time.Time) api.Group {
+	return api.Group{
+		ID:       id,
+		Org:      org,
+		Name:     name,
+		Path:     path,
+		Urn:      api.CreateUrn(org, api.RESOURCE_GROUP, path, name),
+		CreateAt: createAt,
+		UpdateAt: createAt,
+	}
+}
+
+func makePolicy(id string, org string, name string, path string, createAt time.Time) api.Policy {
+	return api.Policy{
+		ID:       id,
+		Org:      org,
+		Name:     name,
+		Path:     path,
+		Urn:      api.CreateUrn(org, api.RESOURCE_POLICY, path, name),
+		CreateAt: createAt,
+		UpdateAt: createAt,
+		Statements: &[]api.Statement{
+			{
+				Effect:    "allow",
+				Actions:   []string{"iam:*"},
+				Resources: []string{"urn:everything:*"},
+			},
+		},
+	}
+}
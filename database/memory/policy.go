@@ -0,0 +1,281 @@
+package memory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Tecsisa/foulkon/api"
+	"github.com/Tecsisa/foulkon/database"
+)
+
+// POLICY REPOSITORY IMPLEMENTATION
+
+func (r *MemoryRepo) AddPolicy(policy api.Policy) (*api.Policy, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// Check unique fields
+	if _, ok := r.policies[policy.ID]; ok {
+		return nil, internalError("Policy with id %v already exists", policy.ID)
+	}
+	for _, p := range r.policies {
+		if p.Urn == policy.Urn {
+			return nil, internalError("Policy with urn %v already exists", policy.Urn)
+		}
+	}
+
+	// Store policy
+	r.policies[policy.ID] = memPolicy(policy)
+
+	// Create API policy
+	policyApi := memPolicy(policy)
+	policyApi.Statements = policy.Statements
+
+	return &policyApi, nil
+}
+
+func (r *MemoryRepo) GetPolicyByName(org string, name string) (*api.Policy, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.getPolicyByName(org, name)
+}
+
+func (r *MemoryRepo) GetPolicyById(id string) (*api.Policy, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.getPolicyByID(id)
+}
+
+func (r *MemoryRepo) GetPoliciesFiltered(filter *api.Filter) ([]api.Policy, int, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	policies := []api.Policy{}
+	for _, policy := range r.policies {
+		if len(filter.Org) > 0 && policy.Org != filter.Org {
+			continue
+		}
+		if strings.HasPrefix(policy.Path, filter.PathPrefix) {
+			policies = append(policies, policy)
+		}
+	}
+
+	sortByColumn(filter.OrderBy, len(policies), func(i int, column string) string {
+		return policyColumn(policies[i], column)
+	}, func(i, j int) {
+		policies[i], policies[j] = policies[j], policies[i]
+	})
+
+	total := len(policies)
+	start, end := paginate(filter, total)
+
+	// Return copies of statements
+	apiPolicies := []api.Policy{}
+	for _, policy := range policies[start:end] {
+		policy.Statements = copyStatements(policy.Statements)
+		apiPolicies = append(apiPolicies, policy)
+	}
+
+	return apiPolicies, total, nil
+}
+
+func (r *MemoryRepo) UpdatePolicy(policy api.Policy) (*api.Policy, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.policies[policy.ID]; !ok {
+		return nil, &database.Error{
+			Code:    database.POLICY_NOT_FOUND,
+			Message: fmt.Sprintf("Policy with id %v not found", policy.ID),
+		}
+	}
+	for _, p := range r.policies {
+		if p.ID != policy.ID && p.Urn == policy.Urn {
+			return nil, internalError("Policy with urn %v already exists", policy.Urn)
+		}
+	}
+
+	// Update policy and override its statements
+	r.policies[policy.ID] = memPolicy(policy)
+
+	return &policy, nil
+}
+
+func (r *MemoryRepo) RemovePolicy(id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// Delete policy relations (group)
+	relations := []groupPolicyRelation{}
+	for _, rel := range r.groupPolicyRelations {
+		if rel.PolicyID != id {
+			relations = append(relations, rel)
+		}
+	}
+	r.groupPolicyRelations = relations
+
+	// Delete policy with its statements
+	delete(r.policies, id)
+
+	return nil
+}
+
+func (r *MemoryRepo) GetAttachedGroups(policyID string, filter *api.Filter) ([]api.PolicyGroupRelation, int, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	relations := []groupPolicyRelation{}
+	for _, rel := range r.groupPolicyRelations {
+		if rel.PolicyID == policyID {
+			relations = append(relations, rel)
+		}
+	}
+
+	sortByColumn(filter.OrderBy, len(relations), func(i int, column string) string {
+		if column == "create_at" {
+			return timeColumn(relations[i].CreateAt)
+		}
+		return relations[i].GroupID
+	}, func(i, j int) {
+		relations[i], relations[j] = relations[j], relations[i]
+	})
+
+	total := len(relations)
+	start, end := paginate(filter, total)
+
+	// Transform relations to API domain
+	groups := []api.PolicyGroupRelation{}
+	for _, rel := range relations[start:end] {
+		group, err := r.getGroupByID(rel.GroupID)
+		if err != nil {
+			return nil, total, internalError("%v", err.Error())
+		}
+		groups = append(groups, PolicyGroup{
+			Group:    group,
+			CreateAt: rel.CreateAt,
+		})
+	}
+
+	return groups, total, nil
+}
+
+func (r *MemoryRepo) GetEffectiveStatementsByUser(userID string, action string) ([]api.Statement, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	groupIDs := map[string]bool{}
+	for _, rel := range r.groupUserRelations {
+		if rel.UserID == userID {
+			groupIDs[rel.GroupID] = true
+		}
+	}
+
+	// Policies attached to several groups of the user are only included once
+	policyIDs := map[string]bool{}
+	policies := []api.Policy{}
+	for _, rel := range r.groupPolicyRelations {
+		if !groupIDs[rel.GroupID] || policyIDs[rel.PolicyID] {
+			continue
+		}
+		policyIDs[rel.PolicyID] = true
+		policy, err := r.getPolicyByID(rel.PolicyID)
+		if err != nil {
+			return nil, internalError("%v", err.Error())
+		}
+		policies = append(policies, *policy)
+	}
+
+	// Statements are returned by policy organization and name, in the order they have in the policy
+	sort.Sort(sorter{
+		length: len(policies),
+		less: func(i, j int) bool {
+			if policies[i].Org != policies[j].Org {
+				return policies[i].Org < policies[j].Org
+			}
+			return policies[i].Name < policies[j].Name
+		},
+		swap: func(i, j int) {
+			policies[i], policies[j] = policies[j], policies[i]
+		},
+	})
+	statements := []api.Statement{}
+	for _, policy := range policies {
+		for _, statement := range *policy.Statements {
+			if action == "" || api.IsActionContained(action, statement.Actions) {
+				statements = append(statements, statement)
+			}
+		}
+	}
+
+	return statements, nil
+}
+
+// PRIVATE HELPER METHODS
+
+// Retrieve policy by id. Caller must hold the lock
+func (r *MemoryRepo) getPolicyByID(id string) (*api.Policy, error) {
+	policy, ok := r.policies[id]
+	if !ok {
+		return nil, &database.Error{
+			Code:    database.POLICY_NOT_FOUND,
+			Message: fmt.Sprintf("Policy with id %v not found", id),
+		}
+	}
+	policy.Statements = copyStatements(policy.Statements)
+	return &policy, nil
+}
+
+// Retrieve policy by organization and name. Caller must hold the lock
+func (r *MemoryRepo) getPolicyByName(org string, name string) (*api.Policy, error) {
+	for _, policy := range r.policies {
+		if policy.Org == org && policy.Name == name {
+			policy.Statements = copyStatements(policy.Statements)
+			return &policy, nil
+		}
+	}
+	return nil, &database.Error{
+		Code:    database.POLICY_NOT_FOUND,
+		Message: fmt.Sprintf("Policy with organization %v and name %v not found", org, name),
+	}
+}
+
+// Transform a policy received into the stored one
+func memPolicy(policy api.Policy) api.Policy {
+	statements := copyStatements(policy.Statements)
+	if statements == nil {
+		statements = &[]api.Statement{}
+	}
+	return api.Policy{
+		ID:         policy.ID,
+		Name:       policy.Name,
+		Path:       policy.Path,
+		CreateAt:   normalizeTime(policy.CreateAt),
+		UpdateAt:   normalizeTime(policy.UpdateAt),
+		Urn:        policy.Urn,
+		Org:        policy.Org,
+		Statements: statements,
+	}
+}
+
+// Return the value of a policy column to sort policies
+func policyColumn(policy api.Policy, column string) string {
+	switch column {
+	case "name":
+		return policy.Name
+	case "path":
+		return policy.Path
+	case "org":
+		return policy.Org
+	case "create_at":
+		return timeColumn(policy.CreateAt)
+	case "update_at":
+		return timeColumn(policy.UpdateAt)
+	case "urn":
+		return policy.Urn
+	default:
+		return policy.ID
+	}
+}
@@ -0,0 +1,207 @@
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Tecsisa/foulkon/api"
+	"github.com/Tecsisa/foulkon/database"
+)
+
+func TestMemoryRepo_AddPolicy(t *testing.T) {
+	policy := makePolicy("PolicyID", "org1", "policy1", "/path/", now)
+	testcases := map[string]struct {
+		// Previous data
+		previousPolicy *api.Policy
+		// Memory Repo Args
+		policyToCreate api.Policy
+		// Expected result
+		expectedResponse *api.Policy
+		expectedError    *database.Error
+	}{
+		"OkCase": {
+			policyToCreate:   policy,
+			expectedResponse: &policy,
+		},
+		"ErrorCasePolicyAlreadyExist": {
+			previousPolicy: &policy,
+			policyToCreate: policy,
+			expectedError: &database.Error{
+				Code:    database.INTERNAL_ERROR,
+				Message: "Policy with id PolicyID already exists",
+			},
+		},
+	}
+
+	for n, test := range testcases {
+		repo := NewMemoryRepo()
+		if test.previousPolicy != nil {
+			repo.AddPolicy(*test.previousPolicy)
+		}
+		storedPolicy, err := repo.AddPolicy(test.policyToCreate)
+		checkRepoResponse(t, n, test.expectedError, err, test.expectedResponse, storedPolicy)
+	}
+}
+
+func TestMemoryRepo_GetPolicyByName(t *testing.T) {
+	policy := makePolicy("PolicyID", "org1", "policy1", "/path/", now)
+	testcases := map[string]struct {
+		org  string
+		name string
+		// Expected result
+		expectedResponse *api.Policy
+		expectedError    *database.Error
+	}{
+		"OkCase": {
+			org:              "org1",
+			name:             "policy1",
+			expectedResponse: &policy,
+		},
+		"ErrorCasePolicyNotExist": {
+			org:  "org1",
+			name: "policy2",
+			expectedError: &database.Error{
+				Code:    database.POLICY_NOT_FOUND,
+				Message: "Policy with organization org1 and name policy2 not found",
+			},
+		},
+	}
+
+	repo := NewMemoryRepo()
+	repo.AddPolicy(policy)
+	for n, test := range testcases {
+		receivedPolicy, err := repo.GetPolicyByName(test.org, test.name)
+		checkRepoResponse(t, n, test.expectedError, err, test.expectedResponse, receivedPolicy)
+	}
+
+	// Stored statements can't be modified from outside
+	receivedPolicy, _ := repo.GetPolicyByName("org1", "policy1")
+	(*receivedPolicy.Statements)[0].Effect = "deny"
+	storedPolicy, _ := repo.GetPolicyById("PolicyID")
+	checkRepoResponse(t, "ModifiedStatements", nil, nil, &policy, storedPolicy)
+}
+
+func TestMemoryRepo_GetPoliciesFiltered(t *testing.T) {
+	policy1 := makePolicy("PolicyID1", "org1", "policy1", "/path/", now)
+	policy2 := makePolicy("PolicyID2", "org1", "policy2", "/path/sub/", now.Add(time.Second))
+	policy3 := makePolicy("PolicyID3", "org2", "policy3", "/path/", now.Add(2*time.Second))
+	testcases := map[string]struct {
+		filter *api.Filter
+		// Expected result
+		expectedResponse []api.Policy
+		expectedTotal    int
+	}{
+		"OkCaseWithoutFilter": {
+			filter:           &api.Filter{},
+			expectedResponse: []api.Policy{policy1, policy2, policy3},
+			expectedTotal:    3,
+		},
+		"OkCaseOrg": {
+			filter: &api.Filter{
+				Org: "org2",
+			},
+			expectedResponse: []api.Policy{policy3},
+			expectedTotal:    1,
+		},
+		"OkCaseOrderByAndPagination": {
+			filter: &api.Filter{
+				Offset:  1,
+				Limit:   1,
+				OrderBy: "create_at desc",
+			},
+			expectedResponse: []api.Policy{policy2},
+			expectedTotal:    3,
+		},
+	}
+
+	repo := NewMemoryRepo()
+	for _, policy := range []api.Policy{policy3, policy2, policy1} {
+		repo.AddPolicy(policy)
+	}
+	for n, test := range testcases {
+		policies, total, err := repo.GetPoliciesFiltered(test.filter)
+		checkRepoResponse(t, n, nil, err, test.expectedResponse, policies)
+		if total != test.expectedTotal {
+			t.Errorf("Test %v failed. Received different total (wanted:%v / received:%v)", n, test.expectedTotal, total)
+		}
+	}
+}
+
+func TestMemoryRepo_UpdatePolicy(t *testing.T) {
+	updatedPolicy := makePolicy("PolicyID", "org1", "newName", "/newpath/", now)
+	updatedPolicy.Statements = &[]api.Statement{
+		{
+			Effect:    "deny",
+			Actions:   []string{"iam:GetUser"},
+			Resources: []string{"urn:iws:iam::user/path/*"},
+		},
+	}
+	testcases := map[string]struct {
+		policyToUpdate api.Policy
+		// Expected result
+		expectedResponse *api.Policy
+		expectedError    *database.Error
+	}{
+		"OkCase": {
+			policyToUpdate:   updatedPolicy,
+			expectedResponse: &updatedPolicy,
+		},
+		"ErrorCasePolicyNotExist": {
+			policyToUpdate: makePolicy("PolicyID2", "org1", "policy2", "/path/", now),
+			expectedError: &database.Error{
+				Code:    database.POLICY_NOT_FOUND,
+				Message: "Policy with id PolicyID2 not found",
+			},
+		},
+	}
+
+	for n, test := range testcases {
+		repo := NewMemoryRepo()
+		repo.AddPolicy(makePolicy("PolicyID", "org1", "policy1", "/path/", now))
+		receivedPolicy, err := repo.UpdatePolicy(test.policyToUpdate)
+		checkRepoResponse(t, n, test.expectedError, err, test.expectedResponse, receivedPolicy)
+		if test.expectedError == nil {
+			storedPolicy, _ := repo.GetPolicyByName(test.policyToUpdate.Org, test.policyToUpdate.Name)
+			checkRepoResponse(t, n, nil, nil, test.expectedResponse, storedPolicy)
+		}
+	}
+}
+
+func TestMemoryRepo_RemovePolicy(t *testing.T) {
+	repo := NewMemoryRepo()
+	repo.AddGroup(makeGroup("GroupID", "org1", "group1", "/path/", now))
+	repo.AddPolicy(makePolicy("PolicyID", "org1", "policy1", "/path/", now))
+	repo.AttachPolicy("GroupID", "PolicyID")
+
+	if err := repo.RemovePolicy("PolicyID"); err != nil {
+		t.Fatalf("Test failed. Unexpected error: %v", err)
+	}
+	if _, err := repo.GetPolicyById("PolicyID"); err == nil {
+		t.Errorf("Test failed. Policy wasn't removed")
+	}
+	if isAttached, _ := repo.IsAttachedToGroup("GroupID", "PolicyID"); isAttached {
+		t.Errorf("Test failed. Policy relations weren't removed")
+	}
+}
+
+func TestMemoryRepo_GetAttachedGroups(t *testing.T) {
+	group1 := makeGroup("GroupID1", "org1", "group1", "/path/", now)
+	group2 := makeGroup("GroupID2", "org1", "group2", "/path/", now)
+	repo := NewMemoryRepo()
+	repo.AddGroup(group1)
+	repo.AddGroup(group2)
+	repo.AddPolicy(makePolicy("PolicyID", "org1", "policy1", "/path/", now))
+	repo.groupPolicyRelations = []groupPolicyRelation{
+		{GroupID: "GroupID1", PolicyID: "PolicyID", CreateAt: now},
+		{GroupID: "GroupID2", PolicyID: "PolicyID", CreateAt: now.Add(time.Second)},
+	}
+
+	groups, total, err := repo.GetAttachedGroups("PolicyID", &api.Filter{OrderBy: "create_at desc"})
+	checkRepoResponse(t, "OkCase", nil, err, []api.PolicyGroupRelation{
+		PolicyGroup{Group: &group2, CreateAt: now.Add(time.Second)},
+		PolicyGroup{Group: &group1, CreateAt: now},
+	}, groups)
+	if total != 2 {
+		t.Errorf("Test failed. Received different total (wanted:2 / received:%v)", total)
+	}
+}
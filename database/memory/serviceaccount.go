@@ -0,0 +1,117 @@
+package memory
+
+import (
+	"fmt"
+
+	"github.com/Tecsisa/foulkon/api"
+	"github.com/Tecsisa/foulkon/database"
+)
+
+// SERVICE ACCOUNT REPOSITORY IMPLEMENTATION
+
+func (r *MemoryRepo) AddServiceAccount(serviceAccount api.ServiceAccount) (*api.ServiceAccount, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// Check unique fields
+	if _, ok := r.serviceAccounts[serviceAccount.ID]; ok {
+		return nil, internalError("Service account with id %v already exists", serviceAccount.ID)
+	}
+	for _, sa := range r.serviceAccounts {
+		if sa.Name == serviceAccount.Name || sa.KeyHash == serviceAccount.KeyHash || sa.Urn == serviceAccount.Urn {
+			return nil, internalError("Service account with name %v, key or urn %v already exists", serviceAccount.Name, serviceAccount.Urn)
+		}
+	}
+
+	// Store service account
+	serviceAccountDB := memServiceAccount(serviceAccount)
+	r.serviceAccounts[serviceAccount.ID] = serviceAccountDB
+
+	return &serviceAccountDB, nil
+}
+
+func (r *MemoryRepo) GetServiceAccountByName(name string) (*api.ServiceAccount, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, sa := range r.serviceAccounts {
+		if sa.Name == name {
+			return &sa, nil
+		}
+	}
+
+	return nil, &database.Error{
+		Code:    database.SERVICE_ACCOUNT_NOT_FOUND,
+		Message: fmt.Sprintf("Service account with name %v not found", name),
+	}
+}
+
+func (r *MemoryRepo) GetServiceAccountByKeyHash(keyHash string) (*api.ServiceAccount, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, sa := range r.serviceAccounts {
+		if sa.KeyHash == keyHash {
+			return &sa, nil
+		}
+	}
+
+	return nil, &database.Error{
+		Code:    database.SERVICE_ACCOUNT_NOT_FOUND,
+		Message: "Service account with key hash specified not found",
+	}
+}
+
+func (r *MemoryRepo) GetServiceAccountsFiltered(filter *api.Filter) ([]api.ServiceAccount, int, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	serviceAccounts := []api.ServiceAccount{}
+	for _, sa := range r.serviceAccounts {
+		if len(filter.ExternalID) == 0 || sa.ExternalID == filter.ExternalID {
+			serviceAccounts = append(serviceAccounts, sa)
+		}
+	}
+
+	sortByColumn(filter.OrderBy, len(serviceAccounts), func(i int, column string) string {
+		return serviceAccountColumn(serviceAccounts[i], column)
+	}, func(i, j int) {
+		serviceAccounts[i], serviceAccounts[j] = serviceAccounts[j], serviceAccounts[i]
+	})
+
+	total := len(serviceAccounts)
+	start, end := paginate(filter, total)
+
+	return serviceAccounts[start:end], total, nil
+}
+
+func (r *MemoryRepo) RemoveServiceAccount(id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.serviceAccounts, id)
+
+	return nil
+}
+
+// PRIVATE HELPER METHODS
+
+// Transform a service account received into the stored one
+func memServiceAccount(serviceAccount api.ServiceAccount) api.ServiceAccount {
+	serviceAccount.CreateAt = normalizeTime(serviceAccount.CreateAt)
+	return serviceAccount
+}
+
+// Return the value of a service account column to sort service accounts
+func serviceAccountColumn(serviceAccount api.ServiceAccount, column string) string {
+	switch column {
+	case "name":
+		return serviceAccount.Name
+	case "external_id":
+		return serviceAccount.ExternalID
+	case "create_at":
+		return timeColumn(serviceAccount.CreateAt)
+	default:
+		return serviceAccount.ID
+	}
+}
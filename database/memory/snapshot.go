@@ -0,0 +1,378 @@
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/Tecsisa/foulkon/api"
+	"github.com/satori/go.uuid"
+)
+
+// Snapshot contains the data of a repository. Relations can reference users by externalId and
+// groups and policies by organization and name instead of ids, so a snapshot can be written by
+// hand to seed a repository. Empty ids, urns, paths and dates are filled when it is loaded.
+type Snapshot struct {
+	Users       []api.User        `json:"users"`
+	Groups      []api.Group       `json:"groups"`
+	Policies    []api.Policy      `json:"policies"`
+	Members     []Member          `json:"members"`
+	Attachments []Attachment      `json:"attachments"`
+	AuditEvents []api.AuditEvent  `json:"auditEvents,omitempty"`
+	Outbox      []api.OutboxEntry `json:"outbox,omitempty"`
+
+	ServiceAccounts []ServiceAccount `json:"serviceAccounts,omitempty"`
+}
+
+// ServiceAccount is a service account with the hash of its key, which isn't returned by API
+type ServiceAccount struct {
+	api.ServiceAccount
+	KeyHash string `json:"keyHash"`
+}
+
+// Member is a user that belongs to a group
+type Member struct {
+	UserID     string    `json:"userId,omitempty"`
+	GroupID    string    `json:"groupId,omitempty"`
+	ExternalID string    `json:"externalId,omitempty"`
+	Org        string    `json:"org,omitempty"`
+	Group      string    `json:"group,omitempty"`
+	CreateAt   time.Time `json:"createAt"`
+}
+
+// Attachment is a policy attached to a group of the same organization
+type Attachment struct {
+	GroupID  string    `json:"groupId,omitempty"`
+	PolicyID string    `json:"policyId,omitempty"`
+	Org      string    `json:"org,omitempty"`
+	Group    string    `json:"group,omitempty"`
+	Policy   string    `json:"policy,omitempty"`
+	CreateAt time.Time `json:"createAt"`
+}
+
+// LoadSnapshotFile reads a JSON snapshot from a file
+func LoadSnapshotFile(path string) (*Snapshot, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &Snapshot{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return nil, fmt.Errorf("Invalid snapshot file %v: %v", path, err)
+	}
+	return snapshot, nil
+}
+
+// Load replaces the content of the repository with the snapshot. The repository isn't
+// modified if the snapshot isn't valid.
+func (r *MemoryRepo) Load(snapshot *Snapshot) error {
+	repo := NewMemoryRepo()
+	now := time.Now().UTC()
+
+	for _, user := range snapshot.Users {
+		if !api.IsValidUserExternalID(user.ExternalID) {
+			return fmt.Errorf("Invalid user externalId %v in snapshot", user.ExternalID)
+		}
+		if user.Path == "" {
+			user.Path = "/"
+		}
+		if !api.IsValidPath(user.Path) {
+			return fmt.Errorf("Invalid path %v for user %v in snapshot", user.Path, user.ExternalID)
+		}
+		if user.ID == "" {
+			user.ID = uuid.NewV4().String()
+		}
+		if user.Urn == "" {
+			user.Urn = api.CreateUrn("", api.RESOURCE_USER, user.Path, user.ExternalID)
+		}
+		user.CreateAt, user.UpdateAt = defaultDates(user.CreateAt, user.UpdateAt, now)
+		if _, err := repo.AddUser(user); err != nil {
+			return err
+		}
+	}
+
+	for _, group := range snapshot.Groups {
+		if !api.IsValidOrg(group.Org) || !api.IsValidName(group.Name) {
+			return fmt.Errorf("Invalid group with organization %v and name %v in snapshot", group.Org, group.Name)
+		}
+		if _, err := repo.getGroupByName(group.Org, group.Name); err == nil {
+			return fmt.Errorf("Duplicated group with organization %v and name %v in snapshot", group.Org, group.Name)
+		}
+		if group.Path == "" {
+			group.Path = "/"
+		}
+		if !api.IsValidPath(group.Path) {
+			return fmt.Errorf("Invalid path %v for group %v in snapshot", group.Path, group.Name)
+		}
+		if group.ID == "" {
+			group.ID = uuid.NewV4().String()
+		}
+		if group.Urn == "" {
+			group.Urn = api.CreateUrn(group.Org, api.RESOURCE_GROUP, group.Path, group.Name)
+		}
+		group.CreateAt, group.UpdateAt = defaultDates(group.CreateAt, group.UpdateAt, now)
+		if _, err := repo.AddGroup(group); err != nil {
+			return err
+		}
+	}
+
+	for _, policy := range snapshot.Policies {
+		if !api.IsValidOrg(policy.Org) || !api.IsValidName(policy.Name) {
+			return fmt.Errorf("Invalid policy with organization %v and name %v in snapshot", policy.Org, policy.Name)
+		}
+		if _, err := repo.getPolicyByName(policy.Org, policy.Name); err == nil {
+			return fmt.Errorf("Duplicated policy with organization %v and name %v in snapshot", policy.Org, policy.Name)
+		}
+		if policy.Path == "" {
+			policy.Path = "/"
+		}
+		if !api.IsValidPath(policy.Path) {
+			return fmt.Errorf("Invalid path %v for policy %v in snapshot", policy.Path, policy.Name)
+		}
+		if policy.Statements == nil {
+			policy.Statements = &[]api.Statement{}
+		}
+		if err := api.AreValidStatements(policy.Statements); err != nil {
+			return fmt.Errorf("Invalid statements for policy %v in snapshot: %v", policy.Name, err)
+		}
+		if policy.ID == "" {
+			policy.ID = uuid.NewV4().String()
+		}
+		if policy.Urn == "" {
+			policy.Urn = api.CreateUrn(policy.Org, api.RESOURCE_POLICY, policy.Path, policy.Name)
+		}
+		policy.CreateAt, policy.UpdateAt = defaultDates(policy.CreateAt, policy.UpdateAt, now)
+		if _, err := repo.AddPolicy(policy); err != nil {
+			return err
+		}
+	}
+
+	for _, member := range snapshot.Members {
+		userID, groupID := member.UserID, member.GroupID
+		if userID == "" {
+			user, err := repo.GetUserByExternalID(member.ExternalID)
+			if err != nil {
+				return fmt.Errorf("Invalid member in snapshot: %v", err)
+			}
+			userID = user.ID
+		} else if _, err := repo.getUserByID(userID); err != nil {
+			return fmt.Errorf("Invalid member in snapshot: %v", err)
+		}
+		if groupID == "" {
+			group, err := repo.getGroupByName(member.Org, member.Group)
+			if err != nil {
+				return fmt.Errorf("Invalid member in snapshot: %v", err)
+			}
+			groupID = group.ID
+		} else if _, err := repo.getGroupByID(groupID); err != nil {
+			return fmt.Errorf("Invalid member in snapshot: %v", err)
+		}
+		if ok, _ := repo.IsMemberOfGroup(userID, groupID); ok {
+			return fmt.Errorf("Duplicated member with user id %v and group id %v in snapshot", userID, groupID)
+		}
+		createAt, _ := defaultDates(member.CreateAt, member.CreateAt, now)
+		repo.groupUserRelations = append(repo.groupUserRelations, groupUserRelation{
+			UserID:   userID,
+			GroupID:  groupID,
+			CreateAt: createAt,
+		})
+	}
+
+	for _, attachment := range snapshot.Attachments {
+		groupID, policyID := attachment.GroupID, attachment.PolicyID
+		if groupID == "" {
+			group, err := repo.getGroupByName(attachment.Org, attachment.Group)
+			if err != nil {
+				return fmt.Errorf("Invalid attachment in snapshot: %v", err)
+			}
+			groupID = group.ID
+		} else if _, err := repo.getGroupByID(groupID); err != nil {
+			return fmt.Errorf("Invalid attachment in snapshot: %v", err)
+		}
+		if policyID == "" {
+			policy, err := repo.getPolicyByName(attachment.Org, attachment.Policy)
+			if err != nil {
+				return fmt.Errorf("Invalid attachment in snapshot: %v", err)
+			}
+			policyID = policy.ID
+		} else if _, err := repo.getPolicyByID(policyID); err != nil {
+			return fmt.Errorf("Invalid attachment in snapshot: %v", err)
+		}
+		if ok, _ := repo.IsAttachedToGroup(groupID, policyID); ok {
+			return fmt.Errorf("Duplicated attachment with group id %v and policy id %v in snapshot", groupID, policyID)
+		}
+		createAt, _ := defaultDates(attachment.CreateAt, attachment.CreateAt, now)
+		repo.groupPolicyRelations = append(repo.groupPolicyRelations, groupPolicyRelation{
+			GroupID:  groupID,
+			PolicyID: policyID,
+			CreateAt: createAt,
+		})
+	}
+
+	for _, sa := range snapshot.ServiceAccounts {
+		sa.ServiceAccount.KeyHash = sa.KeyHash
+		if !api.IsValidName(sa.Name) || sa.KeyHash == "" {
+			return fmt.Errorf("Invalid service account with name %v in snapshot", sa.Name)
+		}
+		if _, err := repo.GetUserByExternalID(sa.ExternalID); err != nil {
+			return fmt.Errorf("Invalid service account %v in snapshot: %v", sa.Name, err)
+		}
+		if sa.ID == "" {
+			sa.ID = uuid.NewV4().String()
+		}
+		if sa.Urn == "" {
+			sa.Urn = api.CreateUrn("", api.RESOURCE_SERVICE_ACCOUNT, "/", sa.Name)
+		}
+		sa.CreateAt, _ = defaultDates(sa.CreateAt, sa.CreateAt, now)
+		if _, err := repo.AddServiceAccount(sa.ServiceAccount); err != nil {
+			return err
+		}
+	}
+
+	for _, event := range snapshot.AuditEvents {
+		if err := repo.AddAuditEvent(event); err != nil {
+			return err
+		}
+	}
+	if err := repo.AddOutboxEntries(snapshot.Outbox); err != nil {
+		return err
+	}
+
+	r.replace(repo)
+	return nil
+}
+
+// Snapshot returns a copy of the content of the repository, where relations reference ids
+func (r *MemoryRepo) Snapshot() *Snapshot {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	snapshot := &Snapshot{
+		Users:       []api.User{},
+		Groups:      []api.Group{},
+		Policies:    []api.Policy{},
+		Members:     []Member{},
+		Attachments: []Attachment{},
+	}
+	for _, user := range r.users {
+		snapshot.Users = append(snapshot.Users, user)
+	}
+	for _, group := range r.groups {
+		snapshot.Groups = append(snapshot.Groups, group)
+	}
+	for _, policy := range r.policies {
+		policy.Statements = copyStatements(policy.Statements)
+		snapshot.Policies = append(snapshot.Policies, policy)
+	}
+	for _, rel := range r.groupUserRelations {
+		snapshot.Members = append(snapshot.Members, Member{
+			UserID:   rel.UserID,
+			GroupID:  rel.GroupID,
+			CreateAt: rel.CreateAt,
+		})
+	}
+	for _, rel := range r.groupPolicyRelations {
+		snapshot.Attachments = append(snapshot.Attachments, Attachment{
+			GroupID:  rel.GroupID,
+			PolicyID: rel.PolicyID,
+			CreateAt: rel.CreateAt,
+		})
+	}
+	for _, sa := range r.serviceAccounts {
+		snapshot.ServiceAccounts = append(snapshot.ServiceAccounts, ServiceAccount{
+			ServiceAccount: sa,
+			KeyHash:        sa.KeyHash,
+		})
+	}
+	for _, event := range r.auditEvents {
+		snapshot.AuditEvents = append(snapshot.AuditEvents, memAuditEvent(event))
+	}
+	for _, entry := range r.outbox {
+		snapshot.Outbox = append(snapshot.Outbox, memOutboxEntry(entry))
+	}
+
+	// Keep the same order between snapshots of the same content
+	sortByColumn("", len(snapshot.Users), func(i int, column string) string {
+		return userColumn(snapshot.Users[i], column)
+	}, func(i, j int) {
+		snapshot.Users[i], snapshot.Users[j] = snapshot.Users[j], snapshot.Users[i]
+	})
+	sortByColumn("", len(snapshot.Groups), func(i int, column string) string {
+		return groupColumn(snapshot.Groups[i], column)
+	}, func(i, j int) {
+		snapshot.Groups[i], snapshot.Groups[j] = snapshot.Groups[j], snapshot.Groups[i]
+	})
+	sortByColumn("", len(snapshot.Policies), func(i int, column string) string {
+		return policyColumn(snapshot.Policies[i], column)
+	}, func(i, j int) {
+		snapshot.Policies[i], snapshot.Policies[j] = snapshot.Policies[j], snapshot.Policies[i]
+	})
+	sortByColumn("", len(snapshot.ServiceAccounts), func(i int, column string) string {
+		return serviceAccountColumn(snapshot.ServiceAccounts[i].ServiceAccount, column)
+	}, func(i, j int) {
+		snapshot.ServiceAccounts[i], snapshot.ServiceAccounts[j] = snapshot.ServiceAccounts[j], snapshot.ServiceAccounts[i]
+	})
+
+	return snapshot
+}
+
+// Restore replaces the content of the repository with a snapshot returned by Snapshot method.
+// Unlike Load, values aren't validated or filled, so the repository is restored as it was.
+func (r *MemoryRepo) Restore(snapshot *Snapshot) {
+	repo := NewMemoryRepo()
+	for _, user := range snapshot.Users {
+		repo.users[user.ID] = memUser(user)
+	}
+	for _, group := range snapshot.Groups {
+		repo.groups[group.ID] = memGroup(group)
+	}
+	for _, policy := range snapshot.Policies {
+		repo.policies[policy.ID] = memPolicy(policy)
+	}
+	for _, member := range snapshot.Members {
+		repo.groupUserRelations = append(repo.groupUserRelations, groupUserRelation{
+			UserID:   member.UserID,
+			GroupID:  member.GroupID,
+			CreateAt: normalizeTime(member.CreateAt),
+		})
+	}
+	for _, attachment := range snapshot.Attachments {
+		repo.groupPolicyRelations = append(repo.groupPolicyRelations, groupPolicyRelation{
+			GroupID:  attachment.GroupID,
+			PolicyID: attachment.PolicyID,
+			CreateAt: normalizeTime(attachment.CreateAt),
+		})
+	}
+	for _, sa := range snapshot.ServiceAccounts {
+		sa.ServiceAccount.KeyHash = sa.KeyHash
+		repo.serviceAccounts[sa.ID] = memServiceAccount(sa.ServiceAccount)
+	}
+	for _, event := range snapshot.AuditEvents {
+		repo.auditEvents = append(repo.auditEvents, memAuditEvent(event))
+	}
+	for _, entry := range snapshot.Outbox {
+		repo.outbox = append(repo.outbox, memOutboxEntry(entry))
+	}
+	r.replace(repo)
+}
+
+// PRIVATE HELPER METHODS
+
+// Replace the content of the repository with the content of other one
+func (r *MemoryRepo) replace(repo *MemoryRepo) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.memoryData = repo.memoryData
+}
+
+// Fill empty creation and update dates
+func defaultDates(createAt time.Time, updateAt time.Time, now time.Time) (time.Time, time.Time) {
+	if createAt.IsZero() {
+		createAt = now
+	}
+	if updateAt.IsZero() {
+		updateAt = createAt
+	}
+	return normalizeTime(createAt), normalizeTime(updateAt)
+}
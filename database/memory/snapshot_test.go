@@ -0,0 +1,283 @@
+package memory
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/Tecsisa/foulkon/api"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestMemoryRepo_Load(t *testing.T) {
+	testcases := map[string]struct {
+		snapshot *Snapshot
+		// Expected result
+		expectedError string
+	}{
+		"OkCase": {
+			snapshot: &Snapshot{
+				Users: []api.User{
+					{ExternalID: "user1"},
+				},
+				Groups: []api.Group{
+					{Org: "org1", Name: "group1", Path: "/path/"},
+				},
+				Policies: []api.Policy{
+					{Org: "org1", Name: "policy1", Statements: makePolicy("", "", "", "", now).Statements},
+				},
+				Members: []Member{
+					{ExternalID: "user1", Org: "org1", Group: "group1"},
+				},
+				Attachments: []Attachment{
+					{Org: "org1", Group: "group1", Policy: "policy1"},
+				},
+				ServiceAccounts: []ServiceAccount{
+					{ServiceAccount: api.ServiceAccount{Name: "serviceaccount1", ExternalID: "user1"}, KeyHash: "hash1"},
+				},
+			},
+		},
+		"ErrorCaseInvalidExternalID": {
+			snapshot: &Snapshot{
+				Users: []api.User{
+					{ExternalID: "user 1"},
+				},
+			},
+			expectedError: "Invalid user externalId user 1 in snapshot",
+		},
+		"ErrorCaseDuplicatedGroup": {
+			snapshot: &Snapshot{
+				Groups: []api.Group{
+					{Org: "org1", Name: "group1"},
+					{Org: "org1", Name: "group1", Path: "/other/"},
+				},
+			},
+			expectedError: "Duplicated group with organization org1 and name group1 in snapshot",
+		},
+		"ErrorCaseInvalidStatements": {
+			snapshot: &Snapshot{
+				Policies: []api.Policy{
+					{Org: "org1", Name: "policy1", Statements: &[]api.Statement{{Effect: "other"}}},
+				},
+			},
+			expectedError: "Invalid statements for policy policy1 in snapshot: Code: InvalidParameterError, Message: Invalid effect: other - Only 'allow' and 'deny' accepted",
+		},
+		"ErrorCaseMemberGroupNotFound": {
+			snapshot: &Snapshot{
+				Users: []api.User{
+					{ExternalID: "user1"},
+				},
+				Members: []Member{
+					{ExternalID: "user1", Org: "org1", Group: "group1"},
+				},
+			},
+			expectedError: "Invalid member in snapshot: Code: GroupNotFound, Message: Group with organization org1 and name group1 not found",
+		},
+		"ErrorCaseAttachmentPolicyNotFound": {
+			snapshot: &Snapshot{
+				Groups: []api.Group{
+					{Org: "org1", Name: "group1"},
+				},
+				Attachments: []Attachment{
+					{Org: "org1", Group: "group1", Policy: "policy1"},
+				},
+			},
+			expectedError: "Invalid attachment in snapshot: Code: PolicyNotFound, Message: Policy with organization org1 and name policy1 not found",
+		},
+		"ErrorCaseServiceAccountUserNotFound": {
+			snapshot: &Snapshot{
+				ServiceAccounts: []ServiceAccount{
+					{ServiceAccount: api.ServiceAccount{Name: "serviceaccount1", ExternalID: "user1"}, KeyHash: "hash1"},
+				},
+			},
+			expectedError: "Invalid service account serviceaccount1 in snapshot: Code: UserNotFound, Message: User with externalId user1 not found",
+		},
+	}
+
+	for n, test := range testcases {
+		repo := NewMemoryRepo()
+		previousUser := makeUser("UserID", "previous", "/", now)
+		repo.AddUser(previousUser)
+
+		err := repo.Load(test.snapshot)
+		if test.expectedError != "" {
+			if err == nil || err.Error() != test.expectedError {
+				t.Errorf("Test %v failed. Received different error (wanted:%v / received:%v)", n, test.expectedError, err)
+				continue
+			}
+			// Repository isn't modified
+			if _, err := repo.GetUserByExternalID("previous"); err != nil {
+				t.Errorf("Test %v failed. Repository modified after error: %v", n, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %v failed. Unexpected error: %v", n, err)
+			continue
+		}
+
+		// Check loaded data
+		if _, err := repo.GetUserByExternalID("previous"); err == nil {
+			t.Errorf("Test %v failed. Previous data wasn't replaced", n)
+		}
+		user, err := repo.GetUserByExternalID("user1")
+		if err != nil {
+			t.Errorf("Test %v failed. Unexpected error retrieving user: %v", n, err)
+			continue
+		}
+		if user.ID == "" || user.Path != "/" || user.Urn != api.CreateUrn("", api.RESOURCE_USER, "/", "user1") || user.CreateAt.IsZero() {
+			t.Errorf("Test %v failed. User default values not filled: %v", n, user)
+		}
+		group, err := repo.GetGroupByName("org1", "group1")
+		if err != nil {
+			t.Errorf("Test %v failed. Unexpected error retrieving group: %v", n, err)
+			continue
+		}
+		if isMember, _ := repo.IsMemberOfGroup(user.ID, group.ID); !isMember {
+			t.Errorf("Test %v failed. Member relation not loaded", n)
+		}
+		policy, err := repo.GetPolicyByName("org1", "policy1")
+		if err != nil {
+			t.Errorf("Test %v failed. Unexpected error retrieving policy: %v", n, err)
+			continue
+		}
+		if isAttached, _ := repo.IsAttachedToGroup(group.ID, policy.ID); !isAttached {
+			t.Errorf("Test %v failed. Policy relation not loaded", n)
+		}
+		serviceAccount, err := repo.GetServiceAccountByKeyHash("hash1")
+		if err != nil {
+			t.Errorf("Test %v failed. Unexpected error retrieving service account: %v", n, err)
+			continue
+		}
+		if serviceAccount.ID == "" || serviceAccount.Urn != api.CreateUrn("", api.RESOURCE_SERVICE_ACCOUNT, "/", "serviceaccount1") || serviceAccount.CreateAt.IsZero() {
+			t.Errorf("Test %v failed. Service account default values not filled: %v", n, serviceAccount)
+		}
+	}
+}
+
+func TestLoadSnapshotFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "foulkon-seed")
+	if err != nil {
+		t.Fatalf("Unexpected error creating file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(`{
+		"users": [{"externalId": "user1"}],
+		"groups": [{"org": "org1", "name": "group1"}],
+		"policies": [{"org": "org1", "name": "policy1", "statements": [
+			{"effect": "allow", "actions": ["example:Read"], "resources": ["urn:ews:example:instance1:resource/*"]}
+		]}],
+		"members": [{"externalId": "user1", "org": "org1", "group": "group1"}],
+		"attachments": [{"org": "org1", "group": "group1", "policy": "policy1"}]
+	}`)
+	file.Close()
+
+	snapshot, err := LoadSnapshotFile(file.Name())
+	if err != nil {
+		t.Fatalf("Unexpected error loading file: %v", err)
+	}
+	repo := NewMemoryRepo()
+	if err := repo.Load(snapshot); err != nil {
+		t.Fatalf("Unexpected error loading snapshot: %v", err)
+	}
+
+	// Authorize with seeded data
+	authAPI := api.AuthAPI{
+		UserRepo:   repo,
+		GroupRepo:  repo,
+		PolicyRepo: repo,
+		Logger: &log.Logger{
+			Out:       bytes.NewBuffer([]byte{}),
+			Formatter: &log.TextFormatter{},
+			Hooks:     make(log.LevelHooks),
+			Level:     log.DebugLevel,
+		},
+	}
+	resources, err := authAPI.GetAuthorizedExternalResources(api.RequestInfo{Identifier: "user1"}, "example:Read",
+		[]string{"urn:ews:example:instance1:resource/res1"})
+	if err != nil {
+		t.Fatalf("Unexpected error authorizing resources: %v", err)
+	}
+	if diff := pretty.Compare(resources, []string{"urn:ews:example:instance1:resource/res1"}); diff != "" {
+		t.Errorf("Test failed. Received different resources (received/wanted) %v", diff)
+	}
+
+	// Invalid files
+	if _, err := LoadSnapshotFile(file.Name() + "-notexist"); err == nil {
+		t.Errorf("Test failed. Expected error loading file that doesn't exist")
+	}
+}
+
+func TestMemoryRepo_SnapshotRestore(t *testing.T) {
+	repo := NewMemoryRepo()
+	user := makeUser("UserID", "user1", "/path/", now)
+	group := makeGroup("GroupID", "org1", "group1", "/path/", now)
+	policy := makePolicy("PolicyID", "org1", "policy1", "/path/", now)
+	if _, err := repo.AddUser(user); err != nil {
+		t.Fatalf("Unexpected error adding user: %v", err)
+	}
+	if _, err := repo.AddGroup(group); err != nil {
+		t.Fatalf("Unexpected error adding group: %v", err)
+	}
+	if _, err := repo.AddPolicy(policy); err != nil {
+		t.Fatalf("Unexpected error adding policy: %v", err)
+	}
+	if err := repo.AddMember(user.ID, group.ID); err != nil {
+		t.Fatalf("Unexpected error adding member: %v", err)
+	}
+	if err := repo.AttachPolicy(group.ID, policy.ID); err != nil {
+		t.Fatalf("Unexpected error attaching policy: %v", err)
+	}
+	serviceAccount := api.ServiceAccount{
+		ID:         "ServiceAccountID",
+		Name:       "serviceaccount1",
+		ExternalID: user.ExternalID,
+		KeyPrefix:  "fk_0123",
+		KeyHash:    "hash",
+		Urn:        api.CreateUrn("", api.RESOURCE_SERVICE_ACCOUNT, "/", "serviceaccount1"),
+		CreateAt:   now,
+	}
+	if _, err := repo.AddServiceAccount(serviceAccount); err != nil {
+		t.Fatalf("Unexpected error adding service account: %v", err)
+	}
+
+	snapshot := repo.Snapshot()
+	restored := NewMemoryRepo()
+	restored.Restore(snapshot)
+
+	if diff := pretty.Compare(restored.Snapshot(), snapshot); diff != "" {
+		t.Errorf("Test failed. Received different snapshots (received/wanted) %v", diff)
+	}
+	storedPolicy, err := restored.GetPolicyByName(policy.Org, policy.Name)
+	checkRepoResponse(t, "GetRestoredPolicy", nil, err, &policy, storedPolicy)
+	if ok, _ := restored.IsMemberOfGroup(user.ID, group.ID); !ok {
+		t.Errorf("Test failed. Member wasn't restored")
+	}
+	if ok, _ := restored.IsAttachedToGroup(group.ID, policy.ID); !ok {
+		t.Errorf("Test failed. Attachment wasn't restored")
+	}
+
+	// Key hash isn't returned by API, but it is kept in JSON snapshots
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatalf("Unexpected error marshalling snapshot: %v", err)
+	}
+	unmarshalled := &Snapshot{}
+	if err := json.Unmarshal(data, unmarshalled); err != nil {
+		t.Fatalf("Unexpected error unmarshalling snapshot: %v", err)
+	}
+	restored.Restore(unmarshalled)
+	storedServiceAccount, err := restored.GetServiceAccountByKeyHash(serviceAccount.KeyHash)
+	checkRepoResponse(t, "GetRestoredServiceAccount", nil, err, &serviceAccount, storedServiceAccount)
+
+	// Snapshot is a copy, so changes in repository aren't visible
+	if err := repo.RemoveUser(user.ID); err != nil {
+		t.Fatalf("Unexpected error removing user: %v", err)
+	}
+	if len(snapshot.Users) != 1 || len(snapshot.Members) != 1 {
+		t.Errorf("Test failed. Snapshot was modified by repository")
+	}
+}
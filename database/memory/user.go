@@ -0,0 +1,209 @@
+package memory
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Tecsisa/foulkon/api"
+	"github.com/Tecsisa/foulkon/database"
+)
+
+// USER REPOSITORY IMPLEMENTATION
+
+func (r *MemoryRepo) AddUser(user api.User) (*api.User, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// Check unique fields
+	if _, ok := r.users[user.ID]; ok {
+		return nil, internalError("User with id %v already exists", user.ID)
+	}
+	for _, u := range r.users {
+		if u.ExternalID == user.ExternalID || u.Urn == user.Urn {
+			return nil, internalError("User with externalId %v or urn %v already exists", user.ExternalID, user.Urn)
+		}
+	}
+
+	// Store user
+	userDB := memUser(user)
+	r.users[user.ID] = userDB
+
+	return &userDB, nil
+}
+
+func (r *MemoryRepo) GetUserByExternalID(id string) (*api.User, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, user := range r.users {
+		if user.ExternalID == id {
+			return &user, nil
+		}
+	}
+
+	return nil, &database.Error{
+		Code:    database.USER_NOT_FOUND,
+		Message: fmt.Sprintf("User with externalId %v not found", id),
+	}
+}
+
+func (r *MemoryRepo) GetUserByID(id string) (*api.User, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.getUserByID(id)
+}
+
+func (r *MemoryRepo) GetUsersFiltered(filter *api.Filter) ([]api.User, int, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	users := []api.User{}
+	for _, user := range r.users {
+		if strings.HasPrefix(user.Path, filter.PathPrefix) {
+			users = append(users, user)
+		}
+	}
+
+	sortByColumn(filter.OrderBy, len(users), func(i int, column string) string {
+		return userColumn(users[i], column)
+	}, func(i, j int) {
+		users[i], users[j] = users[j], users[i]
+	})
+
+	total := len(users)
+	start, end := paginate(filter, total)
+
+	return users[start:end], total, nil
+}
+
+func (r *MemoryRepo) UpdateUser(user api.User) (*api.User, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.users[user.ID]; !ok {
+		return nil, &database.Error{
+			Code:    database.USER_NOT_FOUND,
+			Message: fmt.Sprintf("User with id %v not found", user.ID),
+		}
+	}
+	for _, u := range r.users {
+		if u.ID != user.ID && (u.ExternalID == user.ExternalID || u.Urn == user.Urn) {
+			return nil, internalError("User with externalId %v or urn %v already exists", user.ExternalID, user.Urn)
+		}
+	}
+
+	// Update user
+	r.users[user.ID] = memUser(user)
+
+	return &user, nil
+}
+
+func (r *MemoryRepo) RemoveUser(id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// Delete user and its service accounts
+	if user, ok := r.users[id]; ok {
+		for saID, sa := range r.serviceAccounts {
+			if sa.ExternalID == user.ExternalID {
+				delete(r.serviceAccounts, saID)
+			}
+		}
+	}
+	delete(r.users, id)
+
+	// Delete all user relations
+	relations := []groupUserRelation{}
+	for _, rel := range r.groupUserRelations {
+		if rel.UserID != id {
+			relations = append(relations, rel)
+		}
+	}
+	r.groupUserRelations = relations
+
+	return nil
+}
+
+func (r *MemoryRepo) GetGroupsByUserID(id string, filter *api.Filter) ([]api.UserGroupRelation, int, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	relations := []groupUserRelation{}
+	for _, rel := range r.groupUserRelations {
+		if rel.UserID == id {
+			relations = append(relations, rel)
+		}
+	}
+
+	sortByColumn(filter.OrderBy, len(relations), func(i int, column string) string {
+		if column == "create_at" {
+			return timeColumn(relations[i].CreateAt)
+		}
+		return relations[i].GroupID
+	}, func(i, j int) {
+		relations[i], relations[j] = relations[j], relations[i]
+	})
+
+	total := len(relations)
+	start, end := paginate(filter, total)
+
+	// Transform relations to API domain
+	groups := []api.UserGroupRelation{}
+	for _, rel := range relations[start:end] {
+		group, err := r.getGroupByID(rel.GroupID)
+		if err != nil {
+			return nil, total, internalError("%v", err.Error())
+		}
+		groups = append(groups, GroupUser{
+			Group:    group,
+			CreateAt: rel.CreateAt,
+		})
+	}
+
+	return groups, total, nil
+}
+
+// PRIVATE HELPER METHODS
+
+// Retrieve user by id. Caller must hold the lock
+func (r *MemoryRepo) getUserByID(id string) (*api.User, error) {
+	user, ok := r.users[id]
+	if !ok {
+		return nil, &database.Error{
+			Code:    database.USER_NOT_FOUND,
+			Message: fmt.Sprintf("User with id %v not found", id),
+		}
+	}
+	return &user, nil
+}
+
+// Transform a user received into the stored one
+func memUser(user api.User) api.User {
+	return api.User{
+		ID:         user.ID,
+		ExternalID: user.ExternalID,
+		Path:       user.Path,
+		CreateAt:   normalizeTime(user.CreateAt),
+		UpdateAt:   normalizeTime(user.UpdateAt),
+		Urn:        user.Urn,
+	}
+}
+
+// Return the value of a user column to sort users
+func userColumn(user api.User, column string) string {
+	switch column {
+	case "path":
+		return user.Path
+	case "external_id":
+		return user.ExternalID
+	case "create_at":
+		return timeColumn(user.CreateAt)
+	case "update_at":
+		return timeColumn(user.UpdateAt)
+	case "urn":
+		return user.Urn
+	default:
+		return user.ID
+	}
+}
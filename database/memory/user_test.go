@@ -0,0 +1,333 @@
+package memory
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Tecsisa/foulkon/api"
+	"github.com/Tecsisa/foulkon/database"
+)
+
+func TestMemoryRepo_AddUser(t *testing.T) {
+	testcases := map[string]struct {
+		// Previous data
+		previousUser *api.User
+		// Memory Repo Args
+		userToCreate api.User
+		// Expected result
+		expectedResponse *api.User
+		expectedError    *database.Error
+	}{
+		"OkCase": {
+			userToCreate: makeUser("UserID", "user1", "/path/", now),
+			expectedResponse: &api.User{
+				ID:         "UserID",
+				ExternalID: "user1",
+				Path:       "/path/",
+				Urn:        api.CreateUrn("", api.RESOURCE_USER, "/path/", "user1"),
+				CreateAt:   now,
+				UpdateAt:   now,
+			},
+		},
+		"ErrorCaseUserIDAlreadyExist": {
+			previousUser: &api.User{
+				ID:         "UserID",
+				ExternalID: "user2",
+				Urn:        "urn2",
+			},
+			userToCreate: makeUser("UserID", "user1", "/path/", now),
+			expectedError: &database.Error{
+				Code:    database.INTERNAL_ERROR,
+				Message: "User with id UserID already exists",
+			},
+		},
+		"ErrorCaseExternalIDAlreadyExist": {
+			previousUser: &api.User{
+				ID:         "UserID2",
+				ExternalID: "user1",
+				Urn:        "urn2",
+			},
+			userToCreate: makeUser("UserID", "user1", "/path/", now),
+			expectedError: &database.Error{
+				Code:    database.INTERNAL_ERROR,
+				Message: "User with externalId user1 or urn urn:iws:iam::user/path/user1 already exists",
+			},
+		},
+	}
+
+	for n, test := range testcases {
+		repo := NewMemoryRepo()
+		if test.previousUser != nil {
+			if _, err := repo.AddUser(*test.previousUser); err != nil {
+				t.Errorf("Test %v failed. Unexpected error inserting previous user: %v", n, err)
+				continue
+			}
+		}
+		storedUser, err := repo.AddUser(test.userToCreate)
+		checkRepoResponse(t, n, test.expectedError, err, test.expectedResponse, storedUser)
+	}
+}
+
+func TestMemoryRepo_GetUserByExternalID(t *testing.T) {
+	user := makeUser("UserID", "user1", "/path/", now)
+	testcases := map[string]struct {
+		externalID string
+		// Expected result
+		expectedResponse *api.User
+		expectedError    *database.Error
+	}{
+		"OkCase": {
+			externalID:       "user1",
+			expectedResponse: &user,
+		},
+		"ErrorCaseUserNotExist": {
+			externalID: "user2",
+			expectedError: &database.Error{
+				Code:    database.USER_NOT_FOUND,
+				Message: "User with externalId user2 not found",
+			},
+		},
+	}
+
+	repo := NewMemoryRepo()
+	repo.AddUser(user)
+	for n, test := range testcases {
+		receivedUser, err := repo.GetUserByExternalID(test.externalID)
+		checkRepoResponse(t, n, test.expectedError, err, test.expectedResponse, receivedUser)
+	}
+}
+
+func TestMemoryRepo_GetUserByID(t *testing.T) {
+	user := makeUser("UserID", "user1", "/path/", now)
+	testcases := map[string]struct {
+		id string
+		// Expected result
+		expectedResponse *api.User
+		expectedError    *database.Error
+	}{
+		"OkCase": {
+			id:               "UserID",
+			expectedResponse: &user,
+		},
+		"ErrorCaseUserNotExist": {
+			id: "UserID2",
+			expectedError: &database.Error{
+				Code:    database.USER_NOT_FOUND,
+				Message: "User with id UserID2 not found",
+			},
+		},
+	}
+
+	repo := NewMemoryRepo()
+	repo.AddUser(user)
+	for n, test := range testcases {
+		receivedUser, err := repo.GetUserByID(test.id)
+		checkRepoResponse(t, n, test.expectedError, err, test.expectedResponse, receivedUser)
+	}
+}
+
+func TestMemoryRepo_GetUsersFiltered(t *testing.T) {
+	user1 := makeUser("UserID1", "user1", "/path/", now)
+	user2 := makeUser("UserID2", "user2", "/path/sub/", now.Add(time.Second))
+	user3 := makeUser("UserID3", "user3", "/other/", now.Add(2*time.Second))
+	testcases := map[string]struct {
+		filter *api.Filter
+		// Expected result
+		expectedResponse []api.User
+		expectedTotal    int
+	}{
+		"OkCaseWithoutFilter": {
+			filter:           &api.Filter{},
+			expectedResponse: []api.User{user1, user2, user3},
+			expectedTotal:    3,
+		},
+		"OkCasePathPrefix": {
+			filter: &api.Filter{
+				PathPrefix: "/path/",
+			},
+			expectedResponse: []api.User{user1, user2},
+			expectedTotal:    2,
+		},
+		"OkCaseOrderBy": {
+			filter: &api.Filter{
+				OrderBy: "urn asc",
+			},
+			expectedResponse: []api.User{user3, user2, user1},
+			expectedTotal:    3,
+		},
+		"OkCasePagination": {
+			filter: &api.Filter{
+				Offset:  1,
+				Limit:   1,
+				OrderBy: "external_id asc",
+			},
+			expectedResponse: []api.User{user2},
+			expectedTotal:    3,
+		},
+		"OkCaseNoResults": {
+			filter: &api.Filter{
+				PathPrefix: "/nopath/",
+			},
+			expectedResponse: []api.User{},
+			expectedTotal:    0,
+		},
+	}
+
+	repo := NewMemoryRepo()
+	for _, user := range []api.User{user3, user1, user2} {
+		repo.AddUser(user)
+	}
+	for n, test := range testcases {
+		users, total, err := repo.GetUsersFiltered(test.filter)
+		checkRepoResponse(t, n, nil, err, test.expectedResponse, users)
+		if total != test.expectedTotal {
+			t.Errorf("Test %v failed. Received different total (wanted:%v / received:%v)", n, test.expectedTotal, total)
+		}
+	}
+}
+
+func TestMemoryRepo_UpdateUser(t *testing.T) {
+	updatedUser := makeUser("UserID", "user1", "/newpath/", now)
+	testcases := map[string]struct {
+		userToUpdate api.User
+		// Expected result
+		expectedResponse *api.User
+		expectedError    *database.Error
+	}{
+		"OkCase": {
+			userToUpdate:     updatedUser,
+			expectedResponse: &updatedUser,
+		},
+		"ErrorCaseUserNotExist": {
+			userToUpdate: makeUser("UserID2", "user2", "/newpath/", now),
+			expectedError: &database.Error{
+				Code:    database.USER_NOT_FOUND,
+				Message: "User with id UserID2 not found",
+			},
+		},
+		"ErrorCaseDuplicatedUrn": {
+			userToUpdate: api.User{
+				ID:         "UserID",
+				ExternalID: "user1",
+				Urn:        api.CreateUrn("", api.RESOURCE_USER, "/path/", "user3"),
+			},
+			expectedError: &database.Error{
+				Code:    database.INTERNAL_ERROR,
+				Message: "User with externalId user1 or urn urn:iws:iam::user/path/user3 already exists",
+			},
+		},
+	}
+
+	for n, test := range testcases {
+		repo := NewMemoryRepo()
+		repo.AddUser(makeUser("UserID", "user1", "/path/", now))
+		repo.AddUser(makeUser("UserID3", "user3", "/path/", now))
+		receivedUser, err := repo.UpdateUser(test.userToUpdate)
+		checkRepoResponse(t, n, test.expectedError, err, test.expectedResponse, receivedUser)
+		if test.expectedError == nil {
+			storedUser, _ := repo.GetUserByExternalID(test.userToUpdate.ExternalID)
+			checkRepoResponse(t, n, nil, nil, test.expectedResponse, storedUser)
+		}
+	}
+}
+
+func TestMemoryRepo_RemoveUser(t *testing.T) {
+	repo := NewMemoryRepo()
+	repo.AddUser(makeUser("UserID", "user1", "/path/", now))
+	repo.AddGroup(makeGroup("GroupID", "org1", "group1", "/path/", now))
+	repo.AddMember("UserID", "GroupID")
+
+	if err := repo.RemoveUser("UserID"); err != nil {
+		t.Fatalf("Test failed. Unexpected error: %v", err)
+	}
+	if _, err := repo.GetUserByID("UserID"); err == nil {
+		t.Errorf("Test failed. User wasn't removed")
+	}
+	if isMember, _ := repo.IsMemberOfGroup("UserID", "GroupID"); isMember {
+		t.Errorf("Test failed. User relations weren't removed")
+	}
+}
+
+func TestMemoryRepo_GetGroupsByUserID(t *testing.T) {
+	group1 := makeGroup("GroupID1", "org1", "group1", "/path/", now)
+	group2 := makeGroup("GroupID2", "org1", "group2", "/path/", now)
+	repo := NewMemoryRepo()
+	repo.AddUser(makeUser("UserID", "user1", "/path/", now))
+	repo.AddGroup(group1)
+	repo.AddGroup(group2)
+	repo.groupUserRelations = []groupUserRelation{
+		{UserID: "UserID", GroupID: "GroupID1", CreateAt: now},
+		{UserID: "UserID", GroupID: "GroupID2", CreateAt: now.Add(time.Second)},
+		{UserID: "UserID2", GroupID: "GroupID1", CreateAt: now},
+	}
+
+	testcases := map[string]struct {
+		userID string
+		filter *api.Filter
+		// Expected result
+		expectedResponse []api.UserGroupRelation
+		expectedTotal    int
+	}{
+		"OkCase": {
+			userID: "UserID",
+			filter: &api.Filter{
+				OrderBy: "create_at desc",
+			},
+			expectedResponse: []api.UserGroupRelation{
+				GroupUser{Group: &group2, CreateAt: now.Add(time.Second)},
+				GroupUser{Group: &group1, CreateAt: now},
+			},
+			expectedTotal: 2,
+		},
+		"OkCasePagination": {
+			userID: "UserID",
+			filter: &api.Filter{
+				Limit: 1,
+			},
+			expectedResponse: []api.UserGroupRelation{
+				GroupUser{Group: &group1, CreateAt: now},
+			},
+			expectedTotal: 2,
+		},
+		"OkCaseWithoutGroups": {
+			userID:           "UserID3",
+			filter:           &api.Filter{},
+			expectedResponse: []api.UserGroupRelation{},
+			expectedTotal:    0,
+		},
+	}
+
+	for n, test := range testcases {
+		groups, total, err := repo.GetGroupsByUserID(test.userID, test.filter)
+		checkRepoResponse(t, n, nil, err, test.expectedResponse, groups)
+		if total != test.expectedTotal {
+			t.Errorf("Test %v failed. Received different total (wanted:%v / received:%v)", n, test.expectedTotal, total)
+		}
+	}
+}
+
+func TestMemoryRepo_ConcurrentAccess(t *testing.T) {
+	repo := NewMemoryRepo()
+	repo.AddGroup(makeGroup("GroupID", "org1", "group1", "/path/", now))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprintf("UserID%v", i)
+			repo.AddUser(makeUser(id, fmt.Sprintf("user%v", i), "/path/", now))
+			repo.AddMember(id, "GroupID")
+			repo.GetUsersFiltered(&api.Filter{})
+			repo.GetGroupMembers("GroupID", &api.Filter{})
+		}(i)
+	}
+	wg.Wait()
+
+	_, total, err := repo.GetGroupMembers("GroupID", &api.Filter{})
+	if err != nil || total != 50 {
+		t.Errorf("Test failed. Received different members (wanted:50 / received:%v), error: %v", total, err)
+	}
+}
@@ -0,0 +1,106 @@
+package postgresql
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Tecsisa/foulkon/api"
+	"github.com/Tecsisa/foulkon/database"
+)
+
+// AUDIT REPOSITORY IMPLEMENTATION
+
+func (a PostgresRepo) AddAuditEvent(event api.AuditEvent) error {
+	// Create audit event model
+	eventDB := &AuditEvent{
+		ID:          event.ID,
+		Actor:       event.Actor,
+		RequestID:   event.RequestID,
+		Action:      event.Action,
+		Urn:         event.Urn,
+		BeforeState: auditStateToString(event.Before),
+		AfterState:  auditStateToString(event.After),
+		CreateAt:    event.CreateAt.UnixNano(),
+	}
+
+	// Store audit event
+	if err := a.Dbmap.Create(eventDB).Error; err != nil {
+		return &database.Error{
+			Code:    database.INTERNAL_ERROR,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+func (a PostgresRepo) GetAuditEventsFiltered(filter *api.AuditFilter) ([]api.AuditEvent, int, error) {
+	var total int
+	events := []AuditEvent{}
+	query := a.Dbmap
+
+	if len(filter.Actor) > 0 {
+		query = query.Where("actor = ?", filter.Actor)
+	}
+	if len(filter.Urn) > 0 {
+		query = query.Where("urn = ?", filter.Urn)
+	}
+	if len(filter.Action) > 0 {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("create_at >= ?", filter.From.UnixNano())
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("create_at <= ?", filter.To.UnixNano())
+	}
+
+	// Error handling
+	if err := query.Model(&AuditEvent{}).Count(&total).Order("create_at desc, id").Offset(filter.Offset).Limit(filter.Limit).Find(&events).Error; err != nil {
+		return nil, total, &database.Error{
+			Code:    database.INTERNAL_ERROR,
+			Message: err.Error(),
+		}
+	}
+
+	// Transform audit events for API
+	apiEvents := make([]api.AuditEvent, len(events))
+	for i, e := range events {
+		apiEvents[i] = *dbAuditEventToAPIAuditEvent(&e)
+	}
+
+	return apiEvents, total, nil
+}
+
+// PRIVATE HELPER METHODS
+
+// Transform an audit event retrieved from db into an audit event for API
+func dbAuditEventToAPIAuditEvent(eventDB *AuditEvent) *api.AuditEvent {
+	return &api.AuditEvent{
+		ID:        eventDB.ID,
+		Actor:     eventDB.Actor,
+		RequestID: eventDB.RequestID,
+		Action:    eventDB.Action,
+		Urn:       eventDB.Urn,
+		CreateAt:  time.Unix(0, eventDB.CreateAt).UTC(),
+		Before:    stringToAuditState(eventDB.BeforeState),
+		After:     stringToAuditState(eventDB.AfterState),
+	}
+}
+
+// Transform a resource state into a string to store it, empty if there isn't state
+func auditStateToString(state *json.RawMessage) string {
+	if state == nil {
+		return ""
+	}
+	return string(*state)
+}
+
+// Transform a stored string into a resource state, nil if it is empty
+func stringToAuditState(state string) *json.RawMessage {
+	if state == "" {
+		return nil
+	}
+	raw := json.RawMessage(state)
+	return &raw
+}
@@ -0,0 +1,103 @@
+package postgresql
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Tecsisa/foulkon/api"
+	"github.com/Tecsisa/foulkon/database"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestPostgresRepo_AddAuditEvent(t *testing.T) {
+	now := time.Now().UTC()
+	state := json.RawMessage(`{"externalId":"user1"}`)
+	testcases := map[string]struct {
+		// Previous data
+		previousEvent *AuditEvent
+		// Postgres Repo Args
+		eventToCreate api.AuditEvent
+		// Expected result
+		expectedResponse []api.AuditEvent
+		expectedError    *database.Error
+	}{
+		"OkCase": {
+			eventToCreate: api.AuditEvent{
+				ID:        "AuditEventID",
+				Actor:     "admin",
+				RequestID: "RequestID",
+				Action:    api.USER_ACTION_CREATE_USER,
+				Urn:       "urn",
+				CreateAt:  now,
+				After:     &state,
+			},
+			expectedResponse: []api.AuditEvent{
+				{
+					ID:        "AuditEventID",
+					Actor:     "admin",
+					RequestID: "RequestID",
+					Action:    api.USER_ACTION_CREATE_USER,
+					Urn:       "urn",
+					CreateAt:  now,
+					After:     &state,
+				},
+			},
+		},
+		"ErrorCaseAuditEventAlreadyExist": {
+			previousEvent: &AuditEvent{
+				ID:        "AuditEventID",
+				Actor:     "admin",
+				RequestID: "RequestID",
+				Action:    api.USER_ACTION_CREATE_USER,
+				Urn:       "urn",
+				CreateAt:  now.UnixNano(),
+			},
+			eventToCreate: api.AuditEvent{
+				ID:        "AuditEventID",
+				Actor:     "admin",
+				RequestID: "RequestID",
+				Action:    api.USER_ACTION_CREATE_USER,
+				Urn:       "urn",
+				CreateAt:  now,
+			},
+			expectedError: &database.Error{
+				Code:    database.INTERNAL_ERROR,
+				Message: "pq: duplicate key value violates unique constraint \"audit_events_pkey\"",
+			},
+		},
+	}
+
+	for n, test := range testcases {
+		// Clean audit event database
+		cleanAuditEventTable()
+
+		// Insert previous data
+		if test.previousEvent != nil {
+			if err := repoDB.Dbmap.Create(test.previousEvent).Error; err != nil {
+				t.Errorf("Test %v failed. Unexpected error inserting previous event: %v", n, err)
+				continue
+			}
+		}
+		// Call to repository to store event
+		err := repoDB.AddAuditEvent(test.eventToCreate)
+		if test.expectedError != nil {
+			if diff := pretty.Compare(err, test.expectedError); diff != "" {
+				t.Errorf("Test %v failed. Received different error response (received/wanted) %v", n, diff)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %v failed. Unexpected error: %v", n, err)
+			continue
+		}
+		events, _, err := repoDB.GetAuditEventsFiltered(&api.AuditFilter{})
+		if err != nil {
+			t.Errorf("Test %v failed. Unexpected error retrieving events: %v", n, err)
+			continue
+		}
+		if diff := pretty.Compare(events, test.expectedResponse); diff != "" {
+			t.Errorf("Test %v failed. Received different responses (received/wanted) %v", n, diff)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package postgresql
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Tecsisa/foulkon/api"
+	"github.com/Tecsisa/foulkon/database"
+)
+
+// EVENT REPOSITORY IMPLEMENTATION
+
+func (e PostgresRepo) AddOutboxEntries(entries []api.OutboxEntry) error {
+	transaction := e.begin()
+
+	// Store entries
+	for _, entry := range entries {
+		entryDB := &OutboxEntry{
+			EventID:       entry.Event.ID,
+			Sink:          entry.Sink,
+			Type:          entry.Event.Type,
+			Urn:           entry.Event.Urn,
+			Actor:         entry.Event.Actor,
+			RequestID:     entry.Event.RequestID,
+			Data:          auditStateToString(entry.Event.Data),
+			CreateAt:      entry.Event.CreateAt.UnixNano(),
+			Attempts:      entry.Attempts,
+			NextAttemptAt: entry.NextAttemptAt.UnixNano(),
+			LastError:     entry.LastError,
+		}
+		if err := transaction.Create(entryDB).Error; err != nil {
+			e.rollback(transaction)
+			return &database.Error{
+				Code:    database.INTERNAL_ERROR,
+				Message: err.Error(),
+			}
+		}
+	}
+
+	if err := e.commit(transaction); err != nil {
+		return &database.Error{
+			Code:    database.INTERNAL_ERROR,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+func (e PostgresRepo) GetPendingOutboxEntries(until time.Time, limit int) ([]api.OutboxEntry, error) {
+	entries := []OutboxEntry{}
+	query := e.Dbmap.Where("next_attempt_at <= ?", until.UnixNano()).Order("next_attempt_at, event_id, sink")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	// Error handling
+	if err := query.Find(&entries).Error; err != nil {
+		return nil, &database.Error{
+			Code:    database.INTERNAL_ERROR,
+			Message: err.Error(),
+		}
+	}
+
+	// Transform entries for API
+	apiEntries := make([]api.OutboxEntry, len(entries))
+	for i, entry := range entries {
+		apiEntries[i] = *dbOutboxEntryToAPIOutboxEntry(&entry)
+	}
+
+	return apiEntries, nil
+}
+
+func (e PostgresRepo) UpdateOutboxEntry(entry api.OutboxEntry) error {
+	query := e.Dbmap.Model(&OutboxEntry{}).Where("event_id = ? AND sink = ?", entry.Event.ID, entry.Sink).
+		Updates(map[string]interface{}{
+			"attempts":        entry.Attempts,
+			"next_attempt_at": entry.NextAttemptAt.UnixNano(),
+			"last_error":      entry.LastError,
+		})
+
+	// Error Handling
+	if err := query.Error; err != nil {
+		return &database.Error{
+			Code:    database.INTERNAL_ERROR,
+			Message: err.Error(),
+		}
+	}
+	if query.RowsAffected == 0 {
+		return outboxEntryNotFound(entry.Event.ID, entry.Sink)
+	}
+
+	return nil
+}
+
+func (e PostgresRepo) RemoveOutboxEntry(eventID string, sink string) error {
+	query := e.Dbmap.Where("event_id = ? AND sink = ?", eventID, sink).Delete(&OutboxEntry{})
+
+	// Error Handling
+	if err := query.Error; err != nil {
+		return &database.Error{
+			Code:    database.INTERNAL_ERROR,
+			Message: err.Error(),
+		}
+	}
+	if query.RowsAffected == 0 {
+		return outboxEntryNotFound(eventID, sink)
+	}
+
+	return nil
+}
+
+// PRIVATE HELPER METHODS
+
+// Transform an outbox entry retrieved from db into an outbox entry for API
+func dbOutboxEntryToAPIOutboxEntry(entryDB *OutboxEntry) *api.OutboxEntry {
+	return &api.OutboxEntry{
+		Event: api.Event{
+			ID:        entryDB.EventID,
+			Type:      entryDB.Type,
+			Urn:       entryDB.Urn,
+			Actor:     entryDB.Actor,
+			RequestID: entryDB.RequestID,
+			CreateAt:  time.Unix(0, entryDB.CreateAt).UTC(),
+			Data:      stringToAuditState(entryDB.Data),
+		},
+		Sink:          entryDB.Sink,
+		Attempts:      entryDB.Attempts,
+		NextAttemptAt: time.Unix(0, entryDB.NextAttemptAt).UTC(),
+		LastError:     entryDB.LastError,
+	}
+}
+
+func outboxEntryNotFound(eventID string, sink string) error {
+	return &database.Error{
+		Code:    database.OUTBOX_ENTRY_NOT_FOUND,
+		Message: fmt.Sprintf("Outbox entry with event id %v and sink %v not found", eventID, sink),
+	}
+}
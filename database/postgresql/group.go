@@ -152,12 +152,12 @@ func (g PostgresRepo) UpdateGroup(group api.Group) (*api.Group, error) {
 }
 
 func (g PostgresRepo) RemoveGroup(id string) error {
-	transaction := g.Dbmap.Begin()
+	transaction := g.begin()
 
 	// Delete group
 	transaction.Where("id like ?", id).Delete(&Group{})
 	if err := transaction.Error; err != nil {
-		transaction.Rollback()
+		g.rollback(transaction)
 		return &database.Error{
 			Code:    database.INTERNAL_ERROR,
 			Message: err.Error(),
@@ -167,7 +167,7 @@ func (g PostgresRepo) RemoveGroup(id string) error {
 	// Delete all group relations
 	transaction.Where("group_id like ?", id).Delete(&GroupUserRelation{})
 	if err := transaction.Error; err != nil {
-		transaction.Rollback()
+		g.rollback(transaction)
 		return &database.Error{
 			Code:    database.INTERNAL_ERROR,
 			Message: err.Error(),
@@ -177,14 +177,14 @@ func (g PostgresRepo) RemoveGroup(id string) error {
 	// Delete all policy relations
 	transaction.Where("group_id like ?", id).Delete(&GroupPolicyRelation{})
 	if err := transaction.Error; err != nil {
-		transaction.Rollback()
+		g.rollback(transaction)
 		return &database.Error{
 			Code:    database.INTERNAL_ERROR,
 			Message: err.Error(),
 		}
 	}
 
-	transaction.Commit()
+	g.commit(transaction)
 	return nil
 }
 
@@ -0,0 +1,323 @@
+package postgresql
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Migration changes the database schema from the previous version to Version
+type Migration struct {
+	Version     int
+	Description string
+	Up          string
+	Down        string
+}
+
+// Migrations contains all schema versions ordered. New schema changes must be appended as a new
+// migration, and existing ones must never be modified.
+var Migrations = []Migration{
+	{
+		Version:     1,
+		Description: "Baseline schema",
+		Up: `
+CREATE TABLE IF NOT EXISTS users (
+	id TEXT PRIMARY KEY,
+	external_id TEXT NOT NULL UNIQUE,
+	path TEXT NOT NULL,
+	create_at BIGINT NOT NULL,
+	update_at BIGINT NOT NULL,
+	urn TEXT NOT NULL UNIQUE
+);
+CREATE TABLE IF NOT EXISTS groups (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	path TEXT NOT NULL,
+	org TEXT NOT NULL,
+	create_at BIGINT NOT NULL,
+	update_at BIGINT NOT NULL,
+	urn TEXT NOT NULL UNIQUE
+);
+CREATE TABLE IF NOT EXISTS policies (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	path TEXT NOT NULL,
+	org TEXT NOT NULL,
+	create_at BIGINT NOT NULL,
+	update_at BIGINT NOT NULL,
+	urn TEXT NOT NULL UNIQUE
+);
+CREATE TABLE IF NOT EXISTS statements (
+	id TEXT PRIMARY KEY,
+	policy_id TEXT NOT NULL,
+	effect TEXT NOT NULL,
+	actions TEXT NOT NULL,
+	resources TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS group_user_relations (
+	user_id TEXT NOT NULL,
+	group_id TEXT NOT NULL,
+	create_at BIGINT NOT NULL,
+	PRIMARY KEY (user_id, group_id)
+);
+CREATE TABLE IF NOT EXISTS group_policy_relations (
+	group_id TEXT NOT NULL,
+	policy_id TEXT NOT NULL,
+	create_at BIGINT NOT NULL,
+	PRIMARY KEY (group_id, policy_id)
+);`,
+		Down: `
+DROP TABLE IF EXISTS group_policy_relations;
+DROP TABLE IF EXISTS group_user_relations;
+DROP TABLE IF EXISTS statements;
+DROP TABLE IF EXISTS policies;
+DROP TABLE IF EXISTS groups;
+DROP TABLE IF EXISTS users;`,
+	},
+	{
+		Version:     2,
+		Description: "Add conditions to statements",
+		// Column could be created by previous versions without migrations
+		Up: `
+DO $$
+	BEGIN
+		IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+			WHERE table_name = 'statements' AND column_name = 'conditions') THEN
+			ALTER TABLE statements ADD conditions TEXT NOT NULL DEFAULT '';
+		END IF;
+	END $$;`,
+		Down: `ALTER TABLE statements DROP COLUMN IF EXISTS conditions;`,
+	},
+	{
+		Version:     3,
+		Description: "Add index to retrieve statements by policy",
+		Up:          `CREATE INDEX IF NOT EXISTS statements_policy_id_idx ON statements (policy_id);`,
+		Down:        `DROP INDEX IF EXISTS statements_policy_id_idx;`,
+	},
+	{
+		Version:     4,
+		Description: "Add audit events",
+		Up: `
+CREATE TABLE IF NOT EXISTS audit_events (
+	id TEXT PRIMARY KEY,
+	actor TEXT NOT NULL,
+	request_id TEXT NOT NULL,
+	action TEXT NOT NULL,
+	urn TEXT NOT NULL,
+	before_state TEXT NOT NULL DEFAULT '',
+	after_state TEXT NOT NULL DEFAULT '',
+	create_at BIGINT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS audit_events_create_at_idx ON audit_events (create_at);
+CREATE INDEX IF NOT EXISTS audit_events_actor_idx ON audit_events (actor, create_at);
+CREATE INDEX IF NOT EXISTS audit_events_urn_idx ON audit_events (urn, create_at);`,
+		Down: `DROP TABLE IF EXISTS audit_events;`,
+	},
+	{
+		Version:     5,
+		Description: "Add event outbox",
+		Up: `
+CREATE TABLE IF NOT EXISTS outbox_entries (
+	event_id TEXT NOT NULL,
+	sink TEXT NOT NULL,
+	type TEXT NOT NULL,
+	urn TEXT NOT NULL,
+	actor TEXT NOT NULL,
+	request_id TEXT NOT NULL,
+	data TEXT NOT NULL DEFAULT '',
+	create_at BIGINT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at BIGINT NOT NULL,
+	last_error TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (event_id, sink)
+);
+CREATE INDEX IF NOT EXISTS outbox_entries_next_attempt_at_idx ON outbox_entries (next_attempt_at);`,
+		Down: `DROP TABLE IF EXISTS outbox_entries;`,
+	},
+	{
+		Version:     6,
+		Description: "Add service accounts",
+		Up: `
+CREATE TABLE IF NOT EXISTS service_accounts (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE,
+	external_id TEXT NOT NULL,
+	key_prefix TEXT NOT NULL,
+	key_hash TEXT NOT NULL UNIQUE,
+	urn TEXT NOT NULL UNIQUE,
+	create_at BIGINT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS service_accounts_external_id_idx ON service_accounts (external_id);`,
+		Down: `DROP TABLE IF EXISTS service_accounts;`,
+	},
+	{
+		Version:     7,
+		Description: "Add position of statements in their policy",
+		Up:          `ALTER TABLE statements ADD position INTEGER NOT NULL DEFAULT 0;`,
+		Down:        `ALTER TABLE statements DROP COLUMN IF EXISTS position;`,
+	},
+}
+
+const schemaVersionTable = `
+CREATE TABLE IF NOT EXISTS schema_version (
+	version INTEGER PRIMARY KEY,
+	description TEXT NOT NULL,
+	applied_at BIGINT NOT NULL
+);`
+
+// MigrationStatus is a migration with the date it was applied
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Applied migrations table
+type SchemaVersion struct {
+	Version     int    `gorm:"primary_key"`
+	Description string `gorm:"not null"`
+	AppliedAt   int64  `gorm:"not null"`
+}
+
+// SchemaVersion's table name
+func (SchemaVersion) TableName() string {
+	return "schema_version"
+}
+
+// LatestSchemaVersion returns the schema version expected by this version of foulkon
+func LatestSchemaVersion() int {
+	return Migrations[len(Migrations)-1].Version
+}
+
+// CurrentSchemaVersion returns the version of the last migration applied, or 0 if there isn't any.
+func CurrentSchemaVersion(db *gorm.DB) (int, error) {
+	if !db.HasTable(&SchemaVersion{}) {
+		return 0, nil
+	}
+	var version int
+	if err := db.Table(SchemaVersion{}.TableName()).Select("COALESCE(MAX(version), 0)").Row().Scan(&version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// CheckSchemaVersion returns an error if the database schema isn't the version expected by this version of foulkon
+func CheckSchemaVersion(db *gorm.DB) error {
+	current, err := CurrentSchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	latest := LatestSchemaVersion()
+	switch {
+	case current < latest:
+		return fmt.Errorf("Database schema version %v is older than expected version %v, run migrate up command", current, latest)
+	case current > latest:
+		return fmt.Errorf("Database schema version %v is newer than expected version %v, update foulkon or run migrate down command with the newer version", current, latest)
+	}
+	return nil
+}
+
+// MigrateUp applies all pending migrations, each one in its own transaction. It returns the migrations applied.
+func MigrateUp(db *gorm.DB) ([]Migration, error) {
+	if err := db.Exec(schemaVersionTable).Error; err != nil {
+		return nil, err
+	}
+	current, err := CurrentSchemaVersion(db)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := []Migration{}
+	for _, migration := range Migrations {
+		if migration.Version <= current {
+			continue
+		}
+		tx := db.Begin()
+		if err := tx.Exec(migration.Up).Error; err != nil {
+			tx.Rollback()
+			return applied, fmt.Errorf("Error applying migration %v: %v", migration.Version, err)
+		}
+		version := &SchemaVersion{
+			Version:     migration.Version,
+			Description: migration.Description,
+			AppliedAt:   time.Now().UTC().UnixNano(),
+		}
+		if err := tx.Create(version).Error; err != nil {
+			tx.Rollback()
+			return applied, fmt.Errorf("Error applying migration %v: %v", migration.Version, err)
+		}
+		if err := tx.Commit().Error; err != nil {
+			return applied, fmt.Errorf("Error applying migration %v: %v", migration.Version, err)
+		}
+		applied = append(applied, migration)
+	}
+
+	return applied, nil
+}
+
+// MigrateDown reverts the last migration applied. It returns nil if there isn't any migration to revert.
+func MigrateDown(db *gorm.DB) (*Migration, error) {
+	current, err := CurrentSchemaVersion(db)
+	if err != nil || current == 0 {
+		return nil, err
+	}
+	migration := getMigration(current)
+	if migration == nil {
+		return nil, fmt.Errorf("Database schema version %v is unknown for this version of foulkon", current)
+	}
+
+	tx := db.Begin()
+	if err := tx.Exec(migration.Down).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("Error reverting migration %v: %v", migration.Version, err)
+	}
+	if err := tx.Where("version = ?", migration.Version).Delete(&SchemaVersion{}).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("Error reverting migration %v: %v", migration.Version, err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("Error reverting migration %v: %v", migration.Version, err)
+	}
+
+	return migration, nil
+}
+
+// MigrationsStatus returns all known migrations, with the date they were applied if they were.
+func MigrationsStatus(db *gorm.DB) ([]MigrationStatus, error) {
+	versions := []SchemaVersion{}
+	if db.HasTable(&SchemaVersion{}) {
+		if err := db.Order("version").Find(&versions).Error; err != nil {
+			return nil, err
+		}
+	}
+	appliedAt := map[int]int64{}
+	for _, v := range versions {
+		appliedAt[v.Version] = v.AppliedAt
+	}
+
+	status := []MigrationStatus{}
+	for _, migration := range Migrations {
+		s := MigrationStatus{
+			Migration: migration,
+		}
+		if date, ok := appliedAt[migration.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = time.Unix(0, date).UTC()
+		}
+		status = append(status, s)
+	}
+
+	return status, nil
+}
+
+// PRIVATE HELPER METHODS
+
+func getMigration(version int) *Migration {
+	for i, migration := range Migrations {
+		if migration.Version == version {
+			return &Migrations[i]
+		}
+	}
+	return nil
+}
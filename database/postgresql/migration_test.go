@@ -0,0 +1,77 @@
+package postgresql
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestMigrations(t *testing.T) {
+	for i, migration := range Migrations {
+		if migration.Version != i+1 {
+			t.Errorf("Test failed. Migration %v has version %v, migrations must be consecutive", i+1, migration.Version)
+		}
+		if migration.Description == "" || migration.Up == "" || migration.Down == "" {
+			t.Errorf("Test failed. Migration %v must have description, up and down", migration.Version)
+		}
+	}
+}
+
+func TestMigrateDownUp(t *testing.T) {
+	latest := LatestSchemaVersion()
+
+	// Revert last migration
+	reverted, err := MigrateDown(repoDB.Dbmap)
+	if err != nil {
+		t.Fatalf("Test failed. Unexpected error reverting migration: %v", err)
+	}
+	if diff := pretty.Compare(reverted, &Migrations[latest-1]); diff != "" {
+		t.Errorf("Test failed. Received different reverted migration (received/wanted) %v", diff)
+	}
+	expectedError := fmt.Errorf("Database schema version %v is older than expected version %v, run migrate up command", latest-1, latest)
+	if diff := pretty.Compare(CheckSchemaVersion(repoDB.Dbmap), expectedError); diff != "" {
+		t.Errorf("Test failed. Received different error (received/wanted) %v", diff)
+	}
+
+	// Apply it again
+	applied, err := MigrateUp(repoDB.Dbmap)
+	if err != nil {
+		t.Fatalf("Test failed. Unexpected error applying migrations: %v", err)
+	}
+	if diff := pretty.Compare(applied, Migrations[latest-1:]); diff != "" {
+		t.Errorf("Test failed. Received different applied migrations (received/wanted) %v", diff)
+	}
+	if err := CheckSchemaVersion(repoDB.Dbmap); err != nil {
+		t.Errorf("Test failed. Unexpected error checking schema: %v", err)
+	}
+
+	// Nothing to apply
+	applied, err = MigrateUp(repoDB.Dbmap)
+	if err != nil || len(applied) != 0 {
+		t.Errorf("Test failed. Received %v applied migrations and error %v", len(applied), err)
+	}
+
+	status, err := MigrationsStatus(repoDB.Dbmap)
+	if err != nil {
+		t.Fatalf("Test failed. Unexpected error retrieving status: %v", err)
+	}
+	for _, s := range status {
+		if !s.Applied {
+			t.Errorf("Test failed. Migration %v isn't applied", s.Version)
+		}
+	}
+}
+
+func TestCheckSchemaVersion_Newer(t *testing.T) {
+	newer := LatestSchemaVersion() + 1
+	if err := repoDB.Dbmap.Create(&SchemaVersion{Version: newer, Description: "Newer", AppliedAt: 1}).Error; err != nil {
+		t.Fatalf("Test failed. Unexpected error inserting version: %v", err)
+	}
+	defer repoDB.Dbmap.Where("version = ?", newer).Delete(&SchemaVersion{})
+
+	expectedError := fmt.Errorf("Database schema version %v is newer than expected version %v, update foulkon or run migrate down command with the newer version", newer, newer-1)
+	if diff := pretty.Compare(CheckSchemaVersion(repoDB.Dbmap), expectedError); diff != "" {
+		t.Errorf("Test failed. Received different error (received/wanted) %v", diff)
+	}
+}
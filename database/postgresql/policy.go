@@ -1,6 +1,7 @@
 package postgresql
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
@@ -24,11 +25,11 @@ func (p PostgresRepo) AddPolicy(policy api.Policy) (*api.Policy, error) {
 		Org:      policy.Org,
 	}
 
-	transaction := p.Dbmap.Begin()
+	transaction := p.begin()
 
 	// Create policy
 	if err := transaction.Create(policyDB).Error; err != nil {
-		transaction.Rollback()
+		p.rollback(transaction)
 		return nil, &database.Error{
 			Code:    database.INTERNAL_ERROR,
 			Message: err.Error(),
@@ -36,17 +37,27 @@ func (p PostgresRepo) AddPolicy(policy api.Policy) (*api.Policy, error) {
 	}
 
 	// Create statements
-	for _, statementApi := range *policy.Statements {
+	for i, statementApi := range *policy.Statements {
+		conditions, err := conditionsToString(statementApi.Conditions)
+		if err != nil {
+			p.rollback(transaction)
+			return nil, &database.Error{
+				Code:    database.INTERNAL_ERROR,
+				Message: err.Error(),
+			}
+		}
 		// Create statement model
 		statementDB := &Statement{
-			ID:        uuid.NewV4().String(),
-			PolicyID:  policy.ID,
-			Effect:    statementApi.Effect,
-			Actions:   stringArrayToString(statementApi.Actions),
-			Resources: stringArrayToString(statementApi.Resources),
+			ID:         uuid.NewV4().String(),
+			PolicyID:   policy.ID,
+			Effect:     statementApi.Effect,
+			Actions:    stringArrayToString(statementApi.Actions),
+			Resources:  stringArrayToString(statementApi.Resources),
+			Conditions: conditions,
+			Position:   i,
 		}
 		if err := transaction.Create(statementDB).Error; err != nil {
-			transaction.Rollback()
+			p.rollback(transaction)
 			return nil, &database.Error{
 				Code:    database.INTERNAL_ERROR,
 				Message: err.Error(),
@@ -54,7 +65,7 @@ func (p PostgresRepo) AddPolicy(policy api.Policy) (*api.Policy, error) {
 		}
 	}
 
-	transaction.Commit()
+	p.commit(transaction)
 
 	// Create API policy
 	policyApi := dbPolicyToAPIPolicy(policyDB)
@@ -85,7 +96,7 @@ func (p PostgresRepo) GetPolicyByName(org string, name string) (*api.Policy, err
 
 	// Retrieve associated statements
 	statements := []Statement{}
-	query = p.Dbmap.Where("policy_id like ?", policy.ID).Find(&statements)
+	query = p.Dbmap.Where("policy_id like ?", policy.ID).Order("position").Find(&statements)
 	// Error Handling
 	if err := query.Error; err != nil {
 		return nil, &database.Error{
@@ -96,7 +107,14 @@ func (p PostgresRepo) GetPolicyByName(org string, name string) (*api.Policy, err
 
 	// Create API policy
 	policyApi := dbPolicyToAPIPolicy(policy)
-	policyApi.Statements = dbStatementsToAPIStatements(statements)
+	statementsApi, err := dbStatementsToAPIStatements(statements)
+	if err != nil {
+		return nil, &database.Error{
+			Code:    database.INTERNAL_ERROR,
+			Message: err.Error(),
+		}
+	}
+	policyApi.Statements = statementsApi
 
 	return policyApi, nil
 }
@@ -123,7 +141,7 @@ func (p PostgresRepo) GetPolicyById(id string) (*api.Policy, error) {
 
 	// Retrieve associated statements
 	statements := []Statement{}
-	query = p.Dbmap.Where("policy_id like ?", policy.ID).Find(&statements)
+	query = p.Dbmap.Where("policy_id like ?", policy.ID).Order("position").Find(&statements)
 	// Error Handling
 	if err := query.Error; err != nil {
 		return nil, &database.Error{
@@ -134,7 +152,14 @@ func (p PostgresRepo) GetPolicyById(id string) (*api.Policy, error) {
 
 	// Create API policy
 	policyApi := dbPolicyToAPIPolicy(policy)
-	policyApi.Statements = dbStatementsToAPIStatements(statements)
+	statementsApi, err := dbStatementsToAPIStatements(statements)
+	if err != nil {
+		return nil, &database.Error{
+			Code:    database.INTERNAL_ERROR,
+			Message: err.Error(),
+		}
+	}
+	policyApi.Statements = statementsApi
 
 	return policyApi, nil
 }
@@ -172,7 +197,7 @@ func (p PostgresRepo) GetPoliciesFiltered(filter *api.Filter) ([]api.Policy, int
 
 			// Retrieve associated statements
 			statements := []Statement{}
-			query = p.Dbmap.Where("policy_id like ?", policy.ID).Find(&statements)
+			query = p.Dbmap.Where("policy_id like ?", policy.ID).Order("position").Find(&statements)
 			// Error Handling
 			if err := query.Error; err != nil {
 				return nil, total, &database.Error{
@@ -181,7 +206,14 @@ func (p PostgresRepo) GetPoliciesFiltered(filter *api.Filter) ([]api.Policy, int
 				}
 			}
 
-			policy.Statements = dbStatementsToAPIStatements(statements)
+			statementsApi, err := dbStatementsToAPIStatements(statements)
+			if err != nil {
+				return nil, total, &database.Error{
+					Code:    database.INTERNAL_ERROR,
+					Message: err.Error(),
+				}
+			}
+			policy.Statements = statementsApi
 
 			// Assign policy
 			apiPolicies[i] = *policy
@@ -204,11 +236,11 @@ func (p PostgresRepo) UpdatePolicy(policy api.Policy) (*api.Policy, error) {
 		Org:      policy.Org,
 	}
 
-	transaction := p.Dbmap.Begin()
+	transaction := p.begin()
 
 	// Update policy
 	if err := transaction.Model(&Policy{ID: policy.ID}).Update(policyDB).Error; err != nil {
-		transaction.Rollback()
+		p.rollback(transaction)
 		return nil, &database.Error{
 			Code:    database.INTERNAL_ERROR,
 			Message: err.Error(),
@@ -217,7 +249,7 @@ func (p PostgresRepo) UpdatePolicy(policy api.Policy) (*api.Policy, error) {
 
 	// Clear old statements
 	if err := transaction.Where("policy_id like ?", policy.ID).Delete(Statement{}).Error; err != nil {
-		transaction.Rollback()
+		p.rollback(transaction)
 		return nil, &database.Error{
 			Code:    database.INTERNAL_ERROR,
 			Message: err.Error(),
@@ -225,16 +257,26 @@ func (p PostgresRepo) UpdatePolicy(policy api.Policy) (*api.Policy, error) {
 	}
 
 	// Create new statements
-	for _, s := range *policy.Statements {
+	for i, s := range *policy.Statements {
+		conditions, err := conditionsToString(s.Conditions)
+		if err != nil {
+			p.rollback(transaction)
+			return nil, &database.Error{
+				Code:    database.INTERNAL_ERROR,
+				Message: err.Error(),
+			}
+		}
 		statementDB := &Statement{
-			ID:        uuid.NewV4().String(),
-			PolicyID:  policy.ID,
-			Effect:    s.Effect,
-			Actions:   stringArrayToString(s.Actions),
-			Resources: stringArrayToString(s.Resources),
+			ID:         uuid.NewV4().String(),
+			PolicyID:   policy.ID,
+			Effect:     s.Effect,
+			Actions:    stringArrayToString(s.Actions),
+			Resources:  stringArrayToString(s.Resources),
+			Conditions: conditions,
+			Position:   i,
 		}
 		if err := transaction.Create(statementDB).Error; err != nil {
-			transaction.Rollback()
+			p.rollback(transaction)
 			return nil, &database.Error{
 				Code:    database.INTERNAL_ERROR,
 				Message: err.Error(),
@@ -242,19 +284,19 @@ func (p PostgresRepo) UpdatePolicy(policy api.Policy) (*api.Policy, error) {
 		}
 	}
 
-	transaction.Commit()
+	p.commit(transaction)
 
 	return &policy, nil
 }
 
 func (p PostgresRepo) RemovePolicy(id string) error {
 
-	transaction := p.Dbmap.Begin()
+	transaction := p.begin()
 
 	// Delete policy relations (group)
 	transaction.Where("policy_id like ?", id).Delete(&GroupPolicyRelation{})
 	if err := transaction.Error; err != nil {
-		transaction.Rollback()
+		p.rollback(transaction)
 		return &database.Error{
 			Code:    database.INTERNAL_ERROR,
 			Message: err.Error(),
@@ -263,7 +305,7 @@ func (p PostgresRepo) RemovePolicy(id string) error {
 	// Delete policy statements
 	transaction.Where("policy_id like ?", id).Delete(&Statement{})
 	if err := transaction.Error; err != nil {
-		transaction.Rollback()
+		p.rollback(transaction)
 		return &database.Error{
 			Code:    database.INTERNAL_ERROR,
 			Message: err.Error(),
@@ -272,14 +314,14 @@ func (p PostgresRepo) RemovePolicy(id string) error {
 	//  Delete policy
 	transaction.Where("id like ?", id).Delete(&Policy{})
 	if err := transaction.Error; err != nil {
-		transaction.Rollback()
+		p.rollback(transaction)
 		return &database.Error{
 			Code:    database.INTERNAL_ERROR,
 			Message: err.Error(),
 		}
 	}
 
-	transaction.Commit()
+	p.commit(transaction)
 	return nil
 }
 
@@ -326,6 +368,40 @@ func (p PostgresRepo) GetAttachedGroups(policyID string, filter *api.Filter) ([]
 	return groups, total, nil
 }
 
+func (p PostgresRepo) GetEffectiveStatementsByUser(userID string, action string) ([]api.Statement, error) {
+	statements := []Statement{}
+	// Policies attached to several groups of the user are only included once
+	query := p.Dbmap.Select("statements.*").
+		Joins("JOIN policies ON policies.id = statements.policy_id").
+		Where(`statements.policy_id IN (SELECT group_policy_relations.policy_id FROM group_policy_relations
+			JOIN group_user_relations ON group_user_relations.group_id = group_policy_relations.group_id
+			WHERE group_user_relations.user_id = ?)`, userID)
+
+	if len(action) > 0 {
+		// Statement actions are semicolon-separated, and they can be prefixes ended with *
+		query = query.Where(`EXISTS (SELECT 1 FROM unnest(string_to_array(statements.actions, ';')) AS a
+			WHERE a = ? OR (strpos(a, '*') > 0 AND strpos(?, trim(both '*' from a)) = 1))`, action, action)
+	}
+
+	// Error Handling
+	if err := query.Order("policies.org, policies.name, statements.position").Find(&statements).Error; err != nil {
+		return nil, &database.Error{
+			Code:    database.INTERNAL_ERROR,
+			Message: err.Error(),
+		}
+	}
+
+	statementsApi, err := dbStatementsToAPIStatements(statements)
+	if err != nil {
+		return nil, &database.Error{
+			Code:    database.INTERNAL_ERROR,
+			Message: err.Error(),
+		}
+	}
+
+	return *statementsApi, nil
+}
+
 // PRIVATE HELPER METHODS
 
 // Transform a policy retrieved from db into a policy for API
@@ -342,17 +418,46 @@ func dbPolicyToAPIPolicy(policydb *Policy) *api.Policy {
 }
 
 // Transform a list of statements from db into API statements
-func dbStatementsToAPIStatements(statements []Statement) *[]api.Statement {
+func dbStatementsToAPIStatements(statements []Statement) (*[]api.Statement, error) {
 	statementsApi := make([]api.Statement, len(statements), cap(statements))
 	for i, s := range statements {
+		conditions, err := stringToConditions(s.Conditions)
+		if err != nil {
+			return nil, err
+		}
 		statementsApi[i] = api.Statement{
-			Actions:   strings.Split(s.Actions, ";"),
-			Effect:    s.Effect,
-			Resources: strings.Split(s.Resources, ";"),
+			Actions:    strings.Split(s.Actions, ";"),
+			Effect:     s.Effect,
+			Resources:  strings.Split(s.Resources, ";"),
+			Conditions: conditions,
 		}
 	}
 
-	return &statementsApi
+	return &statementsApi, nil
+}
+
+// Transform statement conditions into a JSON string, empty if there aren't conditions
+func conditionsToString(conditions api.Conditions) (string, error) {
+	if len(conditions) < 1 {
+		return "", nil
+	}
+	b, err := json.Marshal(conditions)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Transform a JSON string from db into statement conditions
+func stringToConditions(value string) (api.Conditions, error) {
+	if len(value) < 1 {
+		return nil, nil
+	}
+	conditions := api.Conditions{}
+	if err := json.Unmarshal([]byte(value), &conditions); err != nil {
+		return nil, fmt.Errorf("Invalid statement conditions stored in database: %v", err.Error())
+	}
+	return conditions, nil
 }
 
 // Transform an array of strings into a semicolon-separated string
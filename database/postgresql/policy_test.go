@@ -900,6 +900,129 @@ func TestPostgresRepo_GetAttachedGroups(t *testing.T) {
 	}
 }
 
+func TestPostgresRepo_GetEffectiveStatementsByUser(t *testing.T) {
+	now := time.Now().UTC()
+	policies := map[string][]Statement{
+		"PolicyID1": {
+			{
+				ID:        "StatementID1",
+				Effect:    "allow",
+				Actions:   api.USER_ACTION_GET_USER,
+				Resources: api.GetUrnPrefix("", api.RESOURCE_USER, "/path/"),
+			},
+		},
+		"PolicyID2": {
+			{
+				ID:        "StatementID2",
+				Effect:    "deny",
+				Actions:   "iam:*;example:Read",
+				Resources: api.GetUrnPrefix("", api.RESOURCE_GROUP, "/path/"),
+			},
+		},
+		"PolicyID3": {
+			{
+				ID:        "StatementID3",
+				Effect:    "allow",
+				Actions:   "*",
+				Resources: "urn:*",
+			},
+		},
+	}
+	// PolicyID1 is attached to both groups of the user, PolicyID3 to a group without the user
+	memberships := []struct {
+		groupID  string
+		userID   string
+		policies []string
+	}{
+		{groupID: "GroupID1", userID: "UserID", policies: []string{"PolicyID1"}},
+		{groupID: "GroupID2", userID: "UserID", policies: []string{"PolicyID1", "PolicyID2"}},
+		{groupID: "GroupID3", userID: "OtherUserID", policies: []string{"PolicyID3"}},
+	}
+	statement1 := api.Statement{
+		Effect:    "allow",
+		Actions:   []string{api.USER_ACTION_GET_USER},
+		Resources: []string{api.GetUrnPrefix("", api.RESOURCE_USER, "/path/")},
+	}
+	statement2 := api.Statement{
+		Effect:    "deny",
+		Actions:   []string{"iam:*", "example:Read"},
+		Resources: []string{api.GetUrnPrefix("", api.RESOURCE_GROUP, "/path/")},
+	}
+
+	// Clean database
+	cleanPolicyTable()
+	cleanStatementTable()
+	cleanGroupUserRelationTable()
+	cleanGroupPolicyRelationTable()
+
+	for policyID, statements := range policies {
+		policy := Policy{
+			ID:       policyID,
+			Name:     policyID,
+			Org:      "123",
+			Path:     "/path/",
+			CreateAt: now.UnixNano(),
+			UpdateAt: now.UnixNano(),
+			Urn:      api.CreateUrn("123", api.RESOURCE_POLICY, "/path/", policyID),
+		}
+		if err := insertPolicy(policy, statements); err != nil {
+			t.Fatalf("Test failed. Unexpected error inserting policy: %v", err)
+		}
+	}
+	for _, m := range memberships {
+		if err := insertGroupUserRelation(m.userID, m.groupID, now.UnixNano()); err != nil {
+			t.Fatalf("Test failed. Unexpected error inserting member: %v", err)
+		}
+		for _, policyID := range m.policies {
+			if err := insertGroupPolicyRelation(m.groupID, policyID, now.UnixNano()); err != nil {
+				t.Fatalf("Test failed. Unexpected error inserting policy relation: %v", err)
+			}
+		}
+	}
+
+	testcases := map[string]struct {
+		userID           string
+		action           string
+		expectedResponse []api.Statement
+	}{
+		"OkCaseAllActions": {
+			userID:           "UserID",
+			expectedResponse: []api.Statement{statement1, statement2},
+		},
+		"OkCaseAction": {
+			userID:           "UserID",
+			action:           "example:Read",
+			expectedResponse: []api.Statement{statement2},
+		},
+		"OkCaseActionPrefix": {
+			userID:           "UserID",
+			action:           api.USER_ACTION_GET_USER,
+			expectedResponse: []api.Statement{statement1, statement2},
+		},
+		"OkCaseNoMatches": {
+			userID:           "UserID",
+			action:           "example:Write",
+			expectedResponse: []api.Statement{},
+		},
+		"OkCaseUserWithoutGroups": {
+			userID:           "UnknownUserID",
+			expectedResponse: []api.Statement{},
+		},
+	}
+
+	for n, test := range testcases {
+		statements, err := repoDB.GetEffectiveStatementsByUser(test.userID, test.action)
+		if err != nil {
+			t.Errorf("Test %v failed. Unexpected error: %v", n, err)
+			continue
+		}
+		if diff := pretty.Compare(statements, test.expectedResponse); diff != "" {
+			t.Errorf("Test %v failed. Received different responses (received/wanted) %v", n, diff)
+			continue
+		}
+	}
+}
+
 func Test_dbPolicyToAPIPolicy(t *testing.T) {
 	now := time.Now().UTC()
 	testcases := map[string]struct {
@@ -975,11 +1098,12 @@ func Test_dbStatementsToAPIStatements(t *testing.T) {
 					Resources: api.GetUrnPrefix("", api.RESOURCE_USER, "/path/"),
 				},
 				{
-					ID:        "4321",
-					Effect:    "deny",
-					PolicyID:  "1234",
-					Actions:   api.GROUP_ACTION_GET_GROUP + ";" + api.GROUP_ACTION_CREATE_GROUP,
-					Resources: api.GetUrnPrefix("", api.RESOURCE_GROUP, "/xxx/") + ";" + api.GetUrnPrefix("", api.RESOURCE_GROUP, "/xxx2/"),
+					ID:         "4321",
+					Effect:     "deny",
+					PolicyID:   "1234",
+					Actions:    api.GROUP_ACTION_GET_GROUP + ";" + api.GROUP_ACTION_CREATE_GROUP,
+					Resources:  api.GetUrnPrefix("", api.RESOURCE_GROUP, "/xxx/") + ";" + api.GetUrnPrefix("", api.RESOURCE_GROUP, "/xxx2/"),
+					Conditions: `{"IpAddress":{"foulkon:SourceIp":["10.0.0.0/8"]}}`,
 				},
 			},
 			apiStatements: &[]api.Statement{
@@ -1002,13 +1126,22 @@ func Test_dbStatementsToAPIStatements(t *testing.T) {
 						api.GetUrnPrefix("", api.RESOURCE_GROUP, "/xxx/"),
 						api.GetUrnPrefix("", api.RESOURCE_GROUP, "/xxx2/"),
 					},
+					Conditions: api.Conditions{
+						api.CONDITION_IP_ADDRESS: {
+							api.CONTEXT_KEY_SOURCE_IP: []string{"10.0.0.0/8"},
+						},
+					},
 				},
 			},
 		},
 	}
 
 	for n, test := range testcases {
-		receivedAPIStatements := dbStatementsToAPIStatements(test.dbStatements)
+		receivedAPIStatements, err := dbStatementsToAPIStatements(test.dbStatements)
+		if err != nil {
+			t.Errorf("Test %v failed. Unexpected error: %v", n, err)
+			continue
+		}
 		// Check response
 		if diff := pretty.Compare(receivedAPIStatements, test.apiStatements); diff != "" {
 			t.Errorf("Test %v failed. Received different responses (received/wanted) %v", n, diff)
@@ -6,15 +6,36 @@ import (
 	"time"
 
 	"github.com/Tecsisa/foulkon/api"
+	"github.com/Tecsisa/foulkon/database"
 	"github.com/jinzhu/gorm"
 	_ "github.com/lib/pq" //GORM needs to import the lib/pq driver
 )
 
 type PostgresRepo struct {
 	Dbmap *gorm.DB
+
+	// Dbmap is the transaction of a repository received by Transaction method
+	inTransaction bool
 }
 
+// InitDb connects to database and checks that its schema is the version expected. Run migrations with
+// MigrateUp to update it.
 func InitDb(datasourcename string, idleConns string, maxOpenConns string, connTTL string) (*gorm.DB, error) {
+	db, err := Connect(datasourcename, idleConns, maxOpenConns, connTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := CheckSchemaVersion(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Connect returns a connection to database without checking its schema
+func Connect(datasourcename string, idleConns string, maxOpenConns string, connTTL string) (*gorm.DB, error) {
 	// connect to db using GORM - github.com/jinzhu/gorm
 	db, err := gorm.Open("postgres", datasourcename)
 	if err != nil {
@@ -44,12 +65,6 @@ func InitDb(datasourcename string, idleConns string, maxOpenConns string, connTT
 		return nil, err
 	}
 
-	// Create tables if not exist
-	err = db.AutoMigrate(&User{}, &Group{}, &Policy{}, &Statement{}, &GroupUserRelation{}, &GroupPolicyRelation{}).Error
-	if err != nil {
-		return nil, err
-	}
-
 	return db, nil
 }
 
@@ -102,11 +117,14 @@ func (Policy) TableName() string {
 
 // Statement table
 type Statement struct {
-	ID        string `gorm:"primary_key"`
-	PolicyID  string `gorm:"not null"`
-	Effect    string `gorm:"not null"`
-	Actions   string `gorm:"not null"`
-	Resources string `gorm:"not null"`
+	ID         string `gorm:"primary_key"`
+	PolicyID   string `gorm:"not null"`
+	Effect     string `gorm:"not null"`
+	Actions    string `gorm:"not null"`
+	Resources  string `gorm:"not null"`
+	Conditions string `gorm:"not null;default:''"`
+	// Position of the statement in its policy
+	Position int `gorm:"not null;default:0"`
 }
 
 // Statement's table name
@@ -138,6 +156,94 @@ func (GroupPolicyRelation) TableName() string {
 	return "group_policy_relations"
 }
 
+// Service account table
+type ServiceAccount struct {
+	ID         string `gorm:"primary_key"`
+	Name       string `gorm:"not null;unique"`
+	ExternalID string `gorm:"not null"`
+	KeyPrefix  string `gorm:"not null"`
+	KeyHash    string `gorm:"not null;unique"`
+	Urn        string `gorm:"not null;unique"`
+	CreateAt   int64  `gorm:"not null"`
+}
+
+// ServiceAccount's table name
+func (ServiceAccount) TableName() string {
+	return "service_accounts"
+}
+
+// Audit event table
+type AuditEvent struct {
+	ID          string `gorm:"primary_key"`
+	Actor       string `gorm:"not null"`
+	RequestID   string `gorm:"not null"`
+	Action      string `gorm:"not null"`
+	Urn         string `gorm:"not null"`
+	BeforeState string `gorm:"not null;default:''"`
+	AfterState  string `gorm:"not null;default:''"`
+	CreateAt    int64  `gorm:"not null"`
+}
+
+// AuditEvent's table name
+func (AuditEvent) TableName() string {
+	return "audit_events"
+}
+
+// Outbox table
+type OutboxEntry struct {
+	EventID       string `gorm:"primary_key"`
+	Sink          string `gorm:"primary_key"`
+	Type          string `gorm:"not null"`
+	Urn           string `gorm:"not null"`
+	Actor         string `gorm:"not null"`
+	RequestID     string `gorm:"not null"`
+	Data          string `gorm:"not null;default:''"`
+	CreateAt      int64  `gorm:"not null"`
+	Attempts      int    `gorm:"not null"`
+	NextAttemptAt int64  `gorm:"not null"`
+	LastError     string `gorm:"not null;default:''"`
+}
+
+// OutboxEntry's table name
+func (OutboxEntry) TableName() string {
+	return "outbox_entries"
+}
+
+// Transaction makes changes with the repositories of a database transaction
+func (u PostgresRepo) Transaction(change func(repos api.Repos) error) error {
+	transaction := u.begin()
+	if err := transaction.Error; err != nil {
+		return &database.Error{
+			Code:    database.INTERNAL_ERROR,
+			Message: err.Error(),
+		}
+	}
+
+	tx := PostgresRepo{
+		Dbmap:         transaction,
+		inTransaction: true,
+	}
+	if err := change(api.Repos{
+		UserRepo:           tx,
+		GroupRepo:          tx,
+		PolicyRepo:         tx,
+		ServiceAccountRepo: tx,
+		AuditRepo:          tx,
+		EventRepo:          tx,
+	}); err != nil {
+		u.rollback(transaction)
+		return err
+	}
+
+	if err := u.commit(transaction); err != nil {
+		return &database.Error{
+			Code:    database.INTERNAL_ERROR,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
 func (u PostgresRepo) OrderByValidColumns(action string) []string {
 	switch action {
 	case api.USER_ACTION_LIST_USERS:
@@ -154,7 +260,35 @@ func (u PostgresRepo) OrderByValidColumns(action string) []string {
 		return []string{"name", "path", "org", "create_at", "update_at", "urn"}
 	case api.POLICY_ACTION_LIST_ATTACHED_GROUPS:
 		return []string{"create_at"}
+	case api.SERVICE_ACCOUNT_ACTION_LIST_SERVICE_ACCOUNTS:
+		return []string{"name", "external_id", "create_at"}
 	default:
 		return nil
 	}
 }
+
+// PRIVATE HELPER METHODS
+
+// Begin a transaction, or continue the transaction of the repository if it is in one
+func (u PostgresRepo) begin() *gorm.DB {
+	if u.inTransaction {
+		return u.Dbmap
+	}
+	return u.Dbmap.Begin()
+}
+
+// Commit a transaction begun by the repository. A transaction continued is committed by who began it.
+func (u PostgresRepo) commit(transaction *gorm.DB) error {
+	if u.inTransaction {
+		return nil
+	}
+	return transaction.Commit().Error
+}
+
+// Roll back a transaction begun by the repository. A transaction continued is rolled back by who
+// began it, when the error is returned.
+func (u PostgresRepo) rollback(transaction *gorm.DB) {
+	if !u.inTransaction {
+		transaction.Rollback()
+	}
+}
@@ -0,0 +1,136 @@
+package postgresql
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Tecsisa/foulkon/api"
+	"github.com/Tecsisa/foulkon/database"
+)
+
+// SERVICE ACCOUNT REPOSITORY IMPLEMENTATION
+
+func (s PostgresRepo) AddServiceAccount(serviceAccount api.ServiceAccount) (*api.ServiceAccount, error) {
+	// Create service account model
+	serviceAccountDB := &ServiceAccount{
+		ID:         serviceAccount.ID,
+		Name:       serviceAccount.Name,
+		ExternalID: serviceAccount.ExternalID,
+		KeyPrefix:  serviceAccount.KeyPrefix,
+		KeyHash:    serviceAccount.KeyHash,
+		Urn:        serviceAccount.Urn,
+		CreateAt:   serviceAccount.CreateAt.UnixNano(),
+	}
+
+	// Store service account
+	if err := s.Dbmap.Create(serviceAccountDB).Error; err != nil {
+		return nil, &database.Error{
+			Code:    database.INTERNAL_ERROR,
+			Message: err.Error(),
+		}
+	}
+
+	return dbServiceAccountToAPIServiceAccount(serviceAccountDB), nil
+}
+
+func (s PostgresRepo) GetServiceAccountByName(name string) (*api.ServiceAccount, error) {
+	serviceAccount := &ServiceAccount{}
+	query := s.Dbmap.Where("name = ?", name).First(serviceAccount)
+
+	// Check if service account exists
+	if query.RecordNotFound() {
+		return nil, &database.Error{
+			Code:    database.SERVICE_ACCOUNT_NOT_FOUND,
+			Message: fmt.Sprintf("Service account with name %v not found", name),
+		}
+	}
+
+	// Error Handling
+	if err := query.Error; err != nil {
+		return nil, &database.Error{
+			Code:    database.INTERNAL_ERROR,
+			Message: err.Error(),
+		}
+	}
+
+	return dbServiceAccountToAPIServiceAccount(serviceAccount), nil
+}
+
+func (s PostgresRepo) GetServiceAccountByKeyHash(keyHash string) (*api.ServiceAccount, error) {
+	serviceAccount := &ServiceAccount{}
+	query := s.Dbmap.Where("key_hash = ?", keyHash).First(serviceAccount)
+
+	// Check if service account exists
+	if query.RecordNotFound() {
+		return nil, &database.Error{
+			Code:    database.SERVICE_ACCOUNT_NOT_FOUND,
+			Message: "Service account with key hash specified not found",
+		}
+	}
+
+	// Error Handling
+	if err := query.Error; err != nil {
+		return nil, &database.Error{
+			Code:    database.INTERNAL_ERROR,
+			Message: err.Error(),
+		}
+	}
+
+	return dbServiceAccountToAPIServiceAccount(serviceAccount), nil
+}
+
+func (s PostgresRepo) GetServiceAccountsFiltered(filter *api.Filter) ([]api.ServiceAccount, int, error) {
+	var total int
+	serviceAccounts := []ServiceAccount{}
+	query := s.Dbmap
+
+	if len(filter.ExternalID) > 0 {
+		query = query.Where("external_id = ?", filter.ExternalID)
+	}
+	order := "create_at, id"
+	if len(filter.OrderBy) > 0 {
+		order = filter.OrderBy + ", id"
+	}
+
+	// Error handling
+	if err := query.Model(&ServiceAccount{}).Count(&total).Order(order).Offset(filter.Offset).Limit(filter.Limit).Find(&serviceAccounts).Error; err != nil {
+		return nil, total, &database.Error{
+			Code:    database.INTERNAL_ERROR,
+			Message: err.Error(),
+		}
+	}
+
+	// Transform service accounts for API
+	apiServiceAccounts := make([]api.ServiceAccount, len(serviceAccounts))
+	for i, sa := range serviceAccounts {
+		apiServiceAccounts[i] = *dbServiceAccountToAPIServiceAccount(&sa)
+	}
+
+	return apiServiceAccounts, total, nil
+}
+
+func (s PostgresRepo) RemoveServiceAccount(id string) error {
+	if err := s.Dbmap.Where("id = ?", id).Delete(&ServiceAccount{}).Error; err != nil {
+		return &database.Error{
+			Code:    database.INTERNAL_ERROR,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+// PRIVATE HELPER METHODS
+
+// Transform a service account retrieved from db into a service account for API
+func dbServiceAccountToAPIServiceAccount(serviceAccountDB *ServiceAccount) *api.ServiceAccount {
+	return &api.ServiceAccount{
+		ID:         serviceAccountDB.ID,
+		Name:       serviceAccountDB.Name,
+		ExternalID: serviceAccountDB.ExternalID,
+		KeyPrefix:  serviceAccountDB.KeyPrefix,
+		KeyHash:    serviceAccountDB.KeyHash,
+		Urn:        serviceAccountDB.Urn,
+		CreateAt:   time.Unix(0, serviceAccountDB.CreateAt).UTC(),
+	}
+}
@@ -138,13 +138,25 @@ func (u PostgresRepo) UpdateUser(user api.User) (*api.User, error) {
 }
 
 func (u PostgresRepo) RemoveUser(id string) error {
-	transaction := u.Dbmap.Begin()
+	transaction := u.begin()
+	// Delete user service accounts
+	transaction.Where("external_id IN (SELECT external_id FROM users WHERE id like ?)", id).Delete(&ServiceAccount{})
+
+	// Error handling
+	if err := transaction.Error; err != nil {
+		u.rollback(transaction)
+		return &database.Error{
+			Code:    database.INTERNAL_ERROR,
+			Message: err.Error(),
+		}
+	}
+
 	// Delete user
 	transaction.Where("id like ?", id).Delete(&User{})
 
 	// Error handling
 	if err := transaction.Error; err != nil {
-		transaction.Rollback()
+		u.rollback(transaction)
 		return &database.Error{
 			Code:    database.INTERNAL_ERROR,
 			Message: err.Error(),
@@ -156,14 +168,14 @@ func (u PostgresRepo) RemoveUser(id string) error {
 
 	// Error handling
 	if err := transaction.Error; err != nil {
-		transaction.Rollback()
+		u.rollback(transaction)
 		return &database.Error{
 			Code:    database.INTERNAL_ERROR,
 			Message: err.Error(),
 		}
 	}
 
-	transaction.Commit()
+	u.commit(transaction)
 	return nil
 }
 
@@ -0,0 +1,86 @@
+package foulkon
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Tecsisa/foulkon/database/postgresql"
+	"github.com/pelletier/go-toml"
+)
+
+const (
+	MIGRATE_UP     = "up"
+	MIGRATE_DOWN   = "down"
+	MIGRATE_STATUS = "status"
+)
+
+// Migrate runs a migration command (up, down or status) against the database of the worker
+// configuration, and writes the result in out.
+func Migrate(config *toml.TomlTree, command string, out io.Writer) error {
+	dbType, err := getMandatoryValue(config, "database.type")
+	if err != nil {
+		return err
+	}
+	if dbType != "postgres" {
+		return fmt.Errorf("Database type %v doesn't need migrations", dbType)
+	}
+	dbdsn, err := getMandatoryValue(config, "database.postgres.datasourcename")
+	if err != nil {
+		return err
+	}
+	gormDB, err := postgresql.Connect(dbdsn,
+		getDefaultValue(config, "database.postgres.idleconns", "5"),
+		getDefaultValue(config, "database.postgres.maxopenconns", "20"),
+		getDefaultValue(config, "database.postgres.connttl", "300"),
+	)
+	if err != nil {
+		return err
+	}
+	defer gormDB.Close()
+
+	switch command {
+	case MIGRATE_UP:
+		applied, err := postgresql.MigrateUp(gormDB)
+		for _, migration := range applied {
+			fmt.Fprintf(out, "Applied migration %v: %v\n", migration.Version, migration.Description)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(out, "Database schema is up to date")
+		}
+	case MIGRATE_DOWN:
+		reverted, err := postgresql.MigrateDown(gormDB)
+		if err != nil {
+			return err
+		}
+		if reverted == nil {
+			fmt.Fprintln(out, "There aren't migrations to revert")
+		} else {
+			fmt.Fprintf(out, "Reverted migration %v: %v\n", reverted.Version, reverted.Description)
+		}
+	case MIGRATE_STATUS:
+		status, err := postgresql.MigrationsStatus(gormDB)
+		if err != nil {
+			return err
+		}
+		current, err := postgresql.CurrentSchemaVersion(gormDB)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Current version: %v, expected version: %v\n", current, postgresql.LatestSchemaVersion())
+		for _, s := range status {
+			applied := "pending"
+			if s.Applied {
+				applied = "applied at " + s.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Fprintf(out, "%v\t%v\t%v\n", s.Version, s.Description, applied)
+		}
+	default:
+		return errors.New("Invalid migrate command, expected one of: up, down, status")
+	}
+
+	return nil
+}
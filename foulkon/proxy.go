@@ -2,7 +2,12 @@ package foulkon
 
 import (
 	"io"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"errors"
 
@@ -12,8 +17,33 @@ import (
 	"github.com/pelletier/go-toml"
 )
 
+const (
+	// Combinations of resource checks
+	COMBINE_ALL = "all"
+	COMBINE_ANY = "any"
+
+	// Selection of the host of an upstream
+	BALANCE_ROUND_ROBIN       = "round-robin"
+	BALANCE_LEAST_CONNECTIONS = "least-connections"
+
+	// Signing of identity headers
+	IDENTITY_SIGNING_HMAC = "hmac"
+	IDENTITY_SIGNING_JWT  = "jwt"
+
+	// Minimum length of the secret used to sign identity headers
+	MIN_IDENTITY_SECRET_LENGTH = 32
+
+	// Keys of rate limits
+	RATE_LIMIT_KEY_USER = "user"
+	RATE_LIMIT_KEY_IP   = "ip"
+)
+
 var proxyLogfile *os.File
 
+// Functions called when proxy is closed
+var proxyCloseFuncs []func()
+var proxyCloseMutex sync.Mutex
+
 // Proxy - Authorize resources using definitions in proxy config file
 type Proxy struct {
 	// Server config
@@ -22,6 +52,12 @@ type Proxy struct {
 
 	// Worker location
 	WorkerHost string
+	// Secret shared with worker to send proxy context keys. They aren't sent if it is empty
+	WorkerSecret string
+
+	// Time to wait for the worker response, and for the response headers of destination hosts
+	WorkerTimeout   time.Duration
+	ResponseTimeout time.Duration
 
 	// TLS configuration
 	CertFile string
@@ -32,6 +68,24 @@ type Proxy struct {
 
 	// API Resources
 	APIResources []APIResource
+
+	// Time between checks of config file changes to reload resources, disabled if it is 0
+	WatchInterval time.Duration
+
+	// Authorization decisions cache, disabled if size is 0
+	CacheSize int
+	CacheTTL  time.Duration
+
+	// Identity headers sent to destination hosts, signed with the secret. Disabled if secret is empty.
+	IdentitySigning string
+	IdentitySecret  string
+	// Time that a signed identity is valid
+	IdentityTTL time.Duration
+	// Remove credentials of requests sent to destination hosts
+	IdentityStripAuthorization bool
+
+	// Rate limit of all requests, disabled if it is nil
+	RateLimit *RateLimit
 }
 
 // APIResource represents external API resources to authorize
@@ -42,6 +96,49 @@ type APIResource struct {
 	Method string
 	Urn    string
 	Action string
+	// Additional checks, combined with urn and action
+	Checks []ResourceCheck
+	// How checks are combined, all of them or any of them must be allowed. All by default.
+	Combine string
+	// Hosts balanced instead of Host, shared by the resources of a named upstream
+	Upstream *Upstream
+	// Rate limit of the resource requests, disabled if it is nil
+	RateLimit *RateLimit
+}
+
+// Upstream is a group of destination hosts, requests are balanced between the healthy ones
+type Upstream struct {
+	Name  string
+	Hosts []string
+	// How hosts are selected, round-robin by default
+	Balance string
+	// Time to wait for connections and for response headers of hosts, proxy defaults if they are 0
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	// Passive health checks, a host is ejected during FailTimeout after MaxFails consecutive
+	// failed requests. Disabled if MaxFails is 0.
+	MaxFails    int
+	FailTimeout time.Duration
+	// Active health checks, a host is ejected while requests to HealthCheck path fail.
+	// Disabled if HealthCheck is empty.
+	HealthCheck         string
+	HealthCheckInterval time.Duration
+}
+
+// RateLimit is a quota of requests with token bucket semantics. Buckets have up to Burst
+// tokens, and they are refilled with Requests tokens every Period.
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+	// Requests are counted by user or by client IP
+	Key string
+}
+
+// ResourceCheck is an action over an urn that must be authorized to access to a resource
+type ResourceCheck struct {
+	Urn    string
+	Action string
 }
 
 func NewProxy(config *toml.TomlTree) (*Proxy, error) {
@@ -73,24 +170,13 @@ func NewProxy(config *toml.TomlTree) (*Proxy, error) {
 	logger.Infof("Logger type: %v, LogLevel: %v", loggerType, logger.Level.String())
 
 	// API Resources
-	resources := []APIResource{}
-	// Retrieve resource tree from toml config file
-	tree, ok := config.Get("resources").([]*toml.TomlTree)
-	if !ok {
-		err := errors.New("No resources retrieved from file")
+	resources, err := ReadProxyResources(config)
+	if err != nil {
 		logger.Error(err)
 		return nil, err
 	}
-	for _, t := range tree {
-		resources = append(resources, APIResource{
-			Id:     getDefaultValue(t, "id", ""),
-			Host:   getDefaultValue(t, "host", ""),
-			Url:    getDefaultValue(t, "url", ""),
-			Method: getDefaultValue(t, "method", ""),
-			Urn:    getDefaultValue(t, "urn", ""),
-			Action: getDefaultValue(t, "action", ""),
-		})
-		logger.Infof("Added resource %v", getDefaultValue(t, "id", ""))
+	for _, resource := range resources {
+		logger.Infof("Added resource %v", resource.Id)
 	}
 
 	host, err := getMandatoryValue(config, "server.host")
@@ -109,18 +195,226 @@ func NewProxy(config *toml.TomlTree) (*Proxy, error) {
 		return nil, err
 	}
 
+	workerTimeout, err := getTimeoutValue(config, "server.worker-timeout", "10")
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+	responseTimeout, err := getTimeoutValue(config, "server.response-timeout", "30")
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	// Config file watching, disabled if interval is 0
+	watchInterval := getDefaultValue(config, "server.watch-interval", "0")
+	watch, err := strconv.Atoi(watchInterval)
+	if err != nil || watch < 0 {
+		err := fmt.Errorf("Invalid server.watch-interval param: %v", watchInterval)
+		logger.Error(err)
+		return nil, err
+	}
+
+	// Authorization decisions cache, disabled if size is 0
+	cacheSize := getDefaultValue(config, "cache.size", "0")
+	size, err := strconv.Atoi(cacheSize)
+	if err != nil || size < 0 {
+		err := fmt.Errorf("Invalid cache size param: %v", cacheSize)
+		logger.Error(err)
+		return nil, err
+	}
+	cacheTTL := getDefaultValue(config, "cache.ttl", "5")
+	ttl, err := strconv.Atoi(cacheTTL)
+	if err != nil || ttl < 1 {
+		err := fmt.Errorf("Invalid cache ttl param: %v", cacheTTL)
+		logger.Error(err)
+		return nil, err
+	}
+	if size > 0 {
+		logger.Infof("Authorization cache enabled with size %v and TTL %v seconds", size, ttl)
+	}
+
+	// Identity headers, disabled if there isn't secret
+	identitySecret := getDefaultValue(config, "identity.secret", "")
+	if identitySecret != "" && len(identitySecret) < MIN_IDENTITY_SECRET_LENGTH {
+		err := fmt.Errorf("Invalid identity.secret param, it must have at least %v characters", MIN_IDENTITY_SECRET_LENGTH)
+		logger.Error(err)
+		return nil, err
+	}
+	identitySigning := getDefaultValue(config, "identity.signing", IDENTITY_SIGNING_HMAC)
+	if identitySigning != IDENTITY_SIGNING_HMAC && identitySigning != IDENTITY_SIGNING_JWT {
+		err := fmt.Errorf("Invalid identity.signing param: %v", identitySigning)
+		logger.Error(err)
+		return nil, err
+	}
+	identityTTL, err := getTimeoutValue(config, "identity.ttl", "60")
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+	stripAuthorization := getDefaultValue(config, "identity.strip-authorization", "false")
+	strip, err := strconv.ParseBool(stripAuthorization)
+	if err != nil {
+		err := fmt.Errorf("Invalid identity.strip-authorization param: %v", stripAuthorization)
+		logger.Error(err)
+		return nil, err
+	}
+	if identitySecret != "" {
+		logger.Infof("Identity headers enabled with %v signing", identitySigning)
+	}
+
+	// Global rate limit, disabled if it isn't defined
+	rateLimit, err := readRateLimit(config, "ratelimit")
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+	if rateLimit != nil {
+		logger.Infof("Rate limit enabled with %v requests every %v by %v", rateLimit.Requests, rateLimit.Period, rateLimit.Key)
+	}
+
 	return &Proxy{
-		Host:         host,
-		Port:         port,
-		WorkerHost:   workerHost,
-		CertFile:     getDefaultValue(config, "server.certfile", ""),
-		KeyFile:      getDefaultValue(config, "server.keyfile", ""),
-		Logger:       logger,
-		APIResources: resources,
+		Host:            host,
+		Port:            port,
+		WorkerHost:      workerHost,
+		WorkerSecret:    getDefaultValue(config, "server.proxysecret", ""),
+		WorkerTimeout:   workerTimeout,
+		ResponseTimeout: responseTimeout,
+		CertFile:        getDefaultValue(config, "server.certfile", ""),
+		KeyFile:         getDefaultValue(config, "server.keyfile", ""),
+		Logger:          logger,
+		APIResources:    resources,
+		WatchInterval:   time.Duration(watch) * time.Second,
+		CacheSize:       size,
+		CacheTTL:        time.Duration(ttl) * time.Second,
+
+		IdentitySigning:            identitySigning,
+		IdentitySecret:             identitySecret,
+		IdentityTTL:                identityTTL,
+		IdentityStripAuthorization: strip,
+
+		RateLimit: rateLimit,
 	}, nil
 }
 
+// ReadProxyResources retrieves the resources defined in config file, or an error if any of them
+// is invalid. It is used to read them again when config file changes.
+func ReadProxyResources(config *toml.TomlTree) ([]APIResource, error) {
+	resources := []APIResource{}
+	// Named upstreams, shared by the resources that use them
+	upstreams := map[string]*Upstream{}
+	if config.Has("upstreams") {
+		tree, ok := config.Get("upstreams").([]*toml.TomlTree)
+		if !ok {
+			return nil, errors.New("Invalid upstreams retrieved from file")
+		}
+		for _, t := range tree {
+			name := getDefaultValue(t, "name", "")
+			if name == "" || upstreams[name] != nil {
+				return nil, fmt.Errorf("Upstreams must have a unique name, invalid name %v", name)
+			}
+			upstream, err := readUpstream(t, name)
+			if err != nil {
+				return nil, err
+			}
+			upstreams[name] = upstream
+		}
+	}
+
+	// Retrieve resource tree from toml config file
+	tree, ok := config.Get("resources").([]*toml.TomlTree)
+	if !ok {
+		return nil, errors.New("No resources retrieved from file")
+	}
+	ids := map[string]bool{}
+	for _, t := range tree {
+		resource := APIResource{
+			Id:      getDefaultValue(t, "id", ""),
+			Host:    getDefaultValue(t, "host", ""),
+			Url:     getDefaultValue(t, "url", ""),
+			Method:  getDefaultValue(t, "method", ""),
+			Urn:     getDefaultValue(t, "urn", ""),
+			Action:  getDefaultValue(t, "action", ""),
+			Combine: COMBINE_ALL,
+		}
+		if t.Has("checks") {
+			checks, ok := t.Get("checks").([]*toml.TomlTree)
+			if !ok {
+				return nil, fmt.Errorf("Invalid checks in resource %v", resource.Id)
+			}
+			for _, c := range checks {
+				resource.Checks = append(resource.Checks, ResourceCheck{
+					Urn:    getDefaultValue(c, "urn", ""),
+					Action: getDefaultValue(c, "action", ""),
+				})
+			}
+			resource.Combine = getDefaultValue(t, "combine", COMBINE_ALL)
+		}
+
+		// Validate resource
+		if resource.Id == "" || ids[resource.Id] {
+			return nil, fmt.Errorf("Resources must have a unique id, invalid id %v", resource.Id)
+		}
+		ids[resource.Id] = true
+		if resource.Url == "" || resource.Method == "" {
+			return nil, fmt.Errorf("Resource %v must have url and method", resource.Id)
+		}
+		// Destination is a host, a named upstream or several hosts of the resource
+		upstreamName := getDefaultValue(t, "upstream", "")
+		switch {
+		case resource.Host != "" && upstreamName == "" && !t.Has("hosts"):
+			if !isValidHost(resource.Host) {
+				return nil, fmt.Errorf("Invalid host %v in resource %v", resource.Host, resource.Id)
+			}
+		case resource.Host == "" && upstreamName != "" && !t.Has("hosts"):
+			if resource.Upstream = upstreams[upstreamName]; resource.Upstream == nil {
+				return nil, fmt.Errorf("Invalid upstream %v in resource %v", upstreamName, resource.Id)
+			}
+		case resource.Host == "" && upstreamName == "" && t.Has("hosts"):
+			upstream, err := readUpstream(t, resource.Id)
+			if err != nil {
+				return nil, err
+			}
+			resource.Upstream = upstream
+		default:
+			return nil, fmt.Errorf("Resource %v must have one of host, hosts or upstream", resource.Id)
+		}
+		if (resource.Urn == "") != (resource.Action == "") || (resource.Urn == "" && len(resource.Checks) == 0) {
+			return nil, fmt.Errorf("Resource %v must have urn and action, or checks", resource.Id)
+		}
+		for _, check := range resource.Checks {
+			if check.Urn == "" || check.Action == "" {
+				return nil, fmt.Errorf("Checks of resource %v must have urn and action", resource.Id)
+			}
+		}
+		if resource.Combine != COMBINE_ALL && resource.Combine != COMBINE_ANY {
+			return nil, fmt.Errorf("Invalid combine param %v in resource %v", resource.Combine, resource.Id)
+		}
+		rateLimit, err := readRateLimit(t, "ratelimit")
+		if err != nil {
+			return nil, fmt.Errorf("%v in resource %v", err.Error(), resource.Id)
+		}
+		resource.RateLimit = rateLimit
+		resources = append(resources, resource)
+	}
+	return resources, nil
+}
+
+// OnCloseProxy registers a function called by CloseProxy before closing the logger, like a
+// function that closes the connections that server doesn't manage
+func OnCloseProxy(f func()) {
+	proxyCloseMutex.Lock()
+	defer proxyCloseMutex.Unlock()
+	proxyCloseFuncs = append(proxyCloseFuncs, f)
+}
+
 func CloseProxy() int {
+	proxyCloseMutex.Lock()
+	for _, f := range proxyCloseFuncs {
+		f()
+	}
+	proxyCloseMutex.Unlock()
+
 	status := 0
 	if proxyLogfile != nil {
 		if err := proxyLogfile.Close(); err != nil {
@@ -130,3 +424,106 @@ func CloseProxy() int {
 	}
 	return status
 }
+
+// Retrieve an upstream from a table with its hosts and options, like an upstream or a resource table
+func readUpstream(t *toml.TomlTree, name string) (*Upstream, error) {
+	upstream := &Upstream{
+		Name:        name,
+		Balance:     getDefaultValue(t, "balance", BALANCE_ROUND_ROBIN),
+		HealthCheck: getDefaultValue(t, "health-check", ""),
+	}
+	// Hosts are separated by ';', like lists of other config values
+	for _, host := range strings.Split(getDefaultValue(t, "hosts", ""), ";") {
+		if host = strings.TrimSpace(host); host == "" {
+			continue
+		}
+		if !isValidHost(host) {
+			return nil, fmt.Errorf("Invalid host %v in upstream %v", host, name)
+		}
+		upstream.Hosts = append(upstream.Hosts, host)
+	}
+	if len(upstream.Hosts) == 0 {
+		return nil, fmt.Errorf("Upstream %v must have hosts", name)
+	}
+	if upstream.Balance != BALANCE_ROUND_ROBIN && upstream.Balance != BALANCE_LEAST_CONNECTIONS {
+		return nil, fmt.Errorf("Invalid balance param %v in upstream %v", upstream.Balance, name)
+	}
+	if upstream.HealthCheck != "" && !strings.HasPrefix(upstream.HealthCheck, "/") {
+		return nil, fmt.Errorf("Invalid health-check param %v in upstream %v", upstream.HealthCheck, name)
+	}
+
+	var err error
+	durations := []struct {
+		key   string
+		def   string
+		min   int
+		value *time.Duration
+	}{
+		{"connect-timeout", "0", 0, &upstream.ConnectTimeout},
+		{"read-timeout", "0", 0, &upstream.ReadTimeout},
+		{"fail-timeout", "10", 1, &upstream.FailTimeout},
+		{"health-interval", "10", 1, &upstream.HealthCheckInterval},
+	}
+	for _, d := range durations {
+		var seconds int
+		if seconds, err = getIntValue(t, d.key, d.def, d.min); err != nil {
+			return nil, fmt.Errorf("%v in upstream %v", err.Error(), name)
+		}
+		*d.value = time.Duration(seconds) * time.Second
+	}
+	if upstream.MaxFails, err = getIntValue(t, "max-fails", "3", 0); err != nil {
+		return nil, fmt.Errorf("%v in upstream %v", err.Error(), name)
+	}
+	return upstream, nil
+}
+
+// Retrieve the rate limit defined in a table, or nil if it isn't defined
+func readRateLimit(config *toml.TomlTree, key string) (*RateLimit, error) {
+	if !config.Has(key) {
+		return nil, nil
+	}
+	rateLimit := &RateLimit{
+		Key: getDefaultValue(config, key+".key", RATE_LIMIT_KEY_USER),
+	}
+	var err error
+	if rateLimit.Requests, err = getIntValue(config, key+".requests", "0", 1); err != nil {
+		return nil, err
+	}
+	period, err := getIntValue(config, key+".period", "1", 1)
+	if err != nil {
+		return nil, err
+	}
+	rateLimit.Period = time.Duration(period) * time.Second
+	if rateLimit.Burst, err = getIntValue(config, key+".burst", strconv.Itoa(rateLimit.Requests), 1); err != nil {
+		return nil, err
+	}
+	if rateLimit.Key != RATE_LIMIT_KEY_USER && rateLimit.Key != RATE_LIMIT_KEY_IP {
+		return nil, fmt.Errorf("Invalid %v.key param: %v", key, rateLimit.Key)
+	}
+	return rateLimit, nil
+}
+
+// Check that a host is a full URL with scheme and host
+func isValidHost(host string) bool {
+	u, err := url.Parse(host)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
+// Retrieve a timeout in seconds, it must be greater than 0
+func getTimeoutValue(config *toml.TomlTree, key string, def string) (time.Duration, error) {
+	seconds, err := getIntValue(config, key, def, 1)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// Retrieve an integer value, it must be greater or equal than min
+func getIntValue(config *toml.TomlTree, key string, def string, min int) (int, error) {
+	value := getDefaultValue(config, key, def)
+	number, err := strconv.Atoi(value)
+	if err != nil || number < min {
+		return 0, fmt.Errorf("Invalid %v param: %v", key, value)
+	}
+	return number, nil
+}
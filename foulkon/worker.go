@@ -6,16 +6,22 @@ import (
 
 	"errors"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"fmt"
 
+	"crypto/tls"
 	"database/sql"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/Tecsisa/foulkon/api"
 	"github.com/Tecsisa/foulkon/auth"
+	"github.com/Tecsisa/foulkon/database/filedb"
+	"github.com/Tecsisa/foulkon/database/memory"
 	"github.com/Tecsisa/foulkon/database/postgresql"
+	"github.com/Tecsisa/foulkon/webhook"
 	"github.com/pelletier/go-toml"
 )
 
@@ -24,6 +30,7 @@ var rEnvVar, _ = regexp.Compile(`^\$\{(\w+)\}$`)
 var db *sql.DB
 var workerLogfile *os.File
 var logger *log.Logger
+var dispatcher *webhook.Dispatcher
 
 // Worker is the Authorization server.
 type Worker struct {
@@ -34,12 +41,21 @@ type Worker struct {
 	// TLS configuration
 	CertFile string
 	KeyFile  string
+	// Optional server TLS configuration, to request client certificates
+	TLSConfig *tls.Config
+
+	// Secret shared with proxies, the only callers that can send proxy context keys. Disabled if it is empty
+	ProxySecret string
 
 	// APIs
-	UserApi   api.UserAPI
-	GroupApi  api.GroupAPI
-	PolicyApi api.PolicyAPI
-	AuthzApi  api.AuthzAPI
+	UserApi           api.UserAPI
+	GroupApi          api.GroupAPI
+	PolicyApi         api.PolicyAPI
+	AuthzApi          api.AuthzAPI
+	AuditApi          api.AuditAPI
+	ServiceAccountApi api.ServiceAccountAPI
+	// Optional just-in-time provisioning of authenticated users
+	ProvisioningApi api.ProvisioningAPI
 
 	// Logger
 	Logger *log.Logger
@@ -111,9 +127,63 @@ func NewWorker(config *toml.TomlTree) (*Worker, error) {
 			Dbmap: gormDB,
 		}
 		authApi = api.AuthAPI{
-			GroupRepo:  repoDB,
-			UserRepo:   repoDB,
-			PolicyRepo: repoDB,
+			GroupRepo:          repoDB,
+			UserRepo:           repoDB,
+			PolicyRepo:         repoDB,
+			AuditRepo:          repoDB,
+			EventRepo:          repoDB,
+			ServiceAccountRepo: repoDB,
+			TxRepo:             repoDB,
+		}
+
+	case "memory": // In-memory DB
+		repoDB := memory.NewMemoryRepo()
+		seedFile := getDefaultValue(config, "database.memory.seedfile", "")
+		if seedFile != "" {
+			snapshot, err := memory.LoadSnapshotFile(seedFile)
+			if err != nil {
+				logger.Error(err)
+				return nil, err
+			}
+			if err := repoDB.Load(snapshot); err != nil {
+				logger.Error(err)
+				return nil, err
+			}
+			logger.Infof("In-memory database seeded from file %v", seedFile)
+		}
+		logger.Warn("Using in-memory database, data will be lost when worker stops")
+
+		authApi = api.AuthAPI{
+			GroupRepo:          repoDB,
+			UserRepo:           repoDB,
+			PolicyRepo:         repoDB,
+			AuditRepo:          repoDB,
+			EventRepo:          repoDB,
+			ServiceAccountRepo: repoDB,
+			TxRepo:             repoDB,
+		}
+
+	case "file": // File DB
+		path, err := getMandatoryValue(config, "database.file.path")
+		if err != nil {
+			logger.Error(err)
+			return nil, err
+		}
+		repoDB, err := filedb.Open(path)
+		if err != nil {
+			logger.Error(err)
+			return nil, err
+		}
+		logger.Infof("Using file database %v", path)
+
+		authApi = api.AuthAPI{
+			GroupRepo:          repoDB,
+			UserRepo:           repoDB,
+			PolicyRepo:         repoDB,
+			AuditRepo:          repoDB,
+			EventRepo:          repoDB,
+			ServiceAccountRepo: repoDB,
+			TxRepo:             repoDB,
 		}
 
 	default:
@@ -124,33 +194,75 @@ func NewWorker(config *toml.TomlTree) (*Worker, error) {
 
 	authApi.Logger = logger
 
+	// Policy cache, disabled if size is 0
+	cacheSize := getDefaultValue(config, "cache.size", "0")
+	size, err := strconv.Atoi(cacheSize)
+	if err != nil {
+		err := fmt.Errorf("Invalid cache size param: %v", cacheSize)
+		logger.Error(err)
+		return nil, err
+	}
+	cacheTTL := getDefaultValue(config, "cache.ttl", "60")
+	ttl, err := strconv.Atoi(cacheTTL)
+	if err != nil {
+		err := fmt.Errorf("Invalid cache ttl param: %v", cacheTTL)
+		logger.Error(err)
+		return nil, err
+	}
+	authApi.Cache = api.NewPolicyCache(size, time.Duration(ttl)*time.Second)
+	if authApi.Cache != nil {
+		logger.Infof("Policy cache enabled with size %v and TTL %v seconds", size, ttl)
+	}
+
+	// Users created and synced with groups claim when they are authenticated
+	authApi.Provisioning, err = newProvisioning(config)
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+	if authApi.Provisioning != nil {
+		logger.Infof("User provisioning enabled with path %v and %v mapped groups", authApi.Provisioning.Path, len(authApi.Provisioning.Groups))
+	}
+
+	// Webhooks that receive events, published only if there are webhooks
+	dispatcher, err = newDispatcher(config, authApi.EventRepo)
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+	if dispatcher != nil {
+		authApi.EventSinks = dispatcher.Sinks()
+	}
+
 	// Instantiate Auth Connector
-	var authConnector auth.AuthConnector
 	authType, err := getMandatoryValue(config, "authenticator.type")
 	if err != nil {
 		return nil, err
 	}
-	switch authType {
-	case "oidc":
-		issuer, err := getMandatoryValue(config, "authenticator.oidc.issuer")
-		if err != nil {
-			return nil, err
-		}
-		clientsids, err := getMandatoryValue(config, "authenticator.oidc.clientids")
-		if err != nil {
-			return nil, err
-		}
-		authOidcConnector, err := auth.InitOIDCConnector(logger, issuer, strings.Split(clientsids, ";"))
-		if err != nil {
+	var authConnector auth.AuthConnector
+	if authType == "chain" {
+		authConnector, err = newChainConnector(config, authApi)
+	} else {
+		authConnector, err = newAuthConnector(config, authType, "authenticator."+authType+".", authApi)
+	}
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	// Client certificates are requested in TLS handshakes, and verified by connector
+	certFile := getDefaultValue(config, "server.certfile", "")
+	keyFile := getDefaultValue(config, "server.keyfile", "")
+	var tlsConfig *tls.Config
+	if auth.RequiresClientCertificates(authConnector) {
+		if certFile == "" || keyFile == "" {
+			err := errors.New("mTLS connector needs server.certfile and server.keyfile")
 			logger.Error(err)
 			return nil, err
 		}
-		authConnector = authOidcConnector
-		logger.Infof("OIDC connector configured for issuer %v", issuer)
-	default:
-		err := errors.New("Unexpected auth_connector_type value in configuration file (Maybe it is empty)")
-		logger.Error(err)
-		return nil, err
+		tlsConfig = &tls.Config{
+			ClientAuth: tls.RequestClientCert,
+		}
 	}
 
 	adminUser, err := getMandatoryValue(config, "admin.username")
@@ -183,25 +295,43 @@ func NewWorker(config *toml.TomlTree) (*Worker, error) {
 		return nil, err
 	}
 
-	return &Worker{
-		Host:          host,
-		Port:          port,
-		CertFile:      getDefaultValue(config, "server.certfile", ""),
-		KeyFile:       getDefaultValue(config, "server.keyfile", ""),
-		Logger:        logger,
-		Authenticator: authenticator,
-		UserApi:       authApi,
-		GroupApi:      authApi,
-		PolicyApi:     authApi,
-		AuthzApi:      authApi,
-	}, nil
+	if dispatcher != nil {
+		dispatcher.Start()
+		logger.Infof("Event dispatcher started with %v webhooks", len(dispatcher.Webhooks))
+	}
+
+	worker := &Worker{
+		Host:              host,
+		Port:              port,
+		CertFile:          certFile,
+		KeyFile:           keyFile,
+		TLSConfig:         tlsConfig,
+		ProxySecret:       getDefaultValue(config, "server.proxysecret", ""),
+		Logger:            logger,
+		Authenticator:     authenticator,
+		UserApi:           authApi,
+		GroupApi:          authApi,
+		PolicyApi:         authApi,
+		AuthzApi:          authApi,
+		AuditApi:          authApi,
+		ServiceAccountApi: authApi,
+	}
+	if authApi.Provisioning != nil {
+		worker.ProvisioningApi = authApi
+	}
+	return worker, nil
 }
 
 func CloseWorker() int {
 	status := 0
-	if err := db.Close(); err != nil {
-		logger.Errorf("Couldn't close DB connection: %v", err)
-		status = 1
+	if dispatcher != nil {
+		dispatcher.Stop()
+	}
+	if db != nil {
+		if err := db.Close(); err != nil {
+			logger.Errorf("Couldn't close DB connection: %v", err)
+			status = 1
+		}
 	}
 	if workerLogfile != nil {
 		if err := workerLogfile.Close(); err != nil {
@@ -212,6 +342,197 @@ func CloseWorker() int {
 	return status
 }
 
+// This aux method returns the event dispatcher for the webhooks configured, nil if there aren't webhooks
+func newDispatcher(config *toml.TomlTree, repo api.EventRepo) (*webhook.Dispatcher, error) {
+	tree, ok := config.Get("webhooks").([]*toml.TomlTree)
+	if !ok || len(tree) == 0 {
+		return nil, nil
+	}
+	webhooks := []webhook.Webhook{}
+	for _, t := range tree {
+		var events []string
+		if e := getDefaultValue(t, "events", ""); e != "" {
+			events = strings.Split(e, ";")
+		}
+		webhooks = append(webhooks, webhook.Webhook{
+			Name:   getDefaultValue(t, "name", ""),
+			URL:    getDefaultValue(t, "url", ""),
+			Secret: getDefaultValue(t, "secret", ""),
+			Events: events,
+		})
+	}
+	d, err := webhook.NewDispatcher(repo, webhooks, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	// Durations in seconds
+	durations := map[string]*time.Duration{
+		"events.pollinterval": &d.PollInterval,
+		"events.backoff":      &d.Backoff,
+		"events.maxbackoff":   &d.MaxBackoff,
+		"events.timeout":      &d.Client.Timeout,
+	}
+	for key, duration := range durations {
+		value := getDefaultValue(config, key, strconv.Itoa(int(*duration/time.Second)))
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 1 {
+			return nil, fmt.Errorf("Invalid %v param: %v", key, value)
+		}
+		*duration = time.Duration(seconds) * time.Second
+	}
+	numbers := map[string]*int{
+		"events.batchsize":   &d.BatchSize,
+		"events.maxattempts": &d.MaxAttempts,
+	}
+	for key, number := range numbers {
+		value := getDefaultValue(config, key, strconv.Itoa(*number))
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("Invalid %v param: %v", key, value)
+		}
+		*number = n
+	}
+
+	return d, nil
+}
+
+// This aux method returns the provisioning config, nil if it isn't enabled. Groups are mapped with
+// "value=org/name" entries separated by ";"
+func newProvisioning(config *toml.TomlTree) (*api.Provisioning, error) {
+	enabled, err := strconv.ParseBool(getDefaultValue(config, "provisioning.enabled", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid provisioning.enabled param: %v", err)
+	}
+	if !enabled {
+		return nil, nil
+	}
+	p := &api.Provisioning{
+		Path:        getDefaultValue(config, "provisioning.path", "/"),
+		GroupsClaim: getDefaultValue(config, "provisioning.groupsclaim", ""),
+		Groups:      map[string]api.GroupIdentity{},
+	}
+	if !api.IsValidPath(p.Path) {
+		return nil, fmt.Errorf("Invalid provisioning.path param: %v", p.Path)
+	}
+	cacheSize := getDefaultValue(config, "provisioning.cachesize", "1000")
+	if p.CacheSize, err = strconv.Atoi(cacheSize); err != nil || p.CacheSize < 0 {
+		return nil, fmt.Errorf("Invalid provisioning.cachesize param: %v", cacheSize)
+	}
+	cacheTTL := getDefaultValue(config, "provisioning.cachettl", "60")
+	ttl, err := strconv.Atoi(cacheTTL)
+	if err != nil || ttl < 0 {
+		return nil, fmt.Errorf("Invalid provisioning.cachettl param: %v", cacheTTL)
+	}
+	p.CacheTTL = time.Duration(ttl) * time.Second
+	groups := getDefaultValue(config, "provisioning.groups", "")
+	if groups == "" {
+		return p, nil
+	}
+	for _, entry := range strings.Split(groups, ";") {
+		mapping := strings.SplitN(entry, "=", 2)
+		if len(mapping) != 2 {
+			return nil, fmt.Errorf("Invalid provisioning.groups entry: %v", entry)
+		}
+		group := strings.SplitN(mapping[1], "/", 2)
+		if mapping[0] == "" || len(group) != 2 || !api.IsValidOrg(group[0]) || !api.IsValidName(group[1]) {
+			return nil, fmt.Errorf("Invalid provisioning.groups entry: %v", entry)
+		}
+		p.Groups[mapping[0]] = api.GroupIdentity{Org: group[0], Name: group[1]}
+	}
+	return p, nil
+}
+
+// This aux method returns the auth connector of a type, with its config values in keys with prefix
+func newAuthConnector(config *toml.TomlTree, authType string, prefix string, validator auth.APIKeyValidator) (auth.AuthConnector, error) {
+	switch authType {
+	case "oidc":
+		issuer, err := getMandatoryValue(config, prefix+"issuer")
+		if err != nil {
+			return nil, err
+		}
+		clientsids, err := getMandatoryValue(config, prefix+"clientids")
+		if err != nil {
+			return nil, err
+		}
+		mapping := auth.OIDCClaimMapping{
+			UserClaim: getDefaultValue(config, prefix+"userclaim", auth.OIDC_DEFAULT_USER_CLAIM),
+		}
+		if t := getDefaultValue(config, prefix+"usertransforms", ""); t != "" {
+			mapping.UserTransforms = strings.Split(t, ";")
+		}
+		if c := getDefaultValue(config, prefix+"claims", ""); c != "" {
+			mapping.Claims = strings.Split(c, ";")
+		}
+		authOidcConnector, err := auth.InitOIDCConnector(logger, issuer, strings.Split(clientsids, ";"), mapping)
+		if err != nil {
+			return nil, err
+		}
+		logger.Infof("OIDC connector configured for issuer %v, user from %v claim", issuer, mapping.UserClaim)
+		return authOidcConnector, nil
+	case "apikey":
+		logger.Info("API key connector configured for service accounts")
+		return auth.InitAPIKeyConnector(logger, validator), nil
+	case "mtls":
+		caFile, err := getMandatoryValue(config, prefix+"cafile")
+		if err != nil {
+			return nil, err
+		}
+		field := getDefaultValue(config, prefix+"field", auth.MTLS_FIELD_CN)
+		template := getDefaultValue(config, prefix+"template", "{value}")
+		authMTLSConnector, err := auth.InitMTLSConnector(logger, caFile, field, template)
+		if err != nil {
+			return nil, err
+		}
+		logger.Infof("mTLS connector configured with CA file %v, user %v from certificate %v field", caFile, template, field)
+		return authMTLSConnector, nil
+	default:
+		return nil, errors.New("Unexpected auth_connector_type value in configuration file (Maybe it is empty)")
+	}
+}
+
+// This aux method returns a connector that tries the connectors of authenticator.chain in order. Users of
+// each connector are namespaced with its name, except service accounts that are already foulkon users.
+func newChainConnector(config *toml.TomlTree, validator auth.APIKeyValidator) (auth.AuthConnector, error) {
+	tree, ok := config.Get("authenticator.chain").([]*toml.TomlTree)
+	if !ok || len(tree) == 0 {
+		return nil, errors.New("Chain authenticator without connectors in authenticator.chain")
+	}
+	connectors := []auth.ChainedConnector{}
+	for _, t := range tree {
+		name, err := getMandatoryValue(t, "name")
+		if err != nil {
+			return nil, err
+		}
+		authType, err := getMandatoryValue(t, "type")
+		if err != nil {
+			return nil, err
+		}
+		if authType == "chain" {
+			return nil, fmt.Errorf("Invalid connector type in chain connector %v: %v", name, authType)
+		}
+		connector, err := newAuthConnector(t, authType, "", validator)
+		if err != nil {
+			return nil, err
+		}
+		namespace := name
+		if authType == "apikey" {
+			namespace = ""
+		}
+		connectors = append(connectors, auth.ChainedConnector{
+			Name:      name,
+			Namespace: namespace,
+			Connector: connector,
+		})
+	}
+	chain, err := auth.InitChainConnector(logger, connectors)
+	if err != nil {
+		return nil, err
+	}
+	logger.Infof("Chain connector configured with %v connectors", len(connectors))
+	return chain, nil
+}
+
 // This aux method returns mandatory config value or any error occurred
 func getMandatoryValue(config *toml.TomlTree, key string) (string, error) {
 	if !config.Has(key) {
@@ -0,0 +1,75 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Tecsisa/foulkon/api"
+	"github.com/julienschmidt/httprouter"
+)
+
+// RESPONSES
+
+type GetAuditEventsResponse struct {
+	Events []api.AuditEvent `json:"events"`
+	Limit  int              `json:"limit"`
+	Offset int              `json:"offset"`
+	Total  int              `json:"total"`
+}
+
+// HANDLERS
+
+func (h *WorkerHandler) HandleListAuditEvents(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Process request
+	requestInfo, filterData, apiErr := h.processHttpRequest(r, w, ps, nil)
+	if apiErr != nil {
+		h.RespondBadRequest(r, requestInfo, w, apiErr)
+		return
+	}
+	filter, apiErr := getAuditFilter(r, filterData)
+	if apiErr != nil {
+		api.LogErrorMessage(h.worker.Logger, requestInfo, apiErr)
+		h.RespondBadRequest(r, requestInfo, w, apiErr)
+		return
+	}
+
+	// Call audit API to list events
+	result, total, err := h.worker.AuditApi.ListAuditEvents(requestInfo, filter)
+	// Create response
+	response := &GetAuditEventsResponse{
+		Events: result,
+		Offset: filter.Offset,
+		Limit:  filter.Limit,
+		Total:  total,
+	}
+	h.processHttpResponse(r, w, requestInfo, response, err, http.StatusOK)
+}
+
+// PRIVATE HELPER METHODS
+
+// Retrieve audit filter from query params, dates must have RFC3339 format
+func getAuditFilter(r *http.Request, filterData *api.Filter) (*api.AuditFilter, *api.Error) {
+	filter := &api.AuditFilter{
+		Actor:  r.URL.Query().Get("Actor"),
+		Urn:    r.URL.Query().Get("Urn"),
+		Action: r.URL.Query().Get("Action"),
+		Offset: filterData.Offset,
+		Limit:  filterData.Limit,
+	}
+	for param, date := range map[string]*time.Time{"From": &filter.From, "To": &filter.To} {
+		value := r.URL.Query().Get(param)
+		if len(value) == 0 {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, &api.Error{
+				Code:    api.INVALID_PARAMETER_ERROR,
+				Message: fmt.Sprintf("Invalid parameter: %v %v", param, value),
+			}
+		}
+		*date = parsed.UTC()
+	}
+	return filter, nil
+}
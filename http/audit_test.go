@@ -0,0 +1,193 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Tecsisa/foulkon/api"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestWorkerHandler_HandleListAuditEvents(t *testing.T) {
+	now := time.Date(2016, time.October, 1, 10, 0, 0, 0, time.UTC)
+	state := json.RawMessage(`{"externalId":"user1"}`)
+	testcases := map[string]struct {
+		// API method args
+		queryParams map[string]string
+		// Expected result
+		expectedStatusCode int
+		expectedResponse   GetAuditEventsResponse
+		expectedFilter     *api.AuditFilter
+		expectedError      api.Error
+		// Manager Results
+		listAuditEventsResult []api.AuditEvent
+		totalResult           int
+		// Manager Errors
+		listAuditEventsErr error
+	}{
+		"OkCase": {
+			queryParams: map[string]string{
+				"Actor":  "admin",
+				"Urn":    "urn:iws:iam::user/user1",
+				"Action": api.USER_ACTION_CREATE_USER,
+				"From":   "2016-10-01T09:00:00Z",
+				"To":     "2016-10-01T12:00:00+02:00",
+				"Offset": "0",
+				"Limit":  "20",
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedResponse: GetAuditEventsResponse{
+				Events: []api.AuditEvent{
+					{
+						ID:        "AuditEventID",
+						Actor:     "admin",
+						RequestID: "RequestID",
+						Action:    api.USER_ACTION_CREATE_USER,
+						Urn:       "urn:iws:iam::user/user1",
+						CreateAt:  now,
+						After:     &state,
+					},
+				},
+				Limit: 20,
+				Total: 1,
+			},
+			expectedFilter: &api.AuditFilter{
+				Actor:  "admin",
+				Urn:    "urn:iws:iam::user/user1",
+				Action: api.USER_ACTION_CREATE_USER,
+				From:   now.Add(-time.Hour),
+				To:     now,
+				Limit:  20,
+			},
+			listAuditEventsResult: []api.AuditEvent{
+				{
+					ID:        "AuditEventID",
+					Actor:     "admin",
+					RequestID: "RequestID",
+					Action:    api.USER_ACTION_CREATE_USER,
+					Urn:       "urn:iws:iam::user/user1",
+					CreateAt:  now,
+					After:     &state,
+				},
+			},
+			totalResult: 1,
+		},
+		"ErrorCaseInvalidDate": {
+			queryParams: map[string]string{
+				"From": "yesterday",
+			},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedError: api.Error{
+				Code:    api.INVALID_PARAMETER_ERROR,
+				Message: "Invalid parameter: From yesterday",
+			},
+		},
+		"ErrorCaseInvalidLimit": {
+			queryParams: map[string]string{
+				"Limit": "-1",
+			},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedError: api.Error{
+				Code:    api.INVALID_PARAMETER_ERROR,
+				Message: "Invalid parameter: Limit -1",
+			},
+		},
+		"ErrorCaseUnauthorizedError": {
+			expectedStatusCode: http.StatusForbidden,
+			expectedError: api.Error{
+				Code:    api.UNAUTHORIZED_RESOURCES_ERROR,
+				Message: "Error",
+			},
+			listAuditEventsErr: &api.Error{
+				Code:    api.UNAUTHORIZED_RESOURCES_ERROR,
+				Message: "Error",
+			},
+		},
+		"ErrorCaseInvalidParameterError": {
+			expectedStatusCode: http.StatusBadRequest,
+			expectedError: api.Error{
+				Code:    api.INVALID_PARAMETER_ERROR,
+				Message: "Error",
+			},
+			listAuditEventsErr: &api.Error{
+				Code:    api.INVALID_PARAMETER_ERROR,
+				Message: "Error",
+			},
+		},
+		"ErrorCaseUnknownApiError": {
+			expectedStatusCode: http.StatusInternalServerError,
+			listAuditEventsErr: &api.Error{
+				Code:    api.UNKNOWN_API_ERROR,
+				Message: "Error",
+			},
+		},
+	}
+
+	client := http.DefaultClient
+
+	for n, test := range testcases {
+
+		testApi.ArgsOut[ListAuditEventsMethod][0] = test.listAuditEventsResult
+		testApi.ArgsOut[ListAuditEventsMethod][1] = test.totalResult
+		testApi.ArgsOut[ListAuditEventsMethod][2] = test.listAuditEventsErr
+
+		req, err := http.NewRequest(http.MethodGet, server.URL+AUDIT_URL, nil)
+		if err != nil {
+			t.Errorf("Test case %v. Unexpected error creating http request %v", n, err)
+			continue
+		}
+		q := req.URL.Query()
+		for param, value := range test.queryParams {
+			q.Add(param, value)
+		}
+		req.URL.RawQuery = q.Encode()
+
+		res, err := client.Do(req)
+		if err != nil {
+			t.Errorf("Test case %v. Unexpected error calling server %v", n, err)
+			continue
+		}
+
+		// check status code
+		if test.expectedStatusCode != res.StatusCode {
+			t.Errorf("Test case %v. Received different http status code (wanted:%v / received:%v)", n, test.expectedStatusCode, res.StatusCode)
+			continue
+		}
+
+		switch res.StatusCode {
+		case http.StatusOK:
+			// Check received filter
+			if diff := pretty.Compare(testApi.ArgsIn[ListAuditEventsMethod][1], test.expectedFilter); diff != "" {
+				t.Errorf("Test %v failed. Received different filter (received/wanted) %v", n, diff)
+				continue
+			}
+			response := GetAuditEventsResponse{}
+			err = json.NewDecoder(res.Body).Decode(&response)
+			if err != nil {
+				t.Errorf("Test case %v. Unexpected error parsing response %v", n, err)
+				continue
+			}
+			// Check result
+			if diff := pretty.Compare(response, test.expectedResponse); diff != "" {
+				t.Errorf("Test %v failed. Received different responses (received/wanted) %v", n, diff)
+				continue
+			}
+		case http.StatusInternalServerError: // Empty message so continue
+			continue
+		default:
+			apiError := api.Error{}
+			err = json.NewDecoder(res.Body).Decode(&apiError)
+			if err != nil {
+				t.Errorf("Test case %v. Unexpected error parsing error response %v", n, err)
+				continue
+			}
+			// Check result
+			if diff := pretty.Compare(apiError, test.expectedError); diff != "" {
+				t.Errorf("Test %v failed. Received different error response (received/wanted) %v", n, diff)
+				continue
+			}
+		}
+	}
+}
@@ -3,14 +3,28 @@ package http
 import (
 	"net/http"
 
+	"github.com/Tecsisa/foulkon/api"
 	"github.com/julienschmidt/httprouter"
 )
 
 // REQUESTS
 
 type AuthorizeResourcesRequest struct {
-	Action    string   `json:"action, omitempty"`
-	Resources []string `json:"resources, omitempty"`
+	Action    string            `json:"action, omitempty"`
+	Resources []string          `json:"resources, omitempty"`
+	Context   map[string]string `json:"context,omitempty"`
+}
+
+type AuthorizeResourcesBatchRequest struct {
+	Checks  []api.AuthorizationCheck `json:"checks"`
+	Context map[string]string        `json:"context,omitempty"`
+}
+
+type ExplainAuthorizedResourcesRequest struct {
+	ExternalID string            `json:"externalId"`
+	Action     string            `json:"action"`
+	Resources  []string          `json:"resources"`
+	Context    map[string]string `json:"context,omitempty"`
 }
 
 // RESPONSES
@@ -19,6 +33,14 @@ type AuthorizeResourcesResponse struct {
 	ResourcesAllowed []string `json:"resourcesAllowed, omitempty"`
 }
 
+type AuthorizeResourcesBatchResponse struct {
+	Results []api.AuthorizationResult `json:"results"`
+}
+
+type SimulatePolicyResponse struct {
+	Results []api.SimulationResult `json:"results"`
+}
+
 // HANDLERS
 
 func (h *WorkerHandler) HandleGetAuthorizedExternalResources(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
@@ -31,10 +53,92 @@ func (h *WorkerHandler) HandleGetAuthorizedExternalResources(w http.ResponseWrit
 		return
 	}
 
+	// Add context keys received to evaluate conditions
+	if err := api.AreValidRequestContext(request.Context, h.isProxyRequest(r)); err != nil {
+		h.processHttpResponse(r, w, requestInfo, nil, err, http.StatusOK)
+		return
+	}
+	for key, value := range request.Context {
+		requestInfo.Context[key] = value
+	}
+
 	// Retrieve allowed resources
 	result, err := h.worker.AuthzApi.GetAuthorizedExternalResources(requestInfo, request.Action, request.Resources)
 	response := AuthorizeResourcesResponse{
 		ResourcesAllowed: result,
 	}
+	w.Header().Set(AUTHENTICATED_USER_HEADER, requestInfo.Identifier)
+	h.processHttpResponse(r, w, requestInfo, response, err, http.StatusOK)
+}
+
+func (h *WorkerHandler) HandleGetAuthorizedExternalResourcesBatch(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	// Process request
+	request := &AuthorizeResourcesBatchRequest{}
+	requestInfo, _, apiErr := h.processHttpRequest(r, w, nil, request)
+	if apiErr != nil {
+		h.RespondBadRequest(r, requestInfo, w, apiErr)
+		return
+	}
+
+	// Add context keys received to evaluate conditions
+	if err := api.AreValidRequestContext(request.Context, h.isProxyRequest(r)); err != nil {
+		h.processHttpResponse(r, w, requestInfo, nil, err, http.StatusOK)
+		return
+	}
+	for key, value := range request.Context {
+		requestInfo.Context[key] = value
+	}
+
+	// Retrieve authorization of each action and resource
+	result, err := h.worker.AuthzApi.GetAuthorizedExternalResourcesBatch(requestInfo, request.Checks)
+	response := AuthorizeResourcesBatchResponse{
+		Results: result,
+	}
+	w.Header().Set(AUTHENTICATED_USER_HEADER, requestInfo.Identifier)
+	h.processHttpResponse(r, w, requestInfo, response, err, http.StatusOK)
+}
+
+func (h *WorkerHandler) HandleExplainAuthorizedExternalResources(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	// Process request
+	request := &ExplainAuthorizedResourcesRequest{}
+	requestInfo, _, apiErr := h.processHttpRequest(r, w, nil, request)
+	if apiErr != nil {
+		h.RespondBadRequest(r, requestInfo, w, apiErr)
+		return
+	}
+
+	// Retrieve explanation
+	response, err := h.worker.AuthzApi.ExplainAuthorizedExternalResources(requestInfo, request.ExternalID, request.Action,
+		request.Resources, request.Context)
+	h.processHttpResponse(r, w, requestInfo, response, err, http.StatusOK)
+}
+
+func (h *WorkerHandler) HandleSimulatePolicy(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	// Process request
+	request := &api.PolicySimulation{}
+	requestInfo, _, apiErr := h.processHttpRequest(r, w, nil, request)
+	if apiErr != nil {
+		h.RespondBadRequest(r, requestInfo, w, apiErr)
+		return
+	}
+
+	// Simulate policy
+	result, err := h.worker.AuthzApi.SimulatePolicy(requestInfo, *request)
+	response := SimulatePolicyResponse{
+		Results: result,
+	}
+	h.processHttpResponse(r, w, requestInfo, response, err, http.StatusOK)
+}
+
+func (h *WorkerHandler) HandleGetCacheStats(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	// Process request
+	requestInfo, _, apiErr := h.processHttpRequest(r, w, nil, nil)
+	if apiErr != nil {
+		h.RespondBadRequest(r, requestInfo, w, apiErr)
+		return
+	}
+
+	// Retrieve statistics
+	response, err := h.worker.AuthzApi.GetCacheStats(requestInfo)
 	h.processHttpResponse(r, w, requestInfo, response, err, http.StatusOK)
 }
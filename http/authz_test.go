@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/Tecsisa/foulkon/api"
+	"github.com/Tecsisa/foulkon/auth"
 	"github.com/kylelemons/godebug/pretty"
 )
 
@@ -14,9 +16,15 @@ func TestWorkerHandler_HandleGetAuthorizedExternalResources(t *testing.T) {
 	testcases := map[string]struct {
 		// API method args
 		request *AuthorizeResourcesRequest
+		// Secret sent by proxies
+		proxySecret string
+		// Claims set by connector and sent by client
+		connectorClaims string
+		clientClaims    string
 		// Expected result
 		expectedStatusCode int
 		expectedResponse   AuthorizeResourcesResponse
+		expectedClaims     map[string]string
 		expectedError      api.Error
 		// Manager Results
 		getAuthorizedExternalResourcesResult []string
@@ -34,6 +42,93 @@ func TestWorkerHandler_HandleGetAuthorizedExternalResources(t *testing.T) {
 			},
 			getAuthorizedExternalResourcesResult: []string{"resource1", "resource2"},
 		},
+		"OkCaseWithContext": {
+			request: &AuthorizeResourcesRequest{
+				Resources: []string{},
+				Action:    api.USER_ACTION_GET_USER,
+				Context: map[string]string{
+					"proxy:Tenant": "tenant1",
+				},
+			},
+			proxySecret:        "proxysecret",
+			expectedStatusCode: http.StatusOK,
+			expectedResponse: AuthorizeResourcesResponse{
+				ResourcesAllowed: []string{"resource1"},
+			},
+			getAuthorizedExternalResourcesResult: []string{"resource1"},
+		},
+		"ErrorCaseProxyContextKeyWithoutSecret": {
+			request: &AuthorizeResourcesRequest{
+				Resources: []string{},
+				Action:    api.USER_ACTION_GET_USER,
+				Context: map[string]string{
+					"proxy:SourceIp": "127.0.0.1",
+				},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedError: api.Error{
+				Code:    api.INVALID_PARAMETER_ERROR,
+				Message: "Invalid parameter: context key proxy:SourceIp uses prefix proxy: only allowed for proxies",
+			},
+		},
+		"ErrorCaseProxyContextKeyWithInvalidSecret": {
+			request: &AuthorizeResourcesRequest{
+				Resources: []string{},
+				Action:    api.USER_ACTION_GET_USER,
+				Context: map[string]string{
+					"proxy:SourceIp": "127.0.0.1",
+				},
+			},
+			proxySecret:        "invalid",
+			expectedStatusCode: http.StatusBadRequest,
+			expectedError: api.Error{
+				Code:    api.INVALID_PARAMETER_ERROR,
+				Message: "Invalid parameter: context key proxy:SourceIp uses prefix proxy: only allowed for proxies",
+			},
+		},
+		"OkCaseWithClaims": {
+			request: &AuthorizeResourcesRequest{
+				Resources: []string{},
+				Action:    api.USER_ACTION_GET_USER,
+			},
+			connectorClaims:    `{"groups":",admins,devs,","tenant":"tenant1"}`,
+			expectedStatusCode: http.StatusOK,
+			expectedResponse: AuthorizeResourcesResponse{
+				ResourcesAllowed: []string{"resource1"},
+			},
+			expectedClaims: map[string]string{
+				"foulkon:Claim-groups": ",admins,devs,",
+				"foulkon:Claim-tenant": "tenant1",
+			},
+			getAuthorizedExternalResourcesResult: []string{"resource1"},
+		},
+		"OkCaseClaimsSentByClientIgnored": {
+			request: &AuthorizeResourcesRequest{
+				Resources: []string{},
+				Action:    api.USER_ACTION_GET_USER,
+			},
+			clientClaims:       `{"groups":",admins,"}`,
+			expectedStatusCode: http.StatusOK,
+			expectedResponse: AuthorizeResourcesResponse{
+				ResourcesAllowed: []string{"resource1"},
+			},
+			expectedClaims:                       map[string]string{},
+			getAuthorizedExternalResourcesResult: []string{"resource1"},
+		},
+		"ErrorCaseReservedContextKey": {
+			request: &AuthorizeResourcesRequest{
+				Resources: []string{},
+				Action:    api.USER_ACTION_GET_USER,
+				Context: map[string]string{
+					api.CONTEXT_KEY_SOURCE_IP: "127.0.0.1",
+				},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedError: api.Error{
+				Code:    api.INVALID_PARAMETER_ERROR,
+				Message: "Invalid parameter: context key foulkon:SourceIp uses reserved prefix foulkon:",
+			},
+		},
 		"ErrorCaseMalformedRequest": {
 			expectedStatusCode: http.StatusBadRequest,
 			expectedError: api.Error{
@@ -108,8 +203,16 @@ func TestWorkerHandler_HandleGetAuthorizedExternalResources(t *testing.T) {
 			t.Errorf("Test case %v. Unexpected error creating http request %v", n, err)
 			continue
 		}
+		if test.proxySecret != "" {
+			req.Header.Set(PROXY_SECRET_HEADER, test.proxySecret)
+		}
+		if test.clientClaims != "" {
+			req.Header.Set(auth.CLAIMS_HEADER, test.clientClaims)
+		}
 
+		authConnector.claims = test.connectorClaims
 		res, err := client.Do(req)
+		authConnector.claims = ""
 		if err != nil {
 			t.Errorf("Test case %v. Unexpected error calling server %v", n, err)
 			continue
@@ -134,6 +237,778 @@ func TestWorkerHandler_HandleGetAuthorizedExternalResources(t *testing.T) {
 				t.Errorf("Test %v failed. Received different responses (received/wanted) %v", n, diff)
 				continue
 			}
+			// Check authenticated user sent to proxy
+			if user := res.Header.Get(AUTHENTICATED_USER_HEADER); user != testApi.ArgsIn[GetAuthorizedExternalResourcesMethod][0].(api.RequestInfo).Identifier {
+				t.Errorf("Test %v failed. Received different authenticated user %v", n, user)
+				continue
+			}
+			// Check context received by API
+			requestInfo := testApi.ArgsIn[GetAuthorizedExternalResourcesMethod][0].(api.RequestInfo)
+			if _, ok := requestInfo.Context[api.CONTEXT_KEY_CURRENT_TIME]; !ok {
+				t.Errorf("Test %v failed. Context key %v not received", n, api.CONTEXT_KEY_CURRENT_TIME)
+				continue
+			}
+			for key, value := range test.request.Context {
+				if requestInfo.Context[key] != value {
+					t.Errorf("Test %v failed. Received different context value for key %v (wanted:%v / received:%v)",
+						n, key, value, requestInfo.Context[key])
+				}
+			}
+			if test.expectedClaims != nil {
+				claims := map[string]string{}
+				for key, value := range requestInfo.Context {
+					if strings.HasPrefix(key, api.CONTEXT_KEY_CLAIM_PREFIX) {
+						claims[key] = value
+					}
+				}
+				if diff := pretty.Compare(claims, test.expectedClaims); diff != "" {
+					t.Errorf("Test %v failed. Received different claims in context (received/wanted) %v", n, diff)
+				}
+			}
+		case http.StatusInternalServerError: // Empty message so continue
+			continue
+		default:
+			apiError := api.Error{}
+			err = json.NewDecoder(res.Body).Decode(&apiError)
+			if err != nil {
+				t.Errorf("Test case %v. Unexpected error parsing error response %v", n, err)
+				continue
+			}
+			// Check result
+			if diff := pretty.Compare(apiError, test.expectedError); diff != "" {
+				t.Errorf("Test %v failed. Received different error response (received/wanted) %v", n, diff)
+				continue
+			}
+		}
+	}
+}
+
+func TestWorkerHandler_HandleGetAuthorizedExternalResourcesBatch(t *testing.T) {
+	checks := []api.AuthorizationCheck{
+		{
+			Action:    "example:Read",
+			Resources: []string{"urn:ews:product:instance:example/resource1"},
+		},
+		{
+			Action:    "example:Write",
+			Resources: []string{"urn:ews:product:instance:example/resource1"},
+		},
+	}
+	testcases := map[string]struct {
+		// API method args
+		request *AuthorizeResourcesBatchRequest
+		// Secret sent by proxies
+		proxySecret string
+		// Expected result
+		expectedStatusCode int
+		expectedResponse   AuthorizeResourcesBatchResponse
+		expectedError      api.Error
+		// Manager Results
+		getAuthorizedExternalResourcesBatchResult []api.AuthorizationResult
+		// Manager Errors
+		getAuthorizedExternalResourcesBatchErr error
+	}{
+		"OkCase": {
+			request: &AuthorizeResourcesBatchRequest{
+				Checks: checks,
+				Context: map[string]string{
+					"proxy:Tenant": "tenant1",
+				},
+			},
+			proxySecret:        "proxysecret",
+			expectedStatusCode: http.StatusOK,
+			expectedResponse: AuthorizeResourcesBatchResponse{
+				Results: []api.AuthorizationResult{
+					{
+						Action:  "example:Read",
+						Urn:     "urn:ews:product:instance:example/resource1",
+						Allowed: true,
+					},
+					{
+						Action: "example:Write",
+						Urn:    "urn:ews:product:instance:example/resource1",
+					},
+				},
+			},
+			getAuthorizedExternalResourcesBatchResult: []api.AuthorizationResult{
+				{
+					Action:  "example:Read",
+					Urn:     "urn:ews:product:instance:example/resource1",
+					Allowed: true,
+				},
+				{
+					Action: "example:Write",
+					Urn:    "urn:ews:product:instance:example/resource1",
+				},
+			},
+		},
+		"ErrorCaseReservedContextKey": {
+			request: &AuthorizeResourcesBatchRequest{
+				Checks: checks,
+				Context: map[string]string{
+					api.CONTEXT_KEY_SOURCE_IP: "127.0.0.1",
+				},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedError: api.Error{
+				Code:    api.INVALID_PARAMETER_ERROR,
+				Message: "Invalid parameter: context key foulkon:SourceIp uses reserved prefix foulkon:",
+			},
+		},
+		"ErrorCaseProxyContextKeyWithoutSecret": {
+			request: &AuthorizeResourcesBatchRequest{
+				Checks: checks,
+				Context: map[string]string{
+					"proxy:Method": "GET",
+				},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedError: api.Error{
+				Code:    api.INVALID_PARAMETER_ERROR,
+				Message: "Invalid parameter: context key proxy:Method uses prefix proxy: only allowed for proxies",
+			},
+		},
+		"ErrorCaseMalformedRequest": {
+			expectedStatusCode: http.StatusBadRequest,
+			expectedError: api.Error{
+				Code:    api.INVALID_PARAMETER_ERROR,
+				Message: "EOF",
+			},
+		},
+		"ErrorCaseInvalidParameter": {
+			request: &AuthorizeResourcesBatchRequest{
+				Checks: checks,
+			},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedError: api.Error{
+				Code:    api.INVALID_PARAMETER_ERROR,
+				Message: "Error",
+			},
+			getAuthorizedExternalResourcesBatchErr: &api.Error{
+				Code:    api.INVALID_PARAMETER_ERROR,
+				Message: "Error",
+			},
+		},
+		"ErrorCaseUnauthorizedError": {
+			request: &AuthorizeResourcesBatchRequest{
+				Checks: checks,
+			},
+			expectedStatusCode: http.StatusForbidden,
+			expectedError: api.Error{
+				Code:    api.UNAUTHORIZED_RESOURCES_ERROR,
+				Message: "Error",
+			},
+			getAuthorizedExternalResourcesBatchErr: &api.Error{
+				Code:    api.UNAUTHORIZED_RESOURCES_ERROR,
+				Message: "Error",
+			},
+		},
+		"ErrorCaseUnknownApiError": {
+			request: &AuthorizeResourcesBatchRequest{
+				Checks: checks,
+			},
+			expectedStatusCode: http.StatusInternalServerError,
+			getAuthorizedExternalResourcesBatchErr: &api.Error{
+				Code:    api.UNKNOWN_API_ERROR,
+				Message: "Error",
+			},
+		},
+	}
+
+	client := http.DefaultClient
+
+	for n, test := range testcases {
+
+		testApi.ArgsOut[GetAuthorizedExternalResourcesBatchMethod][0] = test.getAuthorizedExternalResourcesBatchResult
+		testApi.ArgsOut[GetAuthorizedExternalResourcesBatchMethod][1] = test.getAuthorizedExternalResourcesBatchErr
+
+		var body *bytes.Buffer
+		if test.request != nil {
+			jsonObject, err := json.Marshal(test.request)
+			if err != nil {
+				t.Errorf("Test case %v. Unexpected marshalling api request %v", n, err)
+				continue
+			}
+			body = bytes.NewBuffer(jsonObject)
+		}
+		if body == nil {
+			body = bytes.NewBuffer([]byte{})
+		}
+		req, err := http.NewRequest(http.MethodPost, server.URL+RESOURCE_BATCH_URL, body)
+		if err != nil {
+			t.Errorf("Test case %v. Unexpected error creating http request %v", n, err)
+			continue
+		}
+		if test.proxySecret != "" {
+			req.Header.Set(PROXY_SECRET_HEADER, test.proxySecret)
+		}
+
+		res, err := client.Do(req)
+		if err != nil {
+			t.Errorf("Test case %v. Unexpected error calling server %v", n, err)
+			continue
+		}
+
+		// check status code
+		if test.expectedStatusCode != res.StatusCode {
+			t.Errorf("Test case %v. Received different http status code (wanted:%v / received:%v)", n, test.expectedStatusCode, res.StatusCode)
+			continue
+		}
+
+		switch res.StatusCode {
+		case http.StatusOK:
+			batchResponse := AuthorizeResourcesBatchResponse{}
+			err = json.NewDecoder(res.Body).Decode(&batchResponse)
+			if err != nil {
+				t.Errorf("Test case %v. Unexpected error parsing response %v", n, err)
+				continue
+			}
+			// Check result
+			if diff := pretty.Compare(batchResponse, test.expectedResponse); diff != "" {
+				t.Errorf("Test %v failed. Received different responses (received/wanted) %v", n, diff)
+				continue
+			}
+			// Check authenticated user sent to proxy
+			if user := res.Header.Get(AUTHENTICATED_USER_HEADER); user != testApi.ArgsIn[GetAuthorizedExternalResourcesBatchMethod][0].(api.RequestInfo).Identifier {
+				t.Errorf("Test %v failed. Received different authenticated user %v", n, user)
+				continue
+			}
+			// Check parameters received by API
+			if diff := pretty.Compare(testApi.ArgsIn[GetAuthorizedExternalResourcesBatchMethod][1], test.request.Checks); diff != "" {
+				t.Errorf("Test %v failed. Received different checks (received/wanted) %v", n, diff)
+				continue
+			}
+			requestInfo := testApi.ArgsIn[GetAuthorizedExternalResourcesBatchMethod][0].(api.RequestInfo)
+			for key, value := range test.request.Context {
+				if requestInfo.Context[key] != value {
+					t.Errorf("Test %v failed. Received different context value for key %v (wanted:%v / received:%v)",
+						n, key, value, requestInfo.Context[key])
+				}
+			}
+		case http.StatusInternalServerError: // Empty message so continue
+			continue
+		default:
+			apiError := api.Error{}
+			err = json.NewDecoder(res.Body).Decode(&apiError)
+			if err != nil {
+				t.Errorf("Test case %v. Unexpected error parsing error response %v", n, err)
+				continue
+			}
+			// Check result
+			if diff := pretty.Compare(apiError, test.expectedError); diff != "" {
+				t.Errorf("Test %v failed. Received different error response (received/wanted) %v", n, diff)
+				continue
+			}
+		}
+	}
+}
+
+func TestWorkerHandler_HandleExplainAuthorizedExternalResources(t *testing.T) {
+	testcases := map[string]struct {
+		// API method args
+		request *ExplainAuthorizedResourcesRequest
+		// Expected result
+		expectedStatusCode int
+		expectedResponse   *api.AuthorizationExplanation
+		expectedError      api.Error
+		// Manager Results
+		explainAuthorizedExternalResourcesResult *api.AuthorizationExplanation
+		// Manager Errors
+		explainAuthorizedExternalResourcesErr error
+	}{
+		"OkCase": {
+			request: &ExplainAuthorizedResourcesRequest{
+				ExternalID: "user1",
+				Action:     "example:Read",
+				Resources:  []string{"urn:ews:example:instance1:resource/res1"},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedResponse: &api.AuthorizationExplanation{
+				ExternalID: "user1",
+				Action:     "example:Read",
+				Groups:     []string{"urn:iws:iam:org1:group/path/group1"},
+				Policies:   []string{"urn:iws:iam:org1:policy/path/policy1"},
+				Restrictions: &api.Restrictions{
+					AllowedUrnPrefixes: []string{},
+					AllowedFullUrns:    []string{},
+					DeniedUrnPrefixes:  []string{"urn:ews:example:instance1:resource/*"},
+					DeniedFullUrns:     []string{},
+				},
+				Resources: []api.ResourceExplanation{
+					{
+						Urn:      "urn:ews:example:instance1:resource/res1",
+						Decision: api.DECISION_EXPLICIT_DENY,
+						Statements: []api.MatchedStatement{
+							{
+								Group:  "urn:iws:iam:org1:group/path/group1",
+								Policy: "urn:iws:iam:org1:policy/path/policy1",
+								Statement: api.Statement{
+									Effect:    "deny",
+									Actions:   []string{"example:Read"},
+									Resources: []string{"urn:ews:example:instance1:resource/*"},
+								},
+								ConditionsMatched: true,
+							},
+						},
+						DeniedBy: "urn:ews:example:instance1:resource/*",
+					},
+				},
+			},
+			explainAuthorizedExternalResourcesResult: &api.AuthorizationExplanation{
+				ExternalID: "user1",
+				Action:     "example:Read",
+				Groups:     []string{"urn:iws:iam:org1:group/path/group1"},
+				Policies:   []string{"urn:iws:iam:org1:policy/path/policy1"},
+				Restrictions: &api.Restrictions{
+					AllowedUrnPrefixes: []string{},
+					AllowedFullUrns:    []string{},
+					DeniedUrnPrefixes:  []string{"urn:ews:example:instance1:resource/*"},
+					DeniedFullUrns:     []string{},
+				},
+				Resources: []api.ResourceExplanation{
+					{
+						Urn:      "urn:ews:example:instance1:resource/res1",
+						Decision: api.DECISION_EXPLICIT_DENY,
+						Statements: []api.MatchedStatement{
+							{
+								Group:  "urn:iws:iam:org1:group/path/group1",
+								Policy: "urn:iws:iam:org1:policy/path/policy1",
+								Statement: api.Statement{
+									Effect:    "deny",
+									Actions:   []string{"example:Read"},
+									Resources: []string{"urn:ews:example:instance1:resource/*"},
+								},
+								ConditionsMatched: true,
+							},
+						},
+						DeniedBy: "urn:ews:example:instance1:resource/*",
+					},
+				},
+			},
+		},
+		"ErrorCaseMalformedRequest": {
+			expectedStatusCode: http.StatusBadRequest,
+			expectedError: api.Error{
+				Code:    api.INVALID_PARAMETER_ERROR,
+				Message: "EOF",
+			},
+		},
+		"ErrorCaseUnauthorizedError": {
+			request: &ExplainAuthorizedResourcesRequest{
+				ExternalID: "user1",
+				Action:     "example:Read",
+				Resources:  []string{"urn:ews:example:instance1:resource/res1"},
+			},
+			expectedStatusCode: http.StatusForbidden,
+			expectedError: api.Error{
+				Code:    api.UNAUTHORIZED_RESOURCES_ERROR,
+				Message: "Error",
+			},
+			explainAuthorizedExternalResourcesErr: &api.Error{
+				Code:    api.UNAUTHORIZED_RESOURCES_ERROR,
+				Message: "Error",
+			},
+		},
+		"ErrorCaseUserNotFound": {
+			request: &ExplainAuthorizedResourcesRequest{
+				ExternalID: "user1",
+				Action:     "example:Read",
+				Resources:  []string{"urn:ews:example:instance1:resource/res1"},
+			},
+			expectedStatusCode: http.StatusNotFound,
+			expectedError: api.Error{
+				Code:    api.USER_BY_EXTERNAL_ID_NOT_FOUND,
+				Message: "Error",
+			},
+			explainAuthorizedExternalResourcesErr: &api.Error{
+				Code:    api.USER_BY_EXTERNAL_ID_NOT_FOUND,
+				Message: "Error",
+			},
+		},
+		"ErrorCaseUnknownApiError": {
+			request: &ExplainAuthorizedResourcesRequest{
+				ExternalID: "user1",
+				Action:     "example:Read",
+				Resources:  []string{"urn:ews:example:instance1:resource/res1"},
+			},
+			expectedStatusCode: http.StatusInternalServerError,
+			explainAuthorizedExternalResourcesErr: &api.Error{
+				Code:    api.UNKNOWN_API_ERROR,
+				Message: "Error",
+			},
+		},
+	}
+
+	client := http.DefaultClient
+
+	for n, test := range testcases {
+
+		testApi.ArgsOut[ExplainAuthorizedExternalResourcesMethod][0] = test.explainAuthorizedExternalResourcesResult
+		testApi.ArgsOut[ExplainAuthorizedExternalResourcesMethod][1] = test.explainAuthorizedExternalResourcesErr
+
+		var body *bytes.Buffer
+		if test.request != nil {
+			jsonObject, err := json.Marshal(test.request)
+			if err != nil {
+				t.Errorf("Test case %v. Unexpected marshalling api request %v", n, err)
+				continue
+			}
+			body = bytes.NewBuffer(jsonObject)
+		}
+		if body == nil {
+			body = bytes.NewBuffer([]byte{})
+		}
+		req, err := http.NewRequest(http.MethodPost, server.URL+RESOURCE_EXPLAIN_URL, body)
+		if err != nil {
+			t.Errorf("Test case %v. Unexpected error creating http request %v", n, err)
+			continue
+		}
+
+		res, err := client.Do(req)
+		if err != nil {
+			t.Errorf("Test case %v. Unexpected error calling server %v", n, err)
+			continue
+		}
+
+		// check status code
+		if test.expectedStatusCode != res.StatusCode {
+			t.Errorf("Test case %v. Received different http status code (wanted:%v / received:%v)", n, test.expectedStatusCode, res.StatusCode)
+			continue
+		}
+
+		switch res.StatusCode {
+		case http.StatusOK:
+			explanation := &api.AuthorizationExplanation{}
+			err = json.NewDecoder(res.Body).Decode(explanation)
+			if err != nil {
+				t.Errorf("Test case %v. Unexpected error parsing response %v", n, err)
+				continue
+			}
+			// Check result
+			if diff := pretty.Compare(explanation, test.expectedResponse); diff != "" {
+				t.Errorf("Test %v failed. Received different responses (received/wanted) %v", n, diff)
+				continue
+			}
+			// Check received parameters
+			if test.request.ExternalID != testApi.ArgsIn[ExplainAuthorizedExternalResourcesMethod][1] {
+				t.Errorf("Test %v failed. Received different externalId (wanted:%v / received:%v)",
+					n, test.request.ExternalID, testApi.ArgsIn[ExplainAuthorizedExternalResourcesMethod][1])
+				continue
+			}
+		case http.StatusInternalServerError: // Empty message so continue
+			continue
+		default:
+			apiError := api.Error{}
+			err = json.NewDecoder(res.Body).Decode(&apiError)
+			if err != nil {
+				t.Errorf("Test case %v. Unexpected error parsing error response %v", n, err)
+				continue
+			}
+			// Check result
+			if diff := pretty.Compare(apiError, test.expectedError); diff != "" {
+				t.Errorf("Test %v failed. Received different error response (received/wanted) %v", n, diff)
+				continue
+			}
+		}
+	}
+}
+
+func TestWorkerHandler_HandleSimulatePolicy(t *testing.T) {
+	testcases := map[string]struct {
+		// API method args
+		request *api.PolicySimulation
+		// Expected result
+		expectedStatusCode int
+		expectedResponse   *SimulatePolicyResponse
+		expectedError      api.Error
+		// Manager Results
+		simulatePolicyResult []api.SimulationResult
+		// Manager Errors
+		simulatePolicyErr error
+	}{
+		"OkCase": {
+			request: &api.PolicySimulation{
+				ExternalID: "user1",
+				Groups: []api.GroupIdentity{
+					{
+						Org:  "org1",
+						Name: "group1",
+					},
+				},
+				Statements: []api.Statement{
+					{
+						Effect:    "allow",
+						Actions:   []string{"example:Read"},
+						Resources: []string{"urn:ews:example:instance1:resource/*"},
+					},
+				},
+				Actions:   []string{"example:Read", "example:Write"},
+				Resources: []string{"urn:ews:example:instance1:resource/res1"},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedResponse: &SimulatePolicyResponse{
+				Results: []api.SimulationResult{
+					{
+						Action:   "example:Read",
+						Urn:      "urn:ews:example:instance1:resource/res1",
+						Decision: api.DECISION_ALLOW,
+					},
+					{
+						Action:   "example:Write",
+						Urn:      "urn:ews:example:instance1:resource/res1",
+						Decision: api.DECISION_IMPLICIT_DENY,
+					},
+				},
+			},
+			simulatePolicyResult: []api.SimulationResult{
+				{
+					Action:   "example:Read",
+					Urn:      "urn:ews:example:instance1:resource/res1",
+					Decision: api.DECISION_ALLOW,
+				},
+				{
+					Action:   "example:Write",
+					Urn:      "urn:ews:example:instance1:resource/res1",
+					Decision: api.DECISION_IMPLICIT_DENY,
+				},
+			},
+		},
+		"ErrorCaseMalformedRequest": {
+			expectedStatusCode: http.StatusBadRequest,
+			expectedError: api.Error{
+				Code:    api.INVALID_PARAMETER_ERROR,
+				Message: "EOF",
+			},
+		},
+		"ErrorCaseInvalidParameterError": {
+			request: &api.PolicySimulation{
+				Actions:   []string{"example:Read"},
+				Resources: []string{"urn:ews:example:instance1:resource/res1"},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedError: api.Error{
+				Code:    api.INVALID_PARAMETER_ERROR,
+				Message: "Error",
+			},
+			simulatePolicyErr: &api.Error{
+				Code:    api.INVALID_PARAMETER_ERROR,
+				Message: "Error",
+			},
+		},
+		"ErrorCaseUnauthorizedError": {
+			request: &api.PolicySimulation{
+				Actions:   []string{"example:Read"},
+				Resources: []string{"urn:ews:example:instance1:resource/res1"},
+			},
+			expectedStatusCode: http.StatusForbidden,
+			expectedError: api.Error{
+				Code:    api.UNAUTHORIZED_RESOURCES_ERROR,
+				Message: "Error",
+			},
+			simulatePolicyErr: &api.Error{
+				Code:    api.UNAUTHORIZED_RESOURCES_ERROR,
+				Message: "Error",
+			},
+		},
+		"ErrorCaseGroupNotFound": {
+			request: &api.PolicySimulation{
+				Groups: []api.GroupIdentity{
+					{
+						Org:  "org1",
+						Name: "group1",
+					},
+				},
+				Actions:   []string{"example:Read"},
+				Resources: []string{"urn:ews:example:instance1:resource/res1"},
+			},
+			expectedStatusCode: http.StatusNotFound,
+			expectedError: api.Error{
+				Code:    api.GROUP_BY_ORG_AND_NAME_NOT_FOUND,
+				Message: "Error",
+			},
+			simulatePolicyErr: &api.Error{
+				Code:    api.GROUP_BY_ORG_AND_NAME_NOT_FOUND,
+				Message: "Error",
+			},
+		},
+		"ErrorCaseUnknownApiError": {
+			request: &api.PolicySimulation{
+				Actions:   []string{"example:Read"},
+				Resources: []string{"urn:ews:example:instance1:resource/res1"},
+			},
+			expectedStatusCode: http.StatusInternalServerError,
+			simulatePolicyErr: &api.Error{
+				Code:    api.UNKNOWN_API_ERROR,
+				Message: "Error",
+			},
+		},
+	}
+
+	client := http.DefaultClient
+
+	for n, test := range testcases {
+
+		testApi.ArgsOut[SimulatePolicyMethod][0] = test.simulatePolicyResult
+		testApi.ArgsOut[SimulatePolicyMethod][1] = test.simulatePolicyErr
+
+		var body *bytes.Buffer
+		if test.request != nil {
+			jsonObject, err := json.Marshal(test.request)
+			if err != nil {
+				t.Errorf("Test case %v. Unexpected marshalling api request %v", n, err)
+				continue
+			}
+			body = bytes.NewBuffer(jsonObject)
+		}
+		if body == nil {
+			body = bytes.NewBuffer([]byte{})
+		}
+		req, err := http.NewRequest(http.MethodPost, server.URL+RESOURCE_SIMULATE_URL, body)
+		if err != nil {
+			t.Errorf("Test case %v. Unexpected error creating http request %v", n, err)
+			continue
+		}
+
+		res, err := client.Do(req)
+		if err != nil {
+			t.Errorf("Test case %v. Unexpected error calling server %v", n, err)
+			continue
+		}
+
+		// check status code
+		if test.expectedStatusCode != res.StatusCode {
+			t.Errorf("Test case %v. Received different http status code (wanted:%v / received:%v)", n, test.expectedStatusCode, res.StatusCode)
+			continue
+		}
+
+		switch res.StatusCode {
+		case http.StatusOK:
+			response := &SimulatePolicyResponse{}
+			err = json.NewDecoder(res.Body).Decode(response)
+			if err != nil {
+				t.Errorf("Test case %v. Unexpected error parsing response %v", n, err)
+				continue
+			}
+			// Check result
+			if diff := pretty.Compare(response, test.expectedResponse); diff != "" {
+				t.Errorf("Test %v failed. Received different responses (received/wanted) %v", n, diff)
+				continue
+			}
+			// Check received parameters
+			if diff := pretty.Compare(testApi.ArgsIn[SimulatePolicyMethod][1], *test.request); diff != "" {
+				t.Errorf("Test %v failed. Received different simulation (received/wanted) %v", n, diff)
+				continue
+			}
+		case http.StatusInternalServerError: // Empty message so continue
+			continue
+		default:
+			apiError := api.Error{}
+			err = json.NewDecoder(res.Body).Decode(&apiError)
+			if err != nil {
+				t.Errorf("Test case %v. Unexpected error parsing error response %v", n, err)
+				continue
+			}
+			// Check result
+			if diff := pretty.Compare(apiError, test.expectedError); diff != "" {
+				t.Errorf("Test %v failed. Received different error response (received/wanted) %v", n, diff)
+				continue
+			}
+		}
+	}
+}
+
+func TestWorkerHandler_HandleGetCacheStats(t *testing.T) {
+	testcases := map[string]struct {
+		// Expected result
+		expectedStatusCode int
+		expectedResponse   *api.CacheStats
+		expectedError      api.Error
+		// Manager Results
+		getCacheStatsResult *api.CacheStats
+		// Manager Errors
+		getCacheStatsErr error
+	}{
+		"OkCase": {
+			expectedStatusCode: http.StatusOK,
+			expectedResponse: &api.CacheStats{
+				Enabled:       true,
+				Entries:       2,
+				Size:          100,
+				TTL:           "1m0s",
+				Hits:          10,
+				Misses:        3,
+				Evictions:     1,
+				Invalidations: 4,
+			},
+			getCacheStatsResult: &api.CacheStats{
+				Enabled:       true,
+				Entries:       2,
+				Size:          100,
+				TTL:           "1m0s",
+				Hits:          10,
+				Misses:        3,
+				Evictions:     1,
+				Invalidations: 4,
+			},
+		},
+		"ErrorCaseUnauthorizedError": {
+			expectedStatusCode: http.StatusForbidden,
+			expectedError: api.Error{
+				Code:    api.UNAUTHORIZED_RESOURCES_ERROR,
+				Message: "Error",
+			},
+			getCacheStatsErr: &api.Error{
+				Code:    api.UNAUTHORIZED_RESOURCES_ERROR,
+				Message: "Error",
+			},
+		},
+		"ErrorCaseUnknownApiError": {
+			expectedStatusCode: http.StatusInternalServerError,
+			getCacheStatsErr: &api.Error{
+				Code:    api.UNKNOWN_API_ERROR,
+				Message: "Error",
+			},
+		},
+	}
+
+	client := http.DefaultClient
+
+	for n, test := range testcases {
+
+		testApi.ArgsOut[GetCacheStatsMethod][0] = test.getCacheStatsResult
+		testApi.ArgsOut[GetCacheStatsMethod][1] = test.getCacheStatsErr
+
+		req, err := http.NewRequest(http.MethodGet, server.URL+RESOURCE_CACHE_URL, nil)
+		if err != nil {
+			t.Errorf("Test case %v. Unexpected error creating http request %v", n, err)
+			continue
+		}
+
+		res, err := client.Do(req)
+		if err != nil {
+			t.Errorf("Test case %v. Unexpected error calling server %v", n, err)
+			continue
+		}
+
+		// check status code
+		if test.expectedStatusCode != res.StatusCode {
+			t.Errorf("Test case %v. Received different http status code (wanted:%v / received:%v)", n, test.expectedStatusCode, res.StatusCode)
+			continue
+		}
+
+		switch res.StatusCode {
+		case http.StatusOK:
+			response := &api.CacheStats{}
+			err = json.NewDecoder(res.Body).Decode(response)
+			if err != nil {
+				t.Errorf("Test case %v. Unexpected error parsing response %v", n, err)
+				continue
+			}
+			// Check result
+			if diff := pretty.Compare(response, test.expectedResponse); diff != "" {
+				t.Errorf("Test %v failed. Received different responses (received/wanted) %v", n, diff)
+				continue
+			}
 		case http.StatusInternalServerError: // Empty message so continue
 			continue
 		default:
@@ -1,8 +1,13 @@
 package http
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"fmt"
 	"strconv"
@@ -21,6 +26,8 @@ const (
 	POLICY_NAME = "policyname"
 	ORG_NAME    = "orgname"
 
+	SERVICE_ACCOUNT_NAME = "serviceaccountname"
+
 	// URI Path param prefix
 	URI_PATH_PREFIX = "/:"
 
@@ -50,10 +57,25 @@ const (
 	POLICY_ID_GROUPS_URL = POLICY_ROOT_URL + URI_PATH_PREFIX + POLICY_NAME + "/groups"
 
 	// Authorization URLs
-	RESOURCE_URL = API_VERSION_1 + "/resource"
+	RESOURCE_URL          = API_VERSION_1 + "/resource"
+	RESOURCE_EXPLAIN_URL  = RESOURCE_URL + "/explain"
+	RESOURCE_SIMULATE_URL = RESOURCE_URL + "/simulate"
+	RESOURCE_CACHE_URL    = RESOURCE_URL + "/cache"
+	RESOURCE_BATCH_URL    = RESOURCE_URL + "/batch"
+
+	// Audit URLs
+	AUDIT_URL = API_VERSION_1 + "/audit"
+
+	// Service account API urls
+	SERVICE_ACCOUNT_ROOT_URL = API_VERSION_1 + "/service-accounts"
+	SERVICE_ACCOUNT_ID_URL   = SERVICE_ACCOUNT_ROOT_URL + URI_PATH_PREFIX + SERVICE_ACCOUNT_NAME
 
 	// HTTP Header
 	REQUEST_ID_HEADER = "Request-ID"
+	// User authenticated by worker in authorization responses
+	AUTHENTICATED_USER_HEADER = "Authenticated-User"
+	// Secret shared by worker and proxies, so proxies can send proxy context keys
+	PROXY_SECRET_HEADER = "X-FOULKON-PROXY-SECRET"
 )
 
 // WORKER
@@ -93,7 +115,8 @@ func (wh *WorkerHandler) processHttpResponse(r *http.Request, w http.ResponseWri
 		switch apiError.Code {
 		case api.USER_ALREADY_EXIST, api.GROUP_ALREADY_EXIST,
 			api.USER_IS_ALREADY_A_MEMBER_OF_GROUP,
-			api.POLICY_IS_ALREADY_ATTACHED_TO_GROUP, api.POLICY_ALREADY_EXIST:
+			api.POLICY_IS_ALREADY_ATTACHED_TO_GROUP, api.POLICY_ALREADY_EXIST,
+			api.SERVICE_ACCOUNT_ALREADY_EXIST:
 			wh.RespondConflict(r, requestInfo, w, apiError)
 			break
 		case api.UNAUTHORIZED_RESOURCES_ERROR:
@@ -101,7 +124,7 @@ func (wh *WorkerHandler) processHttpResponse(r *http.Request, w http.ResponseWri
 			break
 		case api.USER_BY_EXTERNAL_ID_NOT_FOUND, api.GROUP_BY_ORG_AND_NAME_NOT_FOUND,
 			api.USER_IS_NOT_A_MEMBER_OF_GROUP, api.POLICY_IS_NOT_ATTACHED_TO_GROUP,
-			api.POLICY_BY_ORG_AND_NAME_NOT_FOUND:
+			api.POLICY_BY_ORG_AND_NAME_NOT_FOUND, api.SERVICE_ACCOUNT_BY_NAME_NOT_FOUND:
 			wh.RespondNotFound(r, requestInfo, w, apiError)
 			break
 		case api.INVALID_PARAMETER_ERROR, api.REGEX_NO_MATCH:
@@ -197,13 +220,26 @@ func WorkerHandlerRouter(worker *foulkon.Worker) http.Handler {
 
 	// Resources authorized endpoint
 	router.POST(RESOURCE_URL, workerHandler.HandleGetAuthorizedExternalResources)
+	router.POST(RESOURCE_BATCH_URL, workerHandler.HandleGetAuthorizedExternalResourcesBatch)
+	router.POST(RESOURCE_EXPLAIN_URL, workerHandler.HandleExplainAuthorizedExternalResources)
+	router.POST(RESOURCE_SIMULATE_URL, workerHandler.HandleSimulatePolicy)
+	router.GET(RESOURCE_CACHE_URL, workerHandler.HandleGetCacheStats)
+
+	// Audit api
+	router.GET(AUDIT_URL, workerHandler.HandleListAuditEvents)
+
+	// Service account api
+	router.GET(SERVICE_ACCOUNT_ROOT_URL, workerHandler.HandleListServiceAccounts)
+	router.POST(SERVICE_ACCOUNT_ROOT_URL, workerHandler.HandleAddServiceAccount)
+	router.GET(SERVICE_ACCOUNT_ID_URL, workerHandler.HandleGetServiceAccountByName)
+	router.DELETE(SERVICE_ACCOUNT_ID_URL, workerHandler.HandleRemoveServiceAccount)
 
 	// Return handler with request logging
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		requestID := uuid.NewV4().String()
 		r.Header.Set(REQUEST_ID_HEADER, requestID)
 		w.Header().Add(REQUEST_ID_HEADER, requestID)
-		worker.Authenticator.Authenticate(router).ServeHTTP(w, r)
+		worker.Authenticator.Authenticate(workerHandler.provisionUser(router)).ServeHTTP(w, r)
 		userID, _ := worker.Authenticator.GetAuthenticatedUser(r)
 		workerHandler.TransactionLog(r, requestID, userID, "")
 	})
@@ -292,21 +328,40 @@ func (wh *WorkerHandler) RespondInternalServerError(r *http.Request, requestInfo
 
 func (wh *WorkerHandler) GetRequestInfo(r *http.Request) api.RequestInfo {
 	userID, admin := wh.worker.Authenticator.GetAuthenticatedUser(r)
+	context := getRequestContext(r)
+	for claim, value := range wh.worker.Authenticator.GetAuthenticatedClaims(r) {
+		context[api.CONTEXT_KEY_CLAIM_PREFIX+claim] = value
+	}
 	return api.RequestInfo{
 		Identifier: userID,
 		Admin:      admin,
 		RequestID:  r.Header.Get(REQUEST_ID_HEADER),
+		Context:    context,
 	}
 }
 
+// Returns true if request is sent by a proxy with the secret shared with worker
+func (wh *WorkerHandler) isProxyRequest(r *http.Request) bool {
+	secret := r.Header.Get(PROXY_SECRET_HEADER)
+	return wh.worker.ProxySecret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(wh.worker.ProxySecret)) == 1
+}
+
 // PROXY
 
 type ProxyHandler struct {
-	proxy  *foulkon.Proxy
+	proxy *foulkon.Proxy
+	// Client for destination hosts, without global timeout to stream responses
 	client *http.Client
+	// Client for worker authorization requests
+	workerClient *http.Client
+	cache        *decisionCache
+	// Upgraded connections
+	tunnels *tunnelTracker
+	// Rate limit of all requests
+	rateLimiter *rateLimiter
 }
 
-func (ph *ProxyHandler) TransactionErrorLog(r *http.Request, requestID string, workerRequestID string, msg string) {
+func (ph *ProxyHandler) TransactionErrorLog(r *http.Request, requestID string, workerRequestID string, cached bool, msg string) {
 
 	// TODO: X-Forwarded headers
 	//for header, _ := range r.Header {
@@ -319,10 +374,11 @@ func (ph *ProxyHandler) TransactionErrorLog(r *http.Request, requestID string, w
 		"URI":             r.URL.EscapedPath(),
 		"address":         r.RemoteAddr,
 		"workerRequestID": workerRequestID,
+		"cached":          cached,
 	}).Error(msg)
 }
 
-func (ph *ProxyHandler) TransactionLog(r *http.Request, requestID string, workerRequestID string, msg string) {
+func (ph *ProxyHandler) TransactionLog(r *http.Request, requestID string, workerRequestID string, cached bool, msg string) {
 
 	// TODO: X-Forwarded headers
 	//for header, _ := range r.Header {
@@ -335,6 +391,7 @@ func (ph *ProxyHandler) TransactionLog(r *http.Request, requestID string, worker
 		"URI":             r.URL.EscapedPath(),
 		"address":         r.RemoteAddr,
 		"workerRequestID": workerRequestID,
+		"cached":          cached,
 	}).Info(msg)
 }
 
@@ -360,6 +417,23 @@ func (ph *ProxyHandler) RespondBadRequest(w http.ResponseWriter, proxyErr *api.E
 	w.Write(b)
 }
 
+func (ph *ProxyHandler) RespondTooManyRequests(w http.ResponseWriter, proxyErr *api.Error, retryAfter time.Duration) {
+	b, err := json.Marshal(proxyErr)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	// Seconds to wait, rounded up
+	seconds := int((retryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	w.WriteHeader(http.StatusTooManyRequests)
+	w.Write(b)
+}
+
 func (ph *ProxyHandler) RespondInternalServerError(w http.ResponseWriter, proxyErr *api.Error) {
 	b, err := json.Marshal(proxyErr)
 	if err != nil {
@@ -371,21 +445,180 @@ func (ph *ProxyHandler) RespondInternalServerError(w http.ResponseWriter, proxyE
 	w.Write(b)
 }
 
-// Handler returns an http.Handler for the Proxy including all resources defined in proxy file.
-func ProxyHandlerRouter(proxy *foulkon.Proxy) http.Handler {
-	// Create the muxer to handle the actual endpoints
-	router := httprouter.New()
+// ProxyRouter is the http.Handler of the Proxy, with a router for the resources that can be
+// replaced while requests are being served
+type ProxyRouter struct {
+	proxyHandler *ProxyHandler
+	// Current *httprouter.Router
+	router atomic.Value
+	// Balancers of the upstreams and rate limiters by resource id used by current router
+	balancers []*upstreamBalancer
+	limiters  map[string]*rateLimiter
+	// Serialize reloads
+	mutex sync.Mutex
+}
+
+// ProxyHandlerRouter returns the handler for the Proxy including all resources defined in proxy file,
+// or an error if resources are invalid.
+func ProxyHandlerRouter(proxy *foulkon.Proxy) (*ProxyRouter, error) {
+	transport := newProxyTransport(DEFAULT_CONNECT_TIMEOUT, proxy.ResponseTimeout)
+	proxyHandler := &ProxyHandler{
+		proxy:  proxy,
+		client: newDestinationClient(transport),
+		workerClient: &http.Client{
+			Transport: transport,
+			Timeout:   proxy.WorkerTimeout,
+		},
+		cache:       newDecisionCache(proxy.CacheSize, proxy.CacheTTL),
+		tunnels:     newTunnelTracker(),
+		rateLimiter: newRateLimiter(proxy.RateLimit),
+	}
+
+	router, balancers, limiters, err := proxyHandler.newRouter(proxy.APIResources, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	proxyRouter := &ProxyRouter{proxyHandler: proxyHandler, balancers: balancers, limiters: limiters}
+	proxyRouter.router.Store(router)
+
+	// Upgraded connections aren't managed by server, so they are closed with proxy
+	foulkon.OnCloseProxy(proxyHandler.tunnels.closeAll)
+	return proxyRouter, nil
+}
+
+func (pr *ProxyRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	pr.router.Load().(*httprouter.Router).ServeHTTP(w, r)
+}
 
-	proxyHandler := ProxyHandler{proxy: proxy, client: http.DefaultClient}
+// Reload replaces the resources of the Proxy. Requests in progress finish with the old resources,
+// and new requests use the new ones. If resources are invalid, old ones are kept and an error is returned.
+// Upstreams and rate limits that don't change keep their state, like ejected hosts and consumed tokens.
+func (pr *ProxyRouter) Reload(resources []foulkon.APIResource) error {
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
 
-	for _, res := range proxy.APIResources {
-		router.Handle(res.Method, res.Url, proxyHandler.HandleRequest(res))
+	router, balancers, limiters, err := pr.proxyHandler.newRouter(resources, pr.balancers, pr.limiters)
+	if err != nil {
+		return err
+	}
+	pr.router.Store(router)
+	// Old balancers that aren't used anymore keep working for requests in progress, without health checks
+	for _, old := range pr.balancers {
+		if !containsBalancer(balancers, old) {
+			old.close()
+		}
+	}
+	pr.balancers = balancers
+	pr.limiters = limiters
+	pr.proxyHandler.proxy.Logger.Infof("Proxy reloaded with %v resources", len(resources))
+	return nil
+}
+
+// Create a router for the resources, with the started balancers of their upstreams and their rate limiters,
+// returning an error if any of them is invalid. Old balancers and limiters are reused if their config is the same.
+func (ph *ProxyHandler) newRouter(resources []foulkon.APIResource, oldBalancers []*upstreamBalancer, oldLimiters map[string]*rateLimiter) (
+	router *httprouter.Router, balancers []*upstreamBalancer, limiters map[string]*rateLimiter, err error) {
+	// Router panics if routes conflict
+	defer func() {
+		if r := recover(); r != nil {
+			router = nil
+			balancers = nil
+			limiters = nil
+			err = fmt.Errorf("Invalid resources: %v", r)
+		}
+	}()
+
+	// Create the muxer to handle the actual endpoints
+	router = httprouter.New()
+	// Resources of the same upstream share its balancer
+	upstreams := map[*foulkon.Upstream]*upstreamBalancer{}
+	started := map[*upstreamBalancer]bool{}
+	for _, balancer := range oldBalancers {
+		started[balancer] = true
 	}
+	limiters = map[string]*rateLimiter{}
+	for _, res := range resources {
+		// Requests to resources with invalid URN templates would fail
+		urns := []string{res.Urn}
+		for _, check := range res.Checks {
+			urns = append(urns, check.Urn)
+		}
+		for _, urn := range urns {
+			if _, err := getUrnParameters(urn); err != nil {
+				return nil, nil, nil, fmt.Errorf("Resource %v has an invalid urn: %v", res.Id, err)
+			}
+		}
 
-	return router
+		var balancer *upstreamBalancer
+		if res.Upstream != nil {
+			if balancer = upstreams[res.Upstream]; balancer == nil {
+				if balancer = findBalancer(oldBalancers, res.Upstream); balancer == nil || containsBalancer(balancers, balancer) {
+					if balancer, err = newUpstreamBalancer(res.Upstream, ph.proxy); err != nil {
+						return nil, nil, nil, err
+					}
+				}
+				upstreams[res.Upstream] = balancer
+				balancers = append(balancers, balancer)
+			}
+		}
+		limiter := oldLimiters[res.Id]
+		if limiter == nil || res.RateLimit == nil || *limiter.limit != *res.RateLimit {
+			limiter = newRateLimiter(res.RateLimit)
+		}
+		if limiter != nil {
+			limiters[res.Id] = limiter
+		}
+		router.Handle(res.Method, res.Url, ph.HandleRequest(res, balancer, limiter))
+	}
+
+	for _, balancer := range balancers {
+		if !started[balancer] {
+			balancer.start()
+		}
+	}
+	return router, balancers, limiters, nil
 }
 
 // Private Helper Methods
+
+// Create the transport used to call destination hosts and worker
+func newProxyTransport(connectTimeout time.Duration, responseTimeout time.Duration) *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   connectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		ResponseHeaderTimeout: responseTimeout,
+	}
+}
+
+// Create a client for destination hosts, without global timeout to stream responses
+func newDestinationClient(transport *http.Transport) *http.Client {
+	return &http.Client{
+		Transport: transport,
+		// Redirections are returned to the client
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Retrieve the context keys that the worker computes for every request
+func getRequestContext(r *http.Request) map[string]string {
+	context := map[string]string{
+		api.CONTEXT_KEY_CURRENT_TIME: time.Now().UTC().Format(time.RFC3339),
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		context[api.CONTEXT_KEY_SOURCE_IP] = host
+	}
+	return context
+}
+
 func writeErrorWithStatus(w http.ResponseWriter, apiError *api.Error, statusCode int) (http.ResponseWriter, error) {
 	b, err := json.Marshal(apiError)
 	if err != nil {
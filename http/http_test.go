@@ -46,10 +46,25 @@ const (
 	ListAttachedGroupsMethod = "ListAttachedGroups"
 
 	// AUTHZ API
-	GetAuthorizedUsersMethod             = "GetAuthorizedUsers"
-	GetAuthorizedGroupsMethod            = "GetAuthorizedGroups"
-	GetAuthorizedPoliciesMethod          = "GetAuthorizedPolicies"
-	GetAuthorizedExternalResourcesMethod = "GetAuthorizedExternalResources"
+	GetAuthorizedUsersMethod                  = "GetAuthorizedUsers"
+	GetAuthorizedGroupsMethod                 = "GetAuthorizedGroups"
+	GetAuthorizedPoliciesMethod               = "GetAuthorizedPolicies"
+	GetAuthorizedExternalResourcesMethod      = "GetAuthorizedExternalResources"
+	GetAuthorizedExternalResourcesBatchMethod = "GetAuthorizedExternalResourcesBatch"
+	ExplainAuthorizedExternalResourcesMethod  = "ExplainAuthorizedExternalResources"
+	SimulatePolicyMethod                      = "SimulatePolicy"
+	GetCacheStatsMethod                       = "GetCacheStats"
+
+	ListAuditEventsMethod = "ListAuditEvents"
+
+	AddServiceAccountMethod          = "AddServiceAccount"
+	GetServiceAccountByNameMethod    = "GetServiceAccountByName"
+	ListServiceAccountsMethod        = "ListServiceAccounts"
+	RemoveServiceAccountMethod       = "RemoveServiceAccount"
+	AuthenticateServiceAccountMethod = "AuthenticateServiceAccount"
+
+	// PROVISIONING API
+	ProvisionUserMethod = "ProvisionUser"
 )
 
 // Test server used to test handlers
@@ -78,6 +93,8 @@ type TestAPI struct {
 type TestConnector struct {
 	userID          string
 	unauthenticated bool
+	// Claims of the authenticated user
+	claims string
 }
 
 func (tc TestConnector) Authenticate(h http.Handler) http.Handler {
@@ -89,6 +106,12 @@ func (tc TestConnector) Authenticate(h http.Handler) http.Handler {
 			return
 		})
 	}
+	if tc.claims != "" {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Set(auth.CLAIMS_HEADER, tc.claims)
+			h.ServeHTTP(w, r)
+		})
+	}
 	return h
 }
 
@@ -122,19 +145,23 @@ func TestMain(m *testing.M) {
 
 	// Return created core
 	worker := &foulkon.Worker{
-		Logger:        logger,
-		Authenticator: authenticator,
-		UserApi:       testApi,
-		GroupApi:      testApi,
-		PolicyApi:     testApi,
-		AuthzApi:      testApi,
+		Logger:            logger,
+		Authenticator:     authenticator,
+		UserApi:           testApi,
+		GroupApi:          testApi,
+		PolicyApi:         testApi,
+		AuthzApi:          testApi,
+		AuditApi:          testApi,
+		ServiceAccountApi: testApi,
+		ProxySecret:       "proxysecret",
 	}
 
 	server = httptest.NewServer(WorkerHandlerRouter(worker))
 
 	proxyCore := &foulkon.Proxy{
-		Logger:     logger,
-		WorkerHost: server.URL,
+		Logger:       logger,
+		WorkerHost:   server.URL,
+		WorkerSecret: "proxysecret",
 		APIResources: []foulkon.APIResource{
 			{
 				Id:     "resource1",
@@ -187,7 +214,12 @@ func TestMain(m *testing.M) {
 		},
 	}
 
-	proxy = httptest.NewServer(ProxyHandlerRouter(proxyCore))
+	proxyRouter, err := ProxyHandlerRouter(proxyCore)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating proxy router: %v", err)
+		os.Exit(1)
+	}
+	proxy = httptest.NewServer(proxyRouter)
 
 	// Run tests
 	result := m.Run()
@@ -234,6 +266,20 @@ func makeTestApi() *TestAPI {
 	testApi.ArgsIn[GetAuthorizedGroupsMethod] = make([]interface{}, 4)
 	testApi.ArgsIn[GetAuthorizedPoliciesMethod] = make([]interface{}, 4)
 	testApi.ArgsIn[GetAuthorizedExternalResourcesMethod] = make([]interface{}, 3)
+	testApi.ArgsIn[GetAuthorizedExternalResourcesBatchMethod] = make([]interface{}, 2)
+	testApi.ArgsIn[ExplainAuthorizedExternalResourcesMethod] = make([]interface{}, 5)
+	testApi.ArgsIn[SimulatePolicyMethod] = make([]interface{}, 2)
+	testApi.ArgsIn[GetCacheStatsMethod] = make([]interface{}, 1)
+
+	testApi.ArgsIn[ListAuditEventsMethod] = make([]interface{}, 2)
+
+	testApi.ArgsIn[AddServiceAccountMethod] = make([]interface{}, 3)
+	testApi.ArgsIn[GetServiceAccountByNameMethod] = make([]interface{}, 2)
+	testApi.ArgsIn[ListServiceAccountsMethod] = make([]interface{}, 2)
+	testApi.ArgsIn[RemoveServiceAccountMethod] = make([]interface{}, 2)
+	testApi.ArgsIn[AuthenticateServiceAccountMethod] = make([]interface{}, 1)
+
+	testApi.ArgsIn[ProvisionUserMethod] = make([]interface{}, 1)
 
 	testApi.ArgsOut[AddUserMethod] = make([]interface{}, 2)
 	testApi.ArgsOut[GetUserByExternalIdMethod] = make([]interface{}, 2)
@@ -265,6 +311,20 @@ func makeTestApi() *TestAPI {
 	testApi.ArgsOut[GetAuthorizedGroupsMethod] = make([]interface{}, 2)
 	testApi.ArgsOut[GetAuthorizedPoliciesMethod] = make([]interface{}, 2)
 	testApi.ArgsOut[GetAuthorizedExternalResourcesMethod] = make([]interface{}, 2)
+	testApi.ArgsOut[GetAuthorizedExternalResourcesBatchMethod] = make([]interface{}, 2)
+	testApi.ArgsOut[ExplainAuthorizedExternalResourcesMethod] = make([]interface{}, 2)
+	testApi.ArgsOut[SimulatePolicyMethod] = make([]interface{}, 2)
+	testApi.ArgsOut[GetCacheStatsMethod] = make([]interface{}, 2)
+
+	testApi.ArgsOut[ListAuditEventsMethod] = make([]interface{}, 3)
+
+	testApi.ArgsOut[AddServiceAccountMethod] = make([]interface{}, 3)
+	testApi.ArgsOut[GetServiceAccountByNameMethod] = make([]interface{}, 2)
+	testApi.ArgsOut[ListServiceAccountsMethod] = make([]interface{}, 3)
+	testApi.ArgsOut[RemoveServiceAccountMethod] = make([]interface{}, 1)
+	testApi.ArgsOut[AuthenticateServiceAccountMethod] = make([]interface{}, 2)
+
+	testApi.ArgsOut[ProvisionUserMethod] = make([]interface{}, 1)
 
 	return testApi
 }
@@ -660,6 +720,179 @@ func (t TestAPI) GetAuthorizedExternalResources(authenticatedUser api.RequestInf
 	return resourcesToReturn, err
 }
 
+func (t TestAPI) GetAuthorizedExternalResourcesBatch(authenticatedUser api.RequestInfo, checks []api.AuthorizationCheck) ([]api.AuthorizationResult, error) {
+	t.ArgsIn[GetAuthorizedExternalResourcesBatchMethod][0] = authenticatedUser
+	t.ArgsIn[GetAuthorizedExternalResourcesBatchMethod][1] = checks
+	var results []api.AuthorizationResult
+	if t.ArgsOut[GetAuthorizedExternalResourcesBatchMethod][0] != nil {
+		results = t.ArgsOut[GetAuthorizedExternalResourcesBatchMethod][0].([]api.AuthorizationResult)
+	}
+	var err error
+	if t.ArgsOut[GetAuthorizedExternalResourcesBatchMethod][1] != nil {
+		err = t.ArgsOut[GetAuthorizedExternalResourcesBatchMethod][1].(error)
+	}
+	return results, err
+}
+
+func (t TestAPI) ExplainAuthorizedExternalResources(authenticatedUser api.RequestInfo, externalID string, action string, resources []string,
+	context map[string]string) (*api.AuthorizationExplanation, error) {
+	t.ArgsIn[ExplainAuthorizedExternalResourcesMethod][0] = authenticatedUser
+	t.ArgsIn[ExplainAuthorizedExternalResourcesMethod][1] = externalID
+	t.ArgsIn[ExplainAuthorizedExternalResourcesMethod][2] = action
+	t.ArgsIn[ExplainAuthorizedExternalResourcesMethod][3] = resources
+	t.ArgsIn[ExplainAuthorizedExternalResourcesMethod][4] = context
+	var explanation *api.AuthorizationExplanation
+	if t.ArgsOut[ExplainAuthorizedExternalResourcesMethod][0] != nil {
+		explanation = t.ArgsOut[ExplainAuthorizedExternalResourcesMethod][0].(*api.AuthorizationExplanation)
+	}
+	var err error
+	if t.ArgsOut[ExplainAuthorizedExternalResourcesMethod][1] != nil {
+		err = t.ArgsOut[ExplainAuthorizedExternalResourcesMethod][1].(error)
+	}
+	return explanation, err
+}
+
+func (t TestAPI) SimulatePolicy(authenticatedUser api.RequestInfo, simulation api.PolicySimulation) ([]api.SimulationResult, error) {
+	t.ArgsIn[SimulatePolicyMethod][0] = authenticatedUser
+	t.ArgsIn[SimulatePolicyMethod][1] = simulation
+	var results []api.SimulationResult
+	if t.ArgsOut[SimulatePolicyMethod][0] != nil {
+		results = t.ArgsOut[SimulatePolicyMethod][0].([]api.SimulationResult)
+	}
+	var err error
+	if t.ArgsOut[SimulatePolicyMethod][1] != nil {
+		err = t.ArgsOut[SimulatePolicyMethod][1].(error)
+	}
+	return results, err
+}
+
+func (t TestAPI) GetCacheStats(authenticatedUser api.RequestInfo) (*api.CacheStats, error) {
+	t.ArgsIn[GetCacheStatsMethod][0] = authenticatedUser
+	var stats *api.CacheStats
+	if t.ArgsOut[GetCacheStatsMethod][0] != nil {
+		stats = t.ArgsOut[GetCacheStatsMethod][0].(*api.CacheStats)
+	}
+	var err error
+	if t.ArgsOut[GetCacheStatsMethod][1] != nil {
+		err = t.ArgsOut[GetCacheStatsMethod][1].(error)
+	}
+	return stats, err
+}
+
+// AUDIT API
+
+func (t TestAPI) ListAuditEvents(authenticatedUser api.RequestInfo, filter *api.AuditFilter) ([]api.AuditEvent, int, error) {
+	t.ArgsIn[ListAuditEventsMethod][0] = authenticatedUser
+	t.ArgsIn[ListAuditEventsMethod][1] = filter
+
+	var events []api.AuditEvent
+	if t.ArgsOut[ListAuditEventsMethod][0] != nil {
+		events = t.ArgsOut[ListAuditEventsMethod][0].([]api.AuditEvent)
+	}
+	var total int
+	if t.ArgsOut[ListAuditEventsMethod][1] != nil {
+		total = t.ArgsOut[ListAuditEventsMethod][1].(int)
+	}
+	var err error
+	if t.ArgsOut[ListAuditEventsMethod][2] != nil {
+		err = t.ArgsOut[ListAuditEventsMethod][2].(error)
+	}
+	return events, total, err
+}
+
+// SERVICE ACCOUNT API
+
+func (t TestAPI) AddServiceAccount(requestInfo api.RequestInfo, name string, externalId string) (*api.ServiceAccount, string, error) {
+	t.ArgsIn[AddServiceAccountMethod][0] = requestInfo
+	t.ArgsIn[AddServiceAccountMethod][1] = name
+	t.ArgsIn[AddServiceAccountMethod][2] = externalId
+
+	var serviceAccount *api.ServiceAccount
+	if t.ArgsOut[AddServiceAccountMethod][0] != nil {
+		serviceAccount = t.ArgsOut[AddServiceAccountMethod][0].(*api.ServiceAccount)
+	}
+	var key string
+	if t.ArgsOut[AddServiceAccountMethod][1] != nil {
+		key = t.ArgsOut[AddServiceAccountMethod][1].(string)
+	}
+	var err error
+	if t.ArgsOut[AddServiceAccountMethod][2] != nil {
+		err = t.ArgsOut[AddServiceAccountMethod][2].(error)
+	}
+	return serviceAccount, key, err
+}
+
+func (t TestAPI) GetServiceAccountByName(requestInfo api.RequestInfo, name string) (*api.ServiceAccount, error) {
+	t.ArgsIn[GetServiceAccountByNameMethod][0] = requestInfo
+	t.ArgsIn[GetServiceAccountByNameMethod][1] = name
+
+	var serviceAccount *api.ServiceAccount
+	if t.ArgsOut[GetServiceAccountByNameMethod][0] != nil {
+		serviceAccount = t.ArgsOut[GetServiceAccountByNameMethod][0].(*api.ServiceAccount)
+	}
+	var err error
+	if t.ArgsOut[GetServiceAccountByNameMethod][1] != nil {
+		err = t.ArgsOut[GetServiceAccountByNameMethod][1].(error)
+	}
+	return serviceAccount, err
+}
+
+func (t TestAPI) ListServiceAccounts(requestInfo api.RequestInfo, filter *api.Filter) ([]string, int, error) {
+	t.ArgsIn[ListServiceAccountsMethod][0] = requestInfo
+	t.ArgsIn[ListServiceAccountsMethod][1] = filter
+
+	var serviceAccounts []string
+	if t.ArgsOut[ListServiceAccountsMethod][0] != nil {
+		serviceAccounts = t.ArgsOut[ListServiceAccountsMethod][0].([]string)
+	}
+	var total int
+	if t.ArgsOut[ListServiceAccountsMethod][1] != nil {
+		total = t.ArgsOut[ListServiceAccountsMethod][1].(int)
+	}
+	var err error
+	if t.ArgsOut[ListServiceAccountsMethod][2] != nil {
+		err = t.ArgsOut[ListServiceAccountsMethod][2].(error)
+	}
+	return serviceAccounts, total, err
+}
+
+func (t TestAPI) RemoveServiceAccount(requestInfo api.RequestInfo, name string) error {
+	t.ArgsIn[RemoveServiceAccountMethod][0] = requestInfo
+	t.ArgsIn[RemoveServiceAccountMethod][1] = name
+
+	var err error
+	if t.ArgsOut[RemoveServiceAccountMethod][0] != nil {
+		err = t.ArgsOut[RemoveServiceAccountMethod][0].(error)
+	}
+	return err
+}
+
+func (t TestAPI) AuthenticateServiceAccount(key string) (*api.ServiceAccount, error) {
+	t.ArgsIn[AuthenticateServiceAccountMethod][0] = key
+
+	var serviceAccount *api.ServiceAccount
+	if t.ArgsOut[AuthenticateServiceAccountMethod][0] != nil {
+		serviceAccount = t.ArgsOut[AuthenticateServiceAccountMethod][0].(*api.ServiceAccount)
+	}
+	var err error
+	if t.ArgsOut[AuthenticateServiceAccountMethod][1] != nil {
+		err = t.ArgsOut[AuthenticateServiceAccountMethod][1].(error)
+	}
+	return serviceAccount, err
+}
+
+// PROVISIONING API
+
+func (t TestAPI) ProvisionUser(requestInfo api.RequestInfo) error {
+	t.ArgsIn[ProvisionUserMethod][0] = requestInfo
+
+	var err error
+	if t.ArgsOut[ProvisionUserMethod][0] != nil {
+		err = t.ArgsOut[ProvisionUserMethod][0].(error)
+	}
+	return err
+}
+
 // Private helper methods
 
 func addQueryParams(filter *api.Filter, r *http.Request) {
@@ -0,0 +1,28 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/Tecsisa/foulkon/api"
+)
+
+// Provision authenticated users before handling requests, if worker provisions them
+func (wh *WorkerHandler) provisionUser(h http.Handler) http.Handler {
+	if wh.worker.ProvisioningApi == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestInfo := wh.GetRequestInfo(r)
+		if err := wh.worker.ProvisioningApi.ProvisionUser(requestInfo); err != nil {
+			apiError := err.(*api.Error)
+			switch apiError.Code {
+			case api.INVALID_PARAMETER_ERROR:
+				wh.RespondForbidden(r, requestInfo, w, apiError)
+			default: // Unexpected API error
+				wh.RespondInternalServerError(r, requestInfo, w)
+			}
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
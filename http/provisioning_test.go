@@ -0,0 +1,134 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/Tecsisa/foulkon/api"
+	"github.com/Tecsisa/foulkon/auth"
+	"github.com/Tecsisa/foulkon/foulkon"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestWorkerHandler_provisionUser(t *testing.T) {
+	testcases := map[string]struct {
+		admin bool
+		// Expected result
+		expectedStatusCode int
+		expectedAdmin      bool
+		expectedError      api.Error
+		// API Errors
+		provisionUserErr error
+	}{
+		"OkCase": {
+			expectedStatusCode: http.StatusOK,
+		},
+		"OkCaseAdmin": {
+			admin:              true,
+			expectedStatusCode: http.StatusOK,
+			expectedAdmin:      true,
+		},
+		"ErrorCaseInvalidUser": {
+			expectedStatusCode: http.StatusForbidden,
+			expectedError: api.Error{
+				Code:    api.INVALID_PARAMETER_ERROR,
+				Message: "Invalid parameter: externalId userID",
+			},
+			provisionUserErr: &api.Error{
+				Code:    api.INVALID_PARAMETER_ERROR,
+				Message: "Invalid parameter: externalId userID",
+			},
+		},
+		"ErrorCaseUnknownApiError": {
+			expectedStatusCode: http.StatusInternalServerError,
+			provisionUserErr: &api.Error{
+				Code:    api.UNKNOWN_API_ERROR,
+				Message: "Error",
+			},
+		},
+	}
+
+	// Worker with provisioning
+	worker := &foulkon.Worker{
+		Logger: &log.Logger{
+			Out:       bytes.NewBuffer([]byte{}),
+			Formatter: &log.TextFormatter{},
+			Hooks:     make(log.LevelHooks),
+			Level:     log.DebugLevel,
+		},
+		Authenticator:   auth.NewAuthenticator(authConnector, "admin", "admin"),
+		UserApi:         testApi,
+		ProvisioningApi: testApi,
+	}
+	provisioningServer := httptest.NewServer(WorkerHandlerRouter(worker))
+	defer provisioningServer.Close()
+
+	client := http.DefaultClient
+
+	for n, test := range testcases {
+		testApi.ArgsIn[ProvisionUserMethod][0] = nil
+		testApi.ArgsOut[ProvisionUserMethod][0] = test.provisionUserErr
+		testApi.ArgsIn[ListUsersMethod][0] = nil
+		testApi.ArgsOut[ListUsersMethod][0] = []string{}
+		testApi.ArgsOut[ListUsersMethod][1] = 0
+		testApi.ArgsOut[ListUsersMethod][2] = nil
+
+		req, err := http.NewRequest(http.MethodGet, provisioningServer.URL+USER_ROOT_URL, nil)
+		if err != nil {
+			t.Errorf("Test case %v. Unexpected error creating http request %v", n, err)
+			continue
+		}
+		if test.admin {
+			req.SetBasicAuth("admin", "admin")
+		}
+
+		res, err := client.Do(req)
+		if err != nil {
+			t.Errorf("Test case %v. Unexpected error calling server %v", n, err)
+			continue
+		}
+
+		// check status code
+		if test.expectedStatusCode != res.StatusCode {
+			t.Errorf("Test case %v. Received different http status code (wanted:%v / received:%v)", n, test.expectedStatusCode, res.StatusCode)
+			continue
+		}
+
+		// Check provisioned user
+		requestInfo, ok := testApi.ArgsIn[ProvisionUserMethod][0].(api.RequestInfo)
+		if !ok || requestInfo.Admin != test.expectedAdmin {
+			t.Errorf("Test %v failed. Received different provisioned user %v", n, testApi.ArgsIn[ProvisionUserMethod][0])
+			continue
+		}
+
+		switch res.StatusCode {
+		case http.StatusOK:
+			if testApi.ArgsIn[ListUsersMethod][0] == nil {
+				t.Errorf("Test %v failed. Request not handled after provisioning", n)
+				continue
+			}
+		case http.StatusInternalServerError: // Empty message so continue
+			continue
+		default:
+			if testApi.ArgsIn[ListUsersMethod][0] != nil {
+				t.Errorf("Test %v failed. Request handled after provisioning error", n)
+				continue
+			}
+			apiError := api.Error{}
+			err = json.NewDecoder(res.Body).Decode(&apiError)
+			if err != nil {
+				t.Errorf("Test case %v. Unexpected error parsing error response %v", n, err)
+				continue
+			}
+			// Check result
+			if diff := pretty.Compare(apiError, test.expectedError); diff != "" {
+				t.Errorf("Test %v failed. Received different error response (received/wanted) %v", n, diff)
+				continue
+			}
+		}
+	}
+}
@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/url"
-	"regexp"
 	"strings"
+	"time"
 
 	"github.com/Tecsisa/foulkon/api"
 	"github.com/Tecsisa/foulkon/foulkon"
@@ -17,65 +19,113 @@ import (
 
 const (
 	// Proxy error codes
-	INVALID_DEST_HOST_URL = "InvalidDestinationHostURL"
-	HOST_UNREACHABLE      = "HostUnreachableError"
-	INTERNAL_SERVER_ERROR = "InternalServerError"
-	FORBIDDEN_ERROR       = "ForbiddenError"
-)
+	INVALID_DEST_HOST_URL   = "InvalidDestinationHostURL"
+	HOST_UNREACHABLE        = "HostUnreachableError"
+	INTERNAL_SERVER_ERROR   = "InternalServerError"
+	FORBIDDEN_ERROR         = "ForbiddenError"
+	TOO_MANY_REQUESTS_ERROR = "TooManyRequestsError"
 
-var rUrnParam, _ = regexp.Compile(`\{(\w+)\}`)
+	// Context keys sent to worker to evaluate policy conditions
+	PROXY_CONTEXT_KEY_SOURCE_IP = api.CONTEXT_KEY_PROXY_PREFIX + "SourceIp"
+	PROXY_CONTEXT_KEY_METHOD    = api.CONTEXT_KEY_PROXY_PREFIX + "Method"
+)
 
-func (h *ProxyHandler) HandleRequest(resource foulkon.APIResource) httprouter.Handle {
+// HandleRequest returns the handle of a resource. Requests are sent to the host of the resource,
+// or to a host selected by the balancer of its upstream if it isn't nil. Requests are limited
+// by proxy rate limit and by the limiter of the resource if it isn't nil.
+func (h *ProxyHandler) HandleRequest(resource foulkon.APIResource, balancer *upstreamBalancer, limiter *rateLimiter) httprouter.Handle {
+	limiters := []*rateLimiter{limiter, h.rateLimiter}
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		requestID := uuid.NewV4().String()
 		w.Header().Set(REQUEST_ID_HEADER, requestID)
-		// Retrieve parameters to replace in URN
-		parameters := getUrnParameters(resource.Urn)
-		urn := resource.Urn
-		for _, p := range parameters {
-			urn = strings.Replace(urn, p[0], ps.ByName(p[1]), -1)
+		// Limits by client IP are checked before calling worker, and limits by user too if the user
+		// authenticated with the credentials is cached
+		cachedUser, userKnown := h.cache.getUser(r)
+		keys := []string{foulkon.RATE_LIMIT_KEY_IP}
+		if userKnown {
+			keys = append(keys, foulkon.RATE_LIMIT_KEY_USER)
 		}
-		if workerRequestID, err := h.checkAuthorization(r, urn, resource.Action); err == nil {
-			destURL, err := url.Parse(resource.Host)
-			if err != nil {
-				h.TransactionErrorLog(r, requestID, workerRequestID, fmt.Sprintf("Error creating destination host URL: %v", err.Error()))
-				h.RespondInternalServerError(w, getErrorMessage(INVALID_DEST_HOST_URL, "Invalid destination host"))
+		reservations, ok, wait := reserveRequest(r, limiters, cachedUser, keys...)
+		if !ok {
+			h.respondRateLimited(w, r, requestID, "None", false, wait)
+			return
+		}
+		// Retrieve URNs replacing their parameters with request values
+		workerRequestID, user, cached := "None", "", false
+		checks, err := getResourceChecks(r, ps, resource)
+		if err == nil {
+			if len(checks) == 1 {
+				workerRequestID, user, cached, err = h.checkAuthorization(r, checks[0].Urn, checks[0].Action)
+			} else {
+				workerRequestID, user, cached, err = h.checkAuthorizations(r, checks, resource.Combine)
+			}
+		}
+		if err == nil {
+			// Otherwise limits by user are checked when user is known, returning tokens of other limits if they deny it
+			if !userKnown {
+				if _, ok, wait := reserveRequest(r, limiters, user, foulkon.RATE_LIMIT_KEY_USER); !ok {
+					cancelReservations(reservations)
+					h.respondRateLimited(w, r, requestID, workerRequestID, cached, wait)
+					return
+				}
+			}
+			// Identity of the user is sent to destination host if it is enabled
+			if err := h.setIdentityHeaders(r, requestID, user, checks); err != nil {
+				h.TransactionErrorLog(r, requestID, workerRequestID, cached, fmt.Sprintf("Error signing identity headers: %v", err.Error()))
+				h.RespondInternalServerError(w, getErrorMessage(INTERNAL_SERVER_ERROR, "Internal server error. Contact the administrator"))
+				return
+			}
+			// Selected host of upstream is released when response is sent, recording if it failed
+			var dest destination
+			var host *upstreamHost
+			hostOk := true
+			if balancer != nil {
+				if host, err = balancer.pick(); err != nil {
+					h.TransactionErrorLog(r, requestID, workerRequestID, cached, fmt.Sprintf("Error selecting destination host: %v", err.Error()))
+					h.RespondInternalServerError(w, getErrorMessage(HOST_UNREACHABLE, "Error calling destination resource"))
+					return
+				}
+				defer func() {
+					balancer.done(host, hostOk)
+				}()
+				dest = balancer.getDestination(host)
+			} else {
+				destURL, err := url.Parse(resource.Host)
+				if err != nil {
+					h.TransactionErrorLog(r, requestID, workerRequestID, cached, fmt.Sprintf("Error creating destination host URL: %v", err.Error()))
+					h.RespondInternalServerError(w, getErrorMessage(INVALID_DEST_HOST_URL, "Invalid destination host"))
+					return
+				}
+				dest = destination{
+					url:            destURL,
+					client:         h.client,
+					connectTimeout: DEFAULT_CONNECT_TIMEOUT,
+					readTimeout:    h.proxy.ResponseTimeout,
+				}
+			}
+			// Upgraded connections are tunneled to destination host
+			if isUpgradeRequest(r) {
+				hostOk = h.handleUpgrade(w, r, dest, requestID, workerRequestID, cached)
 				return
 			}
-			r.URL.Host = destURL.Host
-			r.URL.Scheme = destURL.Scheme
-			// Clean request URI because net/http send method force this
-			r.RequestURI = ""
 			// Retrieve requested resource
-			res, err := h.client.Do(r)
+			res, err := dest.client.Do(getUpstreamRequest(r, dest.url))
 			if err != nil {
-				h.TransactionErrorLog(r, requestID, workerRequestID, fmt.Sprintf("Error calling to destination host resource: %v", err.Error()))
+				hostOk = false
+				h.TransactionErrorLog(r, requestID, workerRequestID, cached, fmt.Sprintf("Error calling to destination host resource: %v", err.Error()))
 				h.RespondInternalServerError(w, getErrorMessage(HOST_UNREACHABLE, "Error calling destination resource"))
 				return
 			}
+			defer res.Body.Close()
+			hostOk = !isHostFailure(res.StatusCode)
 
-			// Copy the response cookies
-			for _, cookie := range res.Cookies() {
-				http.SetCookie(w, cookie)
-			}
-			// Copy the response headers from the target server to the proxy response
-			for key, values := range res.Header {
-				for _, v := range values {
-					w.Header().Add(key, v)
-				}
-			}
-
-			buffer := new(bytes.Buffer)
-			if _, err := buffer.ReadFrom(res.Body); err != nil {
-				h.TransactionErrorLog(r, requestID, workerRequestID, fmt.Sprintf("Error reading response from destination: %v", err.Error()))
-				h.RespondInternalServerError(w, getErrorMessage(INTERNAL_SERVER_ERROR, "Error reading response from destination"))
+			if err := writeUpstreamResponse(w, res); err != nil {
+				h.TransactionErrorLog(r, requestID, workerRequestID, cached, fmt.Sprintf("Error reading response from destination: %v", err.Error()))
 				return
 			}
-			w.WriteHeader(res.StatusCode)
-			w.Write(buffer.Bytes())
-			h.TransactionLog(r, requestID, workerRequestID, "Request accepted")
+			h.TransactionLog(r, requestID, workerRequestID, cached, "Request accepted")
 		} else {
-			h.TransactionErrorLog(r, requestID, workerRequestID, fmt.Sprintf("Error in authorization: %v", err.Error()))
+			h.TransactionErrorLog(r, requestID, workerRequestID, cached, fmt.Sprintf("Error in authorization: %v", err.Error()))
 			apiError := err.(*api.Error)
 			switch apiError.Code {
 			case FORBIDDEN_ERROR:
@@ -90,51 +140,80 @@ func (h *ProxyHandler) HandleRequest(resource foulkon.APIResource) httprouter.Ha
 	}
 }
 
-func (h *ProxyHandler) checkAuthorization(r *http.Request, urn string, action string) (string, error) {
+// Respond to a request that exceeded a rate limit, with the time to wait before retrying it
+func (h *ProxyHandler) respondRateLimited(w http.ResponseWriter, r *http.Request, requestID string, workerRequestID string, cached bool, wait time.Duration) {
+	h.TransactionErrorLog(r, requestID, workerRequestID, cached, fmt.Sprintf("Rate limit exceeded, retry after %v", wait))
+	h.RespondTooManyRequests(w, getErrorMessage(TOO_MANY_REQUESTS_ERROR, "Too many requests, retry later"), wait)
+}
+
+// Check if request is authorized to do the action over the urn, using the cached decision if
+// there is one. It returns the id of the worker request that took the decision, the user
+// authenticated by it, and if it was cached.
+func (h *ProxyHandler) checkAuthorization(r *http.Request, urn string, action string) (string, string, bool, error) {
 	workerRequestID := "None"
-	if !isFullUrn(urn) {
-		return workerRequestID,
-			getErrorMessage(api.INVALID_PARAMETER_ERROR, fmt.Sprintf("Urn %v is a prefix, it would be a full urn resource", urn))
+	if err := validateCheck(urn, action); err != nil {
+		return workerRequestID, "", false, err
 	}
-	if err := api.AreValidResources([]string{urn}); err != nil {
-		return workerRequestID, err
+
+	key, cacheable := getDecisionCacheKey(r, urn, action)
+	if cacheable {
+		if workerRequestID, user, apiError, ok := h.cache.get(key); ok {
+			if apiError != nil {
+				return workerRequestID, user, true, apiError
+			}
+			return workerRequestID, user, true, nil
+		}
 	}
-	if err := api.AreValidActions([]string{action}); err != nil {
-		return workerRequestID, err
+
+	workerRequestID, user, decided, apiError := h.requestAuthorization(r, urn, action)
+	// Only decisions taken by worker are cached, not errors retrieving them
+	if cacheable && decided {
+		h.cache.set(key, workerRequestID, user, apiError)
+		h.cache.setUser(r, workerRequestID, user)
 	}
+	if apiError != nil {
+		return workerRequestID, user, false, apiError
+	}
+	return workerRequestID, user, false, nil
+}
 
+// Call worker to retrieve authorization. It returns the worker request id, the user authenticated
+// by worker, if worker decided to allow or deny the access, and the error if it wasn't allowed.
+func (h *ProxyHandler) requestAuthorization(r *http.Request, urn string, action string) (string, string, bool, *api.Error) {
+	workerRequestID := "None"
 	body, err := json.Marshal(AuthorizeResourcesRequest{
 		Action:    action,
 		Resources: []string{urn},
+		Context:   h.getWorkerContext(r),
 	})
 	if err != nil {
-		return workerRequestID, getErrorMessage(api.UNKNOWN_API_ERROR, err.Error())
+		return workerRequestID, "", false, getErrorMessage(api.UNKNOWN_API_ERROR, err.Error())
 	}
 
-	req, err := http.NewRequest(http.MethodPost, h.proxy.WorkerHost+RESOURCE_URL, bytes.NewBuffer(body))
+	req, err := h.newWorkerRequest(r, RESOURCE_URL, body)
 	if err != nil {
-		return workerRequestID, getErrorMessage(api.UNKNOWN_API_ERROR, err.Error())
+		return workerRequestID, "", false, getErrorMessage(api.UNKNOWN_API_ERROR, err.Error())
 	}
-	// Add all headers from original request
-	req.Header = r.Header
 	// Call worker to retrieve authorization
-	res, err := h.client.Do(req)
+	res, err := h.workerClient.Do(req)
 	if err != nil {
-		return workerRequestID, getErrorMessage(HOST_UNREACHABLE, err.Error())
+		return workerRequestID, "", false, getErrorMessage(HOST_UNREACHABLE, err.Error())
 	}
+	defer res.Body.Close()
 
 	workerRequestID = res.Header.Get(REQUEST_ID_HEADER)
+	user := res.Header.Get(AUTHENTICATED_USER_HEADER)
 
 	switch res.StatusCode {
 	case http.StatusUnauthorized:
-		return workerRequestID, getErrorMessage(FORBIDDEN_ERROR, "Unauthenticated user")
+		return workerRequestID, user, false, getErrorMessage(FORBIDDEN_ERROR, "Unauthenticated user")
 	case http.StatusForbidden:
-		return workerRequestID, getErrorMessage(FORBIDDEN_ERROR, fmt.Sprintf("Restricted access to urn %v", urn))
+		return workerRequestID, user, true, getErrorMessage(FORBIDDEN_ERROR, fmt.Sprintf("Restricted access to urn %v", urn))
 	case http.StatusOK:
 		authzResponse := AuthorizeResourcesResponse{}
 		err = json.NewDecoder(res.Body).Decode(&authzResponse)
 		if err != nil {
-			return workerRequestID, getErrorMessage(api.UNKNOWN_API_ERROR, fmt.Sprintf("Error parsing foulkon response %v", err.Error()))
+			return workerRequestID, user, false, getErrorMessage(api.UNKNOWN_API_ERROR, fmt.Sprintf("Error parsing foulkon response %v", err.Error()))
 		}
 
 		// Check urns allowed to find target urn
@@ -147,26 +226,171 @@ func (h *ProxyHandler) checkAuthorization(r *http.Request, urn string, action st
 		}
 
 		if !allowed {
-			return workerRequestID,
+			return workerRequestID, user, true,
 				getErrorMessage(FORBIDDEN_ERROR, fmt.Sprintf("No access for urn %v received from server", urn))
 		}
 
-		return workerRequestID, nil
+		return workerRequestID, user, true, nil
 	default:
-		return workerRequestID,
+		return workerRequestID, user, false,
 			getErrorMessage(INTERNAL_SERVER_ERROR, fmt.Sprintf("There was a problem retrieving authorization, status code %v", res.StatusCode))
 	}
 }
 
-// Check parameters in URN to replace with URI parameters
-func getUrnParameters(urn string) [][]string {
-	match := rUrnParam.FindAllStringSubmatch(urn, -1)
-	if match != nil && len(match) > 0 {
-		return match
+// Create a request to worker with all headers from original request. Proxy secret is only sent if
+// it's configured, so clients can't send it.
+func (h *ProxyHandler) newWorkerRequest(r *http.Request, url string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodPost, h.proxy.WorkerHost+url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	// Copied, original headers are sent to destination hosts
+	for key, values := range r.Header {
+		req.Header[key] = append([]string{}, values...)
+	}
+	req.Header.Del(PROXY_SECRET_HEADER)
+	if h.proxy.WorkerSecret != "" {
+		req.Header.Set(PROXY_SECRET_HEADER, h.proxy.WorkerSecret)
+	}
+	return req, nil
+}
+
+// Retrieve context sent to worker. Worker only accepts proxy keys from proxies with secret, so
+// they aren't sent without it.
+func (h *ProxyHandler) getWorkerContext(r *http.Request) map[string]string {
+	if h.proxy.WorkerSecret == "" {
+		return nil
+	}
+	return getProxyContext(r)
+}
+
+// Retrieve attributes of the original request, so worker can evaluate conditions with them
+func getProxyContext(r *http.Request) map[string]string {
+	context := map[string]string{
+		PROXY_CONTEXT_KEY_METHOD: r.Method,
 	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		context[PROXY_CONTEXT_KEY_SOURCE_IP] = host
+	}
+	return context
+}
+
+// Hop-by-hop headers, removed when request and response are forwarded. See RFC 2616, section 13.5.1
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Returns the request sent to destination host, a copy of the original one without hop-by-hop headers
+func getUpstreamRequest(r *http.Request, destURL *url.URL) *http.Request {
+	req := new(http.Request)
+	*req = *r
+	u := *r.URL
+	u.Host = destURL.Host
+	u.Scheme = destURL.Scheme
+	req.URL = &u
+	// Clean request URI because net/http send method force this
+	req.RequestURI = ""
+	req.Close = false
+	if r.ContentLength == 0 {
+		req.Body = nil
+	}
+	req.Header = http.Header{}
+	copyHeader(req.Header, r.Header)
+	removeHopHeaders(req.Header)
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if prior, ok := req.Header["X-Forwarded-For"]; ok {
+			host = strings.Join(prior, ", ") + ", " + host
+		}
+		req.Header.Set("X-Forwarded-For", host)
+	}
+	return req
+}
+
+// Copy a response from destination host to the proxy response, announcing the trailers that
+// will be sent after the body. Body is streamed, so status code is already sent if it fails.
+func writeUpstreamResponse(w http.ResponseWriter, res *http.Response) error {
+	copyHeader(w.Header(), res.Header)
+	removeHopHeaders(w.Header())
+	trailers := make([]string, 0, len(res.Trailer))
+	for key := range res.Trailer {
+		trailers = append(trailers, key)
+	}
+	if len(trailers) > 0 {
+		w.Header().Set("Trailer", strings.Join(trailers, ", "))
+	}
+	w.WriteHeader(res.StatusCode)
+
+	if err := copyResponseBody(w, res.Body); err != nil {
+		return err
+	}
+	copyHeader(w.Header(), res.Trailer)
 	return nil
 }
 
+// Copy the body of a response, flushing after every write so streamed responses are received
+// without delay
+func copyResponseBody(w http.ResponseWriter, body io.Reader) error {
+	flusher, _ := w.(http.Flusher)
+	buffer := make([]byte, 32*1024)
+	for {
+		n, err := body.Read(buffer)
+		if n > 0 {
+			if _, werr := w.Write(buffer[:n]); werr != nil {
+				return werr
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func copyHeader(dst http.Header, src http.Header) {
+	for key, values := range src {
+		for _, v := range values {
+			dst.Add(key, v)
+		}
+	}
+}
+
+// Remove hop-by-hop headers, and the headers listed in Connection header
+func removeHopHeaders(header http.Header) {
+	for _, value := range header["Connection"] {
+		for _, key := range strings.Split(value, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				header.Del(key)
+			}
+		}
+	}
+	for _, key := range hopHeaders {
+		header.Del(key)
+	}
+}
+
+// Check that urn and action are valid to ask worker
+func validateCheck(urn string, action string) error {
+	if !isFullUrn(urn) {
+		return getErrorMessage(api.INVALID_PARAMETER_ERROR, fmt.Sprintf("Urn %v is a prefix, it would be a full urn resource", urn))
+	}
+	if err := api.AreValidResources([]string{urn}); err != nil {
+		return err
+	}
+	return api.AreValidActions([]string{action})
+}
+
 func isFullUrn(resource string) bool {
 	return !strings.ContainsAny(resource, "*")
 }
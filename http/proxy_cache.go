@@ -0,0 +1,155 @@
+package http
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Tecsisa/foulkon/api"
+)
+
+// TYPE DEFINITIONS
+
+// Cache of the authorization decisions received from worker, so proxy doesn't call worker for
+// every request of the same user. Decisions depend on the credentials, action, resource and
+// the context sent to worker, so all of them are part of the key. Entries expire after TTL and
+// least recently used ones are evicted when cache is full. All methods can be called on a nil
+// cache, which never stores decisions.
+type decisionCache struct {
+	mutex sync.Mutex
+
+	size int
+	ttl  time.Duration
+
+	// Entries ordered by use, most recent first
+	entries map[string]*list.Element
+	lru     *list.List
+
+	// Current time, replaced in tests
+	now func() time.Time
+}
+
+type decisionCacheEntry struct {
+	key string
+	// Worker request that took the decision, and user authenticated by it
+	workerRequestID string
+	user            string
+	// Nil if access was allowed
+	err      *api.Error
+	expireAt time.Time
+}
+
+// Returns a cache with the maximum number of decisions and time to live specified, or nil,
+// a disabled cache, if size or TTL aren't greater than 0.
+func newDecisionCache(size int, ttl time.Duration) *decisionCache {
+	if size < 1 || ttl <= 0 {
+		return nil
+	}
+	return &decisionCache{
+		size:    size,
+		ttl:     ttl,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+		now:     time.Now,
+	}
+}
+
+// Returns the decision stored for the key if it isn't expired
+func (c *decisionCache) get(key string) (string, string, *api.Error, bool) {
+	if c == nil {
+		return "", "", nil, false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return "", "", nil, false
+	}
+	entry := element.Value.(*decisionCacheEntry)
+	if c.now().After(entry.expireAt) {
+		c.remove(element)
+		return "", "", nil, false
+	}
+	c.lru.MoveToFront(element)
+	return entry.workerRequestID, entry.user, entry.err, true
+}
+
+// Stores a decision, evicting the least recently used one if cache is full
+func (c *decisionCache) set(key string, workerRequestID string, user string, err *api.Error) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	if c.lru.Len() >= c.size {
+		c.remove(c.lru.Back())
+	}
+	c.entries[key] = c.lru.PushFront(&decisionCacheEntry{
+		key:             key,
+		workerRequestID: workerRequestID,
+		user:            user,
+		err:             err,
+		expireAt:        c.now().Add(c.ttl),
+	})
+}
+
+// Remove an entry, caller must hold the lock
+func (c *decisionCache) remove(element *list.Element) {
+	entry := c.lru.Remove(element).(*decisionCacheEntry)
+	delete(c.entries, entry.key)
+}
+
+// Stores the user authenticated by worker with the credentials of a request, so it is known
+// before calling worker in next requests
+func (c *decisionCache) setUser(r *http.Request, workerRequestID string, user string) {
+	if key, cacheable := getUserCacheKey(r); cacheable && user != "" {
+		c.set(key, workerRequestID, user, nil)
+	}
+}
+
+// Returns the user authenticated with the credentials of a request if it is cached
+func (c *decisionCache) getUser(r *http.Request) (string, bool) {
+	key, cacheable := getUserCacheKey(r)
+	if !cacheable {
+		return "", false
+	}
+	_, user, _, ok := c.get(key)
+	return user, ok
+}
+
+// Returns the cache key of an authorization request. Requests without credentials aren't
+// cached, and credentials are hashed so they aren't kept in memory.
+func getDecisionCacheKey(r *http.Request, urn string, action string) (string, bool) {
+	credentials, cacheable := getUserCacheKey(r)
+	if !cacheable {
+		return "", false
+	}
+	context := getProxyContext(r)
+	return strings.Join([]string{
+		credentials,
+		action,
+		urn,
+		context[PROXY_CONTEXT_KEY_METHOD],
+		context[PROXY_CONTEXT_KEY_SOURCE_IP],
+	}, " "), true
+}
+
+// Returns the cache key of the user authenticated with the credentials of a request, the hash of
+// the credentials. Keys of decisions start with it, so they are always different.
+func getUserCacheKey(r *http.Request) (string, bool) {
+	credentials := r.Header.Get("Authorization")
+	if credentials == "" {
+		return "", false
+	}
+	hash := sha256.Sum256([]byte(credentials))
+	return hex.EncodeToString(hash[:]), true
+}
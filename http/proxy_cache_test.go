@@ -0,0 +1,191 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/Tecsisa/foulkon/foulkon"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestDecisionCache(t *testing.T) {
+	now := time.Date(2016, time.October, 1, 10, 0, 0, 0, time.UTC)
+	cache := newDecisionCache(2, time.Second)
+	cache.now = func() time.Time { return now }
+	forbidden := getErrorMessage(FORBIDDEN_ERROR, "")
+
+	// Miss
+	if _, _, _, ok := cache.get("key1"); ok {
+		t.Errorf("Test failed. Unexpected decision for empty cache")
+	}
+
+	// Hit
+	cache.set("key1", "WorkerRequestID1", "user1", nil)
+	cache.set("key2", "WorkerRequestID2", "user2", forbidden)
+	workerRequestID, user, apiError, ok := cache.get("key2")
+	if !ok {
+		t.Fatalf("Test failed. Expected cached decision")
+	}
+	if diff := pretty.Compare(apiError, forbidden); diff != "" || workerRequestID != "WorkerRequestID2" || user != "user2" {
+		t.Errorf("Test failed. Received worker request %v, user %v and different error (received/wanted) %v", workerRequestID, user, diff)
+	}
+
+	// Evict least recently used decision
+	cache.set("key3", "WorkerRequestID3", "user3", nil)
+	if _, _, _, ok := cache.get("key1"); ok {
+		t.Errorf("Test failed. Least recently used decision wasn't evicted")
+	}
+	if _, _, _, ok := cache.get("key2"); !ok {
+		t.Errorf("Test failed. Recently used decision was evicted")
+	}
+
+	// Expiration
+	now = now.Add(2 * time.Second)
+	if _, _, _, ok := cache.get("key3"); ok {
+		t.Errorf("Test failed. Expired decision was returned")
+	}
+
+	// Disabled
+	var disabled *decisionCache
+	disabled.set("key1", "WorkerRequestID1", "user1", nil)
+	if _, _, _, ok := disabled.get("key1"); ok {
+		t.Errorf("Test failed. Disabled cache returned a decision")
+	}
+	if newDecisionCache(0, time.Second) != nil {
+		t.Errorf("Test failed. Cache without size is enabled")
+	}
+}
+
+func TestProxyHandler_checkAuthorizationCache(t *testing.T) {
+	workerCalls := 0
+	statusCode := http.StatusOK
+	worker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		workerCalls++
+		w.Header().Set(REQUEST_ID_HEADER, "WorkerRequestID")
+		w.Header().Set(AUTHENTICATED_USER_HEADER, "user")
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(AuthorizeResourcesResponse{
+			ResourcesAllowed: []string{"urn:ews:example:instance1:resource/user"},
+		})
+	}))
+	defer worker.Close()
+
+	handler := &ProxyHandler{
+		proxy: &foulkon.Proxy{
+			WorkerHost: worker.URL,
+			Logger: &log.Logger{
+				Out:       bytes.NewBuffer([]byte{}),
+				Formatter: &log.TextFormatter{},
+				Hooks:     make(log.LevelHooks),
+				Level:     log.DebugLevel,
+			},
+		},
+		workerClient: http.DefaultClient,
+		cache:        newDecisionCache(10, time.Minute),
+	}
+
+	testcases := []struct {
+		name          string
+		authorization string
+		urn           string
+		statusCode    int
+		expectedCalls int
+		expectedCache bool
+		expectedError error
+	}{
+		{
+			name:          "Miss",
+			authorization: "Bearer token1",
+			urn:           "urn:ews:example:instance1:resource/user",
+			statusCode:    http.StatusOK,
+			expectedCalls: 1,
+		},
+		{
+			name:          "Hit",
+			authorization: "Bearer token1",
+			urn:           "urn:ews:example:instance1:resource/user",
+			statusCode:    http.StatusInternalServerError,
+			expectedCalls: 1,
+			expectedCache: true,
+		},
+		{
+			name:          "MissOtherUser",
+			authorization: "Bearer token2",
+			urn:           "urn:ews:example:instance1:resource/user",
+			statusCode:    http.StatusForbidden,
+			expectedCalls: 2,
+			expectedError: getErrorMessage(FORBIDDEN_ERROR, "Restricted access to urn urn:ews:example:instance1:resource/user"),
+		},
+		{
+			name:          "HitDenied",
+			authorization: "Bearer token2",
+			urn:           "urn:ews:example:instance1:resource/user",
+			statusCode:    http.StatusOK,
+			expectedCalls: 2,
+			expectedCache: true,
+			expectedError: getErrorMessage(FORBIDDEN_ERROR, "Restricted access to urn urn:ews:example:instance1:resource/user"),
+		},
+		{
+			name:          "MissOtherUrn",
+			authorization: "Bearer token1",
+			urn:           "urn:ews:example:instance1:resource/other",
+			statusCode:    http.StatusOK,
+			expectedCalls: 3,
+			expectedError: getErrorMessage(FORBIDDEN_ERROR, "No access for urn urn:ews:example:instance1:resource/other received from server"),
+		},
+		{
+			name:          "ErrorNotCached",
+			authorization: "Bearer token3",
+			urn:           "urn:ews:example:instance1:resource/user",
+			statusCode:    http.StatusInternalServerError,
+			expectedCalls: 4,
+			expectedError: getErrorMessage(INTERNAL_SERVER_ERROR, "There was a problem retrieving authorization, status code 500"),
+		},
+		{
+			name:          "ErrorNotCachedRetry",
+			authorization: "Bearer token3",
+			urn:           "urn:ews:example:instance1:resource/user",
+			statusCode:    http.StatusOK,
+			expectedCalls: 5,
+		},
+		{
+			name:          "UnauthenticatedNotCached",
+			urn:           "urn:ews:example:instance1:resource/user",
+			statusCode:    http.StatusOK,
+			expectedCalls: 6,
+		},
+		{
+			name:          "UnauthenticatedNotCachedRetry",
+			urn:           "urn:ews:example:instance1:resource/user",
+			statusCode:    http.StatusOK,
+			expectedCalls: 7,
+		},
+	}
+
+	for _, test := range testcases {
+		statusCode = test.statusCode
+		r, _ := http.NewRequest(http.MethodGet, "/resource", nil)
+		r.RemoteAddr = "127.0.0.1:8080"
+		if test.authorization != "" {
+			r.Header.Set("Authorization", test.authorization)
+		}
+		workerRequestID, user, cached, err := handler.checkAuthorization(r, test.urn, "example:user")
+		if diff := pretty.Compare(err, test.expectedError); diff != "" {
+			t.Errorf("Test %v failed. Received different error (received/wanted) %v", test.name, diff)
+		}
+		if cached != test.expectedCache {
+			t.Errorf("Test %v failed. Received cached %v, wanted %v", test.name, cached, test.expectedCache)
+		}
+		if workerRequestID != "WorkerRequestID" || user != "user" {
+			t.Errorf("Test %v failed. Received worker request id %v and user %v", test.name, workerRequestID, user)
+		}
+		if workerCalls != test.expectedCalls {
+			t.Errorf("Test %v failed. Received %v worker calls, wanted %v", test.name, workerCalls, test.expectedCalls)
+		}
+	}
+}
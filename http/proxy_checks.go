@@ -0,0 +1,193 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Tecsisa/foulkon/api"
+	"github.com/Tecsisa/foulkon/foulkon"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Returns the checks of a resource with their URNs retrieved from request. Urn and action of the
+// resource are the first check, followed by the additional ones.
+func getResourceChecks(r *http.Request, ps httprouter.Params, resource foulkon.APIResource) ([]foulkon.ResourceCheck, error) {
+	checks := []foulkon.ResourceCheck{}
+	if resource.Urn != "" || len(resource.Checks) == 0 {
+		checks = append(checks, foulkon.ResourceCheck{
+			Urn:    resource.Urn,
+			Action: resource.Action,
+		})
+	}
+	checks = append(checks, resource.Checks...)
+
+	for i, check := range checks {
+		urn, err := getUrn(r, ps, check.Urn)
+		if err != nil {
+			return nil, err
+		}
+		checks[i].Urn = urn
+	}
+	return checks, nil
+}
+
+// Check if request is authorized to do several actions over urns, combining them with all or any
+// semantics. Cached decisions are used, and the other ones are retrieved from worker in a single
+// request. It returns the id of the worker request that took the decision, the user authenticated
+// by worker, and if it was cached.
+func (h *ProxyHandler) checkAuthorizations(r *http.Request, checks []foulkon.ResourceCheck, combine string) (string, string, bool, error) {
+	for _, check := range checks {
+		if err := validateCheck(check.Urn, check.Action); err != nil {
+			return "None", "", false, err
+		}
+	}
+
+	decisions := make([]checkDecision, len(checks))
+	keys := make([]string, len(checks))
+	pending := []foulkon.ResourceCheck{}
+	for i, check := range checks {
+		key, cacheable := getDecisionCacheKey(r, check.Urn, check.Action)
+		if cacheable {
+			keys[i] = key
+			if workerRequestID, user, apiError, ok := h.cache.get(key); ok {
+				decisions[i] = checkDecision{known: true, allowed: apiError == nil, workerRequestID: workerRequestID, user: user}
+				continue
+			}
+		}
+		pending = append(pending, check)
+	}
+
+	// Cached decisions can be enough to know the result
+	if decision, decided, err := combineDecisions(checks, decisions, combine); decided {
+		return decision.workerRequestID, decision.user, true, err
+	}
+
+	workerRequestID, user, results, apiError := h.requestAuthorizationBatch(r, pending)
+	if apiError != nil {
+		return workerRequestID, user, false, apiError
+	}
+	h.cache.setUser(r, workerRequestID, user)
+	for i, check := range checks {
+		if decisions[i].known {
+			continue
+		}
+		allowed := results[getCheckKey(check)]
+		decisions[i] = checkDecision{known: true, allowed: allowed, workerRequestID: workerRequestID, user: user}
+		// Decisions are cached like the ones of single checks
+		if keys[i] != "" {
+			var decisionError *api.Error
+			if !allowed {
+				decisionError = getErrorMessage(FORBIDDEN_ERROR, fmt.Sprintf("No access for urn %v received from server", check.Urn))
+			}
+			h.cache.set(keys[i], workerRequestID, user, decisionError)
+		}
+	}
+
+	decision, _, err := combineDecisions(checks, decisions, combine)
+	return decision.workerRequestID, decision.user, false, err
+}
+
+// Call worker to retrieve authorization of several checks in a single request. It returns the
+// worker request id, the user authenticated by worker, and if each check is allowed by its key.
+func (h *ProxyHandler) requestAuthorizationBatch(r *http.Request, checks []foulkon.ResourceCheck) (string, string, map[string]bool, *api.Error) {
+	workerRequestID := "None"
+	request := AuthorizeResourcesBatchRequest{
+		Checks:  []api.AuthorizationCheck{},
+		Context: h.getWorkerContext(r),
+	}
+	for _, check := range checks {
+		request.Checks = append(request.Checks, api.AuthorizationCheck{
+			Action:    check.Action,
+			Resources: []string{check.Urn},
+		})
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return workerRequestID, "", nil, getErrorMessage(api.UNKNOWN_API_ERROR, err.Error())
+	}
+
+	req, err := h.newWorkerRequest(r, RESOURCE_BATCH_URL, body)
+	if err != nil {
+		return workerRequestID, "", nil, getErrorMessage(api.UNKNOWN_API_ERROR, err.Error())
+	}
+	res, err := h.workerClient.Do(req)
+	if err != nil {
+		return workerRequestID, "", nil, getErrorMessage(HOST_UNREACHABLE, err.Error())
+	}
+	defer res.Body.Close()
+
+	workerRequestID = res.Header.Get(REQUEST_ID_HEADER)
+	user := res.Header.Get(AUTHENTICATED_USER_HEADER)
+
+	switch res.StatusCode {
+	case http.StatusUnauthorized:
+		return workerRequestID, user, nil, getErrorMessage(FORBIDDEN_ERROR, "Unauthenticated user")
+	case http.StatusForbidden:
+		return workerRequestID, user, nil, getErrorMessage(FORBIDDEN_ERROR, "Restricted access to resources")
+	case http.StatusBadRequest:
+		return workerRequestID, user, nil, getErrorMessage(api.INVALID_PARAMETER_ERROR, "Invalid authorization checks")
+	case http.StatusOK:
+		response := AuthorizeResourcesBatchResponse{}
+		if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+			return workerRequestID, user, nil, getErrorMessage(api.UNKNOWN_API_ERROR, fmt.Sprintf("Error parsing foulkon response %v", err.Error()))
+		}
+		results := map[string]bool{}
+		for _, result := range response.Results {
+			results[getCheckKey(foulkon.ResourceCheck{Urn: result.Urn, Action: result.Action})] = result.Allowed
+		}
+		return workerRequestID, user, results, nil
+	default:
+		return workerRequestID, user, nil,
+			getErrorMessage(INTERNAL_SERVER_ERROR, fmt.Sprintf("There was a problem retrieving authorization, status code %v", res.StatusCode))
+	}
+}
+
+// PRIVATE HELPER METHODS
+
+// Decision of a check, unknown if it isn't cached and worker wasn't called yet
+type checkDecision struct {
+	known           bool
+	allowed         bool
+	workerRequestID string
+	user            string
+}
+
+// Combine the decisions of the checks. It returns the decision that took the result, if result
+// can be known with the known decisions, and the error identifying the failing checks if access
+// isn't allowed.
+func combineDecisions(checks []foulkon.ResourceCheck, decisions []checkDecision, combine string) (checkDecision, bool, error) {
+	unknown := false
+	denied := []string{}
+	for i, check := range checks {
+		decision := decisions[i]
+		switch {
+		case !decision.known:
+			unknown = true
+		case decision.allowed && combine == foulkon.COMBINE_ANY:
+			return decision, true, nil
+		case !decision.allowed && combine != foulkon.COMBINE_ANY:
+			return decision, true,
+				getErrorMessage(FORBIDDEN_ERROR, fmt.Sprintf("No access for urn %v with action %v received from server", check.Urn, check.Action))
+		case !decision.allowed:
+			denied = append(denied, fmt.Sprintf("urn %v with action %v", check.Urn, check.Action))
+		}
+	}
+	if unknown {
+		return checkDecision{}, false, nil
+	}
+
+	// All checks are allowed, or all of them are denied with any semantics
+	decision := decisions[len(decisions)-1]
+	if combine == foulkon.COMBINE_ANY {
+		return decision, true,
+			getErrorMessage(FORBIDDEN_ERROR, fmt.Sprintf("No access for any of %v received from server", strings.Join(denied, ", ")))
+	}
+	return decision, true, nil
+}
+
+// Key of a check in worker results
+func getCheckKey(check foulkon.ResourceCheck) string {
+	return check.Action + " " + check.Urn
+}
@@ -0,0 +1,281 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/Tecsisa/foulkon/api"
+	"github.com/Tecsisa/foulkon/foulkon"
+	"github.com/julienschmidt/httprouter"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestGetResourceChecks(t *testing.T) {
+	testcases := map[string]struct {
+		resource       foulkon.APIResource
+		expectedChecks []foulkon.ResourceCheck
+		expectedError  error
+	}{
+		"OkCaseSingleCheck": {
+			resource: foulkon.APIResource{
+				Urn:    "urn:ews:example:instance1:item/{id}",
+				Action: "example:read",
+			},
+			expectedChecks: []foulkon.ResourceCheck{
+				{Urn: "urn:ews:example:instance1:item/item1", Action: "example:read"},
+			},
+		},
+		"OkCaseSeveralChecks": {
+			resource: foulkon.APIResource{
+				Urn:    "urn:ews:example:instance1:item/{id}",
+				Action: "example:read",
+				Checks: []foulkon.ResourceCheck{
+					{Urn: "urn:ews:example:instance1:folder/{query.to}", Action: "example:write"},
+				},
+			},
+			expectedChecks: []foulkon.ResourceCheck{
+				{Urn: "urn:ews:example:instance1:item/item1", Action: "example:read"},
+				{Urn: "urn:ews:example:instance1:folder/folder2", Action: "example:write"},
+			},
+		},
+		"OkCaseOnlyChecks": {
+			resource: foulkon.APIResource{
+				Checks: []foulkon.ResourceCheck{
+					{Urn: "urn:ews:example:instance1:folder/{query.to}", Action: "example:write"},
+				},
+			},
+			expectedChecks: []foulkon.ResourceCheck{
+				{Urn: "urn:ews:example:instance1:folder/folder2", Action: "example:write"},
+			},
+		},
+		"ErrorCaseInvalidUrnParameter": {
+			resource: foulkon.APIResource{
+				Urn:    "urn:ews:example:instance1:item/{id}",
+				Action: "example:read",
+				Checks: []foulkon.ResourceCheck{
+					{Urn: "urn:ews:example:instance1:folder/{query.from}", Action: "example:write"},
+				},
+			},
+			expectedError: &api.Error{
+				Code:    api.INVALID_PARAMETER_ERROR,
+				Message: "Invalid urn parameter {query.from}: ",
+			},
+		},
+	}
+
+	for n, test := range testcases {
+		r, _ := http.NewRequest(http.MethodPost, "/items/item1?to=folder2", nil)
+		checks, err := getResourceChecks(r, httprouter.Params{{Key: "id", Value: "item1"}}, test.resource)
+		if diff := pretty.Compare(err, test.expectedError); diff != "" {
+			t.Errorf("Test %v failed. Received different error (received/wanted) %v", n, diff)
+			continue
+		}
+		if diff := pretty.Compare(checks, test.expectedChecks); diff != "" {
+			t.Errorf("Test %v failed. Received different checks (received/wanted) %v", n, diff)
+		}
+	}
+}
+
+func TestProxyHandler_checkAuthorizations(t *testing.T) {
+	readItem := foulkon.ResourceCheck{Urn: "urn:ews:example:instance1:item/item1", Action: "example:read"}
+	writeFolder := foulkon.ResourceCheck{Urn: "urn:ews:example:instance1:folder/folder2", Action: "example:write"}
+	writeOther := foulkon.ResourceCheck{Urn: "urn:ews:example:instance1:folder/other", Action: "example:write"}
+	allowed := map[string]bool{
+		getCheckKey(readItem):    true,
+		getCheckKey(writeFolder): true,
+	}
+
+	var received []api.AuthorizationCheck
+	// Status of worker responses with errors
+	var workerStatus int
+	worker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := AuthorizeResourcesBatchRequest{}
+		json.NewDecoder(r.Body).Decode(&request)
+		received = request.Checks
+		if workerStatus != 0 {
+			w.Header().Set(REQUEST_ID_HEADER, "WorkerRequestID")
+			w.Header().Set(AUTHENTICATED_USER_HEADER, "user")
+			w.WriteHeader(workerStatus)
+			return
+		}
+		response := AuthorizeResourcesBatchResponse{}
+		for _, check := range request.Checks {
+			for _, urn := range check.Resources {
+				response.Results = append(response.Results, api.AuthorizationResult{
+					Action:  check.Action,
+					Urn:     urn,
+					Allowed: allowed[getCheckKey(foulkon.ResourceCheck{Urn: urn, Action: check.Action})],
+				})
+			}
+		}
+		w.Header().Set(REQUEST_ID_HEADER, "WorkerRequestID")
+		w.Header().Set(AUTHENTICATED_USER_HEADER, "user")
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer worker.Close()
+
+	testcases := []struct {
+		name          string
+		checks        []foulkon.ResourceCheck
+		combine       string
+		withCache     bool
+		workerStatus  int
+		expectedSent  []api.AuthorizationCheck
+		expectedCache bool
+		expectedUser  string
+		expectedError error
+	}{
+		{
+			name:         "OkCaseAll",
+			checks:       []foulkon.ResourceCheck{readItem, writeFolder},
+			combine:      foulkon.COMBINE_ALL,
+			expectedUser: "user",
+			expectedSent: []api.AuthorizationCheck{
+				{Action: readItem.Action, Resources: []string{readItem.Urn}},
+				{Action: writeFolder.Action, Resources: []string{writeFolder.Urn}},
+			},
+		},
+		{
+			name:         "ErrorCaseAllDenied",
+			checks:       []foulkon.ResourceCheck{readItem, writeOther},
+			combine:      foulkon.COMBINE_ALL,
+			expectedUser: "user",
+			expectedSent: []api.AuthorizationCheck{
+				{Action: readItem.Action, Resources: []string{readItem.Urn}},
+				{Action: writeOther.Action, Resources: []string{writeOther.Urn}},
+			},
+			expectedError: getErrorMessage(FORBIDDEN_ERROR, "No access for urn urn:ews:example:instance1:folder/other with action example:write received from server"),
+		},
+		{
+			name:         "OkCaseAny",
+			checks:       []foulkon.ResourceCheck{writeOther, readItem},
+			combine:      foulkon.COMBINE_ANY,
+			expectedUser: "user",
+			expectedSent: []api.AuthorizationCheck{
+				{Action: writeOther.Action, Resources: []string{writeOther.Urn}},
+				{Action: readItem.Action, Resources: []string{readItem.Urn}},
+			},
+		},
+		{
+			name:         "ErrorCaseAnyDenied",
+			checks:       []foulkon.ResourceCheck{writeOther, {Urn: "urn:ews:example:instance1:item/item2", Action: "example:read"}},
+			combine:      foulkon.COMBINE_ANY,
+			expectedUser: "user",
+			expectedSent: []api.AuthorizationCheck{
+				{Action: writeOther.Action, Resources: []string{writeOther.Urn}},
+				{Action: "example:read", Resources: []string{"urn:ews:example:instance1:item/item2"}},
+			},
+			expectedError: getErrorMessage(FORBIDDEN_ERROR, "No access for any of urn urn:ews:example:instance1:folder/other with action example:write, "+
+				"urn urn:ews:example:instance1:item/item2 with action example:read received from server"),
+		},
+		{
+			name:         "OkCaseCacheMiss",
+			checks:       []foulkon.ResourceCheck{readItem, writeOther},
+			combine:      foulkon.COMBINE_ANY,
+			expectedUser: "user",
+			withCache:    true,
+			expectedSent: []api.AuthorizationCheck{
+				{Action: readItem.Action, Resources: []string{readItem.Urn}},
+				{Action: writeOther.Action, Resources: []string{writeOther.Urn}},
+			},
+		},
+		{
+			name:          "OkCaseCacheHit",
+			checks:        []foulkon.ResourceCheck{readItem, writeOther},
+			combine:       foulkon.COMBINE_ANY,
+			expectedUser:  "user",
+			withCache:     true,
+			expectedCache: true,
+		},
+		{
+			name:         "OkCaseCachedDeniedOnlySendsPending",
+			checks:       []foulkon.ResourceCheck{writeOther, writeFolder},
+			combine:      foulkon.COMBINE_ANY,
+			expectedUser: "user",
+			withCache:    true,
+			expectedSent: []api.AuthorizationCheck{
+				{Action: writeFolder.Action, Resources: []string{writeFolder.Urn}},
+			},
+		},
+		{
+			name:          "ErrorCaseCachedDeniedWithAll",
+			checks:        []foulkon.ResourceCheck{writeFolder, writeOther},
+			combine:       foulkon.COMBINE_ALL,
+			expectedUser:  "user",
+			withCache:     true,
+			expectedCache: true,
+			expectedError: getErrorMessage(FORBIDDEN_ERROR, "No access for urn urn:ews:example:instance1:folder/other with action example:write received from server"),
+		},
+		{
+			name:         "ErrorCaseWorkerForbidden",
+			checks:       []foulkon.ResourceCheck{readItem, writeFolder},
+			combine:      foulkon.COMBINE_ALL,
+			workerStatus: http.StatusForbidden,
+			expectedUser: "user",
+			expectedSent: []api.AuthorizationCheck{
+				{Action: readItem.Action, Resources: []string{readItem.Urn}},
+				{Action: writeFolder.Action, Resources: []string{writeFolder.Urn}},
+			},
+			expectedError: getErrorMessage(FORBIDDEN_ERROR, "Restricted access to resources"),
+		},
+		{
+			name:         "ErrorCaseWorkerBadRequest",
+			checks:       []foulkon.ResourceCheck{readItem, writeFolder},
+			combine:      foulkon.COMBINE_ALL,
+			workerStatus: http.StatusBadRequest,
+			expectedUser: "user",
+			expectedSent: []api.AuthorizationCheck{
+				{Action: readItem.Action, Resources: []string{readItem.Urn}},
+				{Action: writeFolder.Action, Resources: []string{writeFolder.Urn}},
+			},
+			expectedError: getErrorMessage(api.INVALID_PARAMETER_ERROR, "Invalid authorization checks"),
+		},
+		{
+			name:    "ErrorCaseInvalidUrn",
+			checks:  []foulkon.ResourceCheck{readItem, {Urn: "urn:ews:example:instance1:folder/*", Action: "example:write"}},
+			combine: foulkon.COMBINE_ALL,
+			expectedError: getErrorMessage(api.INVALID_PARAMETER_ERROR,
+				"Urn urn:ews:example:instance1:folder/* is a prefix, it would be a full urn resource"),
+		},
+	}
+
+	handler := &ProxyHandler{
+		proxy: &foulkon.Proxy{
+			WorkerHost: worker.URL,
+			Logger: &log.Logger{
+				Out:       bytes.NewBuffer([]byte{}),
+				Formatter: &log.TextFormatter{},
+				Hooks:     make(log.LevelHooks),
+				Level:     log.DebugLevel,
+			},
+		},
+		workerClient: http.DefaultClient,
+		cache:        newDecisionCache(10, time.Minute),
+	}
+	for _, test := range testcases {
+		received = nil
+		workerStatus = test.workerStatus
+		r, _ := http.NewRequest(http.MethodPost, "/items/item1", nil)
+		if test.withCache {
+			r.Header.Set("Authorization", "Bearer token1")
+		}
+		_, user, cached, err := handler.checkAuthorizations(r, test.checks, test.combine)
+		if diff := pretty.Compare(err, test.expectedError); diff != "" {
+			t.Errorf("Test %v failed. Received different error (received/wanted) %v", test.name, diff)
+		}
+		if cached != test.expectedCache {
+			t.Errorf("Test %v failed. Received cached %v, wanted %v", test.name, cached, test.expectedCache)
+		}
+		if user != test.expectedUser {
+			t.Errorf("Test %v failed. Received user %v, wanted %v", test.name, user, test.expectedUser)
+		}
+		if diff := pretty.Compare(received, test.expectedSent); diff != "" {
+			t.Errorf("Test %v failed. Received different checks in worker (received/wanted) %v", test.name, diff)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package http
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Tecsisa/foulkon/foulkon"
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	// Identity headers sent to destination hosts
+	IDENTITY_USER_HEADER       = "X-Foulkon-User"
+	IDENTITY_URN_HEADER        = "X-Foulkon-Urn"
+	IDENTITY_ACTION_HEADER     = "X-Foulkon-Action"
+	IDENTITY_REQUEST_ID_HEADER = "X-Foulkon-Request-Id"
+	// HMAC signature of identity headers, and time when it was signed
+	IDENTITY_TIMESTAMP_HEADER = "X-Foulkon-Timestamp"
+	IDENTITY_SIGNATURE_HEADER = "X-Foulkon-Signature"
+	// JWT with the identity claims
+	IDENTITY_TOKEN_HEADER = "X-Foulkon-Identity"
+
+	// Issuer of identity JWTs
+	IDENTITY_TOKEN_ISSUER = "foulkon-proxy"
+)
+
+// Identity headers, removed from client requests because they can't be trusted
+var identityHeaders = []string{
+	IDENTITY_USER_HEADER,
+	IDENTITY_URN_HEADER,
+	IDENTITY_ACTION_HEADER,
+	IDENTITY_REQUEST_ID_HEADER,
+	IDENTITY_TIMESTAMP_HEADER,
+	IDENTITY_SIGNATURE_HEADER,
+	IDENTITY_TOKEN_HEADER,
+}
+
+// Replace the identity headers of an authorized request with the user authenticated by worker,
+// the urns and actions authorized and the request id, signed so destination hosts can trust
+// them. Credentials are removed too if proxy is configured to do it. Nothing is changed if
+// identity headers are disabled.
+func (h *ProxyHandler) setIdentityHeaders(r *http.Request, requestID string, user string, checks []foulkon.ResourceCheck) error {
+	if h.proxy.IdentitySecret == "" {
+		return nil
+	}
+	for _, header := range identityHeaders {
+		r.Header.Del(header)
+	}
+	if h.proxy.IdentityStripAuthorization {
+		r.Header.Del("Authorization")
+	}
+
+	urns := make([]string, 0, len(checks))
+	actions := make([]string, 0, len(checks))
+	for _, check := range checks {
+		urns = append(urns, check.Urn)
+		actions = append(actions, check.Action)
+	}
+	urn := strings.Join(urns, ",")
+	action := strings.Join(actions, ",")
+	r.Header.Set(IDENTITY_USER_HEADER, user)
+	r.Header.Set(IDENTITY_URN_HEADER, urn)
+	r.Header.Set(IDENTITY_ACTION_HEADER, action)
+	r.Header.Set(IDENTITY_REQUEST_ID_HEADER, requestID)
+
+	now := time.Now()
+	switch h.proxy.IdentitySigning {
+	case foulkon.IDENTITY_SIGNING_JWT:
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"iss":    IDENTITY_TOKEN_ISSUER,
+			"sub":    user,
+			"urn":    urn,
+			"action": action,
+			"jti":    requestID,
+			"method": r.Method,
+			"path":   r.URL.RequestURI(),
+			"iat":    now.Unix(),
+			"exp":    now.Add(h.proxy.IdentityTTL).Unix(),
+		}).SignedString([]byte(h.proxy.IdentitySecret))
+		if err != nil {
+			return err
+		}
+		r.Header.Set(IDENTITY_TOKEN_HEADER, token)
+	default:
+		timestamp := strconv.FormatInt(now.Unix(), 10)
+		r.Header.Set(IDENTITY_TIMESTAMP_HEADER, timestamp)
+		r.Header.Set(IDENTITY_SIGNATURE_HEADER,
+			getIdentitySignature(h.proxy.IdentitySecret, r.Method, r.URL.RequestURI(), user, urn, action, requestID, timestamp))
+	}
+	return nil
+}
+
+// Returns the hex encoded HMAC-SHA256 of identity values separated by new lines, in the
+// order that destination hosts must use to verify it
+func getIdentitySignature(secret string, values ...string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join(values, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
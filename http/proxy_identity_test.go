@@ -0,0 +1,129 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Tecsisa/foulkon/foulkon"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestProxyHandler_setIdentityHeaders(t *testing.T) {
+	secret := "0123456789abcdef0123456789abcdef"
+	checks := []foulkon.ResourceCheck{
+		{Urn: "urn:ews:example:instance1:item/item1", Action: "example:read"},
+		{Urn: "urn:ews:example:instance1:folder/folder2", Action: "example:write"},
+	}
+	testcases := map[string]struct {
+		proxy *foulkon.Proxy
+		// Expected result
+		expectedHeaders http.Header
+		// Signed header that is checked apart, because it changes with time
+		signedHeader string
+	}{
+		"OkCaseDisabled": {
+			proxy: &foulkon.Proxy{},
+			expectedHeaders: http.Header{
+				"Authorization":        {"Bearer token"},
+				IDENTITY_USER_HEADER:   {"spoofed"},
+				IDENTITY_ACTION_HEADER: {"spoofed"},
+			},
+		},
+		"OkCaseHMAC": {
+			proxy: &foulkon.Proxy{
+				IdentitySigning: foulkon.IDENTITY_SIGNING_HMAC,
+				IdentitySecret:  secret,
+				IdentityTTL:     time.Minute,
+			},
+			expectedHeaders: http.Header{
+				"Authorization":            {"Bearer token"},
+				IDENTITY_USER_HEADER:       {"user1"},
+				IDENTITY_URN_HEADER:        {"urn:ews:example:instance1:item/item1,urn:ews:example:instance1:folder/folder2"},
+				IDENTITY_ACTION_HEADER:     {"example:read,example:write"},
+				IDENTITY_REQUEST_ID_HEADER: {"RequestID"},
+			},
+			signedHeader: IDENTITY_SIGNATURE_HEADER,
+		},
+		"OkCaseJWTStripAuthorization": {
+			proxy: &foulkon.Proxy{
+				IdentitySigning:            foulkon.IDENTITY_SIGNING_JWT,
+				IdentitySecret:             secret,
+				IdentityTTL:                time.Minute,
+				IdentityStripAuthorization: true,
+			},
+			expectedHeaders: http.Header{
+				IDENTITY_USER_HEADER:       {"user1"},
+				IDENTITY_URN_HEADER:        {"urn:ews:example:instance1:item/item1,urn:ews:example:instance1:folder/folder2"},
+				IDENTITY_ACTION_HEADER:     {"example:read,example:write"},
+				IDENTITY_REQUEST_ID_HEADER: {"RequestID"},
+			},
+			signedHeader: IDENTITY_TOKEN_HEADER,
+		},
+	}
+
+	for n, test := range testcases {
+		r, _ := http.NewRequest(http.MethodPost, "/items/item1/move?to=folder2", nil)
+		r.Header.Set("Authorization", "Bearer token")
+		// Identity headers sent by client are replaced
+		r.Header.Set(IDENTITY_USER_HEADER, "spoofed")
+		r.Header.Set(IDENTITY_ACTION_HEADER, "spoofed")
+		h := &ProxyHandler{proxy: test.proxy}
+		if err := h.setIdentityHeaders(r, "RequestID", "user1", checks); err != nil {
+			t.Errorf("Test %v failed. Unexpected error: %v", n, err)
+			continue
+		}
+
+		signed := r.Header.Get(test.signedHeader)
+		timestamp := r.Header.Get(IDENTITY_TIMESTAMP_HEADER)
+		r.Header.Del(IDENTITY_SIGNATURE_HEADER)
+		r.Header.Del(IDENTITY_TOKEN_HEADER)
+		r.Header.Del(IDENTITY_TIMESTAMP_HEADER)
+		if diff := pretty.Compare(r.Header, test.expectedHeaders); diff != "" {
+			t.Errorf("Test %v failed. Received different headers (received/wanted) %v", n, diff)
+			continue
+		}
+
+		switch test.signedHeader {
+		case IDENTITY_SIGNATURE_HEADER:
+			if _, err := strconv.ParseInt(timestamp, 10, 64); err != nil {
+				t.Errorf("Test %v failed. Invalid timestamp %v", n, timestamp)
+			}
+			expected := getIdentitySignature(secret, http.MethodPost, "/items/item1/move?to=folder2", "user1",
+				"urn:ews:example:instance1:item/item1,urn:ews:example:instance1:folder/folder2", "example:read,example:write",
+				"RequestID", timestamp)
+			if signed != expected {
+				t.Errorf("Test %v failed. Received signature %v, wanted %v", n, signed, expected)
+			}
+		case IDENTITY_TOKEN_HEADER:
+			token, err := jwt.Parse(signed, func(token *jwt.Token) (interface{}, error) {
+				return []byte(secret), nil
+			})
+			if err != nil || !token.Valid || token.Method != jwt.SigningMethodHS256 {
+				t.Errorf("Test %v failed. Invalid token %v: %v", n, signed, err)
+				continue
+			}
+			claims := token.Claims.(jwt.MapClaims)
+			iat, exp := claims["iat"].(float64), claims["exp"].(float64)
+			if exp-iat != time.Minute.Seconds() {
+				t.Errorf("Test %v failed. Received token valid for %v seconds", n, exp-iat)
+			}
+			delete(claims, "iat")
+			delete(claims, "exp")
+			expectedClaims := jwt.MapClaims{
+				"iss":    IDENTITY_TOKEN_ISSUER,
+				"sub":    "user1",
+				"urn":    "urn:ews:example:instance1:item/item1,urn:ews:example:instance1:folder/folder2",
+				"action": "example:read,example:write",
+				"jti":    "RequestID",
+				"method": http.MethodPost,
+				"path":   "/items/item1/move?to=folder2",
+			}
+			if diff := pretty.Compare(claims, expectedClaims); diff != "" {
+				t.Errorf("Test %v failed. Received different claims (received/wanted) %v", n, diff)
+			}
+		}
+	}
+}
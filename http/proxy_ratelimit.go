@@ -0,0 +1,173 @@
+package http
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Tecsisa/foulkon/foulkon"
+)
+
+const (
+	// Time between removals of idle buckets
+	RATE_LIMIT_SWEEP_INTERVAL = time.Minute
+)
+
+// TYPE DEFINITIONS
+
+// Rate limiter with a token bucket for every user or client IP. Buckets are kept in memory,
+// and the ones that are full again are removed because they are the same as new ones. All
+// methods can be called on a nil limiter, which allows all requests.
+type rateLimiter struct {
+	limit *foulkon.RateLimit
+	// Tokens added every second
+	rate float64
+
+	mutex     sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+
+	// Current time, replaced in tests
+	now func() time.Time
+}
+
+// Token reserved in a bucket of a limiter
+type rateReservation struct {
+	limiter *rateLimiter
+	key     string
+}
+
+type tokenBucket struct {
+	tokens float64
+	// Time when tokens were refilled
+	updated time.Time
+}
+
+// Returns a limiter for the rate limit, or nil if it is disabled
+func newRateLimiter(limit *foulkon.RateLimit) *rateLimiter {
+	if limit == nil {
+		return nil
+	}
+	return &rateLimiter{
+		limit:     limit,
+		rate:      float64(limit.Requests) / limit.Period.Seconds(),
+		buckets:   map[string]*tokenBucket{},
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Consumes a token of the bucket of a key. It returns if request is allowed, and the time to
+// wait for the next token if it isn't.
+func (l *rateLimiter) reserve(key string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= RATE_LIMIT_SWEEP_INTERVAL {
+		l.sweep(now)
+	}
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(l.limit.Burst), updated: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = l.refill(bucket, now)
+	bucket.updated = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+}
+
+// Returns a token consumed by reserve to the bucket of a key, so requests denied by other limits
+// aren't counted
+func (l *rateLimiter) cancel(key string) {
+	if l == nil {
+		return
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// Removed buckets are already full
+	bucket, ok := l.buckets[key]
+	if !ok {
+		return
+	}
+	now := l.now()
+	bucket.tokens = math.Min(float64(l.limit.Burst), l.refill(bucket, now)+1)
+	bucket.updated = now
+}
+
+// Returns the tokens of a bucket at a time, caller must hold the lock
+func (l *rateLimiter) refill(bucket *tokenBucket, now time.Time) float64 {
+	return math.Min(float64(l.limit.Burst), bucket.tokens+now.Sub(bucket.updated).Seconds()*l.rate)
+}
+
+// Remove buckets that are full again, caller must hold the lock
+func (l *rateLimiter) sweep(now time.Time) {
+	l.lastSweep = now
+	for key, bucket := range l.buckets {
+		if l.refill(bucket, now) >= float64(l.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Check the rate limits of a request keyed by the types specified, global and of the resource.
+// Requests are counted by user, or by client IP if limit is keyed by IP or user is unknown. Tokens
+// are only consumed if all limits allow the request. It returns the tokens reserved, so they can be
+// returned if request is denied later, and the time to wait if request isn't allowed.
+func reserveRequest(r *http.Request, limiters []*rateLimiter, user string, keys ...string) ([]rateReservation, bool, time.Duration) {
+	reservations := []rateReservation{}
+	for _, limiter := range limiters {
+		if limiter == nil || !isRateLimitKey(limiter.limit.Key, keys) {
+			continue
+		}
+		key := getRateLimitKey(r, "")
+		if limiter.limit.Key == foulkon.RATE_LIMIT_KEY_USER {
+			key = getRateLimitKey(r, user)
+		}
+		if ok, wait := limiter.reserve(key); !ok {
+			cancelReservations(reservations)
+			return nil, false, wait
+		}
+		reservations = append(reservations, rateReservation{limiter: limiter, key: key})
+	}
+	return reservations, true, 0
+}
+
+// Returns the tokens reserved for a request
+func cancelReservations(reservations []rateReservation) {
+	for _, reservation := range reservations {
+		reservation.limiter.cancel(reservation.key)
+	}
+}
+
+func isRateLimitKey(key string, keys []string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the key of the bucket of a request
+func getRateLimitKey(r *http.Request, user string) string {
+	if user != "" {
+		return foulkon.RATE_LIMIT_KEY_USER + " " + user
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return foulkon.RATE_LIMIT_KEY_IP + " " + ip
+}
@@ -0,0 +1,247 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/Tecsisa/foulkon/foulkon"
+)
+
+func TestRateLimiter_reserve(t *testing.T) {
+	now := time.Date(2016, time.October, 1, 10, 0, 0, 0, time.UTC)
+	limiter := newRateLimiter(&foulkon.RateLimit{
+		Requests: 1,
+		Period:   time.Second,
+		Burst:    2,
+		Key:      foulkon.RATE_LIMIT_KEY_USER,
+	})
+	limiter.now = func() time.Time { return now }
+	limiter.lastSweep = now
+
+	testcases := []struct {
+		name string
+		// Time elapsed since previous request
+		elapsed      time.Duration
+		key          string
+		expectedOk   bool
+		expectedWait time.Duration
+	}{
+		{name: "OkCaseBurst", key: "user1", expectedOk: true},
+		{name: "OkCaseBurstLast", key: "user1", expectedOk: true},
+		{name: "ErrorCaseEmpty", key: "user1", expectedWait: time.Second},
+		{name: "OkCaseOtherKey", key: "user2", expectedOk: true},
+		{name: "ErrorCasePartialRefill", elapsed: 400 * time.Millisecond, key: "user1", expectedWait: 600 * time.Millisecond},
+		{name: "OkCaseRefilled", elapsed: 600 * time.Millisecond, key: "user1", expectedOk: true},
+		{name: "ErrorCaseRefilledEmpty", key: "user1", expectedWait: time.Second},
+		{name: "OkCaseRefilledUpToBurst", elapsed: time.Hour, key: "user1", expectedOk: true},
+		{name: "OkCaseRefilledUpToBurstLast", key: "user1", expectedOk: true},
+		{name: "ErrorCaseRefilledUpToBurstEmpty", key: "user1", expectedWait: time.Second},
+	}
+
+	for _, test := range testcases {
+		now = now.Add(test.elapsed)
+		ok, wait := limiter.reserve(test.key)
+		if ok != test.expectedOk || wait != test.expectedWait {
+			t.Errorf("Test %v failed. Received allowed %v and wait %v, wanted %v and %v",
+				test.name, ok, wait, test.expectedOk, test.expectedWait)
+		}
+	}
+
+	// Full buckets are removed when they are swept, in the request after an hour, and empty ones are kept
+	if _, ok := limiter.buckets["user2"]; ok {
+		t.Errorf("Test failed. Full bucket wasn't removed")
+	}
+	if _, ok := limiter.buckets["user1"]; !ok {
+		t.Errorf("Test failed. Empty bucket was removed")
+	}
+
+	// Cancelled tokens are returned up to burst
+	limiter.cancel("user1")
+	if ok, wait := limiter.reserve("user1"); !ok {
+		t.Errorf("Test failed. Cancelled token wasn't returned, wait %v", wait)
+	}
+	limiter.cancel("user1")
+	limiter.cancel("user1")
+	limiter.cancel("user1")
+	if tokens := limiter.buckets["user1"].tokens; tokens != 2 {
+		t.Errorf("Test failed. Received %v tokens after cancelling, wanted burst 2", tokens)
+	}
+
+	// Disabled
+	var disabled *rateLimiter
+	disabled.cancel("user1")
+	if ok, _ := disabled.reserve("user1"); !ok {
+		t.Errorf("Test failed. Disabled limiter didn't allow request")
+	}
+	if newRateLimiter(nil) != nil {
+		t.Errorf("Test failed. Limiter without rate limit is enabled")
+	}
+}
+
+func TestReserveRequest(t *testing.T) {
+	resourceLimiter := newRateLimiter(&foulkon.RateLimit{
+		Requests: 1,
+		Period:   time.Minute,
+		Burst:    1,
+		Key:      foulkon.RATE_LIMIT_KEY_IP,
+	})
+	globalLimiter := newRateLimiter(&foulkon.RateLimit{
+		Requests: 1,
+		Period:   time.Minute,
+		Burst:    1,
+		Key:      foulkon.RATE_LIMIT_KEY_USER,
+	})
+	limiters := []*rateLimiter{resourceLimiter, nil, globalLimiter}
+	r, _ := http.NewRequest(http.MethodGet, "/items", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+
+	// Limits keyed by other types aren't checked
+	reservations, ok, _ := reserveRequest(r, limiters, "user1", foulkon.RATE_LIMIT_KEY_IP)
+	if !ok || len(reservations) != 1 || reservations[0].key != "ip 10.0.0.1" {
+		t.Fatalf("Test failed. Received reservations %v, allowed %v", reservations, ok)
+	}
+	cancelReservations(reservations)
+
+	// Global limit of user is empty, so token of resource limit is returned
+	if ok, _ := globalLimiter.reserve("user user1"); !ok {
+		t.Fatalf("Test failed. Global limit didn't allow request")
+	}
+	if _, ok, wait := reserveRequest(r, limiters, "user1", foulkon.RATE_LIMIT_KEY_IP, foulkon.RATE_LIMIT_KEY_USER); ok || wait == 0 {
+		t.Errorf("Test failed. Received allowed %v and wait %v", ok, wait)
+	}
+	if ok, _ := resourceLimiter.reserve("ip 10.0.0.1"); !ok {
+		t.Errorf("Test failed. Token of resource limit wasn't returned")
+	}
+}
+
+func TestProxyHandler_HandleRequestRateLimit(t *testing.T) {
+	workerCalls := 0
+	worker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		workerCalls++
+		// Credentials have the user before colon
+		w.Header().Set(AUTHENTICATED_USER_HEADER, strings.Split(r.Header.Get("Authorization"), ":")[0])
+		json.NewEncoder(w).Encode(AuthorizeResourcesResponse{
+			ResourcesAllowed: []string{"urn:ews:example:instance1:resource/items"},
+		})
+	}))
+	defer worker.Close()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	proxyCore := &foulkon.Proxy{
+		Logger: &log.Logger{
+			Out:       bytes.NewBuffer([]byte{}),
+			Formatter: &log.TextFormatter{},
+			Hooks:     make(log.LevelHooks),
+			Level:     log.DebugLevel,
+		},
+		WorkerHost:      worker.URL,
+		WorkerTimeout:   time.Second,
+		ResponseTimeout: time.Second,
+		CacheSize:       10,
+		CacheTTL:        time.Minute,
+		RateLimit: &foulkon.RateLimit{
+			Requests: 3,
+			Period:   time.Minute,
+			Burst:    3,
+			Key:      foulkon.RATE_LIMIT_KEY_IP,
+		},
+		APIResources: []foulkon.APIResource{
+			{
+				Id:     "items",
+				Host:   upstream.URL,
+				Url:    "/items",
+				Method: "GET",
+				Urn:    "urn:ews:example:instance1:resource/items",
+				Action: "example:get",
+				RateLimit: &foulkon.RateLimit{
+					Requests: 1,
+					Period:   time.Minute,
+					Burst:    1,
+					Key:      foulkon.RATE_LIMIT_KEY_USER,
+				},
+			},
+		},
+	}
+	proxyRouter, err := ProxyHandlerRouter(proxyCore)
+	if err != nil {
+		t.Fatalf("Test failed. Unexpected error creating proxy router: %v", err)
+	}
+	proxyServer := httptest.NewServer(proxyRouter)
+	defer proxyServer.Close()
+
+	testcases := []struct {
+		name               string
+		user               string
+		expectedStatusCode int
+		expectedRetryAfter string
+		expectedCalls      int
+	}{
+		{
+			name:               "OkCase",
+			user:               "user1",
+			expectedStatusCode: http.StatusOK,
+			expectedCalls:      1,
+		},
+		{
+			// User of credentials is cached, so worker isn't called
+			name:               "ErrorCaseUserLimitWithoutWorker",
+			user:               "user1",
+			expectedStatusCode: http.StatusTooManyRequests,
+			expectedRetryAfter: "60",
+			expectedCalls:      1,
+		},
+		{
+			name:               "ErrorCaseUserLimitOtherCredentials",
+			user:               "user1:other",
+			expectedStatusCode: http.StatusTooManyRequests,
+			expectedRetryAfter: "60",
+			expectedCalls:      2,
+		},
+		{
+			name:               "OkCaseOtherUser",
+			user:               "user2",
+			expectedStatusCode: http.StatusOK,
+			expectedCalls:      3,
+		},
+		{
+			// Tokens of IP limit are returned when user limit denies requests
+			name:               "OkCaseIPTokensReturned",
+			user:               "user3",
+			expectedStatusCode: http.StatusOK,
+			expectedCalls:      4,
+		},
+		{
+			name:               "ErrorCaseIPLimitWithoutWorker",
+			user:               "user4",
+			expectedStatusCode: http.StatusTooManyRequests,
+			expectedRetryAfter: "20",
+			expectedCalls:      4,
+		},
+	}
+
+	for _, test := range testcases {
+		req, _ := http.NewRequest(http.MethodGet, proxyServer.URL+"/items", nil)
+		req.Header.Set("Authorization", test.user)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Test %v failed. Unexpected error: %v", test.name, err)
+		}
+		res.Body.Close()
+		if res.StatusCode != test.expectedStatusCode {
+			t.Errorf("Test %v failed. Received status code %v, wanted %v", test.name, res.StatusCode, test.expectedStatusCode)
+		}
+		if retryAfter := res.Header.Get("Retry-After"); retryAfter != test.expectedRetryAfter {
+			t.Errorf("Test %v failed. Received Retry-After %v, wanted %v", test.name, retryAfter, test.expectedRetryAfter)
+		}
+		if workerCalls != test.expectedCalls {
+			t.Errorf("Test %v failed. Received %v worker calls, wanted %v", test.name, workerCalls, test.expectedCalls)
+		}
+	}
+}
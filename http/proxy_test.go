@@ -1,12 +1,21 @@
 package http
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	log "github.com/Sirupsen/logrus"
 	"github.com/Tecsisa/foulkon/api"
+	"github.com/Tecsisa/foulkon/foulkon"
+	"github.com/julienschmidt/httprouter"
 	"github.com/kylelemons/godebug/pretty"
 )
 
@@ -193,3 +202,486 @@ func TestProxyHandler_HandleRequest(t *testing.T) {
 		}
 	}
 }
+
+func TestProxyHandler_HandleRequestStreaming(t *testing.T) {
+	var workerSecret string
+	var workerContext map[string]string
+	worker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		workerSecret = r.Header.Get(PROXY_SECRET_HEADER)
+		request := AuthorizeResourcesRequest{}
+		json.NewDecoder(r.Body).Decode(&request)
+		workerContext = request.Context
+		json.NewEncoder(w).Encode(AuthorizeResourcesResponse{
+			ResourcesAllowed: []string{"urn:ews:example:instance1:resource/stream", "urn:ews:example:instance1:resource/redirect"},
+		})
+	}))
+	defer worker.Close()
+
+	release := make(chan struct{})
+	var upstreamHeader http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/stream", http.StatusFound)
+			return
+		}
+		upstreamHeader = r.Header
+		w.Header().Set("Connection", "X-Hop")
+		w.Header().Set("X-Hop", "hop")
+		w.Header().Set("X-Kept", "kept")
+		w.Header().Set("Trailer", "X-Checksum")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("first\n"))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("second\n"))
+		w.Header().Set("X-Checksum", "checksum")
+	}))
+	defer upstream.Close()
+
+	proxyCore := &foulkon.Proxy{
+		Logger: &log.Logger{
+			Out:       bytes.NewBuffer([]byte{}),
+			Formatter: &log.TextFormatter{},
+			Hooks:     make(log.LevelHooks),
+			Level:     log.DebugLevel,
+		},
+		WorkerHost:      worker.URL,
+		WorkerSecret:    "proxysecret",
+		WorkerTimeout:   time.Second,
+		ResponseTimeout: time.Second,
+		APIResources: []foulkon.APIResource{
+			{
+				Id:     "stream",
+				Host:   upstream.URL,
+				Url:    "/stream",
+				Method: "GET",
+				Urn:    "urn:ews:example:instance1:resource/stream",
+				Action: "example:stream",
+			},
+			{
+				Id:     "redirect",
+				Host:   upstream.URL,
+				Url:    "/redirect",
+				Method: "GET",
+				Urn:    "urn:ews:example:instance1:resource/redirect",
+				Action: "example:redirect",
+			},
+		},
+	}
+	proxyRouter, err := ProxyHandlerRouter(proxyCore)
+	if err != nil {
+		t.Fatalf("Test failed. Unexpected error creating proxy router: %v", err)
+	}
+	proxyServer := httptest.NewServer(proxyRouter)
+	defer proxyServer.Close()
+
+	// Redirections aren't followed by proxy
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	res, err := client.Get(proxyServer.URL + "/redirect")
+	if err != nil {
+		t.Fatalf("Test failed. Unexpected error calling proxy: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusFound || res.Header.Get("Location") != "/stream" {
+		t.Errorf("Test failed. Received status code %v and location %v", res.StatusCode, res.Header.Get("Location"))
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, proxyServer.URL+"/stream", nil)
+	req.Header.Set("Connection", "X-Client-Hop")
+	req.Header.Set("X-Client-Hop", "hop")
+	req.Header.Set("Proxy-Authorization", "secret")
+	req.Header.Set("X-Forwarded-For", "10.0.0.1")
+	res, err = client.Do(req)
+	if err != nil {
+		close(release)
+		t.Fatalf("Test failed. Unexpected error calling proxy: %v", err)
+	}
+	defer res.Body.Close()
+
+	// First chunk is received before upstream finishes the response
+	reader := bufio.NewReader(res.Body)
+	line, err := reader.ReadString('\n')
+	close(release)
+	if err != nil || line != "first\n" {
+		t.Fatalf("Test failed. Received first chunk %q with error %v", line, err)
+	}
+	rest, err := ioutil.ReadAll(reader)
+	if err != nil || string(rest) != "second\n" {
+		t.Errorf("Test failed. Received second chunk %q with error %v", string(rest), err)
+	}
+
+	// Hop-by-hop headers aren't forwarded
+	for _, header := range []string{"X-Client-Hop", "Proxy-Authorization"} {
+		if value := upstreamHeader.Get(header); value != "" {
+			t.Errorf("Test failed. Hop-by-hop request header %v forwarded with value %v", header, value)
+		}
+	}
+	if value := upstreamHeader.Get("X-Forwarded-For"); value != "10.0.0.1, 127.0.0.1" {
+		t.Errorf("Test failed. Received X-Forwarded-For %v", value)
+	}
+	// Proxy context is sent only to worker
+	if workerSecret != "proxysecret" || workerContext[PROXY_CONTEXT_KEY_METHOD] != http.MethodGet {
+		t.Errorf("Test failed. Received proxy secret %v and context %v in worker", workerSecret, workerContext)
+	}
+	if value := upstreamHeader.Get(PROXY_SECRET_HEADER); value != "" {
+		t.Errorf("Test failed. Proxy secret forwarded with value %v", value)
+	}
+	if value := res.Header.Get("X-Hop"); value != "" {
+		t.Errorf("Test failed. Hop-by-hop response header forwarded with value %v", value)
+	}
+	if value := res.Header.Get("X-Kept"); value != "kept" {
+		t.Errorf("Test failed. Received X-Kept header %v", value)
+	}
+	if value := res.Trailer.Get("X-Checksum"); value != "checksum" {
+		t.Errorf("Test failed. Received X-Checksum trailer %v", value)
+	}
+}
+
+func TestProxyHandler_HandleRequestUpgrade(t *testing.T) {
+	worker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(AuthorizeResourcesResponse{
+			ResourcesAllowed: []string{"urn:ews:example:instance1:resource/echo"},
+		})
+	}))
+	defer worker.Close()
+
+	// Echo server that upgrades connections to protocol echo
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "echo" || r.Header.Get("Connection") != "Upgrade" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Upgrade required"))
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		rw.Flush()
+		for {
+			line, err := rw.ReadString('\n')
+			if err != nil {
+				return
+			}
+			rw.WriteString(line)
+			rw.Flush()
+		}
+	}))
+	defer upstream.Close()
+
+	proxyCore := &foulkon.Proxy{
+		Logger: &log.Logger{
+			Out:       bytes.NewBuffer([]byte{}),
+			Formatter: &log.TextFormatter{},
+			Hooks:     make(log.LevelHooks),
+			Level:     log.DebugLevel,
+		},
+		WorkerHost:      worker.URL,
+		WorkerTimeout:   time.Second,
+		ResponseTimeout: time.Second,
+		APIResources: []foulkon.APIResource{
+			{
+				Id:     "echo",
+				Host:   upstream.URL,
+				Url:    "/echo",
+				Method: "GET",
+				Urn:    "urn:ews:example:instance1:resource/echo",
+				Action: "example:echo",
+			},
+		},
+	}
+	proxyRouter, err := ProxyHandlerRouter(proxyCore)
+	if err != nil {
+		t.Fatalf("Test failed. Unexpected error creating proxy router: %v", err)
+	}
+	proxyServer := httptest.NewServer(proxyRouter)
+	defer proxyServer.Close()
+
+	testcases := map[string]struct {
+		upgrade            string
+		expectedStatusCode int
+	}{
+		"OkCase": {
+			upgrade:            "echo",
+			expectedStatusCode: http.StatusSwitchingProtocols,
+		},
+		"OkCaseUpgradeRefused": {
+			upgrade:            "other",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for n, test := range testcases {
+		conn, err := net.Dial("tcp", proxyServer.Listener.Addr().String())
+		if err != nil {
+			t.Fatalf("Test %v failed. Unexpected error connecting to proxy: %v", n, err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		req, _ := http.NewRequest(http.MethodGet, proxyServer.URL+"/echo", nil)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", test.upgrade)
+		req.Write(conn)
+		reader := bufio.NewReader(conn)
+		res, err := http.ReadResponse(reader, req)
+		if err != nil {
+			t.Errorf("Test %v failed. Unexpected error reading response: %v", n, err)
+			continue
+		}
+		if res.StatusCode != test.expectedStatusCode {
+			t.Errorf("Test %v failed. Received status code %v, wanted %v", n, res.StatusCode, test.expectedStatusCode)
+			continue
+		}
+		if res.StatusCode != http.StatusSwitchingProtocols {
+			continue
+		}
+
+		// Data is tunneled in both directions
+		conn.Write([]byte("hello\n"))
+		if line, err := reader.ReadString('\n'); err != nil || line != "hello\n" {
+			t.Errorf("Test %v failed. Received %q with error %v", n, line, err)
+		}
+
+		// Tunnel is closed with proxy
+		foulkon.CloseProxy()
+		if _, err := reader.ReadString('\n'); err == nil {
+			t.Errorf("Test %v failed. Tunnel wasn't closed with proxy", n)
+		}
+	}
+}
+
+func TestProxyRouter_Reload(t *testing.T) {
+	proxyCore := &foulkon.Proxy{
+		Logger: &log.Logger{
+			Out:       bytes.NewBuffer([]byte{}),
+			Formatter: &log.TextFormatter{},
+			Hooks:     make(log.LevelHooks),
+			Level:     log.DebugLevel,
+		},
+		APIResources: []foulkon.APIResource{
+			{
+				Id:     "old",
+				Host:   "http://localhost",
+				Url:    "/old",
+				Method: "GET",
+				Urn:    "urn:ews:example:instance1:resource/old",
+				Action: "example:get",
+			},
+		},
+	}
+	proxyRouter, err := ProxyHandlerRouter(proxyCore)
+	if err != nil {
+		t.Fatalf("Test failed. Unexpected error creating proxy router: %v", err)
+	}
+
+	testcases := []struct {
+		name      string
+		resources []foulkon.APIResource
+		// Prefix of the error, because router messages can change
+		expectedError  string
+		expectedRoutes map[string]bool
+	}{
+		{
+			name: "OkCase",
+			resources: []foulkon.APIResource{
+				{
+					Id:     "new",
+					Host:   "http://localhost",
+					Url:    "/new/:id",
+					Method: "GET",
+					Urn:    "urn:ews:example:instance1:resource/{id}",
+					Action: "example:get",
+				},
+			},
+			expectedRoutes: map[string]bool{
+				"/old":      false,
+				"/new/item": true,
+			},
+		},
+		{
+			name: "ErrorCaseInvalidUrn",
+			resources: []foulkon.APIResource{
+				{
+					Id:     "invalid",
+					Host:   "http://localhost",
+					Url:    "/invalid",
+					Method: "GET",
+					Urn:    "urn:ews:example:instance1:resource/{header.X Invalid}",
+					Action: "example:get",
+				},
+			},
+			expectedError: "Resource invalid has an invalid urn: Invalid parameter {header.X Invalid} in urn urn:ews:example:instance1:resource/{header.X Invalid}",
+			expectedRoutes: map[string]bool{
+				"/invalid":  false,
+				"/new/item": true,
+			},
+		},
+		{
+			name: "ErrorCaseDuplicatedUrls",
+			resources: []foulkon.APIResource{
+				{
+					Id:     "first",
+					Host:   "http://localhost",
+					Url:    "/items/:id",
+					Method: "GET",
+					Urn:    "urn:ews:example:instance1:resource/{id}",
+					Action: "example:get",
+				},
+				{
+					Id:     "second",
+					Host:   "http://localhost",
+					Url:    "/items/:id",
+					Method: "GET",
+					Urn:    "urn:ews:example:instance1:resource/{id}",
+					Action: "example:get",
+				},
+			},
+			expectedError: "Invalid resources: a handle is already registered for path",
+			expectedRoutes: map[string]bool{
+				"/items/item": false,
+				"/new/item":   true,
+			},
+		},
+	}
+
+	for _, test := range testcases {
+		err := proxyRouter.Reload(test.resources)
+		errorMessage := ""
+		if err != nil {
+			errorMessage = err.Error()
+		}
+		if !strings.HasPrefix(errorMessage, test.expectedError) || (errorMessage == "") != (test.expectedError == "") {
+			t.Errorf("Test %v failed. Received error %v, wanted %v", test.name, errorMessage, test.expectedError)
+		}
+		router := proxyRouter.router.Load().(*httprouter.Router)
+		for path, expected := range test.expectedRoutes {
+			if handle, _, _ := router.Lookup(http.MethodGet, path); (handle != nil) != expected {
+				t.Errorf("Test %v failed. Route %v found %v, wanted %v", test.name, path, handle != nil, expected)
+			}
+		}
+	}
+}
+
+func TestProxyRouter_ReloadKeepsState(t *testing.T) {
+	upstream := &foulkon.Upstream{
+		Name:        "upstream",
+		Hosts:       []string{"http://localhost:1", "http://localhost:2"},
+		MaxFails:    1,
+		FailTimeout: time.Minute,
+	}
+	rateLimit := &foulkon.RateLimit{
+		Requests: 1,
+		Period:   time.Minute,
+		Burst:    1,
+		Key:      foulkon.RATE_LIMIT_KEY_IP,
+	}
+	newResources := func(upstream *foulkon.Upstream, rateLimit *foulkon.RateLimit) []foulkon.APIResource {
+		return []foulkon.APIResource{
+			{
+				Id:        "resource",
+				Url:       "/resource",
+				Method:    "GET",
+				Urn:       "urn:ews:example:instance1:resource/resource",
+				Action:    "example:get",
+				Upstream:  upstream,
+				RateLimit: rateLimit,
+			},
+		}
+	}
+	proxyCore := &foulkon.Proxy{
+		Logger: &log.Logger{
+			Out:       bytes.NewBuffer([]byte{}),
+			Formatter: &log.TextFormatter{},
+			Hooks:     make(log.LevelHooks),
+			Level:     log.DebugLevel,
+		},
+		APIResources: newResources(upstream, rateLimit),
+	}
+	proxyRouter, err := ProxyHandlerRouter(proxyCore)
+	if err != nil {
+		t.Fatalf("Test failed. Unexpected error creating proxy router: %v", err)
+	}
+
+	// Consume the token of a client and eject a host
+	if ok, _ := proxyRouter.limiters["resource"].reserve("10.0.0.1"); !ok {
+		t.Fatalf("Test failed. Token not reserved")
+	}
+	balancer := proxyRouter.balancers[0]
+	host, err := balancer.pick()
+	if err != nil {
+		t.Fatalf("Test failed. Unexpected error picking host: %v", err)
+	}
+	balancer.done(host, false)
+
+	sameUpstream := *upstream
+	sameUpstream.Hosts = []string{"http://localhost:1", "http://localhost:2"}
+	sameRateLimit := *rateLimit
+	changedUpstream := *upstream
+	changedUpstream.Hosts = []string{"http://localhost:3"}
+	changedRateLimit := *rateLimit
+	changedRateLimit.Burst = 2
+
+	testcases := []struct {
+		name      string
+		resources []foulkon.APIResource
+		// Expected results
+		expectedSameBalancer bool
+		expectedSameLimiter  bool
+	}{
+		{
+			name:                 "OkCaseSameConfig",
+			resources:            newResources(&sameUpstream, &sameRateLimit),
+			expectedSameBalancer: true,
+			expectedSameLimiter:  true,
+		},
+		{
+			name:                "OkCaseUpstreamChanged",
+			resources:           newResources(&changedUpstream, &sameRateLimit),
+			expectedSameLimiter: true,
+		},
+		{
+			name:                 "OkCaseRateLimitChanged",
+			resources:            newResources(&changedUpstream, &changedRateLimit),
+			expectedSameBalancer: true,
+		},
+	}
+
+	for i, test := range testcases {
+		oldBalancer, oldLimiter := proxyRouter.balancers[0], proxyRouter.limiters["resource"]
+		if err := proxyRouter.Reload(test.resources); err != nil {
+			t.Errorf("Test %v failed. Unexpected error: %v", test.name, err)
+			continue
+		}
+		if same := proxyRouter.balancers[0] == oldBalancer; same != test.expectedSameBalancer {
+			t.Errorf("Test %v failed. Received same balancer %v, wanted %v", test.name, same, test.expectedSameBalancer)
+		}
+		if same := proxyRouter.limiters["resource"] == oldLimiter; same != test.expectedSameLimiter {
+			t.Errorf("Test %v failed. Received same rate limiter %v, wanted %v", test.name, same, test.expectedSameLimiter)
+		}
+		closed := false
+		select {
+		case <-oldBalancer.stop:
+			closed = true
+		default:
+		}
+		if closed == test.expectedSameBalancer {
+			t.Errorf("Test %v failed. Received old balancer closed %v, wanted %v", test.name, closed, !test.expectedSameBalancer)
+		}
+
+		// State is kept by the first reload
+		if i == 0 {
+			if ok, _ := proxyRouter.limiters["resource"].reserve("10.0.0.1"); ok {
+				t.Errorf("Test %v failed. Token consumed before reload is available", test.name)
+			}
+			if host.available(time.Now()) {
+				t.Errorf("Test %v failed. Host ejected before reload is available", test.name)
+			}
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package http
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TYPE DEFINITIONS
+
+// Connections tunneled after an upgrade, so they can be closed when proxy is closed
+type tunnelTracker struct {
+	mutex  sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+}
+
+func newTunnelTracker() *tunnelTracker {
+	return &tunnelTracker{
+		conns: map[net.Conn]struct{}{},
+	}
+}
+
+// Adds the connections of a tunnel. It returns false if tracker is already closed, so
+// connections mustn't be used.
+func (t *tunnelTracker) add(conns ...net.Conn) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.closed {
+		return false
+	}
+	for _, conn := range conns {
+		t.conns[conn] = struct{}{}
+	}
+	return true
+}
+
+// Closes and removes the connections of a tunnel
+func (t *tunnelTracker) remove(conns ...net.Conn) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, conn := range conns {
+		conn.Close()
+		delete(t.conns, conn)
+	}
+}
+
+// Closes all tunneled connections, and the ones added after it
+func (t *tunnelTracker) closeAll() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.closed = true
+	for conn := range t.conns {
+		conn.Close()
+		delete(t.conns, conn)
+	}
+}
+
+// Sends an upgrade request to destination host and, if it switches protocols, tunnels the
+// client connection to destination host in both directions until one of them is closed.
+// Other responses are sent to the client as usual. It returns false if destination host failed.
+func (h *ProxyHandler) handleUpgrade(w http.ResponseWriter, r *http.Request, dest destination, requestID string, workerRequestID string, cached bool) bool {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		h.TransactionErrorLog(r, requestID, workerRequestID, cached, "Error upgrading connection: hijacking not supported")
+		h.RespondInternalServerError(w, getErrorMessage(INTERNAL_SERVER_ERROR, "Internal server error. Contact the administrator"))
+		return true
+	}
+
+	upstream, err := dialUpstream(dest.url, dest.connectTimeout)
+	if err != nil {
+		h.TransactionErrorLog(r, requestID, workerRequestID, cached, fmt.Sprintf("Error calling to destination host resource: %v", err.Error()))
+		h.RespondInternalServerError(w, getErrorMessage(HOST_UNREACHABLE, "Error calling destination resource"))
+		return false
+	}
+
+	// Upgrade headers are hop-by-hop, so they are added again
+	req := getUpstreamRequest(r, dest.url)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", r.Header.Get("Upgrade"))
+	if dest.readTimeout > 0 {
+		upstream.SetDeadline(time.Now().Add(dest.readTimeout))
+	}
+	upstreamReader := bufio.NewReader(upstream)
+	var res *http.Response
+	if err = req.Write(upstream); err == nil {
+		res, err = http.ReadResponse(upstreamReader, req)
+	}
+	if err != nil {
+		upstream.Close()
+		h.TransactionErrorLog(r, requestID, workerRequestID, cached, fmt.Sprintf("Error calling to destination host resource: %v", err.Error()))
+		h.RespondInternalServerError(w, getErrorMessage(HOST_UNREACHABLE, "Error calling destination resource"))
+		return false
+	}
+	upstream.SetDeadline(time.Time{})
+
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		defer upstream.Close()
+		defer res.Body.Close()
+		if err := writeUpstreamResponse(w, res); err != nil {
+			h.TransactionErrorLog(r, requestID, workerRequestID, cached, fmt.Sprintf("Error reading response from destination: %v", err.Error()))
+			return false
+		}
+		h.TransactionLog(r, requestID, workerRequestID, cached, "Request accepted")
+		return !isHostFailure(res.StatusCode)
+	}
+
+	conn, clientReader, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		h.TransactionErrorLog(r, requestID, workerRequestID, cached, fmt.Sprintf("Error upgrading connection: %v", err.Error()))
+		h.RespondInternalServerError(w, getErrorMessage(INTERNAL_SERVER_ERROR, "Internal server error. Contact the administrator"))
+		return true
+	}
+	if !h.tunnels.add(conn, upstream) {
+		conn.Close()
+		upstream.Close()
+		h.TransactionErrorLog(r, requestID, workerRequestID, cached, "Error upgrading connection: proxy is closing")
+		return true
+	}
+	defer h.tunnels.remove(conn, upstream)
+
+	res.Header.Set(REQUEST_ID_HEADER, requestID)
+	if err := res.Write(conn); err != nil {
+		h.TransactionErrorLog(r, requestID, workerRequestID, cached, fmt.Sprintf("Error upgrading connection: %v", err.Error()))
+		return true
+	}
+	h.TransactionLog(r, requestID, workerRequestID, cached, fmt.Sprintf("Connection upgraded to %v", res.Header.Get("Upgrade")))
+
+	// Readers can have data already received, so they are used instead of connections
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(upstream, clientReader)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, upstreamReader)
+		done <- struct{}{}
+	}()
+	<-done
+	h.TransactionLog(r, requestID, workerRequestID, cached, "Upgraded connection closed")
+	return true
+}
+
+// Check if client asks to upgrade the connection to other protocol
+func isUpgradeRequest(r *http.Request) bool {
+	if r.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, value := range r.Header["Connection"] {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Open a connection to destination host, using TLS if its scheme is https
+func dialUpstream(destURL *url.URL, timeout time.Duration) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+	}
+	host := destURL.Host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		if destURL.Scheme == "https" {
+			host = net.JoinHostPort(host, "443")
+		} else {
+			host = net.JoinHostPort(host, "80")
+		}
+	}
+	if destURL.Scheme == "https" {
+		serverName, _, _ := net.SplitHostPort(host)
+		return tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: serverName})
+	}
+	return dialer.Dial("tcp", host)
+}
@@ -0,0 +1,244 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/Tecsisa/foulkon/foulkon"
+)
+
+const (
+	// Time to wait for connections to destination hosts if upstream doesn't define it
+	DEFAULT_CONNECT_TIMEOUT = 30 * time.Second
+)
+
+// TYPE DEFINITIONS
+
+// Destination host of a request, with the client and timeouts used to call it
+type destination struct {
+	url            *url.URL
+	client         *http.Client
+	connectTimeout time.Duration
+	readTimeout    time.Duration
+}
+
+// Host of an upstream with its state
+type upstreamHost struct {
+	url *url.URL
+	// Requests in progress
+	active int
+	// Consecutive failed requests, and time until host is ejected because of them
+	fails        int
+	ejectedUntil time.Time
+	// Result of the last active health check
+	unhealthy bool
+}
+
+// Check if host can receive requests
+func (host *upstreamHost) available(now time.Time) bool {
+	return !host.unhealthy && !now.Before(host.ejectedUntil)
+}
+
+// Balancer of requests between the hosts of an upstream, ejecting the unhealthy ones
+type upstreamBalancer struct {
+	upstream *foulkon.Upstream
+	hosts    []*upstreamHost
+	// Client with the timeouts of the upstream
+	client         *http.Client
+	transport      *http.Transport
+	connectTimeout time.Duration
+	readTimeout    time.Duration
+	logger         *log.Logger
+
+	mutex sync.Mutex
+	// Index of the first host tried by next selection
+	next int
+	// Stops active health checks
+	stop chan struct{}
+	now  func() time.Time
+}
+
+// Creates the balancer of an upstream, using proxy timeouts if upstream doesn't define them
+func newUpstreamBalancer(upstream *foulkon.Upstream, proxy *foulkon.Proxy) (*upstreamBalancer, error) {
+	b := &upstreamBalancer{
+		upstream:       upstream,
+		connectTimeout: upstream.ConnectTimeout,
+		readTimeout:    upstream.ReadTimeout,
+		logger:         proxy.Logger,
+		stop:           make(chan struct{}),
+		now:            time.Now,
+	}
+	for _, host := range upstream.Hosts {
+		u, err := url.Parse(host)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid host %v in upstream %v: %v", host, upstream.Name, err)
+		}
+		b.hosts = append(b.hosts, &upstreamHost{url: u})
+	}
+	if len(b.hosts) == 0 {
+		return nil, fmt.Errorf("Upstream %v must have hosts", upstream.Name)
+	}
+	if b.connectTimeout == 0 {
+		b.connectTimeout = DEFAULT_CONNECT_TIMEOUT
+	}
+	if b.readTimeout == 0 {
+		b.readTimeout = proxy.ResponseTimeout
+	}
+	b.transport = newProxyTransport(b.connectTimeout, b.readTimeout)
+	b.client = newDestinationClient(b.transport)
+	return b, nil
+}
+
+// Selects an available host, with the least requests in progress or the next one in turn
+// depending on upstream balance. Host must be released with done when request finishes.
+func (b *upstreamBalancer) pick() (*upstreamHost, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := b.now()
+	selected := -1
+	for i := range b.hosts {
+		index := (b.next + i) % len(b.hosts)
+		host := b.hosts[index]
+		if !host.available(now) {
+			continue
+		}
+		if selected == -1 || (b.upstream.Balance == foulkon.BALANCE_LEAST_CONNECTIONS && host.active < b.hosts[selected].active) {
+			selected = index
+			if b.upstream.Balance != foulkon.BALANCE_LEAST_CONNECTIONS {
+				break
+			}
+		}
+	}
+	if selected == -1 {
+		return nil, fmt.Errorf("No healthy hosts in upstream %v", b.upstream.Name)
+	}
+	b.next = (selected + 1) % len(b.hosts)
+	host := b.hosts[selected]
+	host.active++
+	return host, nil
+}
+
+// Releases a host selected by pick, recording if request failed. Host is ejected during
+// upstream fail timeout after max fails consecutive failed requests.
+func (b *upstreamBalancer) done(host *upstreamHost, ok bool) {
+	if b == nil || host == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	host.active--
+	if ok {
+		host.fails = 0
+		return
+	}
+	host.fails++
+	if b.upstream.MaxFails > 0 && host.fails >= b.upstream.MaxFails {
+		host.fails = 0
+		host.ejectedUntil = b.now().Add(b.upstream.FailTimeout)
+		b.logger.Warnf("Host %v of upstream %v ejected for %v after %v failed requests",
+			host.url.String(), b.upstream.Name, b.upstream.FailTimeout, b.upstream.MaxFails)
+	}
+}
+
+// Returns the destination to call a host
+func (b *upstreamBalancer) getDestination(host *upstreamHost) destination {
+	return destination{
+		url:            host.url,
+		client:         b.client,
+		connectTimeout: b.connectTimeout,
+		readTimeout:    b.readTimeout,
+	}
+}
+
+// Starts active health checks if upstream has a health check path
+func (b *upstreamBalancer) start() {
+	if b.upstream.HealthCheck == "" {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(b.upstream.HealthCheckInterval)
+		defer ticker.Stop()
+		for {
+			b.checkHosts()
+			select {
+			case <-b.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Returns the balancer of an upstream with the same config, or nil if there isn't any
+func findBalancer(balancers []*upstreamBalancer, upstream *foulkon.Upstream) *upstreamBalancer {
+	for _, b := range balancers {
+		if reflect.DeepEqual(*b.upstream, *upstream) {
+			return b
+		}
+	}
+	return nil
+}
+
+// Check if a balancer is in the list
+func containsBalancer(balancers []*upstreamBalancer, balancer *upstreamBalancer) bool {
+	for _, b := range balancers {
+		if b == balancer {
+			return true
+		}
+	}
+	return false
+}
+
+// Stops active health checks and closes idle connections. Requests in progress aren't affected.
+func (b *upstreamBalancer) close() {
+	close(b.stop)
+	b.transport.CloseIdleConnections()
+}
+
+// Calls health check path of every host, ejecting the ones that don't respond with a
+// successful status code until they do it
+func (b *upstreamBalancer) checkHosts() {
+	client := &http.Client{
+		Transport: b.transport,
+		Timeout:   b.upstream.HealthCheckInterval,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	for _, host := range b.hosts {
+		healthURL := url.URL{
+			Scheme: host.url.Scheme,
+			Host:   host.url.Host,
+			Path:   b.upstream.HealthCheck,
+		}
+		healthy := false
+		res, err := client.Get(healthURL.String())
+		if err == nil {
+			res.Body.Close()
+			healthy = res.StatusCode < http.StatusBadRequest
+		}
+
+		b.mutex.Lock()
+		if host.unhealthy == healthy {
+			if healthy {
+				b.logger.Infof("Host %v of upstream %v is healthy", host.url.String(), b.upstream.Name)
+			} else {
+				b.logger.Warnf("Host %v of upstream %v is unhealthy", host.url.String(), b.upstream.Name)
+			}
+		}
+		host.unhealthy = !healthy
+		b.mutex.Unlock()
+	}
+}
+
+// Check if a response status code means that destination host failed
+func isHostFailure(statusCode int) bool {
+	return statusCode == http.StatusBadGateway ||
+		statusCode == http.StatusServiceUnavailable ||
+		statusCode == http.StatusGatewayTimeout
+}
@@ -0,0 +1,247 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/Tecsisa/foulkon/foulkon"
+)
+
+func TestUpstreamBalancer_pick(t *testing.T) {
+	now := time.Date(2016, time.October, 1, 10, 0, 0, 0, time.UTC)
+	proxy := &foulkon.Proxy{
+		Logger: &log.Logger{
+			Out:       bytes.NewBuffer([]byte{}),
+			Formatter: &log.TextFormatter{},
+			Hooks:     make(log.LevelHooks),
+			Level:     log.DebugLevel,
+		},
+	}
+	newBalancer := func(balance string) *upstreamBalancer {
+		b, err := newUpstreamBalancer(&foulkon.Upstream{
+			Name:        "items",
+			Hosts:       []string{"http://host1", "http://host2", "http://host3"},
+			Balance:     balance,
+			MaxFails:    2,
+			FailTimeout: 10 * time.Second,
+		}, proxy)
+		if err != nil {
+			t.Fatalf("Test failed. Unexpected error creating balancer: %v", err)
+		}
+		b.now = func() time.Time { return now }
+		return b
+	}
+	pick := func(b *upstreamBalancer) string {
+		host, err := b.pick()
+		if err != nil {
+			return err.Error()
+		}
+		return host.url.Host
+	}
+
+	testcases := map[string]struct {
+		balance string
+		// Prepare balancer state before picking hosts
+		prepare       func(b *upstreamBalancer)
+		expectedHosts []string
+	}{
+		"OkCaseRoundRobin": {
+			balance:       foulkon.BALANCE_ROUND_ROBIN,
+			expectedHosts: []string{"host1", "host2", "host3", "host1"},
+		},
+		"OkCaseLeastConnections": {
+			balance: foulkon.BALANCE_LEAST_CONNECTIONS,
+			prepare: func(b *upstreamBalancer) {
+				b.hosts[0].active = 2
+				b.hosts[1].active = 1
+			},
+			expectedHosts: []string{"host3", "host2", "host3", "host1"},
+		},
+		"OkCaseUnhealthySkipped": {
+			balance: foulkon.BALANCE_ROUND_ROBIN,
+			prepare: func(b *upstreamBalancer) {
+				b.hosts[1].unhealthy = true
+			},
+			expectedHosts: []string{"host1", "host3", "host1"},
+		},
+		"OkCaseEjectedAfterMaxFails": {
+			balance: foulkon.BALANCE_ROUND_ROBIN,
+			prepare: func(b *upstreamBalancer) {
+				for i := 0; i < 2; i++ {
+					host, _ := b.pick()
+					b.done(host, false)
+					b.next = 0
+				}
+			},
+			expectedHosts: []string{"host2", "host3", "host2"},
+		},
+		"OkCaseSuccessResetsFails": {
+			balance: foulkon.BALANCE_ROUND_ROBIN,
+			prepare: func(b *upstreamBalancer) {
+				for _, ok := range []bool{false, true, false} {
+					host, _ := b.pick()
+					b.done(host, ok)
+					b.next = 0
+				}
+			},
+			expectedHosts: []string{"host1", "host2", "host3"},
+		},
+		"OkCaseEjectionExpired": {
+			balance: foulkon.BALANCE_ROUND_ROBIN,
+			prepare: func(b *upstreamBalancer) {
+				b.hosts[0].ejectedUntil = now.Add(-time.Second)
+			},
+			expectedHosts: []string{"host1", "host2"},
+		},
+		"ErrorCaseNoHealthyHosts": {
+			balance: foulkon.BALANCE_LEAST_CONNECTIONS,
+			prepare: func(b *upstreamBalancer) {
+				b.hosts[0].unhealthy = true
+				b.hosts[1].ejectedUntil = now.Add(time.Second)
+				b.hosts[2].unhealthy = true
+			},
+			expectedHosts: []string{"No healthy hosts in upstream items"},
+		},
+	}
+
+	for n, test := range testcases {
+		b := newBalancer(test.balance)
+		if test.prepare != nil {
+			test.prepare(b)
+		}
+		for i, expected := range test.expectedHosts {
+			if received := pick(b); received != expected {
+				t.Errorf("Test %v failed. Received host %v in pick %v, wanted %v", n, received, i, expected)
+			}
+		}
+	}
+}
+
+func TestUpstreamBalancer_checkHosts(t *testing.T) {
+	healthy := false
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" || !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer failing.Close()
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer working.Close()
+
+	b, err := newUpstreamBalancer(&foulkon.Upstream{
+		Name:                "items",
+		Hosts:               []string{failing.URL, working.URL},
+		Balance:             foulkon.BALANCE_ROUND_ROBIN,
+		HealthCheck:         "/health",
+		HealthCheckInterval: time.Second,
+	}, &foulkon.Proxy{
+		Logger: &log.Logger{
+			Out:       bytes.NewBuffer([]byte{}),
+			Formatter: &log.TextFormatter{},
+			Hooks:     make(log.LevelHooks),
+			Level:     log.DebugLevel,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Test failed. Unexpected error creating balancer: %v", err)
+	}
+	defer b.close()
+
+	b.checkHosts()
+	if !b.hosts[0].unhealthy || b.hosts[1].unhealthy {
+		t.Errorf("Test failed. Received unhealthy %v and %v, wanted true and false", b.hosts[0].unhealthy, b.hosts[1].unhealthy)
+	}
+	for i := 0; i < 2; i++ {
+		if host, err := b.pick(); err != nil || host != b.hosts[1] {
+			t.Errorf("Test failed. Unhealthy host was selected, error %v", err)
+		}
+	}
+
+	// Host recovers when health check succeeds again
+	healthy = true
+	b.checkHosts()
+	if b.hosts[0].unhealthy {
+		t.Errorf("Test failed. Host wasn't healthy after a successful health check")
+	}
+}
+
+func TestProxyHandler_HandleRequestUpstream(t *testing.T) {
+	worker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(AuthorizeResourcesResponse{
+			ResourcesAllowed: []string{"urn:ews:example:instance1:resource/items"},
+		})
+	}))
+	defer worker.Close()
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("working"))
+	}))
+	defer working.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("failing"))
+	}))
+	defer failing.Close()
+
+	proxyCore := &foulkon.Proxy{
+		Logger: &log.Logger{
+			Out:       bytes.NewBuffer([]byte{}),
+			Formatter: &log.TextFormatter{},
+			Hooks:     make(log.LevelHooks),
+			Level:     log.DebugLevel,
+		},
+		WorkerHost:      worker.URL,
+		WorkerTimeout:   time.Second,
+		ResponseTimeout: time.Second,
+		APIResources: []foulkon.APIResource{
+			{
+				Id:     "items",
+				Url:    "/items",
+				Method: "GET",
+				Urn:    "urn:ews:example:instance1:resource/items",
+				Action: "example:get",
+				Upstream: &foulkon.Upstream{
+					Name:        "items",
+					Hosts:       []string{failing.URL, working.URL},
+					Balance:     foulkon.BALANCE_ROUND_ROBIN,
+					MaxFails:    1,
+					FailTimeout: time.Minute,
+				},
+			},
+		},
+	}
+	proxyRouter, err := ProxyHandlerRouter(proxyCore)
+	if err != nil {
+		t.Fatalf("Test failed. Unexpected error creating proxy router: %v", err)
+	}
+	proxyServer := httptest.NewServer(proxyRouter)
+	defer proxyServer.Close()
+
+	// Failing host is ejected after its first failure
+	testcases := []struct {
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{http.StatusServiceUnavailable, "failing"},
+		{http.StatusOK, "working"},
+		{http.StatusOK, "working"},
+		{http.StatusOK, "working"},
+	}
+	for i, test := range testcases {
+		res, err := http.Get(proxyServer.URL + "/items")
+		if err != nil {
+			t.Fatalf("Test %v failed. Unexpected error: %v", i, err)
+		}
+		buffer := new(bytes.Buffer)
+		buffer.ReadFrom(res.Body)
+		res.Body.Close()
+		if res.StatusCode != test.expectedStatusCode || buffer.String() != test.expectedBody {
+			t.Errorf("Test %v failed. Received status code %v and body %v, wanted %v and %v",
+				i, res.StatusCode, buffer.String(), test.expectedStatusCode, test.expectedBody)
+		}
+	}
+}
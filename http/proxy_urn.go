@@ -0,0 +1,169 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Tecsisa/foulkon/api"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// Sources of URN parameters
+	URN_PARAM_PATH   = ""
+	URN_PARAM_QUERY  = "query"
+	URN_PARAM_HEADER = "header"
+	URN_PARAM_BODY   = "body"
+
+	// Maximum size of the request body read to retrieve URN parameters
+	MAX_URN_BODY_SIZE = 1 << 20
+)
+
+var (
+	// URN parameters like {name}, {query.name}, {header.name} or {body.$.field}
+	rUrnParam, _    = regexp.Compile(`\{(?:(query|header|body)\.)?([^{}]+)\}`)
+	rPathParam, _   = regexp.Compile(`^\w+$`)
+	rHeaderParam, _ = regexp.Compile(`^[\w\-]+$`)
+	// JSON paths like $.field.subfield or $.items[0].id
+	rBodyPath, _        = regexp.Compile(`^\$(\.[\w\-]+|\[\d+\])*$`)
+	rBodyPathSegment, _ = regexp.Compile(`\.([\w\-]+)|\[(\d+)\]`)
+)
+
+// TYPE DEFINITIONS
+
+// Parameter of an URN template, replaced with a value of the request
+type urnParameter struct {
+	// Text replaced in URN template
+	placeholder string
+	source      string
+	name        string
+}
+
+// Returns the parameters of an URN template, or an error if any of them is invalid
+func getUrnParameters(urn string) ([]urnParameter, error) {
+	parameters := []urnParameter{}
+	for _, match := range rUrnParam.FindAllStringSubmatch(urn, -1) {
+		p := urnParameter{
+			placeholder: match[0],
+			source:      match[1],
+			name:        match[2],
+		}
+		valid := false
+		switch p.source {
+		case URN_PARAM_PATH:
+			valid = rPathParam.MatchString(p.name)
+		case URN_PARAM_QUERY:
+			valid = true
+		case URN_PARAM_HEADER:
+			valid = rHeaderParam.MatchString(p.name)
+		case URN_PARAM_BODY:
+			valid = rBodyPath.MatchString(p.name)
+		}
+		if !valid {
+			return nil, fmt.Errorf("Invalid parameter %v in urn %v", p.placeholder, urn)
+		}
+		parameters = append(parameters, p)
+	}
+	return parameters, nil
+}
+
+// Returns the URN of a request, replacing the parameters of the URN template with the request
+// values. Values must be valid URN values, so they can't change other parts of the URN.
+func getUrn(r *http.Request, ps httprouter.Params, template string) (string, error) {
+	parameters, err := getUrnParameters(template)
+	if err != nil {
+		return "", getErrorMessage(INTERNAL_SERVER_ERROR, err.Error())
+	}
+
+	urn := template
+	var body interface{}
+	bodyRead := false
+	for _, p := range parameters {
+		var value string
+		switch p.source {
+		case URN_PARAM_PATH:
+			value = ps.ByName(p.name)
+		case URN_PARAM_QUERY:
+			value = r.URL.Query().Get(p.name)
+		case URN_PARAM_HEADER:
+			value = r.Header.Get(p.name)
+		case URN_PARAM_BODY:
+			if !bodyRead {
+				if body, err = readRequestBody(r); err != nil {
+					return "", getErrorMessage(api.INVALID_PARAMETER_ERROR, fmt.Sprintf("Invalid body to retrieve urn parameters: %v", err.Error()))
+				}
+				bodyRead = true
+			}
+			value = getBodyValue(body, p.name)
+		}
+		if !api.IsValidUrnValue(value) {
+			return "", getErrorMessage(api.INVALID_PARAMETER_ERROR, fmt.Sprintf("Invalid urn parameter %v: %v", p.placeholder, value))
+		}
+		urn = strings.Replace(urn, p.placeholder, value, -1)
+	}
+	return urn, nil
+}
+
+// PRIVATE HELPER METHODS
+
+// Decode the JSON body of a request, restoring it to be sent to destination host
+func readRequestBody(r *http.Request) (interface{}, error) {
+	if r.Body == nil {
+		return nil, fmt.Errorf("Empty body")
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(r.Body, MAX_URN_BODY_SIZE+1))
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > MAX_URN_BODY_SIZE {
+		return nil, fmt.Errorf("Body larger than %v bytes", MAX_URN_BODY_SIZE)
+	}
+
+	var body interface{}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	if err := decoder.Decode(&body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// Returns the string or number in a JSON path of body, or an empty string if there isn't one
+func getBodyValue(body interface{}, path string) string {
+	value := body
+	for _, segment := range rBodyPathSegment.FindAllStringSubmatch(path, -1) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if segment[1] == "" {
+				return ""
+			}
+			value = v[segment[1]]
+		case []interface{}:
+			index, err := strconv.Atoi(segment[2])
+			if segment[2] == "" || err != nil || index >= len(v) {
+				return ""
+			}
+			value = v[index]
+		default:
+			return ""
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		return ""
+	}
+}
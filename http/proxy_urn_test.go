@@ -0,0 +1,118 @@
+package http
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/Tecsisa/foulkon/api"
+	"github.com/julienschmidt/httprouter"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestGetUrn(t *testing.T) {
+	testcases := map[string]struct {
+		template      string
+		url           string
+		header        map[string]string
+		body          string
+		params        httprouter.Params
+		expectedUrn   string
+		expectedError error
+	}{
+		"OkCaseWithoutParameters": {
+			template:    "urn:ews:example:instance1:resource/get",
+			url:         "/get",
+			expectedUrn: "urn:ews:example:instance1:resource/get",
+		},
+		"OkCasePathParameter": {
+			template:    "urn:ews:example:instance1:resource/{code}",
+			url:         "/status/200",
+			params:      httprouter.Params{{Key: "code", Value: "200"}},
+			expectedUrn: "urn:ews:example:instance1:resource/200",
+		},
+		"OkCaseAllSources": {
+			template: "urn:ews:example:{header.X-Tenant}:project/{query.project}/{body.$.items[1].id}/{body.$.version}",
+			url:      "/projects?project=project1",
+			header: map[string]string{
+				"X-Tenant": "tenant1",
+			},
+			body:        `{"items":[{"id":"item0"},{"id":"item1"}],"version":2}`,
+			expectedUrn: "urn:ews:example:tenant1:project/project1/item1/2",
+		},
+		"ErrorCaseInvalidTemplate": {
+			template: "urn:ews:example:instance1:resource/{body.id}",
+			url:      "/resource",
+			expectedError: &api.Error{
+				Code:    INTERNAL_SERVER_ERROR,
+				Message: "Invalid parameter {body.id} in urn urn:ews:example:instance1:resource/{body.id}",
+			},
+		},
+		"ErrorCaseMissingQueryParameter": {
+			template: "urn:ews:example:instance1:project/{query.project}",
+			url:      "/projects",
+			expectedError: &api.Error{
+				Code:    api.INVALID_PARAMETER_ERROR,
+				Message: "Invalid urn parameter {query.project}: ",
+			},
+		},
+		"ErrorCaseInvalidHeaderValue": {
+			template: "urn:ews:example:{header.X-Tenant}:project/project1",
+			url:      "/projects",
+			header: map[string]string{
+				"X-Tenant": "tenant1:other",
+			},
+			expectedError: &api.Error{
+				Code:    api.INVALID_PARAMETER_ERROR,
+				Message: "Invalid urn parameter {header.X-Tenant}: tenant1:other",
+			},
+		},
+		"ErrorCaseInvalidPathValue": {
+			template: "urn:ews:example:instance1:resource/{code}",
+			url:      "/status/*",
+			params:   httprouter.Params{{Key: "code", Value: "*"}},
+			expectedError: &api.Error{
+				Code:    api.INVALID_PARAMETER_ERROR,
+				Message: "Invalid urn parameter {code}: *",
+			},
+		},
+		"ErrorCaseBodyFieldNotString": {
+			template: "urn:ews:example:instance1:resource/{body.$.id}",
+			url:      "/resource",
+			body:     `{"id":{"value":"id1"}}`,
+			expectedError: &api.Error{
+				Code:    api.INVALID_PARAMETER_ERROR,
+				Message: "Invalid urn parameter {body.$.id}: ",
+			},
+		},
+		"ErrorCaseInvalidBody": {
+			template: "urn:ews:example:instance1:resource/{body.$.id}",
+			url:      "/resource",
+			body:     `{"id":`,
+			expectedError: &api.Error{
+				Code:    api.INVALID_PARAMETER_ERROR,
+				Message: "Invalid body to retrieve urn parameters: unexpected EOF",
+			},
+		},
+	}
+
+	for n, test := range testcases {
+		r, _ := http.NewRequest(http.MethodPost, test.url, bytes.NewBufferString(test.body))
+		for key, value := range test.header {
+			r.Header.Set(key, value)
+		}
+		urn, err := getUrn(r, test.params, test.template)
+		if diff := pretty.Compare(err, test.expectedError); diff != "" {
+			t.Errorf("Test %v failed. Received different error (received/wanted) %v", n, diff)
+			continue
+		}
+		if urn != test.expectedUrn {
+			t.Errorf("Test %v failed. Received urn %v, wanted %v", n, urn, test.expectedUrn)
+		}
+		// Body is restored to be sent to destination host
+		if body, _ := ioutil.ReadAll(r.Body); string(body) != test.body {
+			t.Errorf("Test %v failed. Received body %v, wanted %v", n, string(body), test.body)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/Tecsisa/foulkon/api"
+	"github.com/julienschmidt/httprouter"
+)
+
+// REQUESTS
+
+type CreateServiceAccountRequest struct {
+	Name       string `json:"name, omitempty"`
+	ExternalID string `json:"externalId, omitempty"`
+}
+
+// RESPONSES
+
+// Response of service account creation, the only one with the API key
+type CreateServiceAccountResponse struct {
+	*api.ServiceAccount
+	Key string `json:"key"`
+}
+
+type GetServiceAccountNamesResponse struct {
+	ServiceAccounts []string `json:"serviceAccounts, omitempty"`
+	Limit           int      `json:"limit, omitempty"`
+	Offset          int      `json:"offset, omitempty"`
+	Total           int      `json:"total, omitempty"`
+}
+
+// HANDLERS
+
+func (h *WorkerHandler) HandleAddServiceAccount(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	// Process request
+	request := &CreateServiceAccountRequest{}
+	requestInfo, _, apiErr := h.processHttpRequest(r, w, nil, request)
+	if apiErr != nil {
+		h.RespondBadRequest(r, requestInfo, w, apiErr)
+		return
+	}
+
+	// Call service account API to create service account
+	serviceAccount, key, err := h.worker.ServiceAccountApi.AddServiceAccount(requestInfo, request.Name, request.ExternalID)
+	response := &CreateServiceAccountResponse{
+		ServiceAccount: serviceAccount,
+		Key:            key,
+	}
+	h.processHttpResponse(r, w, requestInfo, response, err, http.StatusCreated)
+}
+
+func (h *WorkerHandler) HandleGetServiceAccountByName(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Process request
+	requestInfo, _, apiErr := h.processHttpRequest(r, w, ps, nil)
+	if apiErr != nil {
+		h.RespondBadRequest(r, requestInfo, w, apiErr)
+		return
+	}
+
+	// Call service account API to get service account
+	response, err := h.worker.ServiceAccountApi.GetServiceAccountByName(requestInfo, ps.ByName(SERVICE_ACCOUNT_NAME))
+	h.processHttpResponse(r, w, requestInfo, response, err, http.StatusOK)
+}
+
+func (h *WorkerHandler) HandleListServiceAccounts(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Process request
+	requestInfo, filterData, apiErr := h.processHttpRequest(r, w, ps, nil)
+	if apiErr != nil {
+		h.RespondBadRequest(r, requestInfo, w, apiErr)
+		return
+	}
+	filterData.ExternalID = r.URL.Query().Get("ExternalID")
+
+	// Call service account API to list service accounts
+	result, total, err := h.worker.ServiceAccountApi.ListServiceAccounts(requestInfo, filterData)
+	// Create response
+	response := &GetServiceAccountNamesResponse{
+		ServiceAccounts: result,
+		Offset:          filterData.Offset,
+		Limit:           filterData.Limit,
+		Total:           total,
+	}
+	h.processHttpResponse(r, w, requestInfo, response, err, http.StatusOK)
+}
+
+func (h *WorkerHandler) HandleRemoveServiceAccount(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	// Process request
+	requestInfo, _, apiErr := h.processHttpRequest(r, w, ps, nil)
+	if apiErr != nil {
+		h.RespondBadRequest(r, requestInfo, w, apiErr)
+		return
+	}
+
+	// Call service account API to delete service account
+	err := h.worker.ServiceAccountApi.RemoveServiceAccount(requestInfo, ps.ByName(SERVICE_ACCOUNT_NAME))
+	h.processHttpResponse(r, w, requestInfo, nil, err, http.StatusNoContent)
+}
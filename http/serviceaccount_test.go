@@ -0,0 +1,504 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Tecsisa/foulkon/api"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestWorkerHandler_HandleAddServiceAccount(t *testing.T) {
+	now := time.Date(2016, time.October, 1, 10, 0, 0, 0, time.UTC)
+	serviceAccount := &api.ServiceAccount{
+		ID:         "ServiceAccountID",
+		Name:       "serviceaccount1",
+		ExternalID: "user1",
+		KeyPrefix:  "fk_01234567",
+		Urn:        api.CreateUrn("", api.RESOURCE_SERVICE_ACCOUNT, "/", "serviceaccount1"),
+		CreateAt:   now,
+	}
+	testcases := map[string]struct {
+		// API method args
+		request *CreateServiceAccountRequest
+		// Expected result
+		expectedStatusCode int
+		expectedResponse   CreateServiceAccountResponse
+		expectedError      api.Error
+		// Manager Results
+		addServiceAccountResult *api.ServiceAccount
+		addServiceAccountKey    string
+		// Manager Errors
+		addServiceAccountErr error
+	}{
+		"OkCase": {
+			request: &CreateServiceAccountRequest{
+				Name:       "serviceaccount1",
+				ExternalID: "user1",
+			},
+			expectedStatusCode: http.StatusCreated,
+			expectedResponse: CreateServiceAccountResponse{
+				ServiceAccount: serviceAccount,
+				Key:            "fk_0123456789",
+			},
+			addServiceAccountResult: serviceAccount,
+			addServiceAccountKey:    "fk_0123456789",
+		},
+		"ErrorCaseServiceAccountAlreadyExist": {
+			request: &CreateServiceAccountRequest{
+				Name:       "serviceaccount1",
+				ExternalID: "user1",
+			},
+			expectedStatusCode: http.StatusConflict,
+			expectedError: api.Error{
+				Code:    api.SERVICE_ACCOUNT_ALREADY_EXIST,
+				Message: "Service account already exist",
+			},
+			addServiceAccountErr: &api.Error{
+				Code:    api.SERVICE_ACCOUNT_ALREADY_EXIST,
+				Message: "Service account already exist",
+			},
+		},
+		"ErrorCaseUserNotFound": {
+			request: &CreateServiceAccountRequest{
+				Name:       "serviceaccount1",
+				ExternalID: "user1",
+			},
+			expectedStatusCode: http.StatusNotFound,
+			expectedError: api.Error{
+				Code:    api.USER_BY_EXTERNAL_ID_NOT_FOUND,
+				Message: "User not found",
+			},
+			addServiceAccountErr: &api.Error{
+				Code:    api.USER_BY_EXTERNAL_ID_NOT_FOUND,
+				Message: "User not found",
+			},
+		},
+		"ErrorCaseUnauthorizedResourcesError": {
+			request: &CreateServiceAccountRequest{
+				Name:       "serviceaccount1",
+				ExternalID: "user1",
+			},
+			expectedStatusCode: http.StatusForbidden,
+			expectedError: api.Error{
+				Code:    api.UNAUTHORIZED_RESOURCES_ERROR,
+				Message: "Unauthorized",
+			},
+			addServiceAccountErr: &api.Error{
+				Code:    api.UNAUTHORIZED_RESOURCES_ERROR,
+				Message: "Unauthorized",
+			},
+		},
+		"ErrorCaseUnknownApiError": {
+			request: &CreateServiceAccountRequest{
+				Name:       "serviceaccount1",
+				ExternalID: "user1",
+			},
+			expectedStatusCode: http.StatusInternalServerError,
+			addServiceAccountErr: &api.Error{
+				Code:    api.UNKNOWN_API_ERROR,
+				Message: "Error",
+			},
+		},
+	}
+
+	client := http.DefaultClient
+
+	for n, test := range testcases {
+
+		testApi.ArgsOut[AddServiceAccountMethod][0] = test.addServiceAccountResult
+		testApi.ArgsOut[AddServiceAccountMethod][1] = test.addServiceAccountKey
+		testApi.ArgsOut[AddServiceAccountMethod][2] = test.addServiceAccountErr
+
+		jsonObject, err := json.Marshal(test.request)
+		if err != nil {
+			t.Errorf("Test case %v. Unexpected marshalling api request %v", n, err)
+			continue
+		}
+		req, err := http.NewRequest(http.MethodPost, server.URL+SERVICE_ACCOUNT_ROOT_URL, bytes.NewBuffer(jsonObject))
+		if err != nil {
+			t.Errorf("Test case %v. Unexpected error creating http request %v", n, err)
+			continue
+		}
+
+		res, err := client.Do(req)
+		if err != nil {
+			t.Errorf("Test case %v. Unexpected error calling server %v", n, err)
+			continue
+		}
+
+		// Check received parameters
+		if testApi.ArgsIn[AddServiceAccountMethod][1] != test.request.Name || testApi.ArgsIn[AddServiceAccountMethod][2] != test.request.ExternalID {
+			t.Errorf("Test case %v. Received different parameters %v", n, testApi.ArgsIn[AddServiceAccountMethod])
+			continue
+		}
+
+		// check status code
+		if test.expectedStatusCode != res.StatusCode {
+			t.Errorf("Test case %v. Received different http status code (wanted:%v / received:%v)", n, test.expectedStatusCode, res.StatusCode)
+			continue
+		}
+
+		switch res.StatusCode {
+		case http.StatusCreated:
+			response := CreateServiceAccountResponse{}
+			err = json.NewDecoder(res.Body).Decode(&response)
+			if err != nil {
+				t.Errorf("Test case %v. Unexpected error parsing response %v", n, err)
+				continue
+			}
+			// Check result
+			if diff := pretty.Compare(response, test.expectedResponse); diff != "" {
+				t.Errorf("Test %v failed. Received different responses (received/wanted) %v", n, diff)
+				continue
+			}
+		case http.StatusInternalServerError: // Empty message so continue
+			continue
+		default:
+			apiError := api.Error{}
+			err = json.NewDecoder(res.Body).Decode(&apiError)
+			if err != nil {
+				t.Errorf("Test case %v. Unexpected error parsing error response %v", n, err)
+				continue
+			}
+			// Check result
+			if diff := pretty.Compare(apiError, test.expectedError); diff != "" {
+				t.Errorf("Test %v failed. Received different error response (received/wanted) %v", n, diff)
+				continue
+			}
+		}
+	}
+}
+
+func TestWorkerHandler_HandleGetServiceAccountByName(t *testing.T) {
+	now := time.Date(2016, time.October, 1, 10, 0, 0, 0, time.UTC)
+	testcases := map[string]struct {
+		// API method args
+		name string
+		// Expected result
+		expectedStatusCode int
+		expectedResponse   *api.ServiceAccount
+		expectedError      api.Error
+		// Manager Results
+		getServiceAccountByNameResult *api.ServiceAccount
+		// Manager Errors
+		getServiceAccountByNameErr error
+	}{
+		"OkCase": {
+			name:               "serviceaccount1",
+			expectedStatusCode: http.StatusOK,
+			expectedResponse: &api.ServiceAccount{
+				ID:         "ServiceAccountID",
+				Name:       "serviceaccount1",
+				ExternalID: "user1",
+				KeyPrefix:  "fk_01234567",
+				Urn:        api.CreateUrn("", api.RESOURCE_SERVICE_ACCOUNT, "/", "serviceaccount1"),
+				CreateAt:   now,
+			},
+			getServiceAccountByNameResult: &api.ServiceAccount{
+				ID:         "ServiceAccountID",
+				Name:       "serviceaccount1",
+				ExternalID: "user1",
+				KeyPrefix:  "fk_01234567",
+				KeyHash:    "hash",
+				Urn:        api.CreateUrn("", api.RESOURCE_SERVICE_ACCOUNT, "/", "serviceaccount1"),
+				CreateAt:   now,
+			},
+		},
+		"ErrorCaseServiceAccountNotFound": {
+			name:               "serviceaccount1",
+			expectedStatusCode: http.StatusNotFound,
+			expectedError: api.Error{
+				Code:    api.SERVICE_ACCOUNT_BY_NAME_NOT_FOUND,
+				Message: "Service account not found",
+			},
+			getServiceAccountByNameErr: &api.Error{
+				Code:    api.SERVICE_ACCOUNT_BY_NAME_NOT_FOUND,
+				Message: "Service account not found",
+			},
+		},
+		"ErrorCaseInvalidParameterError": {
+			name:               "serviceaccount1",
+			expectedStatusCode: http.StatusBadRequest,
+			expectedError: api.Error{
+				Code:    api.INVALID_PARAMETER_ERROR,
+				Message: "Invalid parameter",
+			},
+			getServiceAccountByNameErr: &api.Error{
+				Code:    api.INVALID_PARAMETER_ERROR,
+				Message: "Invalid parameter",
+			},
+		},
+	}
+
+	client := http.DefaultClient
+
+	for n, test := range testcases {
+
+		testApi.ArgsOut[GetServiceAccountByNameMethod][0] = test.getServiceAccountByNameResult
+		testApi.ArgsOut[GetServiceAccountByNameMethod][1] = test.getServiceAccountByNameErr
+
+		req, err := http.NewRequest(http.MethodGet, server.URL+SERVICE_ACCOUNT_ROOT_URL+"/"+test.name, nil)
+		if err != nil {
+			t.Errorf("Test case %v. Unexpected error creating http request %v", n, err)
+			continue
+		}
+
+		res, err := client.Do(req)
+		if err != nil {
+			t.Errorf("Test case %v. Unexpected error calling server %v", n, err)
+			continue
+		}
+
+		// Check received parameter
+		if testApi.ArgsIn[GetServiceAccountByNameMethod][1] != test.name {
+			t.Errorf("Test case %v. Received different name (wanted:%v / received:%v)", n, test.name, testApi.ArgsIn[GetServiceAccountByNameMethod][1])
+			continue
+		}
+
+		// check status code
+		if test.expectedStatusCode != res.StatusCode {
+			t.Errorf("Test case %v. Received different http status code (wanted:%v / received:%v)", n, test.expectedStatusCode, res.StatusCode)
+			continue
+		}
+
+		switch res.StatusCode {
+		case http.StatusOK:
+			response := &api.ServiceAccount{}
+			err = json.NewDecoder(res.Body).Decode(response)
+			if err != nil {
+				t.Errorf("Test case %v. Unexpected error parsing response %v", n, err)
+				continue
+			}
+			// Check result, key hash must not be returned
+			if diff := pretty.Compare(response, test.expectedResponse); diff != "" {
+				t.Errorf("Test %v failed. Received different responses (received/wanted) %v", n, diff)
+				continue
+			}
+		default:
+			apiError := api.Error{}
+			err = json.NewDecoder(res.Body).Decode(&apiError)
+			if err != nil {
+				t.Errorf("Test case %v. Unexpected error parsing error response %v", n, err)
+				continue
+			}
+			// Check result
+			if diff := pretty.Compare(apiError, test.expectedError); diff != "" {
+				t.Errorf("Test %v failed. Received different error response (received/wanted) %v", n, diff)
+				continue
+			}
+		}
+	}
+}
+
+func TestWorkerHandler_HandleListServiceAccounts(t *testing.T) {
+	testcases := map[string]struct {
+		// API method args
+		queryParams map[string]string
+		// Expected result
+		expectedStatusCode int
+		expectedResponse   GetServiceAccountNamesResponse
+		expectedFilter     *api.Filter
+		expectedError      api.Error
+		// Manager Results
+		listServiceAccountsResult []string
+		totalResult               int
+		// Manager Errors
+		listServiceAccountsErr error
+	}{
+		"OkCase": {
+			queryParams: map[string]string{
+				"ExternalID": "user1",
+				"OrderBy":    "name",
+				"Limit":      "20",
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedResponse: GetServiceAccountNamesResponse{
+				ServiceAccounts: []string{"serviceaccount1", "serviceaccount2"},
+				Limit:           20,
+				Total:           2,
+			},
+			expectedFilter: &api.Filter{
+				ExternalID: "user1",
+				OrderBy:    "name",
+				Limit:      20,
+			},
+			listServiceAccountsResult: []string{"serviceaccount1", "serviceaccount2"},
+			totalResult:               2,
+		},
+		"ErrorCaseInvalidOffset": {
+			queryParams: map[string]string{
+				"Offset": "-1",
+			},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedError: api.Error{
+				Code:    api.INVALID_PARAMETER_ERROR,
+				Message: "Invalid parameter: Offset -1",
+			},
+		},
+		"ErrorCaseUnauthorizedError": {
+			expectedStatusCode: http.StatusForbidden,
+			expectedError: api.Error{
+				Code:    api.UNAUTHORIZED_RESOURCES_ERROR,
+				Message: "Error",
+			},
+			listServiceAccountsErr: &api.Error{
+				Code:    api.UNAUTHORIZED_RESOURCES_ERROR,
+				Message: "Error",
+			},
+		},
+	}
+
+	client := http.DefaultClient
+
+	for n, test := range testcases {
+
+		testApi.ArgsOut[ListServiceAccountsMethod][0] = test.listServiceAccountsResult
+		testApi.ArgsOut[ListServiceAccountsMethod][1] = test.totalResult
+		testApi.ArgsOut[ListServiceAccountsMethod][2] = test.listServiceAccountsErr
+
+		req, err := http.NewRequest(http.MethodGet, server.URL+SERVICE_ACCOUNT_ROOT_URL, nil)
+		if err != nil {
+			t.Errorf("Test case %v. Unexpected error creating http request %v", n, err)
+			continue
+		}
+		q := req.URL.Query()
+		for param, value := range test.queryParams {
+			q.Add(param, value)
+		}
+		req.URL.RawQuery = q.Encode()
+
+		res, err := client.Do(req)
+		if err != nil {
+			t.Errorf("Test case %v. Unexpected error calling server %v", n, err)
+			continue
+		}
+
+		// check status code
+		if test.expectedStatusCode != res.StatusCode {
+			t.Errorf("Test case %v. Received different http status code (wanted:%v / received:%v)", n, test.expectedStatusCode, res.StatusCode)
+			continue
+		}
+
+		switch res.StatusCode {
+		case http.StatusOK:
+			// Check received filter
+			if diff := pretty.Compare(testApi.ArgsIn[ListServiceAccountsMethod][1], test.expectedFilter); diff != "" {
+				t.Errorf("Test %v failed. Received different filter (received/wanted) %v", n, diff)
+				continue
+			}
+			response := GetServiceAccountNamesResponse{}
+			err = json.NewDecoder(res.Body).Decode(&response)
+			if err != nil {
+				t.Errorf("Test case %v. Unexpected error parsing response %v", n, err)
+				continue
+			}
+			// Check result
+			if diff := pretty.Compare(response, test.expectedResponse); diff != "" {
+				t.Errorf("Test %v failed. Received different responses (received/wanted) %v", n, diff)
+				continue
+			}
+		default:
+			apiError := api.Error{}
+			err = json.NewDecoder(res.Body).Decode(&apiError)
+			if err != nil {
+				t.Errorf("Test case %v. Unexpected error parsing error response %v", n, err)
+				continue
+			}
+			// Check result
+			if diff := pretty.Compare(apiError, test.expectedError); diff != "" {
+				t.Errorf("Test %v failed. Received different error response (received/wanted) %v", n, diff)
+				continue
+			}
+		}
+	}
+}
+
+func TestWorkerHandler_HandleRemoveServiceAccount(t *testing.T) {
+	testcases := map[string]struct {
+		// API method args
+		name string
+		// Expected result
+		expectedStatusCode int
+		expectedError      api.Error
+		// Manager Errors
+		removeServiceAccountErr error
+	}{
+		"OkCase": {
+			name:               "serviceaccount1",
+			expectedStatusCode: http.StatusNoContent,
+		},
+		"ErrorCaseServiceAccountNotFound": {
+			name:               "serviceaccount1",
+			expectedStatusCode: http.StatusNotFound,
+			expectedError: api.Error{
+				Code:    api.SERVICE_ACCOUNT_BY_NAME_NOT_FOUND,
+				Message: "Service account not found",
+			},
+			removeServiceAccountErr: &api.Error{
+				Code:    api.SERVICE_ACCOUNT_BY_NAME_NOT_FOUND,
+				Message: "Service account not found",
+			},
+		},
+		"ErrorCaseUnauthorizedResourcesError": {
+			name:               "serviceaccount1",
+			expectedStatusCode: http.StatusForbidden,
+			expectedError: api.Error{
+				Code:    api.UNAUTHORIZED_RESOURCES_ERROR,
+				Message: "Unauthorized",
+			},
+			removeServiceAccountErr: &api.Error{
+				Code:    api.UNAUTHORIZED_RESOURCES_ERROR,
+				Message: "Unauthorized",
+			},
+		},
+	}
+
+	client := http.DefaultClient
+
+	for n, test := range testcases {
+
+		testApi.ArgsOut[RemoveServiceAccountMethod][0] = test.removeServiceAccountErr
+
+		req, err := http.NewRequest(http.MethodDelete, server.URL+SERVICE_ACCOUNT_ROOT_URL+"/"+test.name, nil)
+		if err != nil {
+			t.Errorf("Test case %v. Unexpected error creating http request %v", n, err)
+			continue
+		}
+
+		res, err := client.Do(req)
+		if err != nil {
+			t.Errorf("Test case %v. Unexpected error calling server %v", n, err)
+			continue
+		}
+
+		// Check received parameter
+		if testApi.ArgsIn[RemoveServiceAccountMethod][1] != test.name {
+			t.Errorf("Test case %v. Received different name (wanted:%v / received:%v)", n, test.name, testApi.ArgsIn[RemoveServiceAccountMethod][1])
+			continue
+		}
+
+		// check status code
+		if test.expectedStatusCode != res.StatusCode {
+			t.Errorf("Test case %v. Received different http status code (wanted:%v / received:%v)", n, test.expectedStatusCode, res.StatusCode)
+			continue
+		}
+
+		if res.StatusCode != http.StatusNoContent {
+			apiError := api.Error{}
+			err = json.NewDecoder(res.Body).Decode(&apiError)
+			if err != nil {
+				t.Errorf("Test case %v. Unexpected error parsing error response %v", n, err)
+				continue
+			}
+			// Check result
+			if diff := pretty.Compare(apiError, test.expectedError); diff != "" {
+				t.Errorf("Test %v failed. Received different error response (received/wanted) %v", n, diff)
+				continue
+			}
+		}
+	}
+}
@@ -0,0 +1,20 @@
+DO $$
+    DECLARE COL_EXIST NUMERIC(10);
+    BEGIN
+        ----------------------------
+        -- ALTER TABLE statements --
+        ----------------------------
+        -- Delete the conditions column
+        SELECT COUNT(column_name) INTO COL_EXIST
+            FROM information_schema.columns
+            WHERE table_name LIKE 'statements' AND column_name LIKE 'conditions';
+
+        IF COL_EXIST = 1 THEN
+            EXECUTE 'ALTER TABLE statements DROP COLUMN conditions';
+            RAISE NOTICE '[INFO] Alter table statements to remove next column: conditions';
+        ELSE
+            RAISE NOTICE '[WARN] The statements column could not be removed. Check if this column exists';
+        END IF;
+
+    END $$
+;
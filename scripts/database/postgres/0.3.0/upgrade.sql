@@ -0,0 +1,20 @@
+DO $$
+    DECLARE COL_EXIST NUMERIC(10);
+    BEGIN
+        ----------------------------
+        -- ALTER TABLE statements --
+        ----------------------------
+        -- Add the conditions column
+        SELECT COUNT(column_name) INTO COL_EXIST
+            FROM information_schema.columns
+            WHERE table_name LIKE 'statements' AND column_name LIKE 'conditions';
+
+        IF COL_EXIST = 0 THEN
+            EXECUTE 'ALTER TABLE statements ADD conditions TEXT NOT NULL DEFAULT ''''';
+            RAISE NOTICE '[INFO] Alter table statements to add next column: conditions';
+        ELSE
+            RAISE NOTICE '[WARN] The statements column could not be created. Check if this column already exists';
+        END IF;
+
+    END $$
+;
@@ -1,8 +1,10 @@
 #!/bin/sh
 
-usage() { echo "Usage: worker|proxy" 1>&2; exit 1; }
+usage() { echo "Usage: worker|proxy|migrate up|down|status" 1>&2; exit 1; }
 if [ "$1" = 'worker' ]; then
     worker -config-file=/worker.toml
+elif [ "$1" = 'migrate' ]; then
+    worker migrate "$2" -config-file=/worker.toml
 elif [ "$1" = 'proxy' ]; then
     proxy -proxy-file=/proxy.toml
 else
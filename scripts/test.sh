@@ -7,7 +7,7 @@ echo "" > coverage.txt
 
 echo "--> Running tests"
 echo -e '----> Running unit tests'
-for d in $(go list ./... | grep -v '/vendor/' | egrep -v '/database/|auth|cmd/|foulkon/foulkon'); do
+for d in $(go list ./... | grep -v '/vendor/' | egrep -v '/database/|cmd/|foulkon/foulkon'); do
     go test -race -coverprofile=profile.out -covermode=atomic $d || exit 1
     if [ -f profile.out ]; then
         cat profile.out >> coverage.txt
@@ -15,6 +15,15 @@ for d in $(go list ./... | grep -v '/vendor/' | egrep -v '/database/|auth|cmd/|f
     fi
 done
 echo -e '\n----> Running connector tests'
+# In-memory and file
+echo -e '--------> Running in-memory and file connectors'
+for d in ./database/memory ./database/filedb; do
+    go test -race -coverprofile=profile.out -covermode=atomic $d || exit 1
+    if [ -f profile.out ]; then
+        cat profile.out >> coverage.txt
+        rm profile.out
+    fi
+done
 # Postgres
 echo -e '--------> Running PostgreSQL connector'
 echo $(echo -e 'Starting PostgreSQL (Docker container) postgrestest with id ') \
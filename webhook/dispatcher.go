@@ -0,0 +1,257 @@
+// Package webhook delivers the events stored in the outbox to HTTP endpoints.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/Tecsisa/foulkon/api"
+)
+
+// Headers sent with every event
+const (
+	EVENT_HEADER     = "X-Foulkon-Event"
+	DELIVERY_HEADER  = "X-Foulkon-Delivery"
+	SIGNATURE_HEADER = "X-Foulkon-Signature"
+)
+
+// Default dispatcher values
+const (
+	DEFAULT_POLL_INTERVAL = 5 * time.Second
+	DEFAULT_BATCH_SIZE    = 100
+	DEFAULT_MAX_ATTEMPTS  = 10
+	DEFAULT_BACKOFF       = 10 * time.Second
+	DEFAULT_MAX_BACKOFF   = time.Hour
+	DEFAULT_TIMEOUT       = 10 * time.Second
+)
+
+// Webhook is an HTTP endpoint that receives the event types specified, or all of them if there
+// aren't types. Events are signed with the secret if it isn't empty.
+type Webhook struct {
+	Name   string
+	URL    string
+	Secret string
+	Events []string
+}
+
+// Dispatcher reads the outbox periodically and sends every entry to its webhook with a POST request.
+// Delivered entries are removed from outbox, and failed ones are retried with exponential backoff
+// until MaxAttempts. Entries can be delivered more than once, so webhooks should discard events
+// already received using the delivery header.
+type Dispatcher struct {
+	Repo     api.EventRepo
+	Webhooks map[string]Webhook
+	Client   *http.Client
+	Logger   *log.Logger
+
+	// Time between outbox reads
+	PollInterval time.Duration
+	// Maximum number of entries sent in each read
+	BatchSize int
+	// Failed entries are discarded after this number of attempts
+	MaxAttempts int
+	// Delay after the first failed attempt, doubled after every attempt up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Current time, replaced in tests
+	now func() time.Time
+
+	mutex sync.Mutex
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// NewDispatcher returns a dispatcher with default values for the webhooks specified. It returns an
+// error if webhooks aren't valid.
+func NewDispatcher(repo api.EventRepo, webhooks []Webhook, logger *log.Logger) (*Dispatcher, error) {
+	hooks := map[string]Webhook{}
+	for _, webhook := range webhooks {
+		if webhook.Name == "" || webhook.URL == "" {
+			return nil, errors.New("Webhooks must have name and url")
+		}
+		if _, ok := hooks[webhook.Name]; ok {
+			return nil, fmt.Errorf("Duplicated webhook %v", webhook.Name)
+		}
+		for _, eventType := range webhook.Events {
+			if !api.IsValidEventType(eventType) {
+				return nil, fmt.Errorf("Invalid event type %v for webhook %v", eventType, webhook.Name)
+			}
+		}
+		hooks[webhook.Name] = webhook
+	}
+
+	return &Dispatcher{
+		Repo:         repo,
+		Webhooks:     hooks,
+		Client:       &http.Client{Timeout: DEFAULT_TIMEOUT},
+		Logger:       logger,
+		PollInterval: DEFAULT_POLL_INTERVAL,
+		BatchSize:    DEFAULT_BATCH_SIZE,
+		MaxAttempts:  DEFAULT_MAX_ATTEMPTS,
+		Backoff:      DEFAULT_BACKOFF,
+		MaxBackoff:   DEFAULT_MAX_BACKOFF,
+		now:          time.Now,
+	}, nil
+}
+
+// Sinks returns the webhooks as sinks, to publish events for them
+func (d *Dispatcher) Sinks() []api.EventSink {
+	sinks := []api.EventSink{}
+	for _, webhook := range d.Webhooks {
+		sinks = append(sinks, api.EventSink{
+			Name:   webhook.Name,
+			Events: webhook.Events,
+		})
+	}
+	return sinks
+}
+
+// Start reads the outbox in background until Stop is called
+func (d *Dispatcher) Start() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.stop != nil {
+		return
+	}
+	d.stop = make(chan struct{})
+	d.done = make(chan struct{})
+
+	go func(stop chan struct{}, done chan struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(d.PollInterval)
+		defer ticker.Stop()
+		for {
+			// Send all pending entries before waiting
+			for d.Dispatch() == d.BatchSize {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+			}
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}(d.stop, d.done)
+}
+
+// Stop finishes the background reads, waiting for the current one
+func (d *Dispatcher) Stop() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.stop == nil {
+		return
+	}
+	close(d.stop)
+	<-d.done
+	d.stop = nil
+}
+
+// Dispatch sends the pending entries of outbox once, and returns the number of entries read
+func (d *Dispatcher) Dispatch() int {
+	entries, err := d.Repo.GetPendingOutboxEntries(d.now(), d.BatchSize)
+	if err != nil {
+		d.Logger.Errorf("Error retrieving pending events: %v", err)
+		return 0
+	}
+
+	for _, entry := range entries {
+		webhook, ok := d.Webhooks[entry.Sink]
+		if !ok {
+			d.Logger.Warnf("Discarding event %v for unknown webhook %v", entry.Event.ID, entry.Sink)
+			d.remove(entry)
+			continue
+		}
+
+		err := d.send(webhook, entry.Event)
+		if err == nil {
+			d.Logger.Debugf("Event %v delivered to webhook %v", entry.Event.ID, entry.Sink)
+			d.remove(entry)
+			continue
+		}
+
+		entry.Attempts++
+		if entry.Attempts >= d.MaxAttempts {
+			d.Logger.Errorf("Discarding event %v for webhook %v after %v attempts: %v", entry.Event.ID, entry.Sink, entry.Attempts, err)
+			d.remove(entry)
+			continue
+		}
+		entry.LastError = err.Error()
+		entry.NextAttemptAt = d.now().Add(d.backoff(entry.Attempts))
+		d.Logger.Warnf("Error delivering event %v to webhook %v, attempt %v: %v", entry.Event.ID, entry.Sink, entry.Attempts, err)
+		if err := d.Repo.UpdateOutboxEntry(entry); err != nil {
+			d.Logger.Errorf("Error updating event %v for webhook %v: %v", entry.Event.ID, entry.Sink, err)
+		}
+	}
+
+	return len(entries)
+}
+
+// Sign returns the signature of a body, the hex encoded HMAC-SHA256 with the secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// PRIVATE HELPER METHODS
+
+// Send an event to a webhook, any status code different from 2xx is an error
+func (d *Dispatcher) send(webhook Webhook, event api.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EVENT_HEADER, event.Type)
+	req.Header.Set(DELIVERY_HEADER, event.ID)
+	if webhook.Secret != "" {
+		req.Header.Set(SIGNATURE_HEADER, Sign(webhook.Secret, body))
+	}
+
+	res, err := d.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("Unexpected status code %v", res.StatusCode)
+	}
+	return nil
+}
+
+// Remove an entry from outbox
+func (d *Dispatcher) remove(entry api.OutboxEntry) {
+	if err := d.Repo.RemoveOutboxEntry(entry.Event.ID, entry.Sink); err != nil {
+		d.Logger.Errorf("Error removing event %v for webhook %v: %v", entry.Event.ID, entry.Sink, err)
+	}
+}
+
+// Delay before next attempt, doubled after every failed attempt
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.Backoff
+	for i := 1; i < attempts && delay < d.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxBackoff {
+		delay = d.MaxBackoff
+	}
+	return delay
+}
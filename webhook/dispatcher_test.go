@@ -0,0 +1,273 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/Tecsisa/foulkon/api"
+	"github.com/Tecsisa/foulkon/database/memory"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+var now = time.Date(2016, time.October, 1, 10, 0, 0, 0, time.UTC)
+
+// Webhook that stores the requests received and responds with the status code configured
+type testWebhook struct {
+	mutex      sync.Mutex
+	statusCode int
+	requests   []*http.Request
+	bodies     [][]byte
+}
+
+func (tw *testWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+	body, _ := ioutil.ReadAll(r.Body)
+	tw.requests = append(tw.requests, r)
+	tw.bodies = append(tw.bodies, body)
+	w.WriteHeader(tw.statusCode)
+}
+
+func TestNewDispatcher(t *testing.T) {
+	testcases := map[string]struct {
+		webhooks      []Webhook
+		expectedSinks []api.EventSink
+		expectedError error
+	}{
+		"OkCase": {
+			webhooks: []Webhook{
+				{Name: "webhook1", URL: "http://localhost/events", Events: []string{api.MEMBER_ADDED_EVENT}},
+			},
+			expectedSinks: []api.EventSink{
+				{Name: "webhook1", Events: []string{api.MEMBER_ADDED_EVENT}},
+			},
+		},
+		"ErrorCaseWithoutURL": {
+			webhooks: []Webhook{
+				{Name: "webhook1"},
+			},
+			expectedError: errors.New("Webhooks must have name and url"),
+		},
+		"ErrorCaseDuplicatedWebhook": {
+			webhooks: []Webhook{
+				{Name: "webhook1", URL: "http://localhost/events"},
+				{Name: "webhook1", URL: "http://localhost/other"},
+			},
+			expectedError: errors.New("Duplicated webhook webhook1"),
+		},
+		"ErrorCaseInvalidEventType": {
+			webhooks: []Webhook{
+				{Name: "webhook1", URL: "http://localhost/events", Events: []string{"Unknown"}},
+			},
+			expectedError: errors.New("Invalid event type Unknown for webhook webhook1"),
+		},
+	}
+
+	for n, test := range testcases {
+		dispatcher, err := NewDispatcher(memory.NewMemoryRepo(), test.webhooks, makeLogger())
+		if diff := pretty.Compare(err, test.expectedError); diff != "" {
+			t.Errorf("Test %v failed. Received different error (received/wanted) %v", n, diff)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if diff := pretty.Compare(dispatcher.Sinks(), test.expectedSinks); diff != "" {
+			t.Errorf("Test %v failed. Received different sinks (received/wanted) %v", n, diff)
+		}
+	}
+}
+
+func TestDispatcher_Dispatch(t *testing.T) {
+	hook := &testWebhook{statusCode: http.StatusOK}
+	server := httptest.NewServer(hook)
+	defer server.Close()
+
+	repo := memory.NewMemoryRepo()
+	dispatcher, err := NewDispatcher(repo, []Webhook{
+		{Name: "webhook1", URL: server.URL, Secret: "secret"},
+	}, makeLogger())
+	if err != nil {
+		t.Fatalf("Test failed. Unexpected error creating dispatcher: %v", err)
+	}
+	current := now
+	dispatcher.now = func() time.Time { return current }
+	dispatcher.MaxAttempts = 3
+
+	data := json.RawMessage(`{"externalId":"user1"}`)
+	event := api.Event{
+		ID:        "EventID",
+		Type:      api.USER_CREATED_EVENT,
+		Urn:       "urn:iws:iam::user/user1",
+		Actor:     "admin",
+		RequestID: "RequestID",
+		CreateAt:  now,
+		Data:      &data,
+	}
+	err = repo.AddOutboxEntries([]api.OutboxEntry{
+		{Event: event, Sink: "webhook1", NextAttemptAt: now},
+		{Event: event, Sink: "removedWebhook", NextAttemptAt: now},
+	})
+	if err != nil {
+		t.Fatalf("Test failed. Unexpected error adding entries: %v", err)
+	}
+
+	// Failed delivery is retried with backoff
+	hook.statusCode = http.StatusInternalServerError
+	if read := dispatcher.Dispatch(); read != 2 {
+		t.Errorf("Test failed. Received %v entries read, wanted 2", read)
+	}
+	pending, _ := repo.GetPendingOutboxEntries(now.Add(time.Hour), 0)
+	expectedPending := []api.OutboxEntry{
+		{
+			Event:         event,
+			Sink:          "webhook1",
+			Attempts:      1,
+			NextAttemptAt: now.Add(DEFAULT_BACKOFF),
+			LastError:     "Unexpected status code 500",
+		},
+	}
+	if diff := pretty.Compare(pending, expectedPending); diff != "" {
+		t.Errorf("Test failed. Received different pending entries (received/wanted) %v", diff)
+	}
+
+	// Entry isn't sent before next attempt
+	if read := dispatcher.Dispatch(); read != 0 {
+		t.Errorf("Test failed. Received %v entries read before next attempt", read)
+	}
+
+	// Delivered entry is removed
+	current = now.Add(DEFAULT_BACKOFF)
+	hook.statusCode = http.StatusNoContent
+	dispatcher.Dispatch()
+	pending, _ = repo.GetPendingOutboxEntries(now.Add(time.Hour), 0)
+	if len(pending) != 0 {
+		t.Errorf("Test failed. Delivered entry wasn't removed: %v", pending)
+	}
+
+	if len(hook.requests) != 2 {
+		t.Fatalf("Test failed. Received %v requests, wanted 2", len(hook.requests))
+	}
+	req, body := hook.requests[1], hook.bodies[1]
+	expectedBody, _ := json.Marshal(event)
+	if !bytes.Equal(body, expectedBody) {
+		t.Errorf("Test failed. Received body %v, wanted %v", string(body), string(expectedBody))
+	}
+	expectedHeaders := map[string]string{
+		"Content-Type":   "application/json",
+		EVENT_HEADER:     api.USER_CREATED_EVENT,
+		DELIVERY_HEADER:  "EventID",
+		SIGNATURE_HEADER: Sign("secret", expectedBody),
+	}
+	for header, value := range expectedHeaders {
+		if received := req.Header.Get(header); received != value {
+			t.Errorf("Test failed. Received header %v with value %v, wanted %v", header, received, value)
+		}
+	}
+}
+
+func TestDispatcher_DispatchMaxAttempts(t *testing.T) {
+	hook := &testWebhook{statusCode: http.StatusBadGateway}
+	server := httptest.NewServer(hook)
+	defer server.Close()
+
+	repo := memory.NewMemoryRepo()
+	dispatcher, err := NewDispatcher(repo, []Webhook{
+		{Name: "webhook1", URL: server.URL},
+	}, makeLogger())
+	if err != nil {
+		t.Fatalf("Test failed. Unexpected error creating dispatcher: %v", err)
+	}
+	current := now
+	dispatcher.now = func() time.Time { return current }
+	dispatcher.MaxAttempts = 2
+
+	repo.AddOutboxEntries([]api.OutboxEntry{
+		{Event: api.Event{ID: "EventID", Type: api.USER_DELETED_EVENT}, Sink: "webhook1", NextAttemptAt: now},
+	})
+	dispatcher.Dispatch()
+	current = current.Add(time.Hour)
+	dispatcher.Dispatch()
+
+	pending, _ := repo.GetPendingOutboxEntries(current.Add(time.Hour), 0)
+	if len(pending) != 0 {
+		t.Errorf("Test failed. Entry wasn't discarded after max attempts: %v", pending)
+	}
+	if len(hook.requests) != 2 {
+		t.Errorf("Test failed. Received %v requests, wanted 2", len(hook.requests))
+	}
+	if signature := hook.requests[0].Header.Get(SIGNATURE_HEADER); signature != "" {
+		t.Errorf("Test failed. Unexpected signature without secret: %v", signature)
+	}
+}
+
+func TestDispatcher_backoff(t *testing.T) {
+	dispatcher := &Dispatcher{
+		Backoff:    time.Second,
+		MaxBackoff: 10 * time.Second,
+	}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, delay := range expected {
+		if received := dispatcher.backoff(i + 1); received != delay {
+			t.Errorf("Test failed. Received backoff %v for attempt %v, wanted %v", received, i+1, delay)
+		}
+	}
+}
+
+func TestDispatcher_StartStop(t *testing.T) {
+	hook := &testWebhook{statusCode: http.StatusOK}
+	server := httptest.NewServer(hook)
+	defer server.Close()
+
+	repo := memory.NewMemoryRepo()
+	dispatcher, err := NewDispatcher(repo, []Webhook{
+		{Name: "webhook1", URL: server.URL},
+	}, makeLogger())
+	if err != nil {
+		t.Fatalf("Test failed. Unexpected error creating dispatcher: %v", err)
+	}
+	dispatcher.PollInterval = 10 * time.Millisecond
+
+	dispatcher.Start()
+	repo.AddOutboxEntries([]api.OutboxEntry{
+		{Event: api.Event{ID: "EventID", Type: api.USER_CREATED_EVENT}, Sink: "webhook1", NextAttemptAt: now},
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		pending, _ := repo.GetPendingOutboxEntries(time.Now(), 0)
+		if len(pending) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Test failed. Entry wasn't delivered in background")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	dispatcher.Stop()
+	dispatcher.Stop()
+}
+
+func TestSign(t *testing.T) {
+	// Value generated with: echo -n '{"id":"EventID"}' | openssl dgst -sha256 -hmac secret
+	expected := "sha256=314d53a71deab3f2ee4a0a3684ddfc9530e9817e4c3027ca3cd6beb29a0841e0"
+	if signature := Sign("secret", []byte(`{"id":"EventID"}`)); signature != expected {
+		t.Errorf("Test failed. Received signature %v, wanted %v", signature, expected)
+	}
+}
+
+func makeLogger() *log.Logger {
+	return &log.Logger{
+		Out:       bytes.NewBuffer([]byte{}),
+		Formatter: &log.TextFormatter{},
+		Hooks:     make(log.LevelHooks),
+		Level:     log.DebugLevel,
+	}
+}